@@ -1,6 +1,7 @@
 package common
 
 import (
+	"crypto/rand"
 	"fmt"
 	"github.com/pkg/errors"
 	"os"
@@ -14,8 +15,16 @@ const (
 	repoTypeKey       string = "PRODUCT_SERVICE_REPO_TYPE"
 	timeoutSecondsKey string = "PRODUCT_SERVICE_TIMEOUT"
 	portKey           string = "PRODUCT_SERVICE_PORT"
+	grpcPortKey       string = "PRODUCT_SERVICE_GRPC_PORT"
 	pgUrlKey          string = "PRODUCT_SERVICE_PG_URL"
+	dataDirKey        string = "PRODUCT_SERVICE_DATA_DIR"
 	initDatasetKey    string = "PRODUCT_SERVICE_INIT_DATASET"
+	cursorSecretKey   string = "PRODUCT_SERVICE_CURSOR_SECRET"
+	sweepIntervalKey  string = "PRODUCT_SERVICE_RESERVATION_SWEEP_INTERVAL"
+	suggestTimeoutKey string = "PRODUCT_SERVICE_SUGGEST_TIMEOUT"
+	cacheSizeKey      string = "PRODUCT_SERVICE_CACHE_SIZE"
+	cacheTtlKey       string = "PRODUCT_SERVICE_CACHE_TTL"
+	autoMigrateKey    string = "PRODUCT_SERVICE_AUTO_MIGRATE"
 )
 
 // LifeCycle represents a particular application life cycle.
@@ -51,6 +60,8 @@ const (
 	InMemoryRepo ProductRepositoryType = 0
 	// PostgreSqlRepo represents a ProductRepository that utilizes a PostgreSQL database.
 	PostgreSqlRepo ProductRepositoryType = iota
+	// EmbeddedRepo represents a ProductRepository that is stored in local files.
+	EmbeddedRepo ProductRepositoryType = iota
 )
 
 func (prt ProductRepositoryType) String() string {
@@ -59,6 +70,8 @@ func (prt ProductRepositoryType) String() string {
 		return "POSTGRESQL"
 	case InMemoryRepo:
 		return "IN_MEMORY"
+	case EmbeddedRepo:
+		return "EMBEDDED"
 	default:
 		return ""
 	}
@@ -74,21 +87,53 @@ type Configuration interface {
 	GetTimeout() time.Duration
 	// GetPort retrieves the configured port.
 	GetPort() int
+	// GetGrpcPort retrieves the configured port of the gRPC API, 0 when it is disabled.
+	GetGrpcPort() int
 
 	// GetInitDataSet retrieves the path to an initial dataset to load on app launch, mostly for testing and dev use.
 	GetInitDataSet() string
 
 	// GetPgUrl retrieves the configured url string for connecting to PostgreSQL.
 	GetPgUrl() string
+
+	// GetAutoMigrate retrieves whether pending migrations of the PostgreSQL schema are applied on app launch, only
+	// allowed in development.
+	GetAutoMigrate() bool
+
+	// GetDataDir retrieves the directory holding the files of an embedded repository.
+	GetDataDir() string
+
+	// GetCursorSecret retrieves the key used to sign pagination cursors.
+	GetCursorSecret() []byte
+
+	// GetReservationSweepInterval retrieves how often expired inventory reservations are released.
+	GetReservationSweepInterval() time.Duration
+
+	// GetSuggestTimeout retrieves the request timeout of suggestions, which are requested as users type.
+	GetSuggestTimeout() time.Duration
+
+	// GetCacheSize retrieves how many products and how many pages of products are cached, 0 when caching is disabled.
+	GetCacheSize() int
+
+	// GetCacheTtl retrieves how long cached products and pages of products are served for.
+	GetCacheTtl() time.Duration
 }
 
 type configuration struct {
-	lifeCycle   LifeCycle
-	repoType    ProductRepositoryType
-	timeout     time.Duration
-	port        int
-	pgUrl       string
-	initDataset string
+	lifeCycle      LifeCycle
+	repoType       ProductRepositoryType
+	timeout        time.Duration
+	port           int
+	grpcPort       int
+	pgUrl          string
+	autoMigrate    bool
+	dataDir        string
+	initDataset    string
+	cursorSecret   []byte
+	sweepInterval  time.Duration
+	suggestTimeout time.Duration
+	cacheSize      int
+	cacheTtl       time.Duration
 }
 
 func (conf *configuration) GetLifeCycle() LifeCycle {
@@ -107,14 +152,46 @@ func (conf *configuration) GetPort() int {
 	return conf.port
 }
 
+func (conf *configuration) GetGrpcPort() int {
+	return conf.grpcPort
+}
+
 func (conf *configuration) GetPgUrl() string {
 	return conf.pgUrl
 }
 
+func (conf *configuration) GetAutoMigrate() bool {
+	return conf.autoMigrate
+}
+
+func (conf *configuration) GetDataDir() string {
+	return conf.dataDir
+}
+
 func (conf *configuration) GetInitDataSet() string {
 	return conf.initDataset
 }
 
+func (conf *configuration) GetCursorSecret() []byte {
+	return conf.cursorSecret
+}
+
+func (conf *configuration) GetReservationSweepInterval() time.Duration {
+	return conf.sweepInterval
+}
+
+func (conf *configuration) GetSuggestTimeout() time.Duration {
+	return conf.suggestTimeout
+}
+
+func (conf *configuration) GetCacheSize() int {
+	return conf.cacheSize
+}
+
+func (conf *configuration) GetCacheTtl() time.Duration {
+	return conf.cacheTtl
+}
+
 // GetConfiguration constucts a Configuration based on environment variables.
 func GetConfiguration() (Configuration, error) {
 	var err error
@@ -144,6 +221,8 @@ func GetConfiguration() (Configuration, error) {
 		config.repoType = InMemoryRepo
 	case PostgreSqlRepo.String():
 		config.repoType = PostgreSqlRepo
+	case EmbeddedRepo.String():
+		config.repoType = EmbeddedRepo
 	default:
 		if config.lifeCycle == DevLifeCycle {
 			config.repoType = InMemoryRepo
@@ -185,8 +264,30 @@ func GetConfiguration() (Configuration, error) {
 
 	config.port = port
 
+	grpcPortStr := os.Getenv(grpcPortKey)
+
+	if grpcPortStr == "" {
+		if config.lifeCycle == DevLifeCycle {
+			grpcPortStr = "3334"
+		} else {
+			grpcPortStr = "0"
+		}
+	}
+
+	grpcPort, err := strconv.Atoi(grpcPortStr)
+
+	if err != nil || grpcPort < 0 {
+		err = errors.New(fmt.Sprintf("Invalid gRPC port, set %s environment variable to a port number or leave it "+
+			"unset to disable the gRPC API", grpcPortKey))
+		return nil, err
+	}
+
+	config.grpcPort = grpcPort
+
 	if config.repoType == PostgreSqlRepo {
 		err = setPostgresqlConfig(&config)
+	} else if config.repoType == EmbeddedRepo {
+		err = setEmbeddedConfig(&config)
 	}
 
 	if err != nil {
@@ -199,9 +300,69 @@ func GetConfiguration() (Configuration, error) {
 		return nil, err
 	}
 
+	err = setCursorSecret(&config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sweepIntervalStr := os.Getenv(sweepIntervalKey)
+
+	if sweepIntervalStr == "" {
+		sweepIntervalStr = "30"
+	}
+
+	sweepIntervalInt, err := strconv.Atoi(sweepIntervalStr)
+
+	if err != nil || sweepIntervalInt <= 0 {
+		err = errors.New(fmt.Sprintf("Invalid reservation sweep interval, set %s environment variable to a "+
+			"positive number of seconds", sweepIntervalKey))
+		return nil, err
+	}
+
+	config.sweepInterval = time.Duration(sweepIntervalInt) * time.Second
+
+	suggestTimeoutStr := os.Getenv(suggestTimeoutKey)
+
+	if suggestTimeoutStr == "" {
+		suggestTimeoutStr = "250"
+	}
+
+	suggestTimeoutInt, err := strconv.Atoi(suggestTimeoutStr)
+
+	if err != nil || suggestTimeoutInt <= 0 {
+		err = errors.New(fmt.Sprintf("Invalid suggest timeout, set %s environment variable to a positive number of "+
+			"milliseconds", suggestTimeoutKey))
+		return nil, err
+	}
+
+	config.suggestTimeout = time.Duration(suggestTimeoutInt) * time.Millisecond
+
+	err = setCacheConfig(&config)
+
+	if err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
 
+// setCursorSecret reads the cursor signing key, generating a random one if none is configured. Cursors signed with a
+// generated key are only valid for the lifetime of the process, so deployments running several instances should set
+// the key explicitly.
+func setCursorSecret(config *configuration) error {
+	secret := os.Getenv(cursorSecretKey)
+
+	if strings.TrimSpace(secret) != "" {
+		config.cursorSecret = []byte(secret)
+		return nil
+	}
+
+	config.cursorSecret = make([]byte, 32)
+	_, err := rand.Read(config.cursorSecret)
+	return err
+}
+
 func setPostgresqlConfig(config *configuration) error {
 	var err error
 
@@ -209,7 +370,72 @@ func setPostgresqlConfig(config *configuration) error {
 
 	if strings.TrimSpace(config.pgUrl) == "" {
 		err = errors.New(fmt.Sprintf("No PostgreSqlRepo url configured, set %s environment variable", pgUrlKey))
+		return err
+	}
+
+	autoMigrateStr := os.Getenv(autoMigrateKey)
+
+	if autoMigrateStr == "" {
+		return nil
+	}
+
+	config.autoMigrate, err = strconv.ParseBool(autoMigrateStr)
+
+	if err != nil {
+		err = errors.New(fmt.Sprintf("Invalid auto migrate flag, set %s environment variable to true or false",
+			autoMigrateKey))
+	} else if config.autoMigrate && config.lifeCycle != DevLifeCycle {
+		err = errors.New(fmt.Sprintf("Migrations are only applied on launch in development, unset %s environment "+
+			"variable and run the migrate up command", autoMigrateKey))
 	}
 
 	return err
 }
+
+func setEmbeddedConfig(config *configuration) error {
+	var err error
+
+	config.dataDir = os.Getenv(dataDirKey)
+
+	if strings.TrimSpace(config.dataDir) == "" {
+		err = errors.New(fmt.Sprintf("No EmbeddedRepo data directory configured, set %s environment variable",
+			dataDirKey))
+	}
+
+	return err
+}
+
+// setCacheConfig reads the size and ttl of the repository cache, which is disabled unless a size is configured.
+func setCacheConfig(config *configuration) error {
+	cacheSizeStr := os.Getenv(cacheSizeKey)
+
+	if cacheSizeStr == "" {
+		cacheSizeStr = "0"
+	}
+
+	cacheSize, err := strconv.Atoi(cacheSizeStr)
+
+	if err != nil || cacheSize < 0 {
+		return errors.New(fmt.Sprintf("Invalid cache size, set %s environment variable to a number of entries or "+
+			"leave it unset to disable caching", cacheSizeKey))
+	}
+
+	config.cacheSize = cacheSize
+
+	cacheTtlStr := os.Getenv(cacheTtlKey)
+
+	if cacheTtlStr == "" {
+		cacheTtlStr = "30"
+	}
+
+	cacheTtl, err := strconv.Atoi(cacheTtlStr)
+
+	if err != nil || cacheTtl <= 0 {
+		return errors.New(fmt.Sprintf("Invalid cache ttl, set %s environment variable to a positive number of "+
+			"seconds", cacheTtlKey))
+	}
+
+	config.cacheTtl = time.Duration(cacheTtl) * time.Second
+
+	return nil
+}
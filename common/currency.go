@@ -0,0 +1,67 @@
+package common
+
+import (
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"strings"
+)
+
+// Currency represents an ISO 4217 currency code.
+type Currency string
+
+const (
+	// CurrencyUSD United States dollar.
+	CurrencyUSD Currency = "USD"
+	// CurrencyEUR Euro.
+	CurrencyEUR Currency = "EUR"
+	// CurrencyJPY Japanese yen.
+	CurrencyJPY Currency = "JPY"
+)
+
+// DefaultCurrency is the currency of Product.Price, prices in other currencies are held in price lists.
+const DefaultCurrency = CurrencyUSD
+
+// ParseCurrency retrieves the supported currency matching the given code, ignoring case.
+func ParseCurrency(code string) (Currency, error) {
+	currency := Currency(strings.ToUpper(strings.TrimSpace(code)))
+
+	if !currency.Supported() {
+		return "", errors.Errorf("Unsupported currency %s", code)
+	}
+
+	return currency, nil
+}
+
+// SupportedCurrencies returns every currency prices can be held in.
+func SupportedCurrencies() []Currency {
+	return []Currency{CurrencyUSD, CurrencyEUR, CurrencyJPY}
+}
+
+// Supported returns true if prices can be held in the given currency.
+func (c Currency) Supported() bool {
+	switch c {
+	case CurrencyUSD:
+		fallthrough
+	case CurrencyEUR:
+		fallthrough
+	case CurrencyJPY:
+		return true
+	default:
+		return false
+	}
+}
+
+// MinorUnits returns the number of decimal places used by the currency, for instance 2 for cents.
+func (c Currency) MinorUnits() int32 {
+	switch c {
+	case CurrencyJPY:
+		return 0
+	default:
+		return 2
+	}
+}
+
+// Format renders the given amount rounded to the minor units of the currency.
+func (c Currency) Format(amount decimal.Decimal) string {
+	return amount.StringFixed(c.MinorUnits())
+}
@@ -0,0 +1,54 @@
+package common_test
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/stone1549/product-service/common"
+	"testing"
+)
+
+// TestParseCurrency_Success ensures that supported currencies are parsed regardless of case.
+func TestParseCurrency_Success(t *testing.T) {
+	currency, err := common.ParseCurrency("jpy")
+	ok(t, err)
+	equals(t, common.CurrencyJPY, currency)
+}
+
+// TestParseCurrency_FailUnsupported ensures that unsupported currencies are rejected.
+func TestParseCurrency_FailUnsupported(t *testing.T) {
+	_, err := common.ParseCurrency("XYZ")
+	notOk(t, err)
+}
+
+// TestCurrency_Format ensures that amounts are rendered with the minor units of their currency.
+func TestCurrency_Format(t *testing.T) {
+	amount := decimal.New(2499989, -3)
+	equals(t, "2499.99", common.CurrencyUSD.Format(amount))
+	equals(t, "2499.99", common.CurrencyEUR.Format(amount))
+	equals(t, "2500", common.CurrencyJPY.Format(amount))
+}
+
+// TestProduct_PriceIn ensures that products are priced from their price list, falling back to their price in the
+// default currency.
+func TestProduct_PriceIn(t *testing.T) {
+	price := decimal.New(10, 0)
+	product := common.Product{Price: &price,
+		Prices: map[common.Currency]decimal.Decimal{common.CurrencyJPY: decimal.New(1500, 0)}}
+
+	equals(t, "10", product.PriceIn(common.CurrencyUSD).String())
+	equals(t, "1500", product.PriceIn(common.CurrencyJPY).String())
+	equals(t, (*decimal.Decimal)(nil), product.PriceIn(common.CurrencyEUR))
+}
+
+// TestVariant_EffectivePrice ensures that variant price overrides take precedence over the price of their product.
+func TestVariant_EffectivePrice(t *testing.T) {
+	price := decimal.New(10, 0)
+	override := decimal.New(12, 0)
+	product := common.Product{Price: &price,
+		Prices: map[common.Currency]decimal.Decimal{common.CurrencyJPY: decimal.New(1500, 0)}}
+	variant := common.Variant{Price: &override,
+		Prices: map[common.Currency]decimal.Decimal{common.CurrencyEUR: decimal.New(11, 0)}}
+
+	equals(t, "12", variant.EffectivePrice(product, common.CurrencyUSD).String())
+	equals(t, "11", variant.EffectivePrice(product, common.CurrencyEUR).String())
+	equals(t, "1500", variant.EffectivePrice(product, common.CurrencyJPY).String())
+}
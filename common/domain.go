@@ -18,6 +18,82 @@ type Product struct {
 	QtyInStock       int              `json:"qtyInStock"`
 	CreatedAt        *time.Time       `json:"createdAt"`
 	UpdatedAt        *time.Time       `json:"updatedAt"`
+	CategoryIds      []string         `json:"categories"`
+	Variants         []Variant        `json:"variants"`
+	// Prices holds the price of the product in currencies other than DefaultCurrency.
+	Prices map[Currency]decimal.Decimal `json:"prices"`
+}
+
+// PriceIn returns the price of the product in the given currency, or nil if it is not sold in that currency.
+func (p Product) PriceIn(currency Currency) *decimal.Decimal {
+	if price, ok := p.Prices[currency]; ok {
+		return &price
+	} else if currency == DefaultCurrency {
+		return p.Price
+	}
+
+	return nil
+}
+
+// Variant is a purchasable version of a product, such as a particular size or color, identified by its SKU.
+type Variant struct {
+	Sku        string            `json:"sku"`
+	ProductId  string            `json:"productId"`
+	Options    map[string]string `json:"options"`
+	Price      *decimal.Decimal  `json:"price"`
+	QtyInStock int               `json:"qtyInStock"`
+	Images     []string          `json:"images"`
+	// Prices holds the price overrides of the variant in currencies other than DefaultCurrency.
+	Prices map[Currency]decimal.Decimal `json:"prices"`
+}
+
+// EffectivePrice returns the price of the variant in the given currency, falling back to the price of the given
+// product when the variant does not override it.
+func (v Variant) EffectivePrice(product Product, currency Currency) *decimal.Decimal {
+	if price, ok := v.Prices[currency]; ok {
+		return &price
+	} else if currency == DefaultCurrency && v.Price != nil {
+		return v.Price
+	}
+
+	return product.PriceIn(currency)
+}
+
+// ReservationStatus represents the state of a Reservation.
+type ReservationStatus string
+
+const (
+	// ReservationPending units are held until the reservation is committed, released or expires.
+	ReservationPending ReservationStatus = "pending"
+	// ReservationCommitted units have been permanently removed from stock.
+	ReservationCommitted ReservationStatus = "committed"
+	// ReservationReleased units have been returned to stock on request.
+	ReservationReleased ReservationStatus = "released"
+	// ReservationExpired units have been returned to stock after the reservation was left pending past its expiry.
+	ReservationExpired ReservationStatus = "expired"
+)
+
+// Reservation holds a quantity of a product out of stock, for instance while an order is checked out.
+type Reservation struct {
+	Id        string            `json:"id"`
+	ProductId string            `json:"productId"`
+	Quantity  int               `json:"quantity"`
+	Status    ReservationStatus `json:"status"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+}
+
+// Active returns true if the reservation is pending and has not yet expired at the given time.
+func (r Reservation) Active(now time.Time) bool {
+	return r.Status == ReservationPending && now.Before(r.ExpiresAt)
+}
+
+// Category groups related products, categories form a hierarchy through their parent.
+type Category struct {
+	Id       string  `json:"id"`
+	Name     string  `json:"name"`
+	ParentId *string `json:"parentId"`
 }
 
 // OrderByKey represents a particular field that products can be sorted by.
@@ -40,6 +116,8 @@ const (
 	OrderByPrice OrderByKey = "price"
 	// OrderByPriceDesc order from most expensive to least expensive.
 	OrderByPriceDesc OrderByKey = "priceDesc"
+	// OrderByRelevance order search results from most to least relevant, it can not be used outside of searches.
+	OrderByRelevance OrderByKey = "relevance"
 )
 
 // Supported returns true if sorting by the given key is currently implemented.
@@ -60,6 +138,8 @@ func (obk OrderByKey) Supported() bool {
 	case OrderByPrice:
 		fallthrough
 	case OrderByPriceDesc:
+		fallthrough
+	case OrderByRelevance:
 		return true
 	default:
 		return false
@@ -91,6 +171,24 @@ func (obk OrderByKey) GetMirrorKey() OrderByKey {
 	}
 }
 
+// Descending returns true if the key sorts from greatest to least.
+func (obk OrderByKey) Descending() bool {
+	switch obk {
+	case OrderByCreatedDesc:
+		fallthrough
+	case OrderByUpdatedDesc:
+		fallthrough
+	case OrderByNameDesc:
+		fallthrough
+	case OrderByPriceDesc:
+		fallthrough
+	case OrderByRelevance:
+		return true
+	default:
+		return false
+	}
+}
+
 // OrderBy represents of and list of keys to sort by.
 type OrderBy struct {
 	keys []OrderByKey
@@ -134,3 +232,19 @@ func (ob *OrderBy) Order() []OrderByKey {
 	copy(result, ob.keys)
 	return result
 }
+
+// SearchOrder retrieves an ordered slice of keys to sort search results by, by relevance unless other keys were added.
+func (ob *OrderBy) SearchOrder() []OrderByKey {
+	if len(ob.keys) == 0 {
+		return []OrderByKey{OrderByRelevance}
+	}
+
+	result := make([]OrderByKey, len(ob.keys))
+	copy(result, ob.keys)
+	return result
+}
+
+// Contains returns true if the given key was added.
+func (ob *OrderBy) Contains(key OrderByKey) bool {
+	return orderByContains(ob.keys, key)
+}
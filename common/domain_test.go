@@ -63,3 +63,18 @@ func TestOrderBy_OrderEmpty(t *testing.T) {
 	equals(t, common.OrderByUpdatedDesc, orderBy.Order()[0])
 	equals(t, common.OrderByCreatedDesc, orderBy.Order()[1])
 }
+
+// TestOrderBy_SearchOrderEmpty ensures that search results are ordered by relevance when no keys are added.
+func TestOrderBy_SearchOrderEmpty(t *testing.T) {
+	orderBy := common.OrderBy{}
+	equals(t, []common.OrderByKey{common.OrderByRelevance}, orderBy.SearchOrder())
+}
+
+// TestOrderBy_SearchOrderMultiple ensures that relevance can be combined with other keys.
+func TestOrderBy_SearchOrderMultiple(t *testing.T) {
+	orderBy := common.OrderBy{}
+	ok(t, orderBy.Add(common.OrderByPrice))
+	ok(t, orderBy.Add(common.OrderByRelevance))
+	equals(t, []common.OrderByKey{common.OrderByPrice, common.OrderByRelevance}, orderBy.SearchOrder())
+	equals(t, true, orderBy.Contains(common.OrderByRelevance))
+}
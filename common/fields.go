@@ -0,0 +1,108 @@
+package common
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// productFieldsKey is the context key of the ProductFields requested by a client.
+const productFieldsKey = "productFields"
+
+// ProductField names a field of the products served to clients.
+type ProductField string
+
+// Fields of the products served to clients, named as in their JSON representation.
+const (
+	ProductFieldId               ProductField = "id"
+	ProductFieldName             ProductField = "name"
+	ProductFieldDisplayImage     ProductField = "displayImage"
+	ProductFieldThumbnail        ProductField = "thumbnail"
+	ProductFieldPrice            ProductField = "price"
+	ProductFieldDescription      ProductField = "description"
+	ProductFieldShortDescription ProductField = "shortDescription"
+	ProductFieldQuantity         ProductField = "quantity"
+	ProductFieldCreatedAt        ProductField = "createdAt"
+	ProductFieldUpdatedAt        ProductField = "updatedAt"
+	ProductFieldCategories       ProductField = "categories"
+	ProductFieldVariants         ProductField = "variants"
+	ProductFieldCurrency         ProductField = "currency"
+	ProductFieldPrices           ProductField = "prices"
+	// ProductFieldScore and ProductFieldHighlights are only served with search results.
+	ProductFieldScore      ProductField = "score"
+	ProductFieldHighlights ProductField = "highlights"
+)
+
+// Supported returns true if the given field is served to clients.
+func (pf ProductField) Supported() bool {
+	switch pf {
+	case ProductFieldId, ProductFieldName, ProductFieldDisplayImage, ProductFieldThumbnail, ProductFieldPrice,
+		ProductFieldDescription, ProductFieldShortDescription, ProductFieldQuantity, ProductFieldCreatedAt,
+		ProductFieldUpdatedAt, ProductFieldCategories, ProductFieldVariants, ProductFieldCurrency, ProductFieldPrices,
+		ProductFieldScore, ProductFieldHighlights:
+		return true
+	default:
+		return false
+	}
+}
+
+// ProductFields is a selection of the fields of products, the zero value selects every field.
+type ProductFields struct {
+	fields map[ProductField]bool
+}
+
+// ParseProductFields parses a comma separated list of fields, an empty list selects every field.
+func ParseProductFields(str string) (ProductFields, error) {
+	var result ProductFields
+
+	if strings.TrimSpace(str) == "" {
+		return result, nil
+	}
+
+	result.fields = make(map[ProductField]bool)
+	for _, name := range strings.Split(str, ",") {
+		field := ProductField(strings.TrimSpace(name))
+		if !field.Supported() {
+			return ProductFields{}, errors.Errorf("Unsupported field %s", field)
+		}
+
+		result.fields[field] = true
+	}
+
+	return result, nil
+}
+
+// All returns true if every field is selected.
+func (pf ProductFields) All() bool {
+	return pf.fields == nil
+}
+
+// Includes returns true if the given field is selected.
+func (pf ProductFields) Includes(field ProductField) bool {
+	return pf.fields == nil || pf.fields[field]
+}
+
+// String returns the selected fields sorted and comma separated, empty if every field is selected.
+func (pf ProductFields) String() string {
+	names := make([]string, 0, len(pf.fields))
+	for field := range pf.fields {
+		names = append(names, string(field))
+	}
+
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// WithProductFields returns a copy of the given context carrying the given selection of fields. Repositories may leave
+// the fields it does not include unset in the products they retrieve with the context.
+func WithProductFields(ctx context.Context, fields ProductFields) context.Context {
+	return context.WithValue(ctx, productFieldsKey, fields)
+}
+
+// ProductFieldsFrom retrieves the selection of fields carried by the given context, every field if it carries none.
+func ProductFieldsFrom(ctx context.Context) ProductFields {
+	fields, _ := ctx.Value(productFieldsKey).(ProductFields)
+	return fields
+}
@@ -0,0 +1,56 @@
+package common_test
+
+import (
+	"context"
+	"github.com/stone1549/product-service/common"
+	"testing"
+)
+
+// TestParseProductFields_Success ensures that only the listed fields are selected.
+func TestParseProductFields_Success(t *testing.T) {
+	fields, err := common.ParseProductFields("id, name,thumbnail")
+
+	ok(t, err)
+	equals(t, false, fields.All())
+	equals(t, true, fields.Includes(common.ProductFieldName))
+	equals(t, false, fields.Includes(common.ProductFieldDescription))
+}
+
+// TestParseProductFields_Empty ensures that every field is selected when none are listed.
+func TestParseProductFields_Empty(t *testing.T) {
+	fields, err := common.ParseProductFields("")
+
+	ok(t, err)
+	equals(t, true, fields.All())
+	equals(t, true, fields.Includes(common.ProductFieldDescription))
+}
+
+// TestParseProductFields_Fail ensures that unknown fields are rejected.
+func TestParseProductFields_Fail(t *testing.T) {
+	_, err := common.ParseProductFields("id,secret")
+	notOk(t, err)
+}
+
+// TestProductFieldsFrom ensures that the fields carried by a context are retrieved, or every field if it carries none.
+func TestProductFieldsFrom(t *testing.T) {
+	equals(t, true, common.ProductFieldsFrom(context.Background()).All())
+
+	fields, err := common.ParseProductFields("name")
+	ok(t, err)
+
+	ctx := common.WithProductFields(context.Background(), fields)
+	equals(t, fields, common.ProductFieldsFrom(ctx))
+}
+
+// TestProductFields_String ensures that selections of the same fields are named alike whatever the order they were
+// listed in.
+func TestProductFields_String(t *testing.T) {
+	fields, err := common.ParseProductFields("name,id")
+	ok(t, err)
+	other, err := common.ParseProductFields("id, name, id")
+	ok(t, err)
+
+	equals(t, "id,name", fields.String())
+	equals(t, fields.String(), other.String())
+	equals(t, "", common.ProductFields{}.String())
+}
@@ -0,0 +1,38 @@
+package common
+
+import (
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// ProductFilter holds criteria that products must satisfy to be included in a listing. Unset criteria are ignored.
+type ProductFilter struct {
+	// Currency is the currency products are priced in by MinPrice, MaxPrice and ordering by price. Products without a
+	// price in the currency are excluded. Defaults to DefaultCurrency.
+	Currency Currency
+	// MinPrice excludes products priced below the given value.
+	MinPrice *decimal.Decimal
+	// MaxPrice excludes products priced above the given value.
+	MaxPrice *decimal.Decimal
+	// InStock includes only products with stock on hand when true, or only those without when false.
+	InStock *bool
+	// CreatedAfter includes only products created after the given time.
+	CreatedAfter *time.Time
+	// UpdatedSince includes only products updated at or after the given time.
+	UpdatedSince *time.Time
+	// Ids includes only products with one of the given ids.
+	Ids []string
+	// CategoryIds includes only products belonging to one of the given categories.
+	CategoryIds []string
+	// IncludeSubcategories extends CategoryIds to every descendant of the given categories.
+	IncludeSubcategories bool
+}
+
+// PriceCurrency returns the currency products are priced in, DefaultCurrency unless another was set.
+func (pf ProductFilter) PriceCurrency() Currency {
+	if pf.Currency == "" {
+		return DefaultCurrency
+	}
+
+	return pf.Currency
+}
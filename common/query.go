@@ -0,0 +1,188 @@
+package common
+
+import (
+	"strings"
+	"unicode"
+)
+
+// searchOr joins two words or phrases of a search query so that either may match.
+const searchOr = "OR"
+
+// SearchTerm is a word, or a quoted phrase of words, of a search query.
+type SearchTerm struct {
+	// Words holds the lower cased words of the term, more than one for phrases.
+	Words []string
+	// Prefix is true if the last word should match any word it is a prefix of.
+	Prefix bool
+}
+
+// SearchQuery is the parsed form of the search text accepted by every ProductRepository.
+type SearchQuery struct {
+	// Required holds groups of alternative terms, a product matches when it matches a term of every group.
+	Required [][]SearchTerm
+	// Excluded holds the terms matching products must not match.
+	Excluded []SearchTerm
+}
+
+// Empty returns true if the query has no required terms, such a query cannot match anything.
+func (sq SearchQuery) Empty() bool {
+	return len(sq.Required) == 0
+}
+
+// ParseSearchQuery parses search text made up of words, "quoted phrases", -excluded words or phrases, words ending in *
+// to match any word they prefix and OR between two words or phrases to match either. Words are split on, and stripped
+// of, anything other than letters and digits so that the resulting terms can never be mistaken for query syntax.
+func ParseSearchQuery(text string) SearchQuery {
+	var result SearchQuery
+
+	runes := []rune(text)
+	or := false
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		excluded := runes[i] == '-'
+		if excluded {
+			i++
+		}
+
+		var raw string
+		quoted := i < len(runes) && runes[i] == '"'
+		if quoted {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+
+			// an unterminated phrase runs to the end of the text
+			raw = string(runes[i+1 : end])
+			i = end + 1
+		} else {
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '"' {
+				i++
+			}
+
+			raw = string(runes[start:i])
+		}
+
+		if !quoted && !excluded && raw == searchOr {
+			or = len(result.Required) > 0
+			continue
+		}
+
+		term := newSearchTerm(raw, !quoted)
+
+		if len(term.Words) == 0 {
+			continue
+		}
+
+		if excluded {
+			result.Excluded = append(result.Excluded, term)
+		} else if or {
+			last := len(result.Required) - 1
+			result.Required[last] = append(result.Required[last], term)
+		} else {
+			result.Required = append(result.Required, []SearchTerm{term})
+		}
+
+		or = false
+	}
+
+	return result
+}
+
+// SplitSearchWords splits the given text into lower cased words on anything other than letters and digits.
+func SplitSearchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// newSearchTerm splits the given raw word or phrase into words, a trailing * marks the term as a prefix when
+// allowPrefix is true.
+func newSearchTerm(raw string, allowPrefix bool) SearchTerm {
+	words := SplitSearchWords(raw)
+	return SearchTerm{Words: words, Prefix: allowPrefix && len(words) > 0 && strings.HasSuffix(raw, "*")}
+}
+
+// Fuzziness returns the number of edits a word may be off by and still match fuzzily, none for words of up to two
+// letters, one for words of up to five letters and two beyond.
+func Fuzziness(word string) int {
+	switch length := len([]rune(word)); {
+	case length <= 2:
+		return 0
+	case length <= 5:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// EditDistance returns the number of single letter insertions, deletions or substitutions needed to turn a into b.
+func EditDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	previous := make([]int, len(br)+1)
+	current := make([]int, len(br)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		current[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(br)]
+}
+
+func minInt(values ...int) int {
+	result := values[0]
+	for _, value := range values[1:] {
+		if value < result {
+			result = value
+		}
+	}
+
+	return result
+}
+
+// ReplaceSearchWords rewrites the given search text replacing every word found in replacements, compared lower cased,
+// while leaving the rest of the text, including its syntax, untouched.
+func ReplaceSearchWords(text string, replacements map[string]string) string {
+	var result strings.Builder
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			result.WriteRune(runes[i])
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+			i++
+		}
+
+		word := string(runes[start:i])
+		if replacement, ok := replacements[strings.ToLower(word)]; ok {
+			word = replacement
+		}
+
+		result.WriteString(word)
+	}
+
+	return result.String()
+}
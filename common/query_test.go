@@ -0,0 +1,71 @@
+package common_test
+
+import (
+	"github.com/stone1549/product-service/common"
+	"testing"
+)
+
+// TestParseSearchQuery_Words ensures that words are all required and stripped of anything but letters and digits.
+func TestParseSearchQuery_Words(t *testing.T) {
+	query := common.ParseSearchQuery("Portal  gun & (ray)")
+
+	equals(t, [][]common.SearchTerm{
+		{{Words: []string{"portal"}}},
+		{{Words: []string{"gun"}}},
+		{{Words: []string{"ray"}}},
+	}, query.Required)
+	equals(t, 0, len(query.Excluded))
+}
+
+// TestParseSearchQuery_Syntax ensures that phrases, exclusions, alternatives and prefixes are recognised.
+func TestParseSearchQuery_Syntax(t *testing.T) {
+	query := common.ParseSearchQuery(`"portal gun" OR ray* -"time crystal" -c-137 plumb*`)
+
+	equals(t, [][]common.SearchTerm{
+		{{Words: []string{"portal", "gun"}}, {Words: []string{"ray"}, Prefix: true}},
+		{{Words: []string{"plumb"}, Prefix: true}},
+	}, query.Required)
+	equals(t, []common.SearchTerm{
+		{Words: []string{"time", "crystal"}},
+		{Words: []string{"c", "137"}},
+	}, query.Excluded)
+}
+
+// TestParseSearchQuery_Lenient ensures that malformed text is parsed as well as possible rather than rejected.
+func TestParseSearchQuery_Lenient(t *testing.T) {
+	query := common.ParseSearchQuery(`OR portal OR "gun`)
+
+	equals(t, [][]common.SearchTerm{
+		{{Words: []string{"portal"}}, {Words: []string{"gun"}}},
+	}, query.Required)
+	equals(t, false, query.Empty())
+}
+
+// TestParseSearchQuery_Empty ensures that text without any required words results in an empty query.
+func TestParseSearchQuery_Empty(t *testing.T) {
+	equals(t, true, common.ParseSearchQuery("").Empty())
+	equals(t, true, common.ParseSearchQuery(`& | ! "" -portal`).Empty())
+}
+
+// TestEditDistance ensures that insertions, deletions and substitutions are each counted as one edit.
+func TestEditDistance(t *testing.T) {
+	equals(t, 0, common.EditDistance("plumbus", "plumbus"))
+	equals(t, 1, common.EditDistance("plumbis", "plumbus"))
+	equals(t, 2, common.EditDistance("plumbs", "plumbuss"))
+	equals(t, 3, common.EditDistance("", "gun"))
+}
+
+// TestFuzziness ensures that longer words may be off by more edits.
+func TestFuzziness(t *testing.T) {
+	equals(t, 0, common.Fuzziness("ok"))
+	equals(t, 1, common.Fuzziness("ray"))
+	equals(t, 2, common.Fuzziness("plumbus"))
+}
+
+// TestReplaceSearchWords ensures that only whole words are replaced, leaving search syntax untouched.
+func TestReplaceSearchWords(t *testing.T) {
+	replacements := map[string]string{"plumbis": "plumbus", "gn": "gun"}
+
+	equals(t, `"Portal gun" OR plumbus -plumbiss*`,
+		common.ReplaceSearchWords(`"Portal gn" OR Plumbis -plumbiss*`, replacements))
+}
@@ -0,0 +1,94 @@
+package common
+
+import (
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// FacetPrice is the name of the facet counting matches within price ranges.
+	FacetPrice = "price"
+	// FacetInStock is the name of the facet counting matches with and without stock on hand.
+	FacetInStock = "inStock"
+	// FacetCategory is the name of the facet counting matches in each category.
+	FacetCategory = "category"
+	// FacetOptionPrefix prefixes the name of a variant option to form the name of the facet counting matches for each
+	// value of the option, for instance option:size.
+	FacetOptionPrefix = "option:"
+)
+
+// SearchOptions holds optional behaviour for product searches.
+type SearchOptions struct {
+	// Facets selects the facets to count across every match of the search.
+	Facets FacetRequest
+	// Highlight requests snippets of the name and description of each match with matching terms marked.
+	Highlight bool
+	// Fuzzy allows words to match words a few typos away, as many as Fuzziness allows for each word. Phrases, prefixes
+	// and excluded words always match exactly.
+	Fuzzy bool
+}
+
+const (
+	// HighlightName is the key of the name snippets of a SearchHit.
+	HighlightName = "name"
+	// HighlightDescription is the key of the description snippets of a SearchHit.
+	HighlightDescription = "description"
+	// HighlightStart marks the start of a matching term within a snippet.
+	HighlightStart = "<mark>"
+	// HighlightEnd marks the end of a matching term within a snippet.
+	HighlightEnd = "</mark>"
+)
+
+// SearchHit holds how well a product matched a search. Score is only comparable with the scores of other hits of the
+// same search. Highlights holds snippets of the product's fields keyed by field name, only when requested.
+type SearchHit struct {
+	Score      float64
+	Highlights map[string][]string
+}
+
+// FacetRequest selects facets to compute alongside search results.
+type FacetRequest struct {
+	// Price counts matches within the ranges bounded by PriceBoundaries.
+	Price bool
+	// PriceBoundaries holds the ascending lower bounds of each price range after the first.
+	PriceBoundaries []decimal.Decimal
+	// InStock counts matches with and without stock on hand.
+	InStock bool
+	// Category counts matches in each category.
+	Category bool
+	// Options holds the names of the variant options to count matches for each value of.
+	Options []string
+}
+
+// Requested returns true if at least one facet was requested.
+func (fr FacetRequest) Requested() bool {
+	return fr.Price || fr.InStock || fr.Category || len(fr.Options) > 0
+}
+
+// Facet holds the number of matches for each distinct value, or range of values, of a field.
+type Facet struct {
+	Name    string
+	Buckets []FacetBucket
+}
+
+// FacetBucket holds the number of matches sharing a value. Price buckets also hold the bounds of their range, Min
+// inclusive and Max exclusive, either of which is nil if the range is unbounded.
+type FacetBucket struct {
+	Value string
+	Min   *decimal.Decimal
+	Max   *decimal.Decimal
+	Count int
+}
+
+// Suggestion is the name of a product or category completing text typed so far. Score is only comparable with the
+// scores of other suggestions of the same kind for the same text.
+type Suggestion struct {
+	Id    string
+	Text  string
+	Score float64
+}
+
+// Suggestions holds the product and category names completing text typed so far, most relevant first.
+type Suggestions struct {
+	Products   []Suggestion
+	Categories []Suggestion
+}
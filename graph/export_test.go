@@ -0,0 +1,4 @@
+package graph
+
+// CheckLimits exposes checkLimits to the tests of the package.
+var CheckLimits = checkLimits
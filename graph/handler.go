@@ -0,0 +1,105 @@
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// request holds a GraphQL query along with its variables and the name of the operation to run.
+type request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// Handler serves GraphQL queries against the ProductRepository in the request context.
+type Handler struct {
+	schema graphql.Schema
+}
+
+// NewHandler constructs a Handler serving queries of the product schema.
+func NewHandler() (*Handler, error) {
+	schema, err := NewSchema()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Handler{schema}, nil
+}
+
+// parseRequest reads a query posted as JSON, or given in the query, variables and operationName parameters of a GET
+// request.
+func parseRequest(r *http.Request) (request, error) {
+	var req request
+
+	if r.Method == http.MethodGet {
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				return req, errors.New("variables must be a JSON object")
+			}
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, errors.New("request body must be a JSON object")
+	}
+
+	if req.Query == "" {
+		return req, errors.New("query must be provided")
+	}
+
+	return req, nil
+}
+
+// execute runs the given request, rejecting valid queries that exceed the depth and complexity limits before resolving
+// any of their fields.
+func (h *Handler) execute(r *http.Request, req request) *graphql.Result {
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"}),
+	})
+
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+
+	validation := graphql.ValidateDocument(&h.schema, doc, nil)
+
+	if !validation.IsValid {
+		return &graphql.Result{Errors: validation.Errors}
+	}
+
+	if err := checkLimits(doc, req.Variables); err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        h.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       r.Context(),
+	})
+}
+
+// ServeHTTP responds with the result of the requested query. Requests that do not hold a query are rejected with a
+// 400, errors raised by the query itself are part of its result.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, err := parseRequest(r)
+
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+
+	render.JSON(w, r, h.execute(r, req))
+}
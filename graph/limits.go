@@ -0,0 +1,171 @@
+package graph
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+const (
+	// maxFirst is the largest page that can be requested.
+	maxFirst = 100
+	// maxDepth is the deepest fields can be nested in a query.
+	maxDepth = 8
+	// maxComplexity is the most fields a query can resolve, counting the fields of every item of a page.
+	maxComplexity = 5000
+)
+
+// pagedFields are the fields retrieving a page of products, the fields selected on them are resolved once for each
+// product of the page.
+var pagedFields = map[string]bool{"products": true, "search": true}
+
+// queryAnalysis measures the depth and complexity of the operations of a validated query document.
+type queryAnalysis struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+// checkLimits returns an error if any operation of the given document nests fields deeper than maxDepth or could
+// resolve more than maxComplexity fields with the given variables. The document must be valid, so that fragments are
+// known and do not spread each other in cycles. Introspection fields are not counted.
+func checkLimits(doc *ast.Document, variables map[string]interface{}) error {
+	analysis := queryAnalysis{fragments: make(map[string]*ast.FragmentDefinition)}
+	for _, definition := range doc.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			analysis.fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	for _, definition := range doc.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+
+		analysis.variables = operationVariables(operation, variables)
+		depth, complexity := analysis.selectionSet(operation.SelectionSet)
+
+		if depth > maxDepth {
+			return fmt.Errorf("query is nested %d fields deep, the limit is %d", depth, maxDepth)
+		}
+
+		if complexity > maxComplexity {
+			return fmt.Errorf("query could resolve more than the limit of %d fields", maxComplexity)
+		}
+	}
+
+	return nil
+}
+
+// operationVariables returns the given variables along with the default value of any variable of the operation that
+// is not given.
+func operationVariables(operation *ast.OperationDefinition, variables map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for _, definition := range operation.VariableDefinitions {
+		name := definition.Variable.Name.Value
+		if value, ok := variables[name]; ok {
+			result[name] = value
+		} else if definition.DefaultValue != nil {
+			result[name] = definition.DefaultValue.GetValue()
+		}
+	}
+
+	return result
+}
+
+// selectionSet returns how deep fields are nested in the given selection set and how many fields it could resolve.
+func (qa queryAnalysis) selectionSet(set *ast.SelectionSet) (int, int) {
+	if set == nil {
+		return 0, 0
+	}
+
+	depth, complexity := 0, 0
+	for _, selection := range set.Selections {
+		var selectionDepth, selectionComplexity int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			selectionDepth, selectionComplexity = qa.field(selection)
+		case *ast.InlineFragment:
+			selectionDepth, selectionComplexity = qa.selectionSet(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			if fragment, ok := qa.fragments[selection.Name.Value]; ok {
+				selectionDepth, selectionComplexity = qa.selectionSet(fragment.SelectionSet)
+			}
+		}
+
+		if selectionDepth > depth {
+			depth = selectionDepth
+		}
+		complexity += selectionComplexity
+	}
+
+	return depth, complexity
+}
+
+// field returns how deep fields are nested in the given field, counting itself, and how many fields it could resolve,
+// counted up to one past maxComplexity.
+func (qa queryAnalysis) field(field *ast.Field) (int, int) {
+	if strings.HasPrefix(field.Name.Value, "__") {
+		return 0, 0
+	}
+
+	depth, complexity := qa.selectionSet(field.SelectionSet)
+	if pagedFields[field.Name.Value] {
+		complexity *= qa.first(field)
+	}
+
+	if complexity > maxComplexity {
+		// the query is rejected however far past the limit it is, so nested pages are capped rather than overflowing
+		complexity = maxComplexity
+	}
+
+	return depth + 1, complexity + 1
+}
+
+// first returns the size of the page requested by the given field, at most maxFirst as larger pages are rejected when
+// the field is resolved.
+func (qa queryAnalysis) first(field *ast.Field) int {
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != "first" {
+			continue
+		}
+
+		var value interface{}
+		switch argValue := argument.Value.(type) {
+		case *ast.Variable:
+			value = qa.variables[argValue.Name.Value]
+		default:
+			value = argValue.GetValue()
+		}
+
+		switch value := value.(type) {
+		case string:
+			// integer literals hold their text
+			if first, err := strconv.Atoi(value); err == nil && first > 0 {
+				return clampFirst(first)
+			}
+		case float64:
+			// variables decoded from JSON hold numbers as float64
+			if value > 0 {
+				return int(math.Min(value, maxFirst))
+			}
+		case int:
+			if value > 0 {
+				return clampFirst(value)
+			}
+		}
+	}
+
+	return defaultFirst
+}
+
+func clampFirst(first int) int {
+	if first > maxFirst {
+		return maxFirst
+	}
+
+	return first
+}
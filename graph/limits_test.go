@@ -0,0 +1,80 @@
+package graph_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/stone1549/product-service/graph"
+)
+
+// checkLimits parses the given query and checks it against the limits with the given variables.
+func checkLimits(t *testing.T, query string, variables map[string]interface{}) error {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(query)})})
+	ok(t, err)
+
+	return graph.CheckLimits(doc, variables)
+}
+
+// fields returns a selection of n fields.
+func fields(n int) string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("field%d", i)
+	}
+
+	return strings.Join(names, " ")
+}
+
+// nested returns a selection of fields nested depth deep.
+func nested(depth int) string {
+	return strings.Repeat("field { ", depth-1) + "field" + strings.Repeat(" }", depth-1)
+}
+
+// TestCheckLimits_Depth ensures that queries are rejected once their fields are nested deeper than the limit, whether
+// directly or through fragments.
+func TestCheckLimits_Depth(t *testing.T) {
+	ok(t, checkLimits(t, "{ "+nested(8)+" }", nil))
+	notOk(t, checkLimits(t, "{ "+nested(9)+" }", nil))
+	ok(t, checkLimits(t, "{ field { ...deep } } fragment deep on Product { "+nested(7)+" }", nil))
+	notOk(t, checkLimits(t, "{ field { ...deep } } fragment deep on Product { "+nested(8)+" }", nil))
+	notOk(t, checkLimits(t, "{ field { ... on Product { "+nested(8)+" } } }", nil))
+}
+
+// TestCheckLimits_FragmentSpreads ensures that the fields selected through fragment spreads count once for every item
+// of the page they are selected on.
+func TestCheckLimits_FragmentSpreads(t *testing.T) {
+	query := "{ products(first: %d) { edges { node { ...product } } } } fragment product on Product { %s }"
+
+	ok(t, checkLimits(t, fmt.Sprintf(query, 10, fields(50)), nil))
+	err := checkLimits(t, fmt.Sprintf(query, 100, fields(50)), nil)
+	equals(t, "query could resolve more than the limit of 5000 fields", err.Error())
+}
+
+// TestCheckLimits_Variables ensures that pages requested through variables are measured by the value of the variable,
+// or its default value when it is not given.
+func TestCheckLimits_Variables(t *testing.T) {
+	query := "query($first: Int%s) { search(text: \"a\", first: $first) { edges { node { " + fields(50) + " } } } }"
+
+	ok(t, checkLimits(t, fmt.Sprintf(query, ""), map[string]interface{}{"first": float64(10)}))
+	notOk(t, checkLimits(t, fmt.Sprintf(query, ""), map[string]interface{}{"first": float64(100)}))
+	notOk(t, checkLimits(t, fmt.Sprintf(query, " = 100"), nil))
+	ok(t, checkLimits(t, fmt.Sprintf(query, " = 100"), map[string]interface{}{"first": float64(10)}))
+	ok(t, checkLimits(t, fmt.Sprintf(query, ""), nil))
+}
+
+// TestCheckLimits_OversizedFirst ensures that pages larger than the resolvers accept are measured as the largest page
+// they accept, so that the complexity of nested pages cannot overflow.
+func TestCheckLimits_OversizedFirst(t *testing.T) {
+	query := "query($first: Int) { products(first: %s) { edges { node { " + fields(10) + " } } } }"
+
+	ok(t, checkLimits(t, fmt.Sprintf(query, "1000"), nil))
+	ok(t, checkLimits(t, fmt.Sprintf(query, "9223372036854775807"), nil))
+	ok(t, checkLimits(t, fmt.Sprintf(query, "$first"), map[string]interface{}{"first": float64(1e300)}))
+
+	page := "products(first: 9223372036854775807) { edges { node { id %s } } }"
+	err := checkLimits(t, "{ "+fmt.Sprintf(page, fmt.Sprintf(page, ""))+" }", nil)
+	equals(t, "query could resolve more than the limit of 5000 fields", err.Error())
+}
@@ -0,0 +1,717 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/shopspring/decimal"
+	"github.com/stone1549/product-service/common"
+	"github.com/stone1549/product-service/repository"
+)
+
+// defaultFirst is the size of the pages requested without one.
+const defaultFirst = 20
+
+// product is the source of the Product type, a product priced in the currency it was requested in.
+type product struct {
+	common.Product
+	currency common.Currency
+}
+
+// variant is the source of the Variant type, a variant of a product priced in the currency it was requested in.
+type variant struct {
+	common.Variant
+	product  common.Product
+	currency common.Currency
+}
+
+// price is the source of the Price type.
+type price struct {
+	currency common.Currency
+	amount   decimal.Decimal
+}
+
+// edge is the source of the ProductEdge type, hit is nil outside of searches.
+type edge struct {
+	product product
+	cursor  string
+	hit     *common.SearchHit
+}
+
+// connection is the source of the ProductConnection type.
+type connection struct {
+	list     repository.ProductList
+	currency common.Currency
+	first    int
+}
+
+func formatPrice(amount *decimal.Decimal, currency common.Currency) interface{} {
+	if amount == nil {
+		return nil
+	}
+
+	return currency.Format(*amount)
+}
+
+// newPrices lists the given prices, along with the given default price, each in its own currency, ordered by currency.
+func newPrices(defaultPrice *decimal.Decimal, prices map[common.Currency]decimal.Decimal) []price {
+	result := make([]price, 0, len(prices)+1)
+	if defaultPrice != nil {
+		result = append(result, price{common.DefaultCurrency, *defaultPrice})
+	}
+
+	for currency, amount := range prices {
+		if currency != common.DefaultCurrency {
+			result = append(result, price{currency, amount})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].currency < result[j].currency
+	})
+	return result
+}
+
+func stringValue(str *string) interface{} {
+	if str == nil {
+		return nil
+	}
+
+	return *str
+}
+
+// productRepository retrieves the ProductRepository added to the request context by the repo middleware.
+func productRepository(p graphql.ResolveParams) (repository.ProductRepository, error) {
+	repo, ok := p.Context.Value("repo").(repository.ProductRepository)
+
+	if !ok {
+		return nil, errors.New("ProductRepository not found in context")
+	}
+
+	return repo, nil
+}
+
+func parseCurrency(value interface{}) (common.Currency, error) {
+	code, _ := value.(string)
+	if code == "" {
+		return common.DefaultCurrency, nil
+	}
+
+	return common.ParseCurrency(code)
+}
+
+func parseDecimal(name string, value interface{}) (*decimal.Decimal, error) {
+	str, _ := value.(string)
+	if str == "" {
+		return nil, nil
+	}
+
+	amount, err := decimal.NewFromString(str)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a number", name)
+	}
+
+	return &amount, nil
+}
+
+func parseTime(value interface{}) *time.Time {
+	t, ok := value.(time.Time)
+	if !ok {
+		return nil
+	}
+
+	return &t
+}
+
+func parseIds(value interface{}) []string {
+	values, _ := value.([]interface{})
+	ids := make([]string, 0, len(values))
+	for _, id := range values {
+		if str, ok := id.(string); ok {
+			ids = append(ids, str)
+		}
+	}
+
+	return ids
+}
+
+// parseFilter builds a ProductFilter from the given ProductFilter input, which may be nil. Subcategories are included
+// unless includeSubcategories is false, as with the REST API.
+func parseFilter(value interface{}) (common.ProductFilter, error) {
+	var filter common.ProductFilter
+	var err error
+
+	input, _ := value.(map[string]interface{})
+
+	filter.Currency, err = parseCurrency(input["currency"])
+
+	if err != nil {
+		return filter, err
+	}
+
+	filter.MinPrice, err = parseDecimal("minPrice", input["minPrice"])
+
+	if err != nil {
+		return filter, err
+	}
+
+	filter.MaxPrice, err = parseDecimal("maxPrice", input["maxPrice"])
+
+	if err != nil {
+		return filter, err
+	}
+
+	if inStock, ok := input["inStock"].(bool); ok {
+		filter.InStock = &inStock
+	}
+
+	filter.CreatedAfter = parseTime(input["createdAfter"])
+	filter.UpdatedSince = parseTime(input["updatedSince"])
+
+	if ids := parseIds(input["ids"]); len(ids) > 0 {
+		filter.Ids = ids
+	}
+
+	if categoryIds := parseIds(input["categoryIds"]); len(categoryIds) > 0 {
+		filter.CategoryIds = categoryIds
+	}
+
+	includeSubcategories, ok := input["includeSubcategories"].(bool)
+	filter.IncludeSubcategories = !ok || includeSubcategories
+	return filter, nil
+}
+
+func parseOrderBy(value interface{}) (common.OrderBy, error) {
+	orderBy := common.OrderBy{}
+	keys, _ := value.([]interface{})
+	for _, key := range keys {
+		if key, ok := key.(common.OrderByKey); ok {
+			if err := orderBy.Add(key); err != nil {
+				return orderBy, err
+			}
+		}
+	}
+
+	return orderBy, nil
+}
+
+// parseFirst retrieves the size of the requested page, which may not exceed the limit on the size of lists.
+func parseFirst(value interface{}) (int, error) {
+	first, ok := value.(int)
+	if !ok {
+		return defaultFirst, nil
+	}
+
+	if first < 1 || first > maxFirst {
+		return 0, fmt.Errorf("first must be between 1 and %d", maxFirst)
+	}
+
+	return first, nil
+}
+
+// resolveProduct retrieves a product from its id, priced in the requested currency.
+func resolveProduct(p graphql.ResolveParams) (interface{}, error) {
+	currency, err := parseCurrency(p.Args["currency"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := productRepository(p)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := repo.GetProduct(p.Context, p.Args["id"].(string))
+
+	if err != nil || result == nil {
+		return nil, err
+	}
+
+	return product{*result, currency}, nil
+}
+
+// resolveProducts retrieves a page of the products matching a filter. Unlike the REST API an empty page is not an
+// error.
+func resolveProducts(p graphql.ResolveParams) (interface{}, error) {
+	first, err := parseFirst(p.Args["first"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	orderBy, err := parseOrderBy(p.Args["orderBy"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := parseFilter(p.Args["filter"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := productRepository(p)
+
+	if err != nil {
+		return nil, err
+	}
+
+	after, _ := p.Args["after"].(string)
+	list, err := repo.GetProducts(p.Context, first, after, orderBy, filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return connection{list, filter.PriceCurrency(), first}, nil
+}
+
+// resolveSearch retrieves a page of the products matching search text and a filter.
+func resolveSearch(p graphql.ResolveParams) (interface{}, error) {
+	first, err := parseFirst(p.Args["first"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	orderBy, err := parseOrderBy(p.Args["orderBy"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := parseFilter(p.Args["filter"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := productRepository(p)
+
+	if err != nil {
+		return nil, err
+	}
+
+	after, _ := p.Args["after"].(string)
+	highlight, _ := p.Args["highlight"].(bool)
+	fuzzy, _ := p.Args["fuzzy"].(bool)
+	list, err := repo.SearchProducts(p.Context, p.Args["text"].(string), first, after, orderBy, filter,
+		common.SearchOptions{Highlight: highlight, Fuzzy: fuzzy})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return connection{list, filter.PriceCurrency(), first}, nil
+}
+
+var orderByEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name:        "ProductOrder",
+	Description: "A key products are sorted by, relevance can only be used when searching.",
+	Values: graphql.EnumValueConfigMap{
+		string(common.OrderByCreated):     &graphql.EnumValueConfig{Value: common.OrderByCreated},
+		string(common.OrderByCreatedDesc): &graphql.EnumValueConfig{Value: common.OrderByCreatedDesc},
+		string(common.OrderByUpdated):     &graphql.EnumValueConfig{Value: common.OrderByUpdated},
+		string(common.OrderByUpdatedDesc): &graphql.EnumValueConfig{Value: common.OrderByUpdatedDesc},
+		string(common.OrderByName):        &graphql.EnumValueConfig{Value: common.OrderByName},
+		string(common.OrderByNameDesc):    &graphql.EnumValueConfig{Value: common.OrderByNameDesc},
+		string(common.OrderByPrice):       &graphql.EnumValueConfig{Value: common.OrderByPrice},
+		string(common.OrderByPriceDesc):   &graphql.EnumValueConfig{Value: common.OrderByPriceDesc},
+		string(common.OrderByRelevance):   &graphql.EnumValueConfig{Value: common.OrderByRelevance},
+	},
+})
+
+var filterInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name:        "ProductFilter",
+	Description: "Criteria products must satisfy, unset criteria are ignored.",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"currency": &graphql.InputObjectFieldConfig{Type: graphql.String,
+			Description: "Currency prices are given and filtered in, defaults to USD."},
+		"minPrice":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"maxPrice":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"inStock":      &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+		"createdAfter": &graphql.InputObjectFieldConfig{Type: graphql.DateTime},
+		"updatedSince": &graphql.InputObjectFieldConfig{Type: graphql.DateTime},
+		"ids":          &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.ID))},
+		"categoryIds":  &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.ID))},
+		"includeSubcategories": &graphql.InputObjectFieldConfig{Type: graphql.Boolean, DefaultValue: true,
+			Description: "Extends categoryIds to their descendants."},
+	},
+})
+
+var priceType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Price",
+	Fields: graphql.Fields{
+		"currency": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return string(p.Source.(price).currency), nil
+			},
+		},
+		"amount": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				source := p.Source.(price)
+				return source.currency.Format(source.amount), nil
+			},
+		},
+	},
+})
+
+var optionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Option",
+	Fields: graphql.Fields{
+		"name":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"value": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+var variantType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Variant",
+	Fields: graphql.Fields{
+		"sku": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.ID),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(variant).Sku, nil
+			},
+		},
+		"productId": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.ID),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(variant).product.Id, nil
+			},
+		},
+		"options": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(optionType))),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				options := p.Source.(variant).Options
+				names := make([]string, 0, len(options))
+				for name := range options {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+
+				result := make([]map[string]interface{}, len(names))
+				for i, name := range names {
+					result[i] = map[string]interface{}{"name": name, "value": options[name]}
+				}
+
+				return result, nil
+			},
+		},
+		"price": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Price in the requested currency, at the product's price unless the variant overrides it.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				source := p.Source.(variant)
+				return formatPrice(source.EffectivePrice(source.product, source.currency), source.currency), nil
+			},
+		},
+		"currency": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return string(p.Source.(variant).currency), nil
+			},
+		},
+		"prices": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(priceType))),
+			Description: "Prices the variant overrides the product's with.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				source := p.Source.(variant)
+				return newPrices(source.Price, source.Prices), nil
+			},
+		},
+		"quantity": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Int),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(variant).QtyInStock, nil
+			},
+		},
+		"images": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				images := p.Source.(variant).Images
+				if images == nil {
+					images = make([]string, 0)
+				}
+
+				return images, nil
+			},
+		},
+	},
+})
+
+var productType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Product",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.ID),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(product).Id, nil
+			},
+		},
+		"name": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(product).Name, nil
+			},
+		},
+		"displayImage": &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return stringValue(p.Source.(product).DisplayImage), nil
+			},
+		},
+		"thumbnail": &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return stringValue(p.Source.(product).Thumbnail), nil
+			},
+		},
+		"price": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Price in the requested currency, null if the product is not sold in it.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				source := p.Source.(product)
+				return formatPrice(source.PriceIn(source.currency), source.currency), nil
+			},
+		},
+		"currency": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return string(p.Source.(product).currency), nil
+			},
+		},
+		"prices": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(priceType))),
+			Description: "Price of the product in every currency it is sold in.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				source := p.Source.(product)
+				return newPrices(source.Price, source.Prices), nil
+			},
+		},
+		"description": &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return stringValue(p.Source.(product).Description), nil
+			},
+		},
+		"shortDescription": &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return stringValue(p.Source.(product).ShortDescription), nil
+			},
+		},
+		"quantity": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Int),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(product).QtyInStock, nil
+			},
+		},
+		"createdAt": &graphql.Field{
+			Type: graphql.DateTime,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(product).CreatedAt, nil
+			},
+		},
+		"updatedAt": &graphql.Field{
+			Type: graphql.DateTime,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(product).UpdatedAt, nil
+			},
+		},
+		"categories": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.ID))),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				categoryIds := p.Source.(product).CategoryIds
+				if categoryIds == nil {
+					categoryIds = make([]string, 0)
+				}
+
+				return categoryIds, nil
+			},
+		},
+		"variants": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(variantType))),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				source := p.Source.(product)
+				variants := make([]variant, len(source.Variants))
+				for i, v := range source.Variants {
+					variants[i] = variant{v, source.Product, source.currency}
+				}
+
+				return variants, nil
+			},
+		},
+	},
+})
+
+var highlightType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Highlight",
+	Description: "Fragments of a field of a product with the words matching a search marked.",
+	Fields: graphql.Fields{
+		"field":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"fragments": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String)))},
+	},
+})
+
+var edgeType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ProductEdge",
+	Fields: graphql.Fields{
+		"cursor": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(edge).cursor, nil
+			},
+		},
+		"node": &graphql.Field{
+			Type: graphql.NewNonNull(productType),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(edge).product, nil
+			},
+		},
+		"score": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "How well the product matched the search, null outside of searches.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				hit := p.Source.(edge).hit
+				if hit == nil {
+					return nil, nil
+				}
+
+				return hit.Score, nil
+			},
+		},
+		"highlights": &graphql.Field{
+			Type:        graphql.NewList(graphql.NewNonNull(highlightType)),
+			Description: "Highlighted fragments of the name and description, when requested by the search.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				hit := p.Source.(edge).hit
+				if hit == nil || hit.Highlights == nil {
+					return nil, nil
+				}
+
+				result := make([]map[string]interface{}, 0, len(hit.Highlights))
+				for _, field := range []string{common.HighlightName, common.HighlightDescription} {
+					if fragments, ok := hit.Highlights[field]; ok {
+						result = append(result, map[string]interface{}{"field": field, "fragments": fragments})
+					}
+				}
+
+				return result, nil
+			},
+		},
+	},
+})
+
+var pageInfoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"endCursor": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "Cursor to request the next page after, the requested cursor if the page is empty.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(connection).list.Cursor, nil
+			},
+		},
+		"hasNextPage": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.Boolean),
+			Description: "False when the page is short, a full page may be followed by an empty one.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				source := p.Source.(connection)
+				return len(source.list.Products) == source.first, nil
+			},
+		},
+	},
+})
+
+var connectionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ProductConnection",
+	Fields: graphql.Fields{
+		"edges": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(edgeType))),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				source := p.Source.(connection)
+				edges := make([]edge, len(source.list.Products))
+				for i, item := range source.list.Products {
+					edges[i] = edge{product: product{item, source.currency}, cursor: source.list.Cursors[i]}
+					if i < len(source.list.Hits) {
+						edges[i].hit = &source.list.Hits[i]
+					}
+				}
+
+				return edges, nil
+			},
+		},
+		"pageInfo": &graphql.Field{
+			Type: graphql.NewNonNull(pageInfoType),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source, nil
+			},
+		},
+		"didYouMean": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Corrected search text when a search matches nothing.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				didYouMean := p.Source.(connection).list.DidYouMean
+				if didYouMean == "" {
+					return nil, nil
+				}
+
+				return didYouMean, nil
+			},
+		},
+	},
+})
+
+// pageArgs are the arguments of the fields retrieving a ProductConnection.
+func pageArgs(args graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	args["first"] = &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultFirst}
+	args["after"] = &graphql.ArgumentConfig{Type: graphql.String}
+	args["orderBy"] = &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(orderByEnum))}
+	args["filter"] = &graphql.ArgumentConfig{Type: filterInput}
+	return args
+}
+
+var queryType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Query",
+	Fields: graphql.Fields{
+		"product": &graphql.Field{
+			Type:        productType,
+			Description: "Retrieves a product from its id, null if it does not exist.",
+			Args: graphql.FieldConfigArgument{
+				"id":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				"currency": &graphql.ArgumentConfig{Type: graphql.String},
+			},
+			Resolve: resolveProduct,
+		},
+		"products": &graphql.Field{
+			Type:        graphql.NewNonNull(connectionType),
+			Description: "Retrieves a page of the products matching a filter.",
+			Args:        pageArgs(graphql.FieldConfigArgument{}),
+			Resolve:     resolveProducts,
+		},
+		"search": &graphql.Field{
+			Type:        graphql.NewNonNull(connectionType),
+			Description: "Retrieves a page of the products matching search text and a filter, most relevant first.",
+			Args: pageArgs(graphql.FieldConfigArgument{
+				"text":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				"highlight": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+				"fuzzy":     &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+			}),
+			Resolve: resolveSearch,
+		},
+	},
+})
+
+// NewSchema builds the schema of product queries, resolved against the ProductRepository in the request context.
+func NewSchema() (graphql.Schema, error) {
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
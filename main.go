@@ -2,17 +2,92 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
 	"github.com/stone1549/product-service/common"
+	"github.com/stone1549/product-service/graph"
 	"github.com/stone1549/product-service/repository"
+	"github.com/stone1549/product-service/rpc"
 	"github.com/stone1549/product-service/service"
+	"google.golang.org/grpc"
+	"net"
 	"net/http"
+	"os"
+	"time"
 )
 
+// serveGrpc serves the gRPC API of the given repository on the configured port.
+func serveGrpc(config common.Configuration, repo repository.ProductRepository) {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", config.GetGrpcPort()))
+
+	if err != nil {
+		panic(fmt.Sprintf("Unable to listen for gRPC requests: %s", err.Error()))
+	}
+
+	server := grpc.NewServer()
+	rpc.RegisterProductServiceServer(server, rpc.NewProductServer(repo))
+
+	if err := server.Serve(listener); err != nil {
+		panic(fmt.Sprintf("Unable to serve gRPC requests: %s", err.Error()))
+	}
+}
+
+// migrate runs the migrate subcommand, applying, reverting or listing migrations of the configured PostgreSQL schema.
+func migrate(config common.Configuration, args []string) error {
+	if config.GetRepoType() != common.PostgreSqlRepo {
+		return errors.New("migrations only apply to the POSTGRESQL repo type")
+	}
+
+	db, err := sql.Open("postgres", config.GetPgUrl())
+
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	command := ""
+	if len(args) == 1 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := repository.MigratePostgresqlUp(context.Background(), db)
+		for _, m := range applied {
+			fmt.Printf("Applied %d %s\n", m.Version, m.Name)
+		}
+
+		return err
+	case "down":
+		reverted, err := repository.MigratePostgresqlDown(context.Background(), db)
+		if reverted != nil {
+			fmt.Printf("Reverted %d %s\n", reverted.Version, reverted.Name)
+		}
+
+		return err
+	case "status":
+		migrations, err := repository.PostgresqlMigrationStatus(context.Background(), db)
+		for _, m := range migrations {
+			status := "pending"
+			if m.AppliedAt != nil {
+				status = "applied " + m.AppliedAt.Format(time.RFC3339)
+			}
+
+			fmt.Printf("%d %s: %s\n", m.Version, m.Name, status)
+		}
+
+		return err
+	default:
+		return errors.New("usage: migrate up|down|status")
+	}
+}
+
 func main() {
 	flag.Parse()
 
@@ -22,12 +97,44 @@ func main() {
 		panic(fmt.Sprintf("Unable to load configuration: %s", err.Error()))
 	}
 
+	if flag.Arg(0) == "migrate" {
+		err = migrate(config, flag.Args()[1:])
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to migrate: %s\n", err.Error())
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if config.GetRepoType() == common.PostgreSqlRepo {
+		err = repository.PreparePostgresqlSchema(context.Background(), config)
+
+		if err != nil {
+			panic(fmt.Sprintf("Unable to prepare database schema: %s", err.Error()))
+		}
+	}
+
 	repo, err := repository.NewProductRepository(config)
 
 	if err != nil {
 		panic(fmt.Sprintf("Unable to configure repository: %s", err.Error()))
 	}
 
+	go repository.SweepExpiredReservations(context.Background(), repo, config.GetReservationSweepInterval())
+	go repository.LogCacheStats(context.Background(), repo, time.Minute)
+
+	if config.GetGrpcPort() != 0 {
+		go serveGrpc(config, repo)
+	}
+
+	graphHandler, err := graph.NewHandler()
+
+	if err != nil {
+		panic(fmt.Sprintf("Unable to build GraphQL schema: %s", err.Error()))
+	}
+
 	repoMiddleWare := func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := context.WithValue(r.Context(), "repo", repo)
@@ -49,14 +156,47 @@ func main() {
 	// processing should be stopped.
 	r.Use(middleware.Timeout(config.GetTimeout()))
 
+	r.Get("/products:batchGet", service.BatchGetProducts)
+	r.Post("/products:batchGet", service.BatchGetProducts)
 	r.Route("/products", func(r chi.Router) {
 		r.With(service.SearchProductsMiddleware).Get("/search", service.SearchProducts)
+		// suggestions are requested as users type, so are given up on well before other requests
+		r.With(middleware.Timeout(config.GetSuggestTimeout()), service.SuggestProductsMiddleware).
+			Get("/suggest", service.SuggestProducts)
 		r.With(service.GetProductsMiddleware).Get("/", service.GetProducts)
+		r.Post("/", service.CreateProduct)
 		r.Route("/{productId}", func(r chi.Router) {
 			r.Use(service.GetProductMiddleware)
 			r.Get("/", service.GetProduct)
+			r.Put("/", service.ReplaceProduct)
+			r.Patch("/", service.PatchProduct)
+			r.Delete("/", service.DeleteProduct)
+			r.Route("/reservations", func(r chi.Router) {
+				r.Post("/", service.CreateReservation)
+				r.Post("/{reservationId}/commit", service.CommitReservation)
+				r.Post("/{reservationId}/release", service.ReleaseReservation)
+			})
 		})
 	})
 
+	r.Route("/categories", func(r chi.Router) {
+		r.Get("/", service.GetCategories)
+		r.Route("/{categoryId}", func(r chi.Router) {
+			r.Use(service.GetCategoryMiddleware)
+			r.Get("/", service.GetCategory)
+			r.With(service.GetProductsMiddleware).Get("/products", service.GetProducts)
+		})
+	})
+
+	r.Route("/variants", func(r chi.Router) {
+		r.Route("/{sku}", func(r chi.Router) {
+			r.Use(service.GetVariantMiddleware)
+			r.Get("/", service.GetVariant)
+		})
+	})
+
+	r.Get("/graphql", graphHandler.ServeHTTP)
+	r.Post("/graphql", graphHandler.ServeHTTP)
+
 	http.ListenAndServe(":3333", r)
 }
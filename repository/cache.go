@@ -0,0 +1,535 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stone1549/product-service/common"
+)
+
+// CacheStats counts the lookups made in the cache of a CachingRepository.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// CachingRepository is a ProductRepository serving products and pages of products from a cache, retrieving them from
+// the repository it wraps on a miss. Writes made through it invalidate the cache, writes made to the wrapped repository
+// by other means must be reported through InvalidateProduct or InvalidateAll.
+type CachingRepository interface {
+	ProductRepository
+	// InvalidateProduct evicts the product with the given id, along with every page of products, from the cache.
+	InvalidateProduct(id string)
+	// InvalidateAll evicts everything from the cache.
+	InvalidateAll()
+	// CacheStats retrieves the number of lookups served from the cache and the number that missed it.
+	CacheStats() CacheStats
+}
+
+// lruEntry is a value held by an lruCache.
+type lruEntry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+// lruCache is a cache of at most size values, each expiring ttl after it was cached, evicting the least recently used
+// value when full. Every eviction other than expiry advances the generation of the cache, so that values retrieved
+// before an invalidation are not cached after it.
+type lruCache struct {
+	lock       sync.Mutex
+	size       int
+	ttl        time.Duration
+	generation uint64
+	entries    map[string]*list.Element
+	recent     *list.List
+}
+
+func newLruCache(size int, ttl time.Duration) *lruCache {
+	return &lruCache{size: size, ttl: ttl, entries: make(map[string]*list.Element), recent: list.New()}
+}
+
+// get returns the value cached under the given key unless it has expired, along with the current generation.
+func (lc *lruCache) get(key string) (interface{}, bool, uint64) {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	element, ok := lc.entries[key]
+	if !ok {
+		return nil, false, lc.generation
+	}
+
+	entry := element.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		lc.recent.Remove(element)
+		delete(lc.entries, key)
+		return nil, false, lc.generation
+	}
+
+	lc.recent.MoveToFront(element)
+	return entry.value, true, lc.generation
+}
+
+// put caches the given value under the given key unless the cache was invalidated since the given generation.
+func (lc *lruCache) put(key string, value interface{}, generation uint64) {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	if generation != lc.generation {
+		return
+	}
+
+	expiresAt := time.Now().Add(lc.ttl)
+	if element, ok := lc.entries[key]; ok {
+		element.Value = &lruEntry{key, value, expiresAt}
+		lc.recent.MoveToFront(element)
+		return
+	}
+
+	lc.entries[key] = lc.recent.PushFront(&lruEntry{key, value, expiresAt})
+
+	for lc.recent.Len() > lc.size {
+		oldest := lc.recent.Back()
+		lc.recent.Remove(oldest)
+		delete(lc.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// removePrefix evicts every value cached under a key starting with the given prefix.
+func (lc *lruCache) removePrefix(prefix string) {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	lc.generation++
+	for key, element := range lc.entries {
+		if strings.HasPrefix(key, prefix) {
+			lc.recent.Remove(element)
+			delete(lc.entries, key)
+		}
+	}
+}
+
+// clear evicts every cached value.
+func (lc *lruCache) clear() {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	lc.generation++
+	lc.entries = make(map[string]*list.Element)
+	lc.recent.Init()
+}
+
+// cacheLoadTimeout bounds the time spent loading a value on behalf of the callers waiting for it, whose own deadlines
+// do not apply.
+const cacheLoadTimeout = 30 * time.Second
+
+// detachedContext carries the values of the context it wraps without its deadline or cancellation, so that a load
+// shared by several callers is not cancelled along with the caller that started it.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (dc detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (dc detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (dc detachedContext) Err() error {
+	return nil
+}
+
+func (dc detachedContext) Value(key interface{}) interface{} {
+	return dc.parent.Value(key)
+}
+
+// flight is a call made on behalf of every caller waiting for its result, done is closed once it returns.
+type flight struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// flightGroup de-duplicates concurrent calls sharing a key.
+type flightGroup struct {
+	lock    sync.Mutex
+	flights map[string]*flight
+}
+
+// do calls fn in the background, unless a call sharing the given key is already in flight, and waits for the result
+// of the call until the given context is done. The call is not interrupted when callers stop waiting for it.
+func (fg *flightGroup) do(ctx context.Context, key string, fn func() (interface{}, error)) (interface{}, error) {
+	fg.lock.Lock()
+	if fg.flights == nil {
+		fg.flights = make(map[string]*flight)
+	}
+
+	f, ok := fg.flights[key]
+	if !ok {
+		f = &flight{done: make(chan struct{})}
+		fg.flights[key] = f
+		go fg.call(key, f, fn)
+	}
+	fg.lock.Unlock()
+
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// call calls fn on behalf of the given flight, then lands it.
+func (fg *flightGroup) call(key string, f *flight, fn func() (interface{}, error)) {
+	f.value, f.err = fn()
+
+	fg.lock.Lock()
+	delete(fg.flights, key)
+	fg.lock.Unlock()
+
+	close(f.done)
+}
+
+// cachingProductRepository caches the products and pages of products retrieved from the ProductRepository it embeds.
+// Products are cached by id, followed by the fields selected, so that every selection of a product can be evicted
+// together.
+type cachingProductRepository struct {
+	hits   uint64
+	misses uint64
+	ProductRepository
+	products *lruCache
+	pages    *lruCache
+	flights  flightGroup
+}
+
+// MakeCachingRepository wraps the given repository with a cache of up to size products and size pages of products,
+// each served for up to ttl.
+func MakeCachingRepository(repo ProductRepository, size int, ttl time.Duration) CachingRepository {
+	return &cachingProductRepository{
+		ProductRepository: repo,
+		products:          newLruCache(size, ttl),
+		pages:             newLruCache(size, ttl),
+	}
+}
+
+// cached returns the value cached under the given key, loading and caching it on a miss. Concurrent misses of a key
+// share a single load, errors are not cached. The load is given a context detached from the given context, bounded by
+// cacheLoadTimeout instead, so that it completes for every caller waiting for it even if the caller that started it
+// gives up, while each caller stops waiting when its own context is done.
+func (cpr *cachingProductRepository) cached(ctx context.Context, cache *lruCache, key string,
+	load func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	value, ok, generation := cache.get(key)
+	if ok {
+		atomic.AddUint64(&cpr.hits, 1)
+		return value, nil
+	}
+
+	atomic.AddUint64(&cpr.misses, 1)
+	return cpr.flights.do(ctx, strconv.FormatUint(generation, 10)+"/"+key, func() (interface{}, error) {
+		loadCtx, cancel := context.WithTimeout(detachedContext{ctx}, cacheLoadTimeout)
+		defer cancel()
+
+		value, err := load(loadCtx)
+		if err == nil {
+			cache.put(key, value, generation)
+		}
+
+		return value, err
+	})
+}
+
+// productKey returns the key a product is cached under for the fields selected by the given context.
+func productKey(ctx context.Context, id string) string {
+	return id + "\x00" + common.ProductFieldsFrom(ctx).String()
+}
+
+// pageKey returns the key a page of products is cached under, or false if the page can not be cached.
+func pageKey(ctx context.Context, args ...interface{}) (string, bool) {
+	key, err := json.Marshal(append(args, common.ProductFieldsFrom(ctx).String()))
+	return string(key), err == nil
+}
+
+// copyProductList returns a deep copy of the given list, so that callers can not modify cached lists.
+func copyProductList(products ProductList) ProductList {
+	if products.Products != nil {
+		cached := products.Products
+		products.Products = make([]common.Product, len(cached))
+		for i, product := range cached {
+			products.Products[i] = copyProduct(product)
+		}
+	}
+
+	products.Cursors = copyStrings(products.Cursors)
+
+	if products.Hits != nil {
+		cached := products.Hits
+		products.Hits = make([]common.SearchHit, len(cached))
+		for i, hit := range cached {
+			products.Hits[i] = hit
+			if hit.Highlights != nil {
+				products.Hits[i].Highlights = make(map[string][]string, len(hit.Highlights))
+				for field, fragments := range hit.Highlights {
+					products.Hits[i].Highlights[field] = copyStrings(fragments)
+				}
+			}
+		}
+	}
+
+	if products.Facets != nil {
+		cached := products.Facets
+		products.Facets = make([]common.Facet, len(cached))
+		for i, facet := range cached {
+			products.Facets[i] = facet
+			if facet.Buckets != nil {
+				products.Facets[i].Buckets = make([]common.FacetBucket, len(facet.Buckets))
+				for j, bucket := range facet.Buckets {
+					bucket.Min = copyDecimal(bucket.Min)
+					bucket.Max = copyDecimal(bucket.Max)
+					products.Facets[i].Buckets[j] = bucket
+				}
+			}
+		}
+	}
+
+	return products
+}
+
+// copyProduct returns a deep copy of the given product, so that callers can not modify cached products.
+func copyProduct(product common.Product) common.Product {
+	product.DisplayImage = copyString(product.DisplayImage)
+	product.Thumbnail = copyString(product.Thumbnail)
+	product.Price = copyDecimal(product.Price)
+	product.Description = copyString(product.Description)
+	product.ShortDescription = copyString(product.ShortDescription)
+	product.CreatedAt = copyTime(product.CreatedAt)
+	product.UpdatedAt = copyTime(product.UpdatedAt)
+	product.CategoryIds = copyStrings(product.CategoryIds)
+	product.Prices = copyPrices(product.Prices)
+
+	if product.Variants != nil {
+		cached := product.Variants
+		product.Variants = make([]common.Variant, len(cached))
+		for i, variant := range cached {
+			if variant.Options != nil {
+				options := variant.Options
+				variant.Options = make(map[string]string, len(options))
+				for name, value := range options {
+					variant.Options[name] = value
+				}
+			}
+
+			variant.Price = copyDecimal(variant.Price)
+			variant.Images = copyStrings(variant.Images)
+			variant.Prices = copyPrices(variant.Prices)
+			product.Variants[i] = variant
+		}
+	}
+
+	return product
+}
+
+func copyString(value *string) *string {
+	if value == nil {
+		return nil
+	}
+
+	result := *value
+	return &result
+}
+
+func copyDecimal(value *decimal.Decimal) *decimal.Decimal {
+	if value == nil {
+		return nil
+	}
+
+	result := *value
+	return &result
+}
+
+func copyTime(value *time.Time) *time.Time {
+	if value == nil {
+		return nil
+	}
+
+	result := *value
+	return &result
+}
+
+// copyStrings returns a copy of the given slice, nil if it is nil.
+func copyStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+
+	return append(make([]string, 0, len(values)), values...)
+}
+
+// copyPrices returns a copy of the given prices, nil if they are nil. Decimals are immutable, so they are shared.
+func copyPrices(prices map[common.Currency]decimal.Decimal) map[common.Currency]decimal.Decimal {
+	if prices == nil {
+		return nil
+	}
+
+	result := make(map[common.Currency]decimal.Decimal, len(prices))
+	for currency, price := range prices {
+		result[currency] = price
+	}
+
+	return result
+}
+
+func (cpr *cachingProductRepository) GetProducts(ctx context.Context, first int, cursor string,
+	orderBy common.OrderBy, filter common.ProductFilter) (ProductList, error) {
+	key, ok := pageKey(ctx, "products", first, cursor, orderBy.Order(), filter)
+	if !ok {
+		return cpr.ProductRepository.GetProducts(ctx, first, cursor, orderBy, filter)
+	}
+
+	value, err := cpr.cached(ctx, cpr.pages, key, func(ctx context.Context) (interface{}, error) {
+		return cpr.ProductRepository.GetProducts(ctx, first, cursor, orderBy, filter)
+	})
+
+	if err != nil {
+		return ProductList{}, err
+	}
+
+	return copyProductList(value.(ProductList)), nil
+}
+
+func (cpr *cachingProductRepository) GetProduct(ctx context.Context, id string) (*common.Product, error) {
+	value, err := cpr.cached(ctx, cpr.products, productKey(ctx, id), func(ctx context.Context) (interface{}, error) {
+		return cpr.ProductRepository.GetProduct(ctx, id)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	product := value.(*common.Product)
+	if product == nil {
+		return nil, nil
+	}
+
+	result := copyProduct(*product)
+	return &result, nil
+}
+
+func (cpr *cachingProductRepository) SearchProducts(ctx context.Context, searchTxt string, first int, cursor string,
+	orderBy common.OrderBy, filter common.ProductFilter, options common.SearchOptions) (ProductList, error) {
+	key, ok := pageKey(ctx, "search", searchTxt, first, cursor, orderBy.Order(), filter, options)
+	if !ok {
+		return cpr.ProductRepository.SearchProducts(ctx, searchTxt, first, cursor, orderBy, filter, options)
+	}
+
+	value, err := cpr.cached(ctx, cpr.pages, key, func(ctx context.Context) (interface{}, error) {
+		return cpr.ProductRepository.SearchProducts(ctx, searchTxt, first, cursor, orderBy, filter, options)
+	})
+
+	if err != nil {
+		return ProductList{}, err
+	}
+
+	return copyProductList(value.(ProductList)), nil
+}
+
+func (cpr *cachingProductRepository) CreateProduct(ctx context.Context, product common.Product) (*common.Product,
+	error) {
+	defer cpr.InvalidateProduct(product.Id)
+	return cpr.ProductRepository.CreateProduct(ctx, product)
+}
+
+func (cpr *cachingProductRepository) UpdateProduct(ctx context.Context, product common.Product) (*common.Product,
+	error) {
+	defer cpr.InvalidateProduct(product.Id)
+	return cpr.ProductRepository.UpdateProduct(ctx, product)
+}
+
+func (cpr *cachingProductRepository) DeleteProduct(ctx context.Context, id string) error {
+	defer cpr.InvalidateProduct(id)
+	return cpr.ProductRepository.DeleteProduct(ctx, id)
+}
+
+func (cpr *cachingProductRepository) ReserveProduct(ctx context.Context, productId string, quantity int,
+	ttl time.Duration) (*common.Reservation, error) {
+	defer cpr.InvalidateProduct(productId)
+	return cpr.ProductRepository.ReserveProduct(ctx, productId, quantity, ttl)
+}
+
+func (cpr *cachingProductRepository) CommitReservation(ctx context.Context, productId,
+	reservationId string) (*common.Reservation, error) {
+	defer cpr.InvalidateProduct(productId)
+	return cpr.ProductRepository.CommitReservation(ctx, productId, reservationId)
+}
+
+func (cpr *cachingProductRepository) ReleaseReservation(ctx context.Context, productId,
+	reservationId string) (*common.Reservation, error) {
+	defer cpr.InvalidateProduct(productId)
+	return cpr.ProductRepository.ReleaseReservation(ctx, productId, reservationId)
+}
+
+func (cpr *cachingProductRepository) ExpireReservations(ctx context.Context) (int, error) {
+	expired, err := cpr.ProductRepository.ExpireReservations(ctx)
+
+	if expired > 0 {
+		cpr.InvalidateAll()
+	}
+
+	return expired, err
+}
+
+// Close closes the wrapped repository if it holds resources that must be released.
+func (cpr *cachingProductRepository) Close() error {
+	if closer, ok := cpr.ProductRepository.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+func (cpr *cachingProductRepository) InvalidateProduct(id string) {
+	cpr.products.removePrefix(id + "\x00")
+	cpr.pages.clear()
+}
+
+func (cpr *cachingProductRepository) InvalidateAll() {
+	cpr.products.clear()
+	cpr.pages.clear()
+}
+
+func (cpr *cachingProductRepository) CacheStats() CacheStats {
+	return CacheStats{Hits: atomic.LoadUint64(&cpr.hits), Misses: atomic.LoadUint64(&cpr.misses)}
+}
+
+// LogCacheStats logs the lookups made in the cache of the given repository every interval until the given context is
+// done. It returns immediately if the repository is not a CachingRepository.
+func LogCacheStats(ctx context.Context, repo ProductRepository, interval time.Duration) {
+	cache, ok := repo.(CachingRepository)
+	if !ok {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stats := cache.CacheStats()
+			log.Printf("Cache hits: %d, misses: %d", stats.Hits, stats.Misses)
+		}
+	}
+}
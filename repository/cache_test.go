@@ -0,0 +1,239 @@
+package repository_test
+
+import (
+	"context"
+	"github.com/stone1549/product-service/common"
+	"github.com/stone1549/product-service/repository"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingRepository counts the products retrieved from the repository it embeds, waiting delay before each and
+// failing if the context of the retrieval is done by then.
+type countingRepository struct {
+	repository.ProductRepository
+	delay time.Duration
+	gets  int32
+}
+
+func (cr *countingRepository) GetProduct(ctx context.Context, id string) (*common.Product, error) {
+	atomic.AddInt32(&cr.gets, 1)
+	time.Sleep(cr.delay)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return cr.ProductRepository.GetProduct(ctx, id)
+}
+
+// makeNewCachedRepo wraps the small in memory repo with a cache of the given size and ttl.
+func makeNewCachedRepo(t *testing.T, size int, ttl time.Duration) (repository.CachingRepository, *countingRepository) {
+	counting := &countingRepository{ProductRepository: makeNewImRepo(t)}
+	return repository.MakeCachingRepository(counting, size, ttl), counting
+}
+
+// TestGetProduct_CacheSuccessHit ensures that a product is only retrieved from the wrapped repo once, and that copies
+// of it are served.
+func TestGetProduct_CacheSuccessHit(t *testing.T) {
+	repo, counting := makeNewCachedRepo(t, 10, time.Minute)
+	product, err := repo.GetProduct(context.Background(), "1")
+	ok(t, err)
+	product.Name = "changed"
+
+	product, err = repo.GetProduct(context.Background(), "1")
+
+	ok(t, err)
+	assert(t, product.Name != "changed", "Expected cached product to not be modified")
+	equals(t, int32(1), counting.gets)
+	equals(t, repository.CacheStats{Hits: 1, Misses: 1}, repo.CacheStats())
+}
+
+// TestGetProduct_CacheSuccessDeepCopy ensures that modifying the slices, maps and pointers of a served product does not
+// modify the cached product.
+func TestGetProduct_CacheSuccessDeepCopy(t *testing.T) {
+	repo, _ := makeNewCachedRepo(t, 10, time.Minute)
+	product, err := repo.GetProduct(context.Background(), "16")
+	ok(t, err)
+	expected := *product.Description
+	product.CategoryIds[0] = "changed"
+	*product.Description = "changed"
+	*product.CreatedAt = time.Time{}
+	product.Variants[0].Options["color"] = "changed"
+	product.Prices[common.CurrencyEUR] = product.Prices[common.CurrencyJPY]
+
+	product, err = repo.GetProduct(context.Background(), "16")
+
+	ok(t, err)
+	equals(t, "apparel", product.CategoryIds[0])
+	equals(t, expected, *product.Description)
+	assert(t, !product.CreatedAt.IsZero(), "Expected cached creation time to not be modified")
+	equals(t, "silver", product.Variants[0].Options["color"])
+	assert(t, !product.Prices[common.CurrencyEUR].Equal(product.Prices[common.CurrencyJPY]),
+		"Expected cached prices to not be modified")
+
+	products, err := repo.GetProducts(context.Background(), 20, "", common.OrderBy{},
+		common.ProductFilter{Ids: []string{"16"}})
+	ok(t, err)
+	products.Products[0].CategoryIds[0] = "changed"
+	products, err = repo.GetProducts(context.Background(), 20, "", common.OrderBy{},
+		common.ProductFilter{Ids: []string{"16"}})
+
+	ok(t, err)
+	equals(t, "apparel", products.Products[0].CategoryIds[0])
+}
+
+// TestGetProduct_CacheSuccessNoResult ensures that products that do not exist are cached until created.
+func TestGetProduct_CacheSuccessNoResult(t *testing.T) {
+	repo, counting := makeNewCachedRepo(t, 10, time.Minute)
+	product, err := repo.GetProduct(context.Background(), "A")
+	ok(t, err)
+	assert(t, product == nil, "expected product to be nil")
+
+	_, err = repo.CreateProduct(context.Background(), makeTestProduct("A"))
+	ok(t, err)
+	product, err = repo.GetProduct(context.Background(), "A")
+
+	ok(t, err)
+	assert(t, product != nil, "Expected product to not be nil")
+	equals(t, int32(2), counting.gets)
+}
+
+// TestGetProduct_CacheSuccessFields ensures that selections of different fields of a product are cached apart.
+func TestGetProduct_CacheSuccessFields(t *testing.T) {
+	repo, counting := makeNewCachedRepo(t, 10, time.Minute)
+	fields, err := common.ParseProductFields("id,name")
+	ok(t, err)
+
+	_, err = repo.GetProduct(context.Background(), "1")
+	ok(t, err)
+	_, err = repo.GetProduct(common.WithProductFields(context.Background(), fields), "1")
+	ok(t, err)
+
+	equals(t, int32(2), counting.gets)
+}
+
+// TestGetProduct_CacheSuccessExpired ensures that products are retrieved again once their ttl elapses.
+func TestGetProduct_CacheSuccessExpired(t *testing.T) {
+	repo, counting := makeNewCachedRepo(t, 10, time.Millisecond)
+	_, err := repo.GetProduct(context.Background(), "1")
+	ok(t, err)
+	time.Sleep(2 * time.Millisecond)
+
+	_, err = repo.GetProduct(context.Background(), "1")
+
+	ok(t, err)
+	equals(t, int32(2), counting.gets)
+}
+
+// TestGetProduct_CacheSuccessEvicted ensures that the least recently used product is evicted once the cache is full.
+func TestGetProduct_CacheSuccessEvicted(t *testing.T) {
+	repo, counting := makeNewCachedRepo(t, 2, time.Minute)
+	for _, id := range []string{"1", "2", "1", "3", "1", "2"} {
+		_, err := repo.GetProduct(context.Background(), id)
+		ok(t, err)
+	}
+
+	equals(t, int32(4), counting.gets)
+}
+
+// TestGetProduct_CacheSuccessConcurrentMisses ensures that concurrent misses of a product share a single retrieval.
+func TestGetProduct_CacheSuccessConcurrentMisses(t *testing.T) {
+	repo, counting := makeNewCachedRepo(t, 10, time.Minute)
+	counting.delay = 50 * time.Millisecond
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			product, err := repo.GetProduct(context.Background(), "1")
+			ok(t, err)
+			equals(t, "1", product.Id)
+		}()
+	}
+	wg.Wait()
+
+	equals(t, int32(1), counting.gets)
+}
+
+// TestGetProduct_CacheSuccessCancelledMiss ensures that a caller giving up on a retrieval shared with other callers
+// does not cancel it for them.
+func TestGetProduct_CacheSuccessCancelledMiss(t *testing.T) {
+	repo, counting := makeNewCachedRepo(t, 10, time.Minute)
+	counting.delay = 50 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := repo.GetProduct(ctx, "1")
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	product, err := repo.GetProduct(context.Background(), "1")
+
+	ok(t, err)
+	equals(t, "1", product.Id)
+	equals(t, context.Canceled, <-errs)
+	equals(t, int32(1), counting.gets)
+}
+
+// TestGetProducts_CacheSuccessInvalidated ensures that cached pages reflect products updated through the cache, and
+// that pages and products are retrieved again after being invalidated.
+func TestGetProducts_CacheSuccessInvalidated(t *testing.T) {
+	repo, counting := makeNewCachedRepo(t, 10, time.Minute)
+	orderBy := common.OrderBy{}
+	ok(t, orderBy.Add(common.OrderByNameDesc))
+	_, err := repo.GetProducts(context.Background(), 1, "", orderBy, common.ProductFilter{})
+	ok(t, err)
+
+	updated := makeTestProduct("1")
+	updated.Name = "~"
+	_, err = repo.UpdateProduct(context.Background(), updated)
+	ok(t, err)
+	products, err := repo.GetProducts(context.Background(), 1, "", orderBy, common.ProductFilter{})
+
+	ok(t, err)
+	equals(t, "1", products.Products[0].Id)
+	equals(t, repository.CacheStats{Hits: 0, Misses: 2}, repo.CacheStats())
+
+	_, err = repo.GetProduct(context.Background(), "2")
+	ok(t, err)
+	repo.InvalidateAll()
+	_, err = repo.GetProduct(context.Background(), "2")
+	ok(t, err)
+	_, err = repo.GetProducts(context.Background(), 1, "", orderBy, common.ProductFilter{})
+	ok(t, err)
+
+	equals(t, int32(2), counting.gets)
+	equals(t, repository.CacheStats{Hits: 0, Misses: 5}, repo.CacheStats())
+}
+
+// TestSearchProducts_CacheSuccessHit ensures that pages of search results are cached by their search text.
+func TestSearchProducts_CacheSuccessHit(t *testing.T) {
+	repo, _ := makeNewCachedRepo(t, 10, time.Minute)
+	for _, searchTxt := range []string{"test", "test", "other"} {
+		_, err := repo.SearchProducts(context.Background(), searchTxt, 5, "", common.OrderBy{},
+			common.ProductFilter{}, common.SearchOptions{})
+		ok(t, err)
+	}
+
+	equals(t, repository.CacheStats{Hits: 1, Misses: 2}, repo.CacheStats())
+}
+
+// TestReserveProduct_CacheSuccess ensures that reserving a product invalidates its cached stock.
+func TestReserveProduct_CacheSuccess(t *testing.T) {
+	repo, _ := makeNewCachedRepo(t, 10, time.Minute)
+	product, err := repo.GetProduct(context.Background(), "2")
+	ok(t, err)
+
+	_, err = repo.ReserveProduct(context.Background(), "2", 10, time.Minute)
+	ok(t, err)
+	reserved, err := repo.GetProduct(context.Background(), "2")
+
+	ok(t, err)
+	equals(t, product.QtyInStock-10, reserved.QtyInStock)
+}
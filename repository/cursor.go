@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stone1549/product-service/common"
+)
+
+// cursorVersion is incremented whenever the cursor payload changes shape, cursors of other versions are rejected.
+const cursorVersion = 1
+
+// cursorPayload is the signed content of a cursor. Values holds the sort values of the last item of a page for each of
+// the Order keys, followed by the item's id. Currency holds the currency prices were sorted in, when other than
+// common.DefaultCurrency.
+type cursorPayload struct {
+	Version  int                 `json:"v"`
+	Order    []common.OrderByKey `json:"o"`
+	Currency common.Currency     `json:"c,omitempty"`
+	Values   []*string           `json:"k"`
+	Mac      []byte              `json:"s,omitempty"`
+}
+
+// payloadCurrency returns the value of cursorPayload.Currency for the given currency.
+func payloadCurrency(currency common.Currency) common.Currency {
+	if currency == common.DefaultCurrency {
+		return ""
+	}
+
+	return currency
+}
+
+// cursorCodec encodes and decodes the opaque cursors handed to clients by every ProductRepository implementation.
+type cursorCodec struct {
+	secret []byte
+}
+
+func newCursorCodec(config common.Configuration) cursorCodec {
+	return cursorCodec{config.GetCursorSecret()}
+}
+
+func (cc cursorCodec) sign(payload cursorPayload) ([]byte, error) {
+	payload.Mac = nil
+	jsonBytes, err := json.Marshal(payload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, cc.secret)
+	mac.Write(jsonBytes)
+	return mac.Sum(nil), nil
+}
+
+// encode builds a cursor pointing after the given product for a listing sorted by order, with prices in the given
+// currency.
+func (cc cursorCodec) encode(order []common.OrderByKey, currency common.Currency, product common.Product) (string,
+	error) {
+	return cc.encodeValues(order, currency, sortValues(order, currency, product))
+}
+
+// encodeValues builds a cursor holding the given sort values, one for each key of order followed by an id, for a
+// listing sorted by order with prices in the given currency.
+func (cc cursorCodec) encodeValues(order []common.OrderByKey, currency common.Currency, values []*string) (string,
+	error) {
+	payload := cursorPayload{Version: cursorVersion, Order: order, Currency: payloadCurrency(currency),
+		Values: values}
+
+	mac, err := cc.sign(payload)
+
+	if err != nil {
+		return "", err
+	}
+
+	payload.Mac = mac
+	jsonBytes, err := json.Marshal(payload)
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(jsonBytes), nil
+}
+
+// decode verifies the given cursor was issued by this service for a listing sorted by order, with prices in the given
+// currency, and returns the sort values it holds. ErrInvalidCursor is returned for malformed, tampered or mismatched
+// cursors.
+func (cc cursorCodec) decode(order []common.OrderByKey, currency common.Currency, cursor string) ([]*string, error) {
+	var payload cursorPayload
+
+	jsonBytes, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err == nil {
+		err = json.Unmarshal(jsonBytes, &payload)
+	}
+
+	if err != nil || payload.Version != cursorVersion || len(payload.Values) != len(order)+1 {
+		return nil, ErrInvalidCursor
+	}
+
+	mac, err := cc.sign(payload)
+
+	if err != nil || !hmac.Equal(mac, payload.Mac) {
+		return nil, ErrInvalidCursor
+	}
+
+	if len(payload.Order) != len(order) || payload.Currency != payloadCurrency(currency) {
+		return nil, ErrInvalidCursor
+	}
+
+	for i, key := range order {
+		if payload.Order[i] != key {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	return payload.Values, nil
+}
+
+func timeSortValue(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+
+	str := t.Format(time.RFC3339Nano)
+	return &str
+}
+
+// sortValues retrieves the product's value for each of the given keys, with prices in the given currency, followed by
+// its id.
+func sortValues(order []common.OrderByKey, currency common.Currency, product common.Product) []*string {
+	values := make([]*string, 0, len(order)+1)
+	for _, key := range order {
+		var value *string
+		switch key {
+		case common.OrderByCreated, common.OrderByCreatedDesc:
+			value = timeSortValue(product.CreatedAt)
+		case common.OrderByUpdated, common.OrderByUpdatedDesc:
+			value = timeSortValue(product.UpdatedAt)
+		case common.OrderByName, common.OrderByNameDesc:
+			name := product.Name
+			value = &name
+		case common.OrderByPrice, common.OrderByPriceDesc:
+			if price := product.PriceIn(currency); price != nil {
+				str := price.String()
+				value = &str
+			}
+		}
+
+		values = append(values, value)
+	}
+
+	id := product.Id
+	return append(values, &id)
+}
+
+// searchSortValues retrieves the sort values of a search match like sortValues, with the given formatted score as the
+// value of common.OrderByRelevance.
+func searchSortValues(order []common.OrderByKey, currency common.Currency, product common.Product,
+	score string) []*string {
+	values := sortValues(order, currency, product)
+	for i, key := range order {
+		if key == common.OrderByRelevance {
+			values[i] = &score
+		}
+	}
+
+	return values
+}
+
+// productFromSortValues constructs a product holding the given sort values, as returned by sortValues, so that it can
+// be compared against other products.
+func productFromSortValues(order []common.OrderByKey, currency common.Currency, values []*string) (common.Product,
+	error) {
+	var product common.Product
+	for i, key := range order {
+		value := values[i]
+		if value == nil {
+			continue
+		}
+
+		switch key {
+		case common.OrderByCreated, common.OrderByCreatedDesc, common.OrderByUpdated, common.OrderByUpdatedDesc:
+			t, err := time.Parse(time.RFC3339Nano, *value)
+
+			if err != nil {
+				return product, ErrInvalidCursor
+			}
+
+			if key == common.OrderByCreated || key == common.OrderByCreatedDesc {
+				product.CreatedAt = &t
+			} else {
+				product.UpdatedAt = &t
+			}
+		case common.OrderByName, common.OrderByNameDesc:
+			product.Name = *value
+		case common.OrderByPrice, common.OrderByPriceDesc:
+			price, err := decimal.NewFromString(*value)
+
+			if err != nil {
+				return product, ErrInvalidCursor
+			}
+
+			if currency == common.DefaultCurrency {
+				product.Price = &price
+			} else {
+				product.Prices = map[common.Currency]decimal.Decimal{currency: price}
+			}
+		}
+	}
+
+	if id := values[len(values)-1]; id != nil {
+		product.Id = *id
+	}
+
+	return product, nil
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/stone1549/product-service/common"
+)
+
+// dataset holds the contents of an initial dataset file. Dataset files are either a JSON object holding categories and
+// products or, for backwards compatibility, a JSON array of products.
+type dataset struct {
+	Categories []common.Category `json:"categories"`
+	Products   []common.Product  `json:"products"`
+}
+
+func loadInitDataset(path string) (dataset, error) {
+	result := dataset{make([]common.Category, 0), make([]common.Product, 0)}
+
+	jsonBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return result, err
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(jsonBytes), []byte("[")) {
+		err = json.Unmarshal(jsonBytes, &result.Products)
+	} else {
+		err = json.Unmarshal(jsonBytes, &result)
+	}
+
+	return result, err
+}
+
+// upsertResult is the outcome of loading an entry of a dataset.
+type upsertResult int
+
+const (
+	entryUnchanged upsertResult = iota
+	entryInserted
+	entryUpdated
+)
+
+// loadCounts counts the entries of a dataset inserted, updated and left unchanged when it is loaded.
+type loadCounts struct {
+	inserted  int
+	updated   int
+	unchanged int
+}
+
+// add counts an entry loaded with the given result.
+func (lc *loadCounts) add(result upsertResult) {
+	switch result {
+	case entryInserted:
+		lc.inserted++
+	case entryUpdated:
+		lc.updated++
+	default:
+		lc.unchanged++
+	}
+}
+
+func (lc loadCounts) String() string {
+	return fmt.Sprintf("%d inserted, %d updated, %d unchanged", lc.inserted, lc.updated, lc.unchanged)
+}
+
+// contentHash returns a hash of the given dataset entry, used to recognize entries that have not changed since they
+// were last loaded.
+func contentHash(entry interface{}) (string, error) {
+	entryJson, err := json.Marshal(entry)
+
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(entryJson)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// sortCategoriesParentsFirst orders the given categories so that every category follows its parent. Entries sharing an
+// id are kept in dataset order and placed together, once the parents of all of them have been placed. Parents that are
+// not in the dataset are left to the caller to resolve, ErrCategoryCycle is returned when categories are their own
+// ancestors.
+func sortCategoriesParentsFirst(categories []common.Category) ([]common.Category, error) {
+	ids := make([]string, 0, len(categories))
+	entries := make(map[string][]common.Category)
+	for _, category := range categories {
+		if _, ok := entries[category.Id]; !ok {
+			ids = append(ids, category.Id)
+		}
+
+		entries[category.Id] = append(entries[category.Id], category)
+	}
+
+	sorted := make([]common.Category, 0, len(categories))
+	added := make(map[string]bool)
+
+	for len(added) < len(ids) {
+		progressed := false
+		for _, id := range ids {
+			if added[id] || !parentsAdded(entries[id], entries, added) {
+				continue
+			}
+
+			sorted = append(sorted, entries[id]...)
+			added[id] = true
+			progressed = true
+		}
+
+		if !progressed {
+			return nil, ErrCategoryCycle
+		}
+	}
+
+	return sorted, nil
+}
+
+// parentsAdded returns true when the parent of each of the given entries is either added or not in the dataset.
+func parentsAdded(categories []common.Category, entries map[string][]common.Category, added map[string]bool) bool {
+	for _, category := range categories {
+		if category.ParentId == nil {
+			continue
+		}
+
+		if _, ok := entries[*category.ParentId]; ok && !added[*category.ParentId] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// expandCategoryIds returns the set of the given category ids along with, when includeSubcategories is true, the ids of
+// all of their descendants.
+func expandCategoryIds(categories []common.Category, ids []string, includeSubcategories bool) map[string]bool {
+	result := make(map[string]bool)
+	for _, id := range ids {
+		result[id] = true
+	}
+
+	for includeSubcategories {
+		includeSubcategories = false
+		for _, category := range categories {
+			if !result[category.Id] && category.ParentId != nil && result[*category.ParentId] {
+				result[category.Id] = true
+				includeSubcategories = true
+			}
+		}
+	}
+
+	return result
+}
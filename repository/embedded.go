@@ -0,0 +1,1343 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/pkg/errors"
+	"github.com/stone1549/product-service/common"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// embeddedDbFile is the name of the database file of an embedded repository within its data directory.
+	embeddedDbFile = "products.db"
+	// embeddedIndexDir is the name of the search index directory of an embedded repository within its data directory.
+	embeddedIndexDir = "products.bleve"
+	// embeddedIndexVersion identifies the mapping built by newProductIndexMapping, it must be incremented whenever the
+	// mapping changes so that indexes built with the previous mapping are rebuilt.
+	embeddedIndexVersion = 1
+	// embeddedIndexBatchSize is the number of products indexed at once when an index is rebuilt.
+	embeddedIndexBatchSize = 1000
+)
+
+// Buckets of the database of an embedded repository. Products, categories and reservations are held as JSON by id,
+// variants map their SKU to the id of their product.
+var (
+	productsBucket     = []byte("products")
+	categoriesBucket   = []byte("categories")
+	variantsBucket     = []byte("variants")
+	reservationsBucket = []byte("reservations")
+	// sortedBucket holds a bucket for each embeddedSortKey, in which every product has an entry sorted by the key.
+	sortedBucket = []byte("sorted")
+	// metaBucket holds the state of the database, its indexGenerationKey counts the transactions that changed indexed
+	// products and its productCountKey counts the products, so that searches need not count them.
+	metaBucket = []byte("meta")
+	// indexGenerationKey is also the internal key of the search index recording the generation it is up to date with.
+	indexGenerationKey = []byte("indexGeneration")
+	productCountKey    = []byte("productCount")
+	// categoryHashesBucket and productHashesBucket hold the contentHash of the dataset entry each category and product
+	// was last loaded from by id.
+	categoryHashesBucket = []byte("categoryHashes")
+	productHashesBucket  = []byte("productHashes")
+)
+
+// embeddedSortKey is a key products are kept sorted by in ascending order, descending orders walk them backwards.
+type embeddedSortKey struct {
+	key      common.OrderByKey
+	currency common.Currency
+}
+
+// embeddedSortKeys returns every key products are kept sorted by.
+func embeddedSortKeys() []embeddedSortKey {
+	keys := []embeddedSortKey{{key: common.OrderByCreated}, {key: common.OrderByUpdated}, {key: common.OrderByName}}
+	for _, currency := range common.SupportedCurrencies() {
+		keys = append(keys, embeddedSortKey{common.OrderByPrice, currency})
+	}
+
+	return keys
+}
+
+// embeddedSortKeyFor returns the key products are sorted by when ordered by the given key with prices in the given
+// currency.
+func embeddedSortKeyFor(key common.OrderByKey, currency common.Currency) embeddedSortKey {
+	switch key {
+	case common.OrderByCreated, common.OrderByCreatedDesc:
+		return embeddedSortKey{key: common.OrderByCreated}
+	case common.OrderByUpdated, common.OrderByUpdatedDesc:
+		return embeddedSortKey{key: common.OrderByUpdated}
+	case common.OrderByName, common.OrderByNameDesc:
+		return embeddedSortKey{key: common.OrderByName}
+	default:
+		return embeddedSortKey{common.OrderByPrice, currency}
+	}
+}
+
+// bucket returns the name of the bucket holding the products sorted by the key.
+func (esk embeddedSortKey) bucket() []byte {
+	if esk.key == common.OrderByPrice {
+		return []byte(string(esk.key) + ":" + string(esk.currency))
+	}
+
+	return []byte(esk.key)
+}
+
+// value encodes the value of the key for the given product so that values sort bytewise as compareByKey sorts
+// products, with missing values last. Prices are encoded as floats, which may give close prices the same value.
+func (esk embeddedSortKey) value(product common.Product) []byte {
+	var value []byte
+	switch esk.key {
+	case common.OrderByCreated:
+		value = encodeSortTime(product.CreatedAt)
+	case common.OrderByUpdated:
+		value = encodeSortTime(product.UpdatedAt)
+	case common.OrderByName:
+		value = append([]byte{0}, product.Name...)
+	case common.OrderByPrice:
+		if price := product.PriceIn(esk.currency); price != nil {
+			f, _ := price.Float64()
+			bits := math.Float64bits(f)
+			if f < 0 {
+				bits = ^bits
+			} else {
+				bits |= 1 << 63
+			}
+
+			value = make([]byte, 9)
+			binary.BigEndian.PutUint64(value[1:], bits)
+		}
+	}
+
+	if value == nil {
+		return []byte{1}
+	}
+
+	return value
+}
+
+// entry returns the key of the entry of the given product in the bucket of the key, its value followed by its id.
+func (esk embeddedSortKey) entry(product common.Product) []byte {
+	return append(append(esk.value(product), 0), product.Id...)
+}
+
+// encodeSortTime encodes the given time to the second so that times sort bytewise, nil if there is no time.
+func encodeSortTime(t *time.Time) []byte {
+	if t == nil {
+		return nil
+	}
+
+	value := make([]byte, 9)
+	binary.BigEndian.PutUint64(value[1:], uint64(t.Unix())^(1<<63))
+	return value
+}
+
+// embeddedView reads and writes the products of an embedded repository within a transaction of its database.
+type embeddedView struct {
+	tx *bolt.Tx
+}
+
+func (ev embeddedView) productCount() (int, error) {
+	data := ev.tx.Bucket(metaBucket).Get(productCountKey)
+
+	if len(data) != 8 {
+		return 0, errors.New("product count is missing")
+	}
+
+	return int(binary.BigEndian.Uint64(data)), nil
+}
+
+// addProductCount adds the given delta to the number of products.
+func (ev embeddedView) addProductCount(delta int) error {
+	count, err := ev.productCount()
+
+	if err != nil {
+		return err
+	}
+
+	return ev.putProductCount(count + delta)
+}
+
+func (ev embeddedView) putProductCount(count int) error {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, uint64(count))
+	return ev.tx.Bucket(metaBucket).Put(productCountKey, data)
+}
+
+// countProducts stores the number of products unless it is stored already, as databases created before products were
+// counted do not hold it.
+func (ev embeddedView) countProducts() error {
+	if ev.tx.Bucket(metaBucket).Get(productCountKey) != nil {
+		return nil
+	}
+
+	return ev.putProductCount(ev.tx.Bucket(productsBucket).Stats().KeyN)
+}
+
+func (ev embeddedView) productById(id string) (*common.Product, error) {
+	data := ev.tx.Bucket(productsBucket).Get([]byte(id))
+
+	if data == nil {
+		return nil, nil
+	}
+
+	var product common.Product
+	err := json.Unmarshal(data, &product)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+func (ev embeddedView) allCategories() ([]common.Category, error) {
+	categories := make([]common.Category, 0)
+	err := ev.tx.Bucket(categoriesBucket).ForEach(func(_, data []byte) error {
+		var category common.Category
+		err := json.Unmarshal(data, &category)
+		categories = append(categories, category)
+		return err
+	})
+
+	return categories, err
+}
+
+func (ev embeddedView) eachProduct(fn func(product common.Product)) error {
+	return ev.tx.Bucket(productsBucket).ForEach(func(_, data []byte) error {
+		var product common.Product
+		err := json.Unmarshal(data, &product)
+
+		if err == nil {
+			fn(product)
+		}
+
+		return err
+	})
+}
+
+// productsWithIds retrieves the products with the given ids, in the order of their ids. Ids without a product are
+// skipped and products listed more than once are retrieved once.
+func (ev embeddedView) productsWithIds(ids []string) ([]common.Product, error) {
+	seen := make(map[string]bool, len(ids))
+	products := make([]common.Product, 0, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+
+		product, err := ev.productById(id)
+
+		if err != nil {
+			return products, err
+		}
+
+		if product != nil {
+			seen[id] = true
+			products = append(products, *product)
+		}
+	}
+
+	return products, nil
+}
+
+// sortedPage retrieves up to first products accepted by the given function, sorted by the given order with prices in
+// the given currency, walking the products sorted by the first key of the order from after the given last product if
+// any. Products sharing a value of the first key are sorted by the whole order before being accepted.
+func (ev embeddedView) sortedPage(order []common.OrderByKey, currency common.Currency, last *common.Product,
+	first int, accept func(product common.Product) bool) ([]common.Product, error) {
+	sortKey := embeddedSortKeyFor(order[0], currency)
+	cursor := ev.tx.Bucket(sortedBucket).Bucket(sortKey.bucket()).Cursor()
+	descending := order[0].Descending()
+
+	next := cursor.Next
+	if descending {
+		next = cursor.Prev
+	}
+
+	var k, v []byte
+	switch {
+	case last == nil && descending:
+		k, v = cursor.Last()
+	case last == nil:
+		k, v = cursor.First()
+	case descending:
+		// seek past the entries sharing the value of the last product, which are followed by a 0 byte
+		k, v = cursor.Seek(append(sortKey.value(*last), 1))
+		if k == nil {
+			k, v = cursor.Last()
+		} else {
+			k, v = cursor.Prev()
+		}
+	default:
+		k, v = cursor.Seek(sortKey.value(*last))
+	}
+
+	page := make([]common.Product, 0)
+	group := make([]common.Product, 0)
+	var groupValue []byte
+	for ; k != nil && len(page) < first; k, v = next() {
+		value := k[:len(k)-len(v)-1]
+
+		if !bytes.Equal(value, groupValue) {
+			page = appendAccepted(page, group, order, currency, first, accept)
+			group = group[:0]
+			groupValue = append(groupValue[:0], value...)
+		}
+
+		product, err := ev.productById(string(v))
+
+		if err != nil {
+			return page, err
+		}
+
+		if product != nil {
+			group = append(group, *product)
+		}
+	}
+
+	return appendAccepted(page, group, order, currency, first, accept), nil
+}
+
+// appendAccepted sorts the given products by the given order and appends those accepted by the given function to the
+// given page, until it holds first products.
+func appendAccepted(page, products []common.Product, order []common.OrderByKey, currency common.Currency, first int,
+	accept func(product common.Product) bool) []common.Product {
+	sort.Sort(&orderBySort{products, order, currency})
+	for _, product := range products {
+		if len(page) >= first {
+			break
+		}
+
+		if accept(product) {
+			page = append(page, product)
+		}
+	}
+
+	return page
+}
+
+func (ev embeddedView) categoriesExist(ids []string) bool {
+	categories := ev.tx.Bucket(categoriesBucket)
+	for _, id := range ids {
+		if categories.Get([]byte(id)) == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// variantsInUse returns true if any of the given product's variants share a SKU with a variant of another product.
+func (ev embeddedView) variantsInUse(product common.Product) bool {
+	variants := ev.tx.Bucket(variantsBucket)
+	for _, variant := range product.Variants {
+		productId := variants.Get([]byte(variant.Sku))
+
+		if productId != nil && string(productId) != product.Id {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (ev embeddedView) variantBySku(sku string) (*common.Variant, error) {
+	productId := ev.tx.Bucket(variantsBucket).Get([]byte(sku))
+
+	if productId == nil {
+		return nil, nil
+	}
+
+	product, err := ev.productById(string(productId))
+
+	if err != nil || product == nil {
+		return nil, err
+	}
+
+	for _, variant := range product.Variants {
+		if variant.Sku == sku {
+			return &variant, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (ev embeddedView) putCategory(category common.Category) error {
+	data, err := json.Marshal(category)
+
+	if err != nil {
+		return err
+	}
+
+	return ev.tx.Bucket(categoriesBucket).Put([]byte(category.Id), data)
+}
+
+// putProduct stores the given product, replacing the given existing product sharing its id if it is not nil, along
+// with its sorted entries and variants.
+func (ev embeddedView) putProduct(existing *common.Product, product common.Product) error {
+	if existing != nil {
+		err := ev.deleteProduct(*existing)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(product)
+
+	if err != nil {
+		return err
+	}
+
+	err = ev.tx.Bucket(productsBucket).Put([]byte(product.Id), data)
+
+	if err != nil {
+		return err
+	}
+
+	err = ev.addProductCount(1)
+
+	if err != nil {
+		return err
+	}
+
+	sorted := ev.tx.Bucket(sortedBucket)
+	for _, sortKey := range embeddedSortKeys() {
+		err = sorted.Bucket(sortKey.bucket()).Put(sortKey.entry(product), []byte(product.Id))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	variants := ev.tx.Bucket(variantsBucket)
+	for _, variant := range product.Variants {
+		err = variants.Put([]byte(variant.Sku), []byte(product.Id))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteProduct removes the given product as it is stored, along with its sorted entries and variants.
+func (ev embeddedView) deleteProduct(product common.Product) error {
+	sorted := ev.tx.Bucket(sortedBucket)
+	for _, sortKey := range embeddedSortKeys() {
+		err := sorted.Bucket(sortKey.bucket()).Delete(sortKey.entry(product))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	variants := ev.tx.Bucket(variantsBucket)
+	for _, variant := range product.Variants {
+		// the variant may have moved to a product stored before this one was deleted
+		if string(variants.Get([]byte(variant.Sku))) != product.Id {
+			continue
+		}
+
+		err := variants.Delete([]byte(variant.Sku))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err := ev.addProductCount(-1)
+
+	if err != nil {
+		return err
+	}
+
+	return ev.tx.Bucket(productsBucket).Delete([]byte(product.Id))
+}
+
+func (ev embeddedView) reservationById(id string) (*common.Reservation, error) {
+	data := ev.tx.Bucket(reservationsBucket).Get([]byte(id))
+
+	if data == nil {
+		return nil, nil
+	}
+
+	var reservation common.Reservation
+	err := json.Unmarshal(data, &reservation)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &reservation, nil
+}
+
+// eachReservation calls the given function with every reservation, which must not modify reservations.
+func (ev embeddedView) eachReservation(fn func(reservation common.Reservation)) error {
+	return ev.tx.Bucket(reservationsBucket).ForEach(func(_, data []byte) error {
+		var reservation common.Reservation
+		err := json.Unmarshal(data, &reservation)
+
+		if err == nil {
+			fn(reservation)
+		}
+
+		return err
+	})
+}
+
+func (ev embeddedView) putReservation(reservation common.Reservation) error {
+	data, err := json.Marshal(reservation)
+
+	if err != nil {
+		return err
+	}
+
+	return ev.tx.Bucket(reservationsBucket).Put([]byte(reservation.Id), data)
+}
+
+// indexGeneration returns the number of transactions that changed indexed products.
+func (ev embeddedView) indexGeneration() uint64 {
+	data := ev.tx.Bucket(metaBucket).Get(indexGenerationKey)
+
+	if len(data) != 8 {
+		return 0
+	}
+
+	return binary.BigEndian.Uint64(data)
+}
+
+// nextIndexGeneration advances the index generation, returning the new generation.
+func (ev embeddedView) nextIndexGeneration() (uint64, error) {
+	generation := ev.indexGeneration() + 1
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, generation)
+	return generation, ev.tx.Bucket(metaBucket).Put(indexGenerationKey, data)
+}
+
+// indexStamp encodes the given index generation along with the version of the index mapping, as recorded by a search
+// index up to date with the generation.
+func indexStamp(generation uint64) []byte {
+	stamp := make([]byte, 16)
+	binary.BigEndian.PutUint64(stamp, embeddedIndexVersion)
+	binary.BigEndian.PutUint64(stamp[8:], generation)
+	return stamp
+}
+
+// embeddedIndexChanges collects the products changed by a transaction by id, nil for products deleted, to be indexed
+// once it commits.
+type embeddedIndexChanges map[string]*common.Product
+
+func (eic embeddedIndexChanges) index(product common.Product) {
+	eic[product.Id] = &product
+}
+
+func (eic embeddedIndexChanges) delete(id string) {
+	eic[id] = nil
+}
+
+// apply indexes the changes in the given index in a single batch, recording the given generation along with them
+// unless it is zero.
+func (eic embeddedIndexChanges) apply(idx bleve.Index, generation uint64) error {
+	batch := idx.NewBatch()
+	for id, product := range eic {
+		if product == nil {
+			batch.Delete(id)
+		} else if err := batch.Index(id, newProductDocument(*product)); err != nil {
+			return err
+		}
+	}
+
+	if generation != 0 {
+		batch.SetInternal(indexGenerationKey, indexStamp(generation))
+	}
+
+	return idx.Batch(batch)
+}
+
+// embeddedProductRepository persists products to a database file with a sorted bucket for each key products can be
+// ordered by, along with a search index kept in the same directory. The search index is updated once the database
+// transactions storing changes commit, so that changes rolled back are never indexed. Each of these transactions
+// advances the index generation stored in the database, which the index records along with the changes, so that an
+// index missing changes, because indexing them failed or the process stopped first, is rebuilt when the repository is
+// opened. Until then searches may miss those changes, though their hits are still looked up in the database and
+// filtered against it.
+type embeddedProductRepository struct {
+	db    *bolt.DB
+	index bleve.Index
+	// writeLock serializes writers, so that changes are indexed in the order they were stored.
+	writeLock sync.Mutex
+	// stale is set once changes failed to be indexed, after which the index no longer records generations.
+	stale   bool
+	cursors cursorCodec
+}
+
+// update calls the given function within a database transaction, then indexes the changes it collected once the
+// transaction commits. Changes failing to be indexed remain stored and the error is returned.
+func (epr *embeddedProductRepository) update(fn func(view embeddedView, changes embeddedIndexChanges) error) error {
+	epr.writeLock.Lock()
+	defer epr.writeLock.Unlock()
+
+	changes := make(embeddedIndexChanges)
+	var generation uint64
+	err := epr.db.Update(func(tx *bolt.Tx) error {
+		view := embeddedView{tx}
+		err := fn(view, changes)
+
+		if err != nil || len(changes) == 0 {
+			return err
+		}
+
+		generation, err = view.nextIndexGeneration()
+		return err
+	})
+
+	if err != nil || len(changes) == 0 {
+		return err
+	}
+
+	if epr.stale {
+		generation = 0
+	}
+
+	err = changes.apply(epr.index, generation)
+
+	if err != nil {
+		epr.stale = true
+	}
+
+	return err
+}
+
+// GetProducts retrieves a list of the first X products matching the given filter starting from the given cursor.
+func (epr *embeddedProductRepository) GetProducts(_ context.Context, first int, cursor string,
+	orderBy common.OrderBy, filter common.ProductFilter) (ProductList, error) {
+	if orderBy.Contains(common.OrderByRelevance) {
+		return ProductList{}, ErrInvalidOrder
+	}
+
+	order := orderBy.Order()
+	currency := filter.PriceCurrency()
+
+	var last *common.Product
+	if cursor != "" {
+		values, err := epr.cursors.decode(order, currency, cursor)
+
+		if err != nil {
+			return ProductList{}, err
+		}
+
+		product, err := productFromSortValues(order, currency, values)
+
+		if err != nil {
+			return ProductList{}, err
+		}
+
+		last = &product
+	}
+
+	var page []common.Product
+	err := epr.db.View(func(tx *bolt.Tx) error {
+		view := embeddedView{tx}
+		categories, err := view.allCategories()
+
+		if err != nil {
+			return err
+		}
+
+		categoryIds := expandCategoryIds(categories, filter.CategoryIds, filter.IncludeSubcategories)
+		accept := func(product common.Product) bool {
+			return (last == nil || compareProducts(order, currency, &product, last) > 0) &&
+				matchesFilter(filter, categoryIds, product)
+		}
+
+		if len(filter.Ids) > 0 {
+			// the few products listed by the filter are quicker to sort than to look for in the sorted buckets
+			products, err := view.productsWithIds(filter.Ids)
+			page = appendAccepted(make([]common.Product, 0), products, order, currency, first, accept)
+			return err
+		}
+
+		page, err = view.sortedPage(order, currency, last, first, accept)
+		return err
+	})
+
+	if err != nil {
+		return ProductList{}, err
+	}
+
+	return newProductList(epr.cursors, order, currency, page, cursor)
+}
+
+// GetProduct retrieves a product from the given id.
+func (epr *embeddedProductRepository) GetProduct(_ context.Context, id string) (*common.Product, error) {
+	var product *common.Product
+	err := epr.db.View(func(tx *bolt.Tx) error {
+		var err error
+		product, err = embeddedView{tx}.productById(id)
+		return err
+	})
+
+	return product, err
+}
+
+// GetProductsByIds retrieves the products with the given ids, in the order of their ids. Ids without a product are
+// skipped and products requested more than once are retrieved once.
+func (epr *embeddedProductRepository) GetProductsByIds(_ context.Context, ids []string) ([]common.Product, error) {
+	var products []common.Product
+	err := epr.db.View(func(tx *bolt.Tx) error {
+		var err error
+		products, err = embeddedView{tx}.productsWithIds(ids)
+		return err
+	})
+
+	return products, err
+}
+
+// SearchProducts retrieves the first X matches satisfying the given filter starting from the given cursor, most
+// relevant first unless otherwise ordered, along with the facets requested by the given options counted across every
+// match.
+func (epr *embeddedProductRepository) SearchProducts(_ context.Context, searchTxt string, first int,
+	cursor string, orderBy common.OrderBy, filter common.ProductFilter, options common.SearchOptions) (ProductList,
+	error) {
+	var result ProductList
+	err := epr.db.View(func(tx *bolt.Tx) error {
+		var err error
+		result, err = searchIndex(epr.index, epr.cursors, embeddedView{tx}, searchTxt, first, cursor, orderBy, filter,
+			options)
+		return err
+	})
+
+	return result, err
+}
+
+// SuggestProducts retrieves up to first product names, and category names when includeCategories is true, with a word
+// starting with each word of the given prefix.
+func (epr *embeddedProductRepository) SuggestProducts(ctx context.Context, prefix string, first int,
+	includeCategories bool) (common.Suggestions, error) {
+	var result common.Suggestions
+	err := epr.db.View(func(tx *bolt.Tx) error {
+		var err error
+		result, err = suggestFromIndex(ctx, epr.index, embeddedView{tx}, prefix, first, includeCategories)
+		return err
+	})
+
+	return result, err
+}
+
+// CreateProduct stores a new product and returns it as stored.
+func (epr *embeddedProductRepository) CreateProduct(_ context.Context, product common.Product) (*common.Product,
+	error) {
+	err := epr.update(func(view embeddedView, changes embeddedIndexChanges) error {
+		existing, err := view.productById(product.Id)
+
+		if err != nil {
+			return err
+		} else if existing != nil {
+			return ErrProductExists
+		}
+
+		if !view.categoriesExist(product.CategoryIds) {
+			return ErrCategoryNotFound
+		}
+
+		if view.variantsInUse(product) {
+			return ErrVariantExists
+		}
+
+		product = withVariantProductIds(product)
+		now := time.Now().UTC()
+		product.CreatedAt = &now
+		product.UpdatedAt = &now
+
+		err = view.putProduct(nil, product)
+
+		if err != nil {
+			return err
+		}
+
+		changes.index(product)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+// UpdateProduct replaces the product sharing the given product's id and returns it as stored.
+func (epr *embeddedProductRepository) UpdateProduct(_ context.Context, product common.Product) (*common.Product,
+	error) {
+	err := epr.update(func(view embeddedView, changes embeddedIndexChanges) error {
+		existing, err := view.productById(product.Id)
+
+		if err != nil {
+			return err
+		} else if existing == nil {
+			return ErrProductNotFound
+		}
+
+		if !view.categoriesExist(product.CategoryIds) {
+			return ErrCategoryNotFound
+		}
+
+		if view.variantsInUse(product) {
+			return ErrVariantExists
+		}
+
+		product = withVariantProductIds(product)
+		now := time.Now().UTC()
+		product.CreatedAt = existing.CreatedAt
+		product.UpdatedAt = &now
+
+		err = view.putProduct(existing, product)
+
+		if err != nil {
+			return err
+		}
+
+		changes.index(product)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+// DeleteProduct removes the product with the given id.
+func (epr *embeddedProductRepository) DeleteProduct(_ context.Context, id string) error {
+	return epr.update(func(view embeddedView, changes embeddedIndexChanges) error {
+		existing, err := view.productById(id)
+
+		if err != nil {
+			return err
+		} else if existing == nil {
+			return ErrProductNotFound
+		}
+
+		err = view.deleteProduct(*existing)
+
+		if err != nil {
+			return err
+		}
+
+		// a deleted product is loaded again from the dataset, as the upsert of loadInitPostgresqlData inserts it
+		err = view.tx.Bucket(productHashesBucket).Delete([]byte(id))
+
+		if err != nil {
+			return err
+		}
+
+		reservationIds := make([][]byte, 0)
+		err = view.eachReservation(func(reservation common.Reservation) {
+			if reservation.ProductId == id {
+				reservationIds = append(reservationIds, []byte(reservation.Id))
+			}
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for _, reservationId := range reservationIds {
+			err = view.tx.Bucket(reservationsBucket).Delete(reservationId)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		changes.delete(id)
+		return nil
+	})
+}
+
+// GetCategories retrieves every category.
+func (epr *embeddedProductRepository) GetCategories(_ context.Context) ([]common.Category, error) {
+	var categories []common.Category
+	err := epr.db.View(func(tx *bolt.Tx) error {
+		var err error
+		categories, err = embeddedView{tx}.allCategories()
+		return err
+	})
+
+	return categories, err
+}
+
+// GetCategory retrieves a category from the given id.
+func (epr *embeddedProductRepository) GetCategory(_ context.Context, id string) (*common.Category, error) {
+	var category *common.Category
+	err := epr.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(categoriesBucket).Get([]byte(id))
+
+		if data == nil {
+			return nil
+		}
+
+		category = &common.Category{}
+		return json.Unmarshal(data, category)
+	})
+
+	return category, err
+}
+
+// GetVariant retrieves a product variant from the given SKU.
+func (epr *embeddedProductRepository) GetVariant(_ context.Context, sku string) (*common.Variant, error) {
+	var variant *common.Variant
+	err := epr.db.View(func(tx *bolt.Tx) error {
+		var err error
+		variant, err = embeddedView{tx}.variantBySku(sku)
+		return err
+	})
+
+	return variant, err
+}
+
+// ReserveProduct holds the given quantity of a product out of stock until the reservation is committed, released or
+// the given ttl elapses.
+func (epr *embeddedProductRepository) ReserveProduct(_ context.Context, productId string, quantity int,
+	ttl time.Duration) (*common.Reservation, error) {
+	var reservation common.Reservation
+	err := epr.update(func(view embeddedView, changes embeddedIndexChanges) error {
+		product, err := view.productById(productId)
+
+		if err != nil {
+			return err
+		} else if product == nil {
+			return ErrProductNotFound
+		} else if product.QtyInStock < quantity {
+			return ErrInsufficientStock
+		}
+
+		id, err := newReservationId()
+
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		reservation = common.Reservation{
+			Id:        id,
+			ProductId: productId,
+			Quantity:  quantity,
+			Status:    common.ReservationPending,
+			ExpiresAt: now.Add(ttl),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+
+		err = setEmbeddedQtyInStock(view, changes, *product, product.QtyInStock-quantity)
+
+		if err != nil {
+			return err
+		}
+
+		return view.putReservation(reservation)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &reservation, nil
+}
+
+// CommitReservation permanently removes the units held by an active reservation from stock.
+func (epr *embeddedProductRepository) CommitReservation(_ context.Context, productId,
+	reservationId string) (*common.Reservation, error) {
+	return epr.closeReservation(productId, reservationId, common.ReservationCommitted)
+}
+
+// ReleaseReservation returns the units held by an active reservation to stock.
+func (epr *embeddedProductRepository) ReleaseReservation(_ context.Context, productId,
+	reservationId string) (*common.Reservation, error) {
+	return epr.closeReservation(productId, reservationId, common.ReservationReleased)
+}
+
+// closeReservation moves an active reservation to the given status, returning its units to stock unless it is being
+// committed. A reservation found pending past its expiry is expired instead.
+func (epr *embeddedProductRepository) closeReservation(productId, reservationId string,
+	status common.ReservationStatus) (*common.Reservation, error) {
+	var result *common.Reservation
+	var closeErr error
+	err := epr.update(func(view embeddedView, changes embeddedIndexChanges) error {
+		reservation, err := view.reservationById(reservationId)
+
+		if err != nil {
+			return err
+		} else if reservation == nil || reservation.ProductId != productId {
+			return ErrReservationNotFound
+		}
+
+		now := time.Now().UTC()
+		if !reservation.Active(now) {
+			// the reservation is expired by the transaction, which must commit even though closing it failed
+			closeErr = ErrReservationNotActive
+
+			if reservation.Status == common.ReservationPending {
+				_, err = setEmbeddedReservationStatus(view, changes, *reservation, common.ReservationExpired, now)
+			}
+
+			return err
+		}
+
+		closed, err := setEmbeddedReservationStatus(view, changes, *reservation, status, now)
+		result = &closed
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	} else if closeErr != nil {
+		return nil, closeErr
+	}
+
+	return result, nil
+}
+
+// setEmbeddedReservationStatus stores the given reservation with the given status, returning its units to stock unless
+// it is being committed.
+func setEmbeddedReservationStatus(view embeddedView, changes embeddedIndexChanges, reservation common.Reservation,
+	status common.ReservationStatus, now time.Time) (common.Reservation, error) {
+	if status != common.ReservationCommitted {
+		product, err := view.productById(reservation.ProductId)
+
+		if err != nil {
+			return reservation, err
+		}
+
+		if product != nil {
+			err = setEmbeddedQtyInStock(view, changes, *product, product.QtyInStock+reservation.Quantity)
+
+			if err != nil {
+				return reservation, err
+			}
+		}
+	}
+
+	reservation.Status = status
+	reservation.UpdatedAt = now
+	return reservation, view.putReservation(reservation)
+}
+
+// setEmbeddedQtyInStock stores the given stock level of the given product, collecting it to be reindexed so that stock
+// filters stay accurate.
+func setEmbeddedQtyInStock(view embeddedView, changes embeddedIndexChanges, product common.Product, qty int) error {
+	updated := product
+	updated.QtyInStock = qty
+	err := view.putProduct(&product, updated)
+
+	if err != nil {
+		return err
+	}
+
+	changes.index(updated)
+	return nil
+}
+
+// ExpireReservations returns the units held by every pending reservation past its expiry to stock, returning the
+// number of reservations expired.
+func (epr *embeddedProductRepository) ExpireReservations(_ context.Context) (int, error) {
+	expired := 0
+	err := epr.update(func(view embeddedView, changes embeddedIndexChanges) error {
+		now := time.Now().UTC()
+		pending := make([]common.Reservation, 0)
+		err := view.eachReservation(func(reservation common.Reservation) {
+			if reservation.Status == common.ReservationPending && !reservation.Active(now) {
+				pending = append(pending, reservation)
+			}
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for _, reservation := range pending {
+			_, err = setEmbeddedReservationStatus(view, changes, reservation, common.ReservationExpired, now)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		expired = len(pending)
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return expired, nil
+}
+
+// Close closes the database and search index files of the repository.
+func (epr *embeddedProductRepository) Close() error {
+	err := epr.index.Close()
+
+	if dbErr := epr.db.Close(); err == nil {
+		err = dbErr
+	}
+
+	return err
+}
+
+// createEmbeddedBuckets creates the buckets of the database, those already existing are left as they are.
+func createEmbeddedBuckets(tx *bolt.Tx) error {
+	for _, name := range [][]byte{productsBucket, categoriesBucket, variantsBucket, reservationsBucket, metaBucket,
+		categoryHashesBucket, productHashesBucket} {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return err
+		}
+	}
+
+	sorted, err := tx.CreateBucketIfNotExists(sortedBucket)
+
+	if err != nil {
+		return err
+	}
+
+	for _, sortKey := range embeddedSortKeys() {
+		if _, err = sorted.CreateBucketIfNotExists(sortKey.bucket()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// upsertDatasetEntry stores the given entry of a dataset with the semantics of loadInitPostgresqlData, unless its
+// content hash matches that of the entry it was last loaded from, in which case it is left as it is even if it was
+// since changed through the repository. Deleting a product forgets its hash, so that it is stored again like a row
+// missing from PostgreSQL. exists reports whether the entry is stored and put stores it.
+func (ev embeddedView) upsertDatasetEntry(hashes []byte, id string, entry interface{}, exists bool,
+	put func() error) (upsertResult, error) {
+	hash, err := contentHash(entry)
+
+	if err != nil {
+		return entryUnchanged, err
+	}
+
+	bucket := ev.tx.Bucket(hashes)
+	if string(bucket.Get([]byte(id))) == hash {
+		return entryUnchanged, nil
+	}
+
+	err = put()
+
+	if err == nil {
+		err = bucket.Put([]byte(id), []byte(hash))
+	}
+
+	if exists {
+		return entryUpdated, err
+	}
+
+	return entryInserted, err
+}
+
+// loadEmbeddedDataset loads the dataset at the given path, entries replacing the categories and products sharing their
+// id, and logs how many entries were inserted, updated and left unchanged. The index generation is advanced if any
+// product changed, so that the search index is rebuilt.
+func loadEmbeddedDataset(view embeddedView, path string) error {
+	data, err := loadInitDataset(path)
+
+	if err != nil {
+		return err
+	}
+
+	categories, err := sortCategoriesParentsFirst(data.Categories)
+
+	if err != nil {
+		return err
+	}
+
+	var categoryCounts, productCounts loadCounts
+	for _, category := range categories {
+		exists := view.tx.Bucket(categoriesBucket).Get([]byte(category.Id)) != nil
+		result, err := view.upsertDatasetEntry(categoryHashesBucket, category.Id, category, exists, func() error {
+			return view.putCategory(category)
+		})
+
+		if err != nil {
+			return err
+		}
+
+		categoryCounts.add(result)
+	}
+
+	for _, product := range data.Products {
+		// an entry repeating the id of an earlier entry replaces the product stored from it
+		existing, err := view.productById(product.Id)
+
+		if err != nil {
+			return err
+		}
+
+		stored := withVariantProductIds(product)
+		result, err := view.upsertDatasetEntry(productHashesBucket, product.Id, product, existing != nil,
+			func() error {
+				return view.putProduct(existing, stored)
+			})
+
+		if err != nil {
+			return err
+		}
+
+		productCounts.add(result)
+	}
+
+	if productCounts.inserted > 0 || productCounts.updated > 0 {
+		if _, err = view.nextIndexGeneration(); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Loaded dataset %s, categories: %s, products: %s", path, categoryCounts, productCounts)
+	return nil
+}
+
+// openEmbeddedIndex opens the search index at the given path, rebuilding it from the products of the given database
+// unless it records the index generation stored in the database.
+func openEmbeddedIndex(path string, db *bolt.DB) (bleve.Index, error) {
+	var generation uint64
+	err := db.View(func(tx *bolt.Tx) error {
+		generation = embeddedView{tx}.indexGeneration()
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := bleve.Open(path)
+
+	if err == nil {
+		stamp, err := idx.GetInternal(indexGenerationKey)
+
+		if err == nil && bytes.Equal(stamp, indexStamp(generation)) {
+			return idx, nil
+		}
+
+		idx.Close()
+	}
+
+	// the index is missing, unreadable, missing changes or built with another mapping
+	err = os.RemoveAll(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err = bleve.New(path, newProductIndexMapping())
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		changes := embeddedIndexChanges{}
+		var indexErr error
+		err := embeddedView{tx}.eachProduct(func(product common.Product) {
+			changes.index(product)
+			if len(changes) == embeddedIndexBatchSize && indexErr == nil {
+				indexErr = changes.apply(idx, 0)
+				changes = embeddedIndexChanges{}
+			}
+		})
+
+		if err == nil {
+			err = indexErr
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// the generation is recorded by the last batch, so that an index rebuilt partially is rebuilt again
+		return changes.apply(idx, generation)
+	})
+
+	if err != nil {
+		idx.Close()
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+// MakeEmbeddedRepository constructs a ProductRepository persisting products to files in the configured data directory,
+// creating them if they do not exist yet, and loads the initial dataset into it.
+func MakeEmbeddedRepository(config common.Configuration) (ProductRepository, error) {
+	err := os.MkdirAll(config.GetDataDir(), 0700)
+
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(filepath.Join(config.GetDataDir(), embeddedDbFile), 0600, &bolt.Options{Timeout: time.Second})
+
+	if err != nil {
+		return nil, err
+	}
+
+	created := false
+	err = db.Update(func(tx *bolt.Tx) error {
+		created = tx.Bucket(productsBucket) == nil
+		err := createEmbeddedBuckets(tx)
+
+		if err != nil {
+			return err
+		}
+
+		err = embeddedView{tx}.countProducts()
+
+		if err != nil || config.GetInitDataSet() == "" {
+			return err
+		}
+
+		return loadEmbeddedDataset(embeddedView{tx}, config.GetInitDataSet())
+	})
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	indexPath := filepath.Join(config.GetDataDir(), embeddedIndexDir)
+	if created {
+		// an index left behind by a removed database is stale
+		err = os.RemoveAll(indexPath)
+
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	idx, err := openEmbeddedIndex(indexPath, db)
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &embeddedProductRepository{db: db, index: idx, cursors: newCursorCodec(config)}, nil
+}
@@ -0,0 +1,520 @@
+package repository_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/stone1549/product-service/common"
+	"github.com/stone1549/product-service/repository"
+	bolt "go.etcd.io/bbolt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// embeddedConfiguration configures an embedded repo storing its files in dataDir, loading dataset instead of the
+// dataset of the configuration it embeds when it is set.
+type embeddedConfiguration struct {
+	configuration
+	dataDir string
+	dataset string
+}
+
+func (ec embeddedConfiguration) GetRepoType() common.ProductRepositoryType {
+	return common.EmbeddedRepo
+}
+
+func (ec embeddedConfiguration) GetDataDir() string {
+	return ec.dataDir
+}
+
+func (ec embeddedConfiguration) GetInitDataSet() string {
+	if ec.dataset != "" {
+		return ec.dataset
+	}
+
+	return ec.configuration.GetInitDataSet()
+}
+
+// makeNewEmRepo constructs an embedded repo holding the small dataset in a new data directory, returning a function
+// closing the repo and removing its files.
+func makeNewEmRepo(t *testing.T) (repository.ProductRepository, embeddedConfiguration, func()) {
+	dataDir, err := ioutil.TempDir("", "product-service")
+	ok(t, err)
+
+	config := embeddedConfiguration{configuration: inMemorySmall, dataDir: dataDir}
+	repo, err := repository.NewProductRepository(config)
+	ok(t, err)
+
+	return repo, config, func() {
+		repo.(io.Closer).Close()
+		os.RemoveAll(dataDir)
+	}
+}
+
+// TestGetProduct_EmSuccessWithResult ensures a product can be retrieved from the repo by id.
+func TestGetProduct_EmSuccessWithResult(t *testing.T) {
+	repo, _, done := makeNewEmRepo(t)
+	defer done()
+	product, err := repo.GetProduct(context.Background(), "1")
+
+	ok(t, err)
+	assert(t, product != nil, "Expected product to not be nil")
+	equals(t, "1", product.Id)
+}
+
+// TestGetProduct_EmSuccessWithNoResult ensures that nil is returned if the requested product does not exist.
+func TestGetProduct_EmSuccessWithNoResult(t *testing.T) {
+	repo, _, done := makeNewEmRepo(t)
+	defer done()
+	product, err := repo.GetProduct(context.Background(), "A")
+
+	ok(t, err)
+	assert(t, product == nil, "expected product to be nil")
+}
+
+// TestGetProductsByIds_EmSuccess ensures that products are retrieved once each, in the order of their ids, skipping
+// ids without a product.
+func TestGetProductsByIds_EmSuccess(t *testing.T) {
+	repo, _, done := makeNewEmRepo(t)
+	defer done()
+	products, err := repo.GetProductsByIds(context.Background(), []string{"12", "A", "3", "12"})
+
+	ok(t, err)
+	equals(t, 2, len(products))
+	equals(t, "12", products[0].Id)
+	equals(t, "3", products[1].Id)
+}
+
+// TestGetProducts_EmSuccessMatchesInMemory ensures that products are paged through in the same order as the in memory
+// repo for each order.
+func TestGetProducts_EmSuccessMatchesInMemory(t *testing.T) {
+	repo, _, done := makeNewEmRepo(t)
+	defer done()
+	imRepo := makeNewImRepo(t)
+
+	orders := [][]common.OrderByKey{
+		nil,
+		{common.OrderByCreated},
+		{common.OrderByCreatedDesc, common.OrderByName},
+		{common.OrderByName},
+		{common.OrderByNameDesc},
+		{common.OrderByPrice},
+		{common.OrderByPriceDesc, common.OrderByUpdated},
+	}
+
+	for _, keys := range orders {
+		orderBy := common.OrderBy{}
+		for _, key := range keys {
+			ok(t, orderBy.Add(key))
+		}
+
+		expected, err := imRepo.GetProducts(context.Background(), 100, "", orderBy, common.ProductFilter{})
+		ok(t, err)
+
+		cursor := ""
+		ids := make([]string, 0)
+		for {
+			products, err := repo.GetProducts(context.Background(), 3, cursor, orderBy, common.ProductFilter{})
+			ok(t, err)
+
+			if len(products.Products) == 0 {
+				break
+			}
+
+			for _, product := range products.Products {
+				ids = append(ids, product.Id)
+			}
+			cursor = products.Cursor
+		}
+
+		expectedIds := make([]string, len(expected.Products))
+		for i, product := range expected.Products {
+			expectedIds[i] = product.Id
+		}
+
+		equals(t, expectedIds, ids)
+	}
+}
+
+// TestGetProducts_EmSuccessFilterIds ensures that only the products listed by the filter are retrieved.
+func TestGetProducts_EmSuccessFilterIds(t *testing.T) {
+	repo, _, done := makeNewEmRepo(t)
+	defer done()
+	orderBy := common.OrderBy{}
+	ok(t, orderBy.Add(common.OrderByName))
+	products, err := repo.GetProducts(context.Background(), 5, "", orderBy,
+		common.ProductFilter{Ids: []string{"3", "1", "A"}})
+
+	ok(t, err)
+	equals(t, 2, len(products.Products))
+	assert(t, products.Products[0].Name <= products.Products[1].Name, "Expected products to be sorted by name")
+}
+
+// TestSearchProducts_EmSuccess ensures that products can be searched for.
+func TestSearchProducts_EmSuccess(t *testing.T) {
+	repo, _, done := makeNewEmRepo(t)
+	defer done()
+	_, err := repo.CreateProduct(context.Background(), makeTestProduct("A"))
+	ok(t, err)
+
+	products, err := repo.SearchProducts(context.Background(), "test", 5, "", common.OrderBy{},
+		common.ProductFilter{}, common.SearchOptions{})
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, "A", products.Products[0].Id)
+}
+
+// TestSearchProducts_EmSuccessRelevancePaged ensures that paging through matches ordered by relevance alone, which the
+// index pages through, retrieves every match once in the order they are retrieved in when facets are requested, once
+// products have been deleted and after the repo is reopened.
+func TestSearchProducts_EmSuccessRelevancePaged(t *testing.T) {
+	repo, config, done := makeNewEmRepo(t)
+	defer done()
+	for i := 0; i < 13; i++ {
+		product := makeTestProduct(fmt.Sprintf("W%02d", i))
+		if i%3 == 0 {
+			product.Name = "Test Test Product"
+		}
+
+		_, err := repo.CreateProduct(context.Background(), product)
+		ok(t, err)
+	}
+
+	ok(t, repo.DeleteProduct(context.Background(), "W05"))
+	ok(t, repo.DeleteProduct(context.Background(), "1"))
+	ok(t, repo.(io.Closer).Close())
+	repo, err := repository.NewProductRepository(config)
+	ok(t, err)
+	defer repo.(io.Closer).Close()
+
+	ids := searchIds(t, repo, "test", 3, common.SearchOptions{})
+	equals(t, 12, len(ids))
+	equals(t, searchIds(t, repo, "test", 100, common.SearchOptions{Facets: common.FacetRequest{InStock: true}}), ids)
+}
+
+// TestSearchProducts_EmSuccessUncountedDatabase ensures that the products of a database created before they were
+// counted are counted when it is opened, so that searches retrieve every match.
+func TestSearchProducts_EmSuccessUncountedDatabase(t *testing.T) {
+	repo, config, done := makeNewEmRepo(t)
+	defer done()
+	options := common.SearchOptions{Facets: common.FacetRequest{InStock: true}}
+	ids := searchIds(t, repo, "portal OR time OR ray", 100, options)
+	ok(t, repo.(io.Closer).Close())
+
+	db, err := bolt.Open(filepath.Join(config.dataDir, "products.db"), 0600, nil)
+	ok(t, err)
+	ok(t, db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("meta")).Delete([]byte("productCount"))
+	}))
+	ok(t, db.Close())
+
+	repo, err = repository.NewProductRepository(config)
+	ok(t, err)
+	defer repo.(io.Closer).Close()
+
+	equals(t, ids, searchIds(t, repo, "portal OR time OR ray", 100, options))
+}
+
+// TestSearchProducts_EmSuccessDidYouMeanFirstPageOnly ensures that corrected search text is only suggested on the first
+// page.
+func TestSearchProducts_EmSuccessDidYouMeanFirstPageOnly(t *testing.T) {
+	repo, _, done := makeNewEmRepo(t)
+	defer done()
+	products, err := repo.SearchProducts(context.Background(), "Plumbis", 5, "", common.OrderBy{},
+		common.ProductFilter{}, common.SearchOptions{})
+	ok(t, err)
+	equals(t, "plumbus", products.DidYouMean)
+
+	products, err = repo.SearchProducts(context.Background(), "portal", 5, "", common.OrderBy{},
+		common.ProductFilter{}, common.SearchOptions{})
+	ok(t, err)
+	products, err = repo.SearchProducts(context.Background(), "Plumbis", 5, products.Cursor, common.OrderBy{},
+		common.ProductFilter{}, common.SearchOptions{})
+
+	ok(t, err)
+	equals(t, 0, len(products.Products))
+	equals(t, "", products.DidYouMean)
+}
+
+// TestCreateProduct_EmSuccessPersisted ensures that products stored by the repo are retrieved after it is reopened.
+func TestCreateProduct_EmSuccessPersisted(t *testing.T) {
+	repo, config, done := makeNewEmRepo(t)
+	defer done()
+	_, err := repo.CreateProduct(context.Background(), makeTestProduct("A"))
+	ok(t, err)
+	ok(t, repo.(io.Closer).Close())
+
+	repo, err = repository.NewProductRepository(config)
+	ok(t, err)
+	defer repo.(io.Closer).Close()
+
+	product, err := repo.GetProduct(context.Background(), "A")
+	ok(t, err)
+	assert(t, product != nil, "Expected product to not be nil")
+	equals(t, "Test Product", product.Name)
+
+	products, err := repo.SearchProducts(context.Background(), "test", 5, "", common.OrderBy{},
+		common.ProductFilter{}, common.SearchOptions{})
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+}
+
+// copyDir copies the files of the given directory, replacing the destination directory.
+func copyDir(t *testing.T, src, dst string) {
+	ok(t, os.RemoveAll(dst))
+	ok(t, filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, path[len(src):])
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode())
+		}
+
+		data, err := ioutil.ReadFile(path)
+
+		if err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(target, data, info.Mode())
+	}))
+}
+
+// TestCreateProduct_EmSuccessIndexRebuilt ensures that a search index missing changes stored in the database is
+// rebuilt when the repo is reopened.
+func TestCreateProduct_EmSuccessIndexRebuilt(t *testing.T) {
+	repo, config, done := makeNewEmRepo(t)
+	defer done()
+	ok(t, repo.(io.Closer).Close())
+	indexPath := filepath.Join(config.dataDir, "products.bleve")
+	copyDir(t, indexPath, indexPath+".old")
+
+	repo, err := repository.NewProductRepository(config)
+	ok(t, err)
+	_, err = repo.CreateProduct(context.Background(), makeTestProduct("A"))
+	ok(t, err)
+	ok(t, repo.(io.Closer).Close())
+	copyDir(t, indexPath+".old", indexPath)
+
+	repo, err = repository.NewProductRepository(config)
+	ok(t, err)
+	defer repo.(io.Closer).Close()
+	products, err := repo.SearchProducts(context.Background(), "test", 5, "", common.OrderBy{},
+		common.ProductFilter{}, common.SearchOptions{})
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, "A", products.Products[0].Id)
+}
+
+// TestMakeEmbeddedRepository_SuccessDatasetUpserted ensures that products repeated by a dataset are stored once, and
+// that changes to the dataset are loaded when the repo is reopened.
+func TestMakeEmbeddedRepository_SuccessDatasetUpserted(t *testing.T) {
+	repo, config, done := makeNewEmRepo(t)
+	defer done()
+	ok(t, repo.(io.Closer).Close())
+	config.dataset = filepath.Join(config.dataDir, "dataset.json")
+	ok(t, ioutil.WriteFile(config.dataset, []byte(`{"products": [
+		{"id": "A", "name": "Grumbo", "price": "1.00", "qtyInStock": 1},
+		{"id": "A", "name": "Zorp", "price": "1.00", "qtyInStock": 1}]}`), 0600))
+
+	orderBy := common.OrderBy{}
+	ok(t, orderBy.Add(common.OrderByName))
+	repo, err := repository.NewProductRepository(config)
+	ok(t, err)
+	products, err := repo.GetProducts(context.Background(), 100, "", orderBy, common.ProductFilter{})
+	ok(t, err)
+	ok(t, repo.(io.Closer).Close())
+
+	var names []string
+	for _, product := range products.Products {
+		if product.Id == "A" {
+			names = append(names, product.Name)
+		}
+	}
+	equals(t, []string{"Zorp"}, names)
+
+	ok(t, ioutil.WriteFile(config.dataset, []byte(`{"products": [
+		{"id": "A", "name": "Blamph", "price": "1.00", "qtyInStock": 1}]}`), 0600))
+	repo, err = repository.NewProductRepository(config)
+	ok(t, err)
+	defer repo.(io.Closer).Close()
+	products, err = repo.SearchProducts(context.Background(), "blamph", 5, "", common.OrderBy{},
+		common.ProductFilter{}, common.SearchOptions{})
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, "A", products.Products[0].Id)
+	products, err = repo.GetProducts(context.Background(), 100, "", orderBy, common.ProductFilter{})
+	ok(t, err)
+	for _, product := range products.Products {
+		assert(t, product.Name != "Zorp", "Expected replaced product to not be listed")
+	}
+}
+
+// TestMakeEmbeddedRepository_SuccessDatasetDeletedReloaded ensures that a product deleted through the repo is loaded
+// again from the dataset when the repo is reopened, like the pg repo inserts it again, while products changed through
+// the repo are left as they are.
+func TestMakeEmbeddedRepository_SuccessDatasetDeletedReloaded(t *testing.T) {
+	repo, config, done := makeNewEmRepo(t)
+	defer done()
+	ok(t, repo.DeleteProduct(context.Background(), "1"))
+	product, err := repo.GetProduct(context.Background(), "2")
+	ok(t, err)
+	product.Name = "Grumbo"
+	_, err = repo.UpdateProduct(context.Background(), *product)
+	ok(t, err)
+	ok(t, repo.(io.Closer).Close())
+
+	repo, err = repository.NewProductRepository(config)
+	ok(t, err)
+	defer repo.(io.Closer).Close()
+
+	product, err = repo.GetProduct(context.Background(), "1")
+	ok(t, err)
+	equals(t, "Portal Gun", product.Name)
+	product, err = repo.GetProduct(context.Background(), "2")
+	ok(t, err)
+	equals(t, "Grumbo", product.Name)
+	products, err := repo.SearchProducts(context.Background(), "portal", 5, "", common.OrderBy{},
+		common.ProductFilter{}, common.SearchOptions{})
+	ok(t, err)
+	equals(t, "1", products.Products[0].Id)
+}
+
+// TestMakeEmbeddedRepository_SuccessDatasetDuplicateCategories ensures that a dataset listing a category more than once
+// loads, the latest entry replacing earlier ones and the category's children following it.
+func TestMakeEmbeddedRepository_SuccessDatasetDuplicateCategories(t *testing.T) {
+	repo, config, done := makeNewEmRepo(t)
+	defer done()
+	ok(t, repo.(io.Closer).Close())
+	config.dataset = filepath.Join(config.dataDir, "dataset.json")
+	ok(t, ioutil.WriteFile(config.dataset, []byte(`{"categories": [
+		{"id": "sub", "name": "Sub", "parentId": "tools"},
+		{"id": "tools", "name": "Tools"},
+		{"id": "tools", "name": "Hand Tools"}]}`), 0600))
+
+	repo, err := repository.NewProductRepository(config)
+	ok(t, err)
+	defer repo.(io.Closer).Close()
+
+	category, err := repo.GetCategory(context.Background(), "tools")
+	ok(t, err)
+	equals(t, "Hand Tools", category.Name)
+	category, err = repo.GetCategory(context.Background(), "sub")
+	ok(t, err)
+	equals(t, "tools", *category.ParentId)
+}
+
+// TestMakeEmbeddedRepository_FailDatasetCategoryCycle ensures that a dataset whose categories are their own ancestors
+// is rejected.
+func TestMakeEmbeddedRepository_FailDatasetCategoryCycle(t *testing.T) {
+	repo, config, done := makeNewEmRepo(t)
+	defer done()
+	ok(t, repo.(io.Closer).Close())
+	config.dataset = filepath.Join(config.dataDir, "dataset.json")
+	ok(t, ioutil.WriteFile(config.dataset, []byte(`{"categories": [
+		{"id": "a", "name": "A", "parentId": "b"},
+		{"id": "b", "name": "B", "parentId": "a"}]}`), 0600))
+
+	_, err := repository.NewProductRepository(config)
+
+	equals(t, repository.ErrCategoryCycle, err)
+}
+
+// TestCreateProduct_EmFailExists ensures a product can not be created with an id that is already in use.
+func TestCreateProduct_EmFailExists(t *testing.T) {
+	repo, _, done := makeNewEmRepo(t)
+	defer done()
+	_, err := repo.CreateProduct(context.Background(), makeTestProduct("1"))
+
+	equals(t, repository.ErrProductExists, err)
+}
+
+// TestUpdateProduct_EmSuccess ensures an existing product can be replaced and is reordered accordingly.
+func TestUpdateProduct_EmSuccess(t *testing.T) {
+	repo, _, done := makeNewEmRepo(t)
+	defer done()
+	existing, err := repo.GetProduct(context.Background(), "1")
+	ok(t, err)
+
+	updated := makeTestProduct("1")
+	updated.Name = "~"
+	product, err := repo.UpdateProduct(context.Background(), updated)
+
+	ok(t, err)
+	equals(t, existing.CreatedAt, product.CreatedAt)
+
+	orderBy := common.OrderBy{}
+	ok(t, orderBy.Add(common.OrderByNameDesc))
+	products, err := repo.GetProducts(context.Background(), 1, "", orderBy, common.ProductFilter{})
+
+	ok(t, err)
+	equals(t, "1", products.Products[0].Id)
+}
+
+// TestDeleteProduct_EmFailNotFound ensures that deleting a product that does not exist fails.
+func TestDeleteProduct_EmFailNotFound(t *testing.T) {
+	repo, _, done := makeNewEmRepo(t)
+	defer done()
+
+	equals(t, repository.ErrProductNotFound, repo.DeleteProduct(context.Background(), "A"))
+}
+
+// TestGetCategory_EmSuccessWithResult ensures a category can be retrieved by id.
+func TestGetCategory_EmSuccessWithResult(t *testing.T) {
+	repo, _, done := makeNewEmRepo(t)
+	defer done()
+	category, err := repo.GetCategory(context.Background(), "weapons")
+
+	ok(t, err)
+	assert(t, category != nil, "Expected category to not be nil")
+	equals(t, "gadgets", *category.ParentId)
+}
+
+// TestCommitReservation_EmSuccess ensures that committing a reservation keeps its units out of stock and that it can
+// not be closed again.
+func TestCommitReservation_EmSuccess(t *testing.T) {
+	repo, _, done := makeNewEmRepo(t)
+	defer done()
+	reservation, err := repo.ReserveProduct(context.Background(), "2", 10, time.Minute)
+	ok(t, err)
+
+	reservation, err = repo.CommitReservation(context.Background(), "2", reservation.Id)
+
+	ok(t, err)
+	equals(t, common.ReservationCommitted, reservation.Status)
+	product, err := repo.GetProduct(context.Background(), "2")
+	ok(t, err)
+	equals(t, 990, product.QtyInStock)
+
+	_, err = repo.ReleaseReservation(context.Background(), "2", reservation.Id)
+	equals(t, repository.ErrReservationNotActive, err)
+}
+
+// TestExpireReservations_EmSuccess ensures that expired reservations return their units to stock and can no longer be
+// committed.
+func TestExpireReservations_EmSuccess(t *testing.T) {
+	repo, _, done := makeNewEmRepo(t)
+	defer done()
+	reservation, err := repo.ReserveProduct(context.Background(), "2", 10, time.Nanosecond)
+	ok(t, err)
+	time.Sleep(time.Millisecond)
+
+	expired, err := repo.ExpireReservations(context.Background())
+
+	ok(t, err)
+	equals(t, 1, expired)
+	product, err := repo.GetProduct(context.Background(), "2")
+	ok(t, err)
+	equals(t, 1000, product.QtyInStock)
+
+	_, err = repo.CommitReservation(context.Background(), "2", reservation.Id)
+	equals(t, repository.ErrReservationNotActive, err)
+}
@@ -13,3 +13,36 @@ func (er errRepository) Error() string {
 func newErrRepository(msg string) error {
 	return errRepository{errors.New(msg)}
 }
+
+var (
+	// ErrProductExists is returned when attempting to create a product with an id that is already in use.
+	ErrProductExists = newErrRepository("product already exists")
+	// ErrProductNotFound is returned when attempting to modify a product that does not exist.
+	ErrProductNotFound = newErrRepository("product not found")
+	// ErrCategoryNotFound is returned when attempting to assign a product to a category that does not exist.
+	ErrCategoryNotFound = newErrRepository("category not found")
+	// ErrVariantExists is returned when attempting to store a variant with a SKU that is already in use by another
+	// product.
+	ErrVariantExists = newErrRepository("variant already exists")
+	// ErrInsufficientStock is returned when attempting to reserve more units of a product than are in stock.
+	ErrInsufficientStock = newErrRepository("insufficient stock")
+	// ErrReservationNotFound is returned when attempting to modify a reservation that does not exist.
+	ErrReservationNotFound = newErrRepository("reservation not found")
+	// ErrReservationNotActive is returned when attempting to modify a reservation that has already been committed,
+	// released or has expired.
+	ErrReservationNotActive = newErrRepository("reservation is no longer active")
+	// ErrCategoryCycle is returned when the categories of a dataset are their own ancestors.
+	ErrCategoryCycle = newErrRepository("dataset categories form a cycle")
+	// ErrInvalidSearch is returned when search text does not contain any words a product is required to match.
+	ErrInvalidSearch = newErrRepository("search text must contain at least one word to match")
+	// ErrInvalidCursor is returned when a cursor is malformed, has been tampered with or was issued for a different
+	// order.
+	ErrInvalidCursor = newErrRepository("invalid cursor")
+	// ErrInvalidOrder is returned when products are ordered by relevance outside of a search.
+	ErrInvalidOrder = newErrRepository("products can only be ordered by relevance when searching")
+	// ErrSchemaOutdated is returned when a migration of the PostgreSQL schema has not been applied.
+	ErrSchemaOutdated = newErrRepository("database schema is outdated, run the migrate up command")
+	// ErrSchemaUnknown is returned when a migration of the PostgreSQL schema unknown to this version of the service has
+	// been applied.
+	ErrSchemaUnknown = newErrRepository("database schema is newer than this version of the service")
+)
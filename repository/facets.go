@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/shopspring/decimal"
+	"github.com/stone1549/product-service/common"
+)
+
+// priceBucket returns the index of the range bounded by the given boundaries that the given price falls in, 0 for
+// prices below the first boundary.
+func priceBucket(boundaries []decimal.Decimal, price decimal.Decimal) int {
+	return sort.Search(len(boundaries), func(i int) bool {
+		return boundaries[i].GreaterThan(price)
+	})
+}
+
+// newPriceFacet builds the price facet from the number of matches in each range bounded by the given boundaries.
+// Ranges without matches are included so that clients always receive the same ranges.
+func newPriceFacet(boundaries []decimal.Decimal, counts []int) common.Facet {
+	facet := common.Facet{Name: common.FacetPrice, Buckets: make([]common.FacetBucket, len(boundaries)+1)}
+	for i := range facet.Buckets {
+		var bucket common.FacetBucket
+		if i > 0 {
+			bucket.Min = &boundaries[i-1]
+			bucket.Value = boundaries[i-1].String()
+		}
+
+		bucket.Value += "-"
+		if i < len(boundaries) {
+			bucket.Max = &boundaries[i]
+			bucket.Value += boundaries[i].String()
+		}
+
+		if i < len(counts) {
+			bucket.Count = counts[i]
+		}
+
+		facet.Buckets[i] = bucket
+	}
+
+	return facet
+}
+
+// newInStockFacet builds the in stock facet from the number of matches with and without stock on hand.
+func newInStockFacet(inStock, outOfStock int) common.Facet {
+	return common.Facet{Name: common.FacetInStock, Buckets: []common.FacetBucket{
+		{Value: strconv.FormatBool(true), Count: inStock},
+		{Value: strconv.FormatBool(false), Count: outOfStock},
+	}}
+}
+
+// newValueFacet builds a facet from the number of matches for each value, most frequent values first.
+func newValueFacet(name string, counts map[string]int) common.Facet {
+	facet := common.Facet{Name: name, Buckets: make([]common.FacetBucket, 0, len(counts))}
+	for value, count := range counts {
+		facet.Buckets = append(facet.Buckets, common.FacetBucket{Value: value, Count: count})
+	}
+
+	sort.Slice(facet.Buckets, func(i, j int) bool {
+		if facet.Buckets[i].Count != facet.Buckets[j].Count {
+			return facet.Buckets[i].Count > facet.Buckets[j].Count
+		}
+
+		return facet.Buckets[i].Value < facet.Buckets[j].Value
+	})
+	return facet
+}
+
+// computeFacets counts the given products for each facet of the given request, with prices in the given currency.
+func computeFacets(request common.FacetRequest, currency common.Currency, products []common.Product) []common.Facet {
+	var facets []common.Facet
+
+	if request.Price {
+		counts := make([]int, len(request.PriceBoundaries)+1)
+		for _, product := range products {
+			if price := product.PriceIn(currency); price != nil {
+				counts[priceBucket(request.PriceBoundaries, *price)]++
+			}
+		}
+
+		facets = append(facets, newPriceFacet(request.PriceBoundaries, counts))
+	}
+
+	if request.InStock {
+		inStock := 0
+		for _, product := range products {
+			if product.QtyInStock > 0 {
+				inStock++
+			}
+		}
+
+		facets = append(facets, newInStockFacet(inStock, len(products)-inStock))
+	}
+
+	if request.Category {
+		counts := make(map[string]int)
+		for _, product := range products {
+			for _, categoryId := range product.CategoryIds {
+				counts[categoryId]++
+			}
+		}
+
+		facets = append(facets, newValueFacet(common.FacetCategory, counts))
+	}
+
+	for _, option := range request.Options {
+		counts := make(map[string]int)
+		for _, product := range products {
+			seen := make(map[string]bool)
+			for _, variant := range product.Variants {
+				if value, ok := variant.Options[option]; ok && !seen[value] {
+					seen[value] = true
+					counts[value]++
+				}
+			}
+		}
+
+		facets = append(facets, newValueFacet(common.FacetOptionPrefix+option, counts))
+	}
+
+	return facets
+}
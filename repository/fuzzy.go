@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"github.com/stone1549/product-service/common"
+	"strings"
+)
+
+// vocabularyWord is a word of the searchable text of products along with the number of products it appears in.
+type vocabularyWord struct {
+	word  string
+	count int
+}
+
+// fuzzyWords returns the words of the given query that may match fuzzily, those of required terms that are neither
+// phrases nor prefixes.
+func fuzzyWords(query common.SearchQuery) []string {
+	var words []string
+	for _, group := range query.Required {
+		for _, term := range group {
+			if len(term.Words) == 1 && !term.Prefix && common.Fuzziness(term.Words[0]) > 0 {
+				words = append(words, term.Words[0])
+			}
+		}
+	}
+
+	return words
+}
+
+// closeWords returns the given candidates that are within the fuzziness of the given word.
+func closeWords(word string, candidates []vocabularyWord) []vocabularyWord {
+	var result []vocabularyWord
+	for _, candidate := range candidates {
+		if common.EditDistance(word, candidate.word) <= common.Fuzziness(word) {
+			result = append(result, candidate)
+		}
+	}
+
+	return result
+}
+
+// expandFuzzyQuery returns a copy of the given query in which every word that may match fuzzily also matches any of
+// its close candidates.
+func expandFuzzyQuery(query common.SearchQuery, candidates map[string][]vocabularyWord) common.SearchQuery {
+	result := common.SearchQuery{Excluded: query.Excluded}
+	for _, group := range query.Required {
+		var alternatives []common.SearchTerm
+		for _, term := range group {
+			alternatives = append(alternatives, term)
+			if len(term.Words) != 1 || term.Prefix {
+				continue
+			}
+
+			for _, candidate := range closeWords(term.Words[0], candidates[term.Words[0]]) {
+				if candidate.word != term.Words[0] {
+					alternatives = append(alternatives, common.SearchTerm{Words: []string{candidate.word}})
+				}
+			}
+		}
+
+		result.Required = append(result.Required, alternatives)
+	}
+
+	return result
+}
+
+// suggestsCorrection reports whether the given page of search results, retrieved from the given cursor, suggests
+// corrected search text in DidYouMean, which only a first page without any product does. Later pages run out of
+// matches without the search text being any less correct.
+func suggestsCorrection(result ProductList, cursor string) bool {
+	return len(result.Products) == 0 && strings.TrimSpace(cursor) == ""
+}
+
+// didYouMean rewrites the given search text replacing every word that may match fuzzily, but does not appear in any
+// product, with its closest candidate, preferring candidates appearing in more products then alphabetically. An empty
+// string is returned if no word could be corrected.
+func didYouMean(searchTxt string, query common.SearchQuery, candidates map[string][]vocabularyWord) string {
+	corrections := make(map[string]string)
+	for _, word := range fuzzyWords(query) {
+		var best *vocabularyWord
+		bestDistance := 0
+		for _, candidate := range closeWords(word, candidates[word]) {
+			distance := common.EditDistance(word, candidate.word)
+
+			if distance == 0 {
+				best = nil
+				break
+			}
+
+			if best == nil || distance < bestDistance || (distance == bestDistance && (candidate.count > best.count ||
+				(candidate.count == best.count && candidate.word < best.word))) {
+				closest := candidate
+				best = &closest
+				bestDistance = distance
+			}
+		}
+
+		if best != nil {
+			corrections[word] = best.word
+		}
+	}
+
+	if len(corrections) == 0 {
+		return ""
+	}
+
+	return common.ReplaceSearchWords(searchTxt, corrections)
+}
@@ -2,24 +2,112 @@ package repository
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"github.com/blevesearch/bleve"
 	"github.com/shopspring/decimal"
 	"github.com/stone1549/product-service/common"
-	"io/ioutil"
+	"log"
 	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// inMemoryCatalog is a snapshot of the products and categories of an inMemoryProductRepository. Catalogs are never
+// modified once published, writers publish a modified copy instead so that readers never wait on them.
+type inMemoryCatalog struct {
+	products   map[string]common.Product
+	categories []common.Category
+	// sorted maps the sortedIndexKey of each order the products have been retrieved by to their *sortedIndex, readers
+	// add indexes as they need them.
+	sorted sync.Map
+}
+
+// inMemoryProductRepository reads products from the current inMemoryCatalog, which writers replace one at a time. The
+// search index is updated in place, writers change it and publish the catalog holding the same changes while holding
+// indexLock, which searches hold for reading so that the index they match text against always matches the catalog
+// they retrieve products from.
 type inMemoryProductRepository struct {
-	products []common.Product
-	index    bleve.Index
+	// catalog holds the current *inMemoryCatalog.
+	catalog atomic.Value
+	// writeLock serializes writers, it also guards reservations as readers never access them.
+	writeLock sync.Mutex
+	// indexLock pairs the index with the current catalog, writers only hold it while publishing a catalog.
+	indexLock    sync.RWMutex
+	reservations map[string]common.Reservation
+	index        bleve.Index
+	cursors      cursorCodec
+}
+
+// newInMemoryCatalog builds a catalog holding the given products and categories.
+func newInMemoryCatalog(products map[string]common.Product, categories []common.Category) *inMemoryCatalog {
+	return &inMemoryCatalog{products: products, categories: categories}
+}
+
+// current returns the catalog to read products from.
+func (impr *inMemoryProductRepository) current() *inMemoryCatalog {
+	return impr.catalog.Load().(*inMemoryCatalog)
+}
+
+// publish applies the given batch of changes to the search index and publishes the given catalog holding the same
+// changes, callers must hold the write lock. Nothing is published if the index fails to apply the batch.
+func (impr *inMemoryProductRepository) publish(catalog *inMemoryCatalog, batch *bleve.Batch) error {
+	impr.indexLock.Lock()
+	defer impr.indexLock.Unlock()
+
+	err := impr.index.Batch(batch)
+
+	if err != nil {
+		return err
+	}
+
+	impr.catalog.Store(catalog)
+	return nil
+}
+
+// searchable returns the search index along with the catalog it matches, which stay paired until the returned function
+// is called.
+func (impr *inMemoryProductRepository) searchable() (bleve.Index, *inMemoryCatalog, func()) {
+	impr.indexLock.RLock()
+	return impr.index, impr.current(), impr.indexLock.RUnlock
+}
+
+// edit returns a copy of the catalog for a writer to modify before publishing it, which costs time proportional to the
+// number of products.
+func (imc *inMemoryCatalog) edit() *inMemoryCatalog {
+	catalog := &inMemoryCatalog{products: make(map[string]common.Product, len(imc.products)),
+		categories: imc.categories}
+	for id, product := range imc.products {
+		catalog.products[id] = product
+	}
+
+	imc.sorted.Range(func(key, index interface{}) bool {
+		catalog.sorted.Store(key, index)
+		return true
+	})
+
+	return catalog
+}
+
+func (imc *inMemoryCatalog) productCount() (int, error) {
+	return len(imc.products), nil
+}
+
+func (imc *inMemoryCatalog) productById(id string) (*common.Product, error) {
+	if product, ok := imc.products[id]; ok {
+		return &product, nil
+	}
+
+	return nil, nil
+}
+
+func (imc *inMemoryCatalog) allCategories() ([]common.Category, error) {
+	return imc.categories, nil
 }
 
 type orderBySort struct {
 	Products []common.Product
-	Order    common.OrderBy
+	Order    []common.OrderByKey
+	Currency common.Currency
 }
 
 func (obs *orderBySort) Len() int {
@@ -30,6 +118,10 @@ func (obs *orderBySort) Swap(i, j int) {
 	obs.Products[i], obs.Products[j] = obs.Products[j], obs.Products[i]
 }
 
+func (obs *orderBySort) Less(i, j int) bool {
+	return compareProducts(obs.Order, obs.Currency, &obs.Products[i], &obs.Products[j]) < 0
+}
+
 func compareTimePtr(a, b *time.Time) int {
 	if a == nil && b == nil {
 		return 0
@@ -75,224 +167,738 @@ func compareDecimalPtr(a, b *decimal.Decimal) int {
 		return -1
 	}
 
-	if *a == *b {
-		return 0
-	} else if a.LessThan(*b) {
-		return -1
-	} else {
-		return 1
+	return a.Cmp(*b)
+}
+
+func compareByKey(key common.OrderByKey, currency common.Currency, a, b *common.Product) int {
+	var value int
+	switch key {
+	case common.OrderByCreated, common.OrderByCreatedDesc:
+		value = compareTimePtr(a.CreatedAt, b.CreatedAt)
+	case common.OrderByUpdated, common.OrderByUpdatedDesc:
+		value = compareTimePtr(a.UpdatedAt, b.UpdatedAt)
+	case common.OrderByName, common.OrderByNameDesc:
+		value = compareStrPtr(&a.Name, &b.Name)
+	case common.OrderByPrice, common.OrderByPriceDesc:
+		value = compareDecimalPtr(a.PriceIn(currency), b.PriceIn(currency))
 	}
+
+	if key.Descending() {
+		return value * -1
+	}
+
+	return value
 }
 
-func (obs *orderBySort) Less(i, j int) bool {
-	for _, key := range obs.Order.Order() {
-		switch key {
-		case common.OrderByCreated:
-			value := compareTimePtr(obs.Products[i].CreatedAt, obs.Products[j].CreatedAt)
-			if value == 0 {
-				continue
-			} else {
-				return value < 0
-			}
-		case common.OrderByCreatedDesc:
-			value := compareTimePtr(obs.Products[i].CreatedAt, obs.Products[j].CreatedAt) * -1
-			if value == 0 {
-				continue
-			} else {
-				return value < 0
-			}
-		case common.OrderByUpdated:
-			value := compareTimePtr(obs.Products[i].UpdatedAt, obs.Products[j].UpdatedAt)
-			if value == 0 {
-				continue
-			} else {
-				return value < 0
-			}
-		case common.OrderByUpdatedDesc:
-			value := compareTimePtr(obs.Products[i].UpdatedAt, obs.Products[j].UpdatedAt) * -1
-			if value == 0 {
-				continue
-			} else {
-				return value < 0
-			}
-		case common.OrderByName:
-			value := compareStrPtr(&obs.Products[i].Name, &obs.Products[j].Name)
-			if value == 0 {
-				continue
-			} else {
-				return value < 0
-			}
-		case common.OrderByNameDesc:
-			value := compareStrPtr(&obs.Products[i].Name, &obs.Products[j].Name) * -1
-			if value == 0 {
-				continue
-			} else {
-				return value < 0
-			}
-		case common.OrderByPrice:
-			value := compareDecimalPtr(obs.Products[i].Price, obs.Products[j].Price)
-			if value == 0 {
-				continue
-			} else {
-				return value < 0
+// compareProducts compares a and b by each of the given keys in turn, with prices in the given currency, falling back
+// to comparing their ids in the direction of the final key so that every product has a distinct position.
+func compareProducts(order []common.OrderByKey, currency common.Currency, a, b *common.Product) int {
+	for _, key := range order {
+		if value := compareByKey(key, currency, a, b); value != 0 {
+			return value
+		}
+	}
+
+	value := compareStrPtr(&a.Id, &b.Id)
+	if len(order) > 0 && order[len(order)-1].Descending() {
+		return value * -1
+	}
+
+	return value
+}
+
+// matchesFilter returns true if the given product satisfies every criteria of the given filter. categoryIds holds the
+// filter's category ids expanded by expandCategoryIds.
+func matchesFilter(filter common.ProductFilter, categoryIds map[string]bool, product common.Product) bool {
+	price := product.PriceIn(filter.PriceCurrency())
+
+	if price == nil && filter.PriceCurrency() != common.DefaultCurrency {
+		return false
+	}
+
+	if filter.MinPrice != nil && (price == nil || price.LessThan(*filter.MinPrice)) {
+		return false
+	}
+
+	if filter.MaxPrice != nil && (price == nil || price.GreaterThan(*filter.MaxPrice)) {
+		return false
+	}
+
+	if filter.InStock != nil && *filter.InStock != (product.QtyInStock > 0) {
+		return false
+	}
+
+	if filter.CreatedAfter != nil && (product.CreatedAt == nil || !product.CreatedAt.After(*filter.CreatedAfter)) {
+		return false
+	}
+
+	if filter.UpdatedSince != nil && (product.UpdatedAt == nil || product.UpdatedAt.Before(*filter.UpdatedSince)) {
+		return false
+	}
+
+	if len(filter.Ids) > 0 {
+		found := false
+		for _, id := range filter.Ids {
+			if id == product.Id {
+				found = true
+				break
 			}
-		case common.OrderByPriceDesc:
-			value := compareDecimalPtr(obs.Products[i].Price, obs.Products[j].Price) * -1
-			if value == 0 {
-				continue
-			} else {
-				return value > 0
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if len(filter.CategoryIds) > 0 {
+		found := false
+		for _, id := range product.CategoryIds {
+			if categoryIds[id] {
+				found = true
+				break
 			}
-		default:
-			continue
+		}
+
+		if !found {
+			return false
 		}
 	}
 
-	return false
+	return true
 }
 
-// GetProducts retrieves a list of the first X products starting from the given cursor.
+// GetProducts retrieves a list of the first X products matching the given filter starting from the given cursor.
 func (impr *inMemoryProductRepository) GetProducts(_ context.Context, first int, cursor string,
-	orderBy common.OrderBy) (ProductList, error) {
-	products := make([]common.Product, 0)
+	orderBy common.OrderBy, filter common.ProductFilter) (ProductList, error) {
+	if orderBy.Contains(common.OrderByRelevance) {
+		return ProductList{}, ErrInvalidOrder
+	}
 
-	newCursor := cursor
-	reachedCursor := false
-	if cursor == "" {
-		reachedCursor = true
+	catalog := impr.current()
+	order := orderBy.Order()
+	currency := filter.PriceCurrency()
+	categoryIds := expandCategoryIds(catalog.categories, filter.CategoryIds, filter.IncludeSubcategories)
+
+	var ids []string
+	if len(filter.Ids) > 0 {
+		// the few products listed by the filter are quicker to sort than to look for in an index
+		ids = sortProducts(order, currency, catalog.productsWithIds(filter.Ids))
+	} else {
+		ids = catalog.sortedIds(order, currency)
 	}
 
-	sortedProducts := make([]common.Product, len(impr.products))
-	copy(sortedProducts, impr.products)
-	sortByOrderBy := orderBySort{sortedProducts, orderBy}
-	sort.Sort(&sortByOrderBy)
+	start := 0
+	if cursor != "" {
+		values, err := impr.cursors.decode(order, currency, cursor)
+
+		if err != nil {
+			return ProductList{}, err
+		}
+
+		last, err := productFromSortValues(order, currency, values)
+
+		if err != nil {
+			return ProductList{}, err
+		}
+
+		start = sort.Search(len(ids), func(i int) bool {
+			product := catalog.products[ids[i]]
+			return compareProducts(order, currency, &product, &last) > 0
+		})
+	}
 
-	for _, product := range sortByOrderBy.Products {
-		if len(products) == first {
+	page := make([]common.Product, 0)
+	for _, id := range ids[start:] {
+		if len(page) >= first {
 			break
-		} else if product.Id == cursor {
-			reachedCursor = true
-			continue
-		} else if reachedCursor {
-			productCopy := product
-			products = append(products, productCopy)
-			newCursor = productCopy.Id
+		}
+
+		if product := catalog.products[id]; matchesFilter(filter, categoryIds, product) {
+			page = append(page, product)
 		}
 	}
-	return ProductList{products, newCursor}, nil
+
+	return newProductList(impr.cursors, order, currency, page, cursor)
 }
 
-func findProductById(products []common.Product, id string) (*common.Product, error) {
-	for _, product := range products {
-		if id == product.Id {
-			return &product, nil
+// sortedIds returns the ids of every product sorted by the given order with prices in the given currency, building an
+// index for the order the first time it is requested.
+func (imc *inMemoryCatalog) sortedIds(order []common.OrderByKey, currency common.Currency) []string {
+	currency = indexCurrency(order, currency)
+	key := sortedIndexKey(order, currency)
+
+	index, ok := imc.sorted.Load(key)
+	if !ok {
+		// concurrent readers may build the same index, only one of them is kept
+		index, _ = imc.sorted.LoadOrStore(key, newSortedIndex(order, currency, imc.products))
+	}
+
+	return index.(*sortedIndex).ids
+}
+
+// storeProduct stores the given product in a catalog being edited, replacing the product sharing its id if any, and
+// moves it within every index it no longer sorts at the same position in.
+func (imc *inMemoryCatalog) storeProduct(product common.Product) {
+	existing, exists := imc.products[product.Id]
+	moved := make(map[interface{}]*sortedIndex)
+	imc.sorted.Range(func(key, value interface{}) bool {
+		index := value.(*sortedIndex)
+		if !exists {
+			moved[key] = index
+		} else if compareProducts(index.order, index.currency, &existing, &product) != 0 {
+			moved[key] = index.removed(imc.products, existing)
 		}
+
+		return true
+	})
+
+	imc.products[product.Id] = product
+	for key, index := range moved {
+		imc.sorted.Store(key, index.inserted(imc.products, product))
 	}
+}
 
-	return nil, nil
+// removeProduct removes the product with the given id from a catalog being edited, along with every index.
+func (imc *inMemoryCatalog) removeProduct(id string) {
+	product, ok := imc.products[id]
+
+	if !ok {
+		return
+	}
+
+	imc.sorted.Range(func(key, value interface{}) bool {
+		imc.sorted.Store(key, value.(*sortedIndex).removed(imc.products, product))
+		return true
+	})
+
+	delete(imc.products, id)
+}
+
+// productsWithIds retrieves the products with the given ids, in the order of their ids. Ids without a product are
+// skipped and products listed more than once are retrieved once.
+func (imc *inMemoryCatalog) productsWithIds(ids []string) []common.Product {
+	seen := make(map[string]bool, len(ids))
+	products := make([]common.Product, 0, len(ids))
+	for _, id := range ids {
+		if product, ok := imc.products[id]; ok && !seen[id] {
+			seen[id] = true
+			products = append(products, product)
+		}
+	}
+
+	return products
+}
+
+// newProductList builds a ProductList holding the given page of products, along with cursors encoded by the given codec
+// pointing after each of them and a cursor pointing after the last of them or the current cursor if the page is empty.
+func newProductList(cursors cursorCodec, order []common.OrderByKey, currency common.Currency,
+	products []common.Product, cursor string) (ProductList, error) {
+	result := ProductList{Products: products, Cursor: cursor, Cursors: make([]string, len(products))}
+	for i, product := range products {
+		var err error
+		result.Cursors[i], err = cursors.encode(order, currency, product)
+
+		if err != nil {
+			return result, err
+		}
+
+		result.Cursor = result.Cursors[i]
+	}
+
+	return result, nil
 }
 
 // GetProduct retrieves a product from the given id.
 func (impr *inMemoryProductRepository) GetProduct(_ context.Context, id string) (*common.Product, error) {
-	return findProductById(impr.products, id)
+	return impr.current().productById(id)
+}
+
+// GetProductsByIds retrieves the products with the given ids, in the order of their ids. Ids without a product are
+// skipped and products requested more than once are retrieved once.
+func (impr *inMemoryProductRepository) GetProductsByIds(_ context.Context, ids []string) ([]common.Product, error) {
+	return impr.current().productsWithIds(ids), nil
 }
 
-// SearchProducts retrieves the first X matches starting from the given cursor.
-func (impr *inMemoryProductRepository) SearchProducts(ctx context.Context, searchTxt string, first int,
-	cursor string) (ProductList, error) {
-	query := bleve.NewMatchQuery(searchTxt)
-	search := bleve.NewSearchRequest(query)
-	searchResults, err := impr.index.Search(search)
+// SearchProducts retrieves the first X matches satisfying the given filter starting from the given cursor, most
+// relevant first unless otherwise ordered, along with the facets requested by the given options counted across every
+// match.
+func (impr *inMemoryProductRepository) SearchProducts(_ context.Context, searchTxt string, first int,
+	cursor string, orderBy common.OrderBy, filter common.ProductFilter, options common.SearchOptions) (ProductList,
+	error) {
+	idx, catalog, done := impr.searchable()
+	defer done()
+
+	return searchIndex(idx, impr.cursors, catalog, searchTxt, first, cursor, orderBy, filter, options)
+}
+
+// CreateProduct stores a new product and returns it as stored.
+func (impr *inMemoryProductRepository) CreateProduct(_ context.Context, product common.Product) (*common.Product,
+	error) {
+	impr.writeLock.Lock()
+	defer impr.writeLock.Unlock()
+
+	current := impr.current()
+	if _, ok := current.products[product.Id]; ok {
+		return nil, ErrProductExists
+	}
+
+	if !current.categoriesExist(product.CategoryIds) {
+		return nil, ErrCategoryNotFound
+	}
+
+	if current.variantsInUse(product) {
+		return nil, ErrVariantExists
+	}
+
+	product = withVariantProductIds(product)
+	now := time.Now().UTC()
+	product.CreatedAt = &now
+	product.UpdatedAt = &now
+
+	batch := impr.index.NewBatch()
+	err := batch.Index(product.Id, newProductDocument(product))
 
 	if err != nil {
-		return ProductList{}, err
+		return nil, err
 	}
 
-	products := make([]common.Product, 0)
-	newCursor := cursor
-	reachedCursor := false
-	if cursor == "" {
-		reachedCursor = true
+	catalog := current.edit()
+	catalog.storeProduct(product)
+	err = impr.publish(catalog, batch)
+
+	if err != nil {
+		return nil, err
 	}
-	for _, hit := range searchResults.Hits {
-		if len(products) == first {
-			break
-		} else if hit.ID == cursor {
-			reachedCursor = true
-			continue
-		} else if reachedCursor {
-			product, err := findProductById(impr.products, hit.ID)
 
-			if err != nil {
-				return ProductList{}, err
+	return &product, nil
+}
+
+// UpdateProduct replaces the product sharing the given product's id and returns it as stored.
+func (impr *inMemoryProductRepository) UpdateProduct(_ context.Context, product common.Product) (*common.Product,
+	error) {
+	impr.writeLock.Lock()
+	defer impr.writeLock.Unlock()
+
+	current := impr.current()
+	existing, ok := current.products[product.Id]
+
+	if !ok {
+		return nil, ErrProductNotFound
+	}
+
+	if !current.categoriesExist(product.CategoryIds) {
+		return nil, ErrCategoryNotFound
+	}
+
+	if current.variantsInUse(product) {
+		return nil, ErrVariantExists
+	}
+
+	product = withVariantProductIds(product)
+	now := time.Now().UTC()
+	product.CreatedAt = existing.CreatedAt
+	product.UpdatedAt = &now
+
+	batch := impr.index.NewBatch()
+	err := batch.Index(product.Id, newProductDocument(product))
+
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := current.edit()
+	catalog.storeProduct(product)
+	err = impr.publish(catalog, batch)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+// DeleteProduct removes the product with the given id.
+func (impr *inMemoryProductRepository) DeleteProduct(_ context.Context, id string) error {
+	impr.writeLock.Lock()
+	defer impr.writeLock.Unlock()
+
+	current := impr.current()
+	if _, ok := current.products[id]; !ok {
+		return ErrProductNotFound
+	}
+
+	batch := impr.index.NewBatch()
+	batch.Delete(id)
+	catalog := current.edit()
+	catalog.removeProduct(id)
+	err := impr.publish(catalog, batch)
+
+	if err != nil {
+		return err
+	}
+
+	for reservationId, reservation := range impr.reservations {
+		if reservation.ProductId == id {
+			delete(impr.reservations, reservationId)
+		}
+	}
+
+	return nil
+}
+
+func (imc *inMemoryCatalog) categoriesExist(ids []string) bool {
+	for _, id := range ids {
+		if findCategoryById(imc.categories, id) == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// variantsInUse returns true if any of the given product's variants share a SKU with a variant of another product.
+func (imc *inMemoryCatalog) variantsInUse(product common.Product) bool {
+	for _, variant := range product.Variants {
+		existing := findVariantBySku(imc.products, variant.Sku)
+
+		if existing != nil && existing.ProductId != product.Id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withVariantProductIds returns the given product with each of its variants referencing it.
+func withVariantProductIds(product common.Product) common.Product {
+	variants := make([]common.Variant, len(product.Variants))
+	for i, variant := range product.Variants {
+		variant.ProductId = product.Id
+		variants[i] = variant
+	}
+
+	product.Variants = variants
+	return product
+}
+
+func findVariantBySku(products map[string]common.Product, sku string) *common.Variant {
+	for _, product := range products {
+		for _, variant := range product.Variants {
+			if sku == variant.Sku {
+				return &variant
 			}
-			products = append(products, *product)
-			newCursor = product.Id
 		}
 	}
 
-	return ProductList{products, newCursor}, nil
+	return nil
 }
 
-// MakeInMemoryRepository constructs an in memory backed ProductRepository from the given configuration.
-func MakeInMemoryRepository(config common.Configuration) (ProductRepository, error) {
-	var products []common.Product
-	var err error
+func findCategoryById(categories []common.Category, id string) *common.Category {
+	for _, category := range categories {
+		if id == category.Id {
+			return &category
+		}
+	}
 
-	// open a new index
-	mapping := bleve.NewIndexMapping()
-	idx, err := bleve.NewMemOnly(mapping)
+	return nil
+}
 
-	if err == bleve.ErrorIndexPathExists {
-		idx, err = bleve.Open("document")
+// GetCategories retrieves every category.
+func (impr *inMemoryProductRepository) GetCategories(_ context.Context) ([]common.Category, error) {
+	catalog := impr.current()
+	categories := make([]common.Category, len(catalog.categories))
+	copy(categories, catalog.categories)
+	return categories, nil
+}
+
+// GetCategory retrieves a category from the given id.
+func (impr *inMemoryProductRepository) GetCategory(_ context.Context, id string) (*common.Category, error) {
+	return findCategoryById(impr.current().categories, id), nil
+}
+
+// GetVariant retrieves a product variant from the given SKU.
+func (impr *inMemoryProductRepository) GetVariant(_ context.Context, sku string) (*common.Variant, error) {
+	return findVariantBySku(impr.current().products, sku), nil
+}
+
+// ReserveProduct holds the given quantity of a product out of stock until the reservation is committed, released or
+// the given ttl elapses.
+func (impr *inMemoryProductRepository) ReserveProduct(_ context.Context, productId string, quantity int,
+	ttl time.Duration) (*common.Reservation, error) {
+	impr.writeLock.Lock()
+	defer impr.writeLock.Unlock()
+
+	current := impr.current()
+	product, ok := current.products[productId]
+
+	if !ok {
+		return nil, ErrProductNotFound
+	} else if product.QtyInStock < quantity {
+		return nil, ErrInsufficientStock
 	}
 
+	id, err := newReservationId()
+
 	if err != nil {
 		return nil, err
 	}
 
-	if config.GetInitDataSet() == "" {
-		products = make([]common.Product, 0)
-	} else {
-		products, err = loadInitInMemoryDataset(config.GetInitDataSet())
+	now := time.Now().UTC()
+	reservation := common.Reservation{
+		Id:        id,
+		ProductId: productId,
+		Quantity:  quantity,
+		Status:    common.ReservationPending,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+		UpdatedAt: now,
 	}
 
-	for _, product := range products {
-		var shortDescription string
-		if product.ShortDescription != nil {
-			shortDescription = *product.ShortDescription
+	catalog := current.edit()
+	batch := impr.index.NewBatch()
+	err = setQtyInStock(catalog, batch, product, product.QtyInStock-quantity)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = impr.publish(catalog, batch)
+
+	if err != nil {
+		return nil, err
+	}
+
+	impr.reservations[id] = reservation
+	return &reservation, nil
+}
+
+// CommitReservation permanently removes the units held by an active reservation from stock.
+func (impr *inMemoryProductRepository) CommitReservation(_ context.Context, productId,
+	reservationId string) (*common.Reservation, error) {
+	return impr.closeReservation(productId, reservationId, common.ReservationCommitted)
+}
+
+// ReleaseReservation returns the units held by an active reservation to stock.
+func (impr *inMemoryProductRepository) ReleaseReservation(_ context.Context, productId,
+	reservationId string) (*common.Reservation, error) {
+	return impr.closeReservation(productId, reservationId, common.ReservationReleased)
+}
+
+// closeReservation moves an active reservation to the given status, returning its units to stock unless it is being
+// committed. A reservation found pending past its expiry is expired instead.
+func (impr *inMemoryProductRepository) closeReservation(productId, reservationId string,
+	status common.ReservationStatus) (*common.Reservation, error) {
+	impr.writeLock.Lock()
+	defer impr.writeLock.Unlock()
+
+	reservation, ok := impr.reservations[reservationId]
+
+	if !ok || reservation.ProductId != productId {
+		return nil, ErrReservationNotFound
+	}
+
+	now := time.Now().UTC()
+	if !reservation.Active(now) {
+		if reservation.Status == common.ReservationPending {
+			_, err := impr.closeReservations([]common.Reservation{reservation}, common.ReservationExpired, now)
+
+			if err != nil {
+				return nil, err
+			}
 		}
-		var description string
-		if product.Description != nil {
-			description = *product.Description
+
+		return nil, ErrReservationNotActive
+	}
+
+	closed, err := impr.closeReservations([]common.Reservation{reservation}, status, now)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &closed[0], nil
+}
+
+// closeReservations moves the given reservations to the given status, returning their units to stock in a single
+// catalog unless they are being committed, and returns them as stored. Callers must hold the write lock.
+func (impr *inMemoryProductRepository) closeReservations(reservations []common.Reservation,
+	status common.ReservationStatus, now time.Time) ([]common.Reservation, error) {
+	if status != common.ReservationCommitted {
+		catalog := impr.current().edit()
+		batch := impr.index.NewBatch()
+		for _, reservation := range reservations {
+			if product, ok := catalog.products[reservation.ProductId]; ok {
+				err := setQtyInStock(catalog, batch, product, product.QtyInStock+reservation.Quantity)
+
+				if err != nil {
+					return nil, err
+				}
+			}
 		}
-		// index name, id, short description, and full description
-		idxData := fmt.Sprintf("%s %s %s %s", product.Name, product.Id, shortDescription,
-			description)
-		err = idx.Index(product.Id, idxData)
+
+		err := impr.publish(catalog, batch)
 
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	return &inMemoryProductRepository{products, idx}, err
+	closed := make([]common.Reservation, len(reservations))
+	for i, reservation := range reservations {
+		reservation.Status = status
+		reservation.UpdatedAt = now
+		impr.reservations[reservation.Id] = reservation
+		closed[i] = reservation
+	}
+
+	return closed, nil
+}
+
+// setQtyInStock stores the given product with the given stock level in a catalog being edited, adding it to the given
+// batch so that stock filters of the index stay accurate once the catalog is published.
+func setQtyInStock(catalog *inMemoryCatalog, batch *bleve.Batch, product common.Product, qty int) error {
+	product.QtyInStock = qty
+	catalog.storeProduct(product)
+	return batch.Index(product.Id, newProductDocument(product))
+}
+
+// ExpireReservations returns the units held by every pending reservation past its expiry to stock, returning the
+// number of reservations expired.
+func (impr *inMemoryProductRepository) ExpireReservations(_ context.Context) (int, error) {
+	impr.writeLock.Lock()
+	defer impr.writeLock.Unlock()
+
+	now := time.Now().UTC()
+	pending := make([]common.Reservation, 0)
+	for _, reservation := range impr.reservations {
+		if reservation.Status == common.ReservationPending && !reservation.Active(now) {
+			pending = append(pending, reservation)
+		}
+	}
+
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	expired, err := impr.closeReservations(pending, common.ReservationExpired, now)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(expired), nil
+}
+
+// SuggestProducts retrieves up to first product names, and category names when includeCategories is true, with a word
+// starting with each word of the given prefix.
+func (impr *inMemoryProductRepository) SuggestProducts(ctx context.Context, prefix string, first int,
+	includeCategories bool) (common.Suggestions, error) {
+	idx, catalog, done := impr.searchable()
+	defer done()
+
+	return suggestFromIndex(ctx, idx, catalog, prefix, first, includeCategories)
+}
+
+// upsertInMemoryData loads the given dataset with the semantics of loadInitPostgresqlData, an entry replacing an
+// earlier entry with the same id only if their contents differ, and logs how many entries were inserted, updated and
+// left unchanged.
+func upsertInMemoryData(data dataset) ([]common.Category, map[string]common.Product, error) {
+	var categoryCounts, productCounts loadCounts
+	categories := make([]common.Category, 0, len(data.Categories))
+	categoryAt := make(map[string]int)
+	hashes := make(map[string]string)
+	for _, category := range data.Categories {
+		hash, err := contentHash(category)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if i, ok := categoryAt[category.Id]; !ok {
+			categoryAt[category.Id] = len(categories)
+			categories = append(categories, category)
+			categoryCounts.add(entryInserted)
+		} else if hashes[category.Id] != hash {
+			categories[i] = category
+			categoryCounts.add(entryUpdated)
+		} else {
+			categoryCounts.add(entryUnchanged)
+		}
+
+		hashes[category.Id] = hash
+	}
+
+	products := make(map[string]common.Product, len(data.Products))
+	hashes = make(map[string]string)
+	for _, product := range data.Products {
+		hash, err := contentHash(product)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if _, ok := products[product.Id]; !ok {
+			productCounts.add(entryInserted)
+		} else if hashes[product.Id] != hash {
+			productCounts.add(entryUpdated)
+		} else {
+			productCounts.add(entryUnchanged)
+			continue
+		}
+
+		products[product.Id] = withVariantProductIds(product)
+		hashes[product.Id] = hash
+	}
+
+	if len(data.Categories) > 0 || len(data.Products) > 0 {
+		log.Printf("Loaded dataset, categories: %s, products: %s", categoryCounts, productCounts)
+	}
+
+	return categories, products, nil
 }
 
-func loadInitInMemoryDataset(dataset string) ([]common.Product, error) {
+// MakeInMemoryRepository constructs an in memory backed ProductRepository from the given configuration.
+func MakeInMemoryRepository(config common.Configuration) (ProductRepository, error) {
+	var data dataset
 	var err error
-	products := make([]common.Product, 0)
+
+	// open a new index
+	idx, err := bleve.NewMemOnly(newProductIndexMapping())
+
+	if err == bleve.ErrorIndexPathExists {
+		idx, err = bleve.Open("document")
+	}
 
 	if err != nil {
-		return products, err
+		return nil, err
+	}
+
+	if config.GetInitDataSet() == "" {
+		data = dataset{make([]common.Category, 0), make([]common.Product, 0)}
+	} else {
+		data, err = loadInitDataset(config.GetInitDataSet())
 	}
 
-	jsonBytes, err := ioutil.ReadFile(dataset)
 	if err != nil {
-		return products, err
+		return nil, err
 	}
 
-	err = json.Unmarshal(jsonBytes, &products)
+	categories, products, err := upsertInMemoryData(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, product := range products {
+		err = indexProduct(idx, product)
+
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	return products, err
+	repo := &inMemoryProductRepository{reservations: make(map[string]common.Reservation), index: idx,
+		cursors: newCursorCodec(config)}
+	repo.catalog.Store(newInMemoryCatalog(products, categories))
+	return repo, nil
 }
@@ -2,9 +2,18 @@ package repository_test
 
 import (
 	"context"
+	"fmt"
+	"github.com/shopspring/decimal"
 	"github.com/stone1549/product-service/common"
 	"github.com/stone1549/product-service/repository"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func makeNewImRepo(t *testing.T) repository.ProductRepository {
@@ -33,14 +42,29 @@ func TestGetProduct_ImSuccessWithNoResult(t *testing.T) {
 	assert(t, product == nil, "expected product to be nil")
 }
 
+// TestGetProductsByIds_ImSuccess ensures that products are retrieved once each, in the order of their ids, skipping
+// ids without a product.
+func TestGetProductsByIds_ImSuccess(t *testing.T) {
+	repo := makeNewImRepo(t)
+	products, err := repo.GetProductsByIds(context.Background(), []string{"12", "A", "3", "12"})
+
+	ok(t, err)
+	equals(t, 2, len(products))
+	equals(t, "12", products[0].Id)
+	equals(t, "3", products[1].Id)
+}
+
 // TestGetProducts_ImSuccessWithPartialResults ensures that a partial list of results will be returned when necessary.
 func TestGetProducts_ImSuccessWithPartialResults(t *testing.T) {
 	repo := makeNewImRepo(t)
-	products, err := repo.GetProducts(context.Background(), 5, "18", common.OrderBy{})
+	products, err := repo.GetProducts(context.Background(), 18, "", common.OrderBy{}, common.ProductFilter{})
+	ok(t, err)
+
+	products, err = repo.GetProducts(context.Background(), 5, products.Cursor, common.OrderBy{}, common.ProductFilter{})
 
 	ok(t, err)
 	equals(t, 2, len(products.Products))
-	equals(t, "20", products.Cursor)
+	equals(t, "20", products.Products[1].Id)
 }
 
 // TestGetProducts_ImSuccessOrderByCreated ensures that products can be retrieved properly sorted by a single key.
@@ -49,11 +73,11 @@ func TestGetProducts_ImSuccessOrderByCreated(t *testing.T) {
 
 	orderBy := common.OrderBy{}
 	orderBy.Add(common.OrderByCreatedDesc)
-	products, err := repo.GetProducts(context.Background(), 5, "", orderBy)
+	products, err := repo.GetProducts(context.Background(), 5, "", orderBy, common.ProductFilter{})
 
 	ok(t, err)
 	equals(t, 5, len(products.Products))
-	equals(t, "16", products.Cursor)
+	equals(t, "16", products.Products[4].Id)
 }
 
 // TestGetProducts_ImSuccessOrderByCreatedAndName ensures that products can be retrieved properly sorted with multiple
@@ -64,11 +88,11 @@ func TestGetProducts_ImSuccessOrderByCreatedAndName(t *testing.T) {
 	orderBy := common.OrderBy{}
 	orderBy.Add(common.OrderByCreatedDesc)
 	orderBy.Add(common.OrderByName)
-	products, err := repo.GetProducts(context.Background(), 2, "", orderBy)
+	products, err := repo.GetProducts(context.Background(), 2, "", orderBy, common.ProductFilter{})
 
 	ok(t, err)
 	equals(t, 2, len(products.Products))
-	equals(t, "20", products.Cursor)
+	equals(t, "20", products.Products[1].Id)
 }
 
 // TestGetProducts_ImSuccessOrderByName ensures that products can be retrieved properly sorted by a text field.
@@ -77,61 +101,1103 @@ func TestGetProducts_ImSuccessOrderByName(t *testing.T) {
 
 	orderBy := common.OrderBy{}
 	orderBy.Add(common.OrderByName)
-	products, err := repo.GetProducts(context.Background(), 5, "", orderBy)
+	products, err := repo.GetProducts(context.Background(), 5, "", orderBy, common.ProductFilter{})
 
 	ok(t, err)
 	equals(t, 5, len(products.Products))
-	equals(t, "11", products.Cursor)
+	equals(t, "11", products.Products[4].Id)
+}
+
+// TestGetProducts_ImSuccessOrderByPriceDesc ensures that products can be paged through sorted by a key holding
+// duplicate values.
+func TestGetProducts_ImSuccessOrderByPriceDesc(t *testing.T) {
+	repo := makeNewImRepo(t)
+
+	orderBy := common.OrderBy{}
+	orderBy.Add(common.OrderByPriceDesc)
+	products, err := repo.GetProducts(context.Background(), 1, "", orderBy, common.ProductFilter{})
+
+	ok(t, err)
+	equals(t, "8", products.Products[0].Id)
+
+	// products 2, 9 and 12 share a price and are ordered by their ids
+	products, err = repo.GetProducts(context.Background(), 14, products.Cursor, orderBy, common.ProductFilter{})
+	ok(t, err)
+	equals(t, "9", products.Products[13].Id)
+
+	products, err = repo.GetProducts(context.Background(), 2, products.Cursor, orderBy, common.ProductFilter{})
+	ok(t, err)
+	equals(t, "2", products.Products[0].Id)
+	equals(t, "12", products.Products[1].Id)
+}
+
+// TestGetProducts_ImSuccessFilterPrice ensures that products can be filtered by a price range.
+func TestGetProducts_ImSuccessFilterPrice(t *testing.T) {
+	repo := makeNewImRepo(t)
+
+	minPrice := decimal.NewFromFloat(1000)
+	maxPrice := decimal.NewFromFloat(2499.99)
+	filter := common.ProductFilter{MinPrice: &minPrice, MaxPrice: &maxPrice}
+	products, err := repo.GetProducts(context.Background(), 20, "", common.OrderBy{}, filter)
+
+	ok(t, err)
+	equals(t, 3, len(products.Products))
+	equals(t, "1", products.Products[0].Id)
+	equals(t, "15", products.Products[1].Id)
+	equals(t, "20", products.Products[2].Id)
+}
+
+// TestGetProducts_ImSuccessFilterInStock ensures that products can be filtered by whether they are in stock.
+func TestGetProducts_ImSuccessFilterInStock(t *testing.T) {
+	repo := makeNewImRepo(t)
+
+	inStock := false
+	filter := common.ProductFilter{InStock: &inStock}
+	products, err := repo.GetProducts(context.Background(), 20, "", common.OrderBy{}, filter)
+
+	ok(t, err)
+	equals(t, 0, len(products.Products))
+}
+
+// TestGetProducts_ImSuccessFilterInStockAfterReservation ensures that products filtered by stock reflect the stock held
+// by reservations, and that it is returned once they are released.
+func TestGetProducts_ImSuccessFilterInStockAfterReservation(t *testing.T) {
+	repo := makeNewImRepo(t)
+	outOfStock := false
+	filter := common.ProductFilter{InStock: &outOfStock}
+
+	reservation, err := repo.ReserveProduct(context.Background(), "1", 1, time.Minute)
+	ok(t, err)
+	products, err := repo.GetProducts(context.Background(), 20, "", common.OrderBy{}, filter)
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, "1", products.Products[0].Id)
+	equals(t, 0, products.Products[0].QtyInStock)
+
+	_, err = repo.ReleaseReservation(context.Background(), "1", reservation.Id)
+	ok(t, err)
+	products, err = repo.GetProducts(context.Background(), 20, "", common.OrderBy{}, filter)
+
+	ok(t, err)
+	equals(t, 0, len(products.Products))
+}
+
+// TestGetProducts_ImSuccessFilterDates ensures that products can be filtered by when they were created and updated.
+func TestGetProducts_ImSuccessFilterDates(t *testing.T) {
+	repo := makeNewImRepo(t)
+
+	createdAfter, _ := time.Parse(time.RFC3339, "2017-01-01T00:00:01Z")
+	updatedSince, _ := time.Parse(time.RFC3339, "2018-01-01T00:00:18Z")
+	filter := common.ProductFilter{CreatedAfter: &createdAfter, UpdatedSince: &updatedSince}
+	products, err := repo.GetProducts(context.Background(), 20, "", common.OrderBy{}, filter)
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, "3", products.Products[0].Id)
+}
+
+// TestGetProducts_ImSuccessFilterIds ensures that products can be filtered by id and paged through.
+func TestGetProducts_ImSuccessFilterIds(t *testing.T) {
+	repo := makeNewImRepo(t)
+
+	filter := common.ProductFilter{Ids: []string{"3", "12", "A"}}
+	products, err := repo.GetProducts(context.Background(), 1, "", common.OrderBy{}, filter)
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, "3", products.Products[0].Id)
+
+	products, err = repo.GetProducts(context.Background(), 5, products.Cursor, common.OrderBy{}, filter)
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, "12", products.Products[0].Id)
 }
 
 // TestGetProduct_ImSuccessWithFullResults ensures that a full set of products will be returned where appropriate.
 func TestGetProduct_ImSuccessWithFullResults(t *testing.T) {
 	repo := makeNewImRepo(t)
 
-	products, err := repo.GetProducts(context.Background(), 5, "", common.OrderBy{})
+	products, err := repo.GetProducts(context.Background(), 5, "", common.OrderBy{}, common.ProductFilter{})
 
 	ok(t, err)
 	equals(t, 5, len(products.Products))
-	equals(t, "5", products.Cursor)
+	equals(t, "5", products.Products[4].Id)
 }
 
 // TestGetProduct_ImSuccessWithFullResults ensures that an empty product set will be returned when appropriate.
 func TestGetProduct_ImSuccessWithFullResultsEmptyPageTwo(t *testing.T) {
 	repo := makeNewImRepo(t)
-	products, err := repo.GetProducts(context.Background(), 5, "21", common.OrderBy{})
+	products, err := repo.GetProducts(context.Background(), 20, "", common.OrderBy{}, common.ProductFilter{})
+	ok(t, err)
+
+	cursor := products.Cursor
+	products, err = repo.GetProducts(context.Background(), 5, cursor, common.OrderBy{}, common.ProductFilter{})
 
 	ok(t, err)
 	equals(t, 0, len(products.Products))
-	equals(t, "21", products.Cursor)
+	equals(t, cursor, products.Cursor)
+}
+
+// TestGetProducts_ImSuccessProductCursors ensures that the cursor of each product of a page resumes after it.
+func TestGetProducts_ImSuccessProductCursors(t *testing.T) {
+	repo := makeNewImRepo(t)
+	products, err := repo.GetProducts(context.Background(), 5, "", common.OrderBy{}, common.ProductFilter{})
+	ok(t, err)
+
+	equals(t, 5, len(products.Cursors))
+	equals(t, products.Cursor, products.Cursors[4])
+
+	products, err = repo.GetProducts(context.Background(), 2, products.Cursors[1], common.OrderBy{},
+		common.ProductFilter{})
+
+	ok(t, err)
+	equals(t, "3", products.Products[0].Id)
+	equals(t, "4", products.Products[1].Id)
+}
+
+// TestGetProducts_ImFailTamperedCursor ensures that a cursor that has been modified is rejected.
+func TestGetProducts_ImFailTamperedCursor(t *testing.T) {
+	repo := makeNewImRepo(t)
+	products, err := repo.GetProducts(context.Background(), 5, "", common.OrderBy{}, common.ProductFilter{})
+	ok(t, err)
+
+	cursor := []byte(products.Cursor)
+	cursor[len(cursor)/2] ^= 1
+	_, err = repo.GetProducts(context.Background(), 5, string(cursor), common.OrderBy{}, common.ProductFilter{})
+
+	equals(t, repository.ErrInvalidCursor, err)
+}
+
+// TestGetProducts_ImFailMismatchedCursor ensures that a cursor issued for a different order is rejected.
+func TestGetProducts_ImFailMismatchedCursor(t *testing.T) {
+	repo := makeNewImRepo(t)
+	products, err := repo.GetProducts(context.Background(), 5, "", common.OrderBy{}, common.ProductFilter{})
+	ok(t, err)
+
+	orderBy := common.OrderBy{}
+	orderBy.Add(common.OrderByName)
+	_, err = repo.GetProducts(context.Background(), 5, products.Cursor, orderBy, common.ProductFilter{})
+
+	equals(t, repository.ErrInvalidCursor, err)
 }
 
 // TestSearchProducts_ImSuccessWithPartialResults ensures that a partial product set will be returned when appropriate.
 func TestSearchProducts_ImSuccessWithPartialResults(t *testing.T) {
 	repo := makeNewImRepo(t)
-	products, err := repo.SearchProducts(context.Background(), "portal OR shrink", 5, "")
+	products, err := repo.SearchProducts(context.Background(), "portal OR shrink", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
 
 	ok(t, err)
 	equals(t, 2, len(products.Products))
-	equals(t, "14", products.Cursor)
+	equals(t, "14", products.Products[1].Id)
 }
 
 // TestSearchProducts_ImSuccessWithFullResults ensures that a full product set will be returned when appropriate.
 func TestSearchProducts_ImSuccessWithFullResults(t *testing.T) {
 	repo := makeNewImRepo(t)
-	products, err := repo.SearchProducts(context.Background(), "portal OR time OR ray", 5, "")
+	products, err := repo.SearchProducts(context.Background(), "portal OR time OR ray", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
 
 	ok(t, err)
 	equals(t, 5, len(products.Products))
-	equals(t, "14", products.Cursor)
+	equals(t, "14", products.Products[4].Id)
 }
 
 // TestSearchProducts_ImSuccessWithFullResultsEmptyPageTwo ensures that an empty product set will be returned when
 // appropriate.
 func TestSearchProducts_ImSuccessWithFullResultsEmptyPageTwo(t *testing.T) {
 	repo := makeNewImRepo(t)
-	products, err := repo.SearchProducts(context.Background(), "portal", 5, "20")
+	products, err := repo.SearchProducts(context.Background(), "portal", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
+	ok(t, err)
+
+	cursor := products.Cursor
+	products, err = repo.SearchProducts(context.Background(), "portal", 5, cursor,
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
 
 	ok(t, err)
 	equals(t, 0, len(products.Products))
-	equals(t, "20", products.Cursor)
+	equals(t, cursor, products.Cursor)
+}
+
+// TestSearchProducts_ImSuccessRelevancePaged ensures that paging through matches ordered by relevance alone, which the
+// index pages through, retrieves every match once in the order they are retrieved in when facets are requested.
+func TestSearchProducts_ImSuccessRelevancePaged(t *testing.T) {
+	repo := makeNewImRepo(t)
+	for i := 0; i < 13; i++ {
+		product := makeTestProduct(fmt.Sprintf("W%02d", i))
+		if i%3 == 0 {
+			product.Name = "Test Test Product"
+		}
+
+		_, err := repo.CreateProduct(context.Background(), product)
+		ok(t, err)
+	}
+
+	ids := searchIds(t, repo, "test", 3, common.SearchOptions{})
+	equals(t, 13, len(ids))
+	equals(t, searchIds(t, repo, "test", 100, common.SearchOptions{Facets: common.FacetRequest{InStock: true}}), ids)
+}
+
+// TestSearchProducts_ImSuccessOrderByPrice ensures that matches can be ordered by price and paged through.
+func TestSearchProducts_ImSuccessOrderByPrice(t *testing.T) {
+	repo := makeNewImRepo(t)
+	orderBy := common.OrderBy{}
+	ok(t, orderBy.Add(common.OrderByPrice))
+
+	products, err := repo.SearchProducts(context.Background(), "ray OR robot", 2, "", orderBy,
+		common.ProductFilter{}, common.SearchOptions{})
+	ok(t, err)
+	equals(t, 2, len(products.Products))
+	equals(t, "12", products.Products[0].Id)
+	equals(t, "4", products.Products[1].Id)
+
+	products, err = repo.SearchProducts(context.Background(), "ray OR robot", 2, products.Cursor, orderBy,
+		common.ProductFilter{}, common.SearchOptions{})
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, "14", products.Products[0].Id)
+}
+
+// TestSearchProducts_ImFailMismatchedCursor ensures that a cursor issued for matches ordered by relevance is rejected
+// when they are ordered otherwise.
+func TestSearchProducts_ImFailMismatchedCursor(t *testing.T) {
+	repo := makeNewImRepo(t)
+	products, err := repo.SearchProducts(context.Background(), "ray OR robot", 2, "", common.OrderBy{},
+		common.ProductFilter{}, common.SearchOptions{})
+	ok(t, err)
+
+	orderBy := common.OrderBy{}
+	ok(t, orderBy.Add(common.OrderByPrice))
+	_, err = repo.SearchProducts(context.Background(), "ray OR robot", 2, products.Cursor, orderBy,
+		common.ProductFilter{}, common.SearchOptions{})
+
+	equals(t, repository.ErrInvalidCursor, err)
+}
+
+// TestGetProducts_ImFailOrderByRelevance ensures that products can only be ordered by relevance when searching.
+func TestGetProducts_ImFailOrderByRelevance(t *testing.T) {
+	repo := makeNewImRepo(t)
+	orderBy := common.OrderBy{}
+	ok(t, orderBy.Add(common.OrderByRelevance))
+
+	_, err := repo.GetProducts(context.Background(), 5, "", orderBy, common.ProductFilter{})
+
+	equals(t, repository.ErrInvalidOrder, err)
+}
+
+// TestSearchProducts_ImSuccessWithQuerySyntax ensures that phrases, exclusions, alternatives and prefixes are
+// supported.
+func TestSearchProducts_ImSuccessWithQuerySyntax(t *testing.T) {
+	repo := makeNewImRepo(t)
+	expected := map[string][]string{
+		"ray -shrink":                 {"12"},
+		`"time crystal"`:              {"17"},
+		`"portal gun" OR plumbus`:     {"1", "2"},
+		"crys*":                       {"15", "17"},
+		`time -"time crystal" -seeds`: {"11", "16", "8"},
+	}
+
+	for searchTxt, ids := range expected {
+		products, err := repo.SearchProducts(context.Background(), searchTxt, 5, "",
+			common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
+		ok(t, err)
+
+		var actual []string
+		for _, product := range products.Products {
+			actual = append(actual, product.Id)
+		}
+
+		sort.Strings(actual)
+		equals(t, ids, actual)
+	}
+}
+
+// TestSearchProducts_ImFailEmptySearch ensures that search text without any words to match is rejected.
+func TestSearchProducts_ImFailEmptySearch(t *testing.T) {
+	repo := makeNewImRepo(t)
+	_, err := repo.SearchProducts(context.Background(), "& -portal", 5, "", common.OrderBy{}, common.ProductFilter{},
+		common.SearchOptions{})
+
+	equals(t, repository.ErrInvalidSearch, err)
+}
+
+// TestSearchProducts_ImSuccessFuzzy ensures that misspelled words only match when fuzzy matching is requested, and
+// that corrected search text is suggested otherwise.
+func TestSearchProducts_ImSuccessFuzzy(t *testing.T) {
+	repo := makeNewImRepo(t)
+	products, err := repo.SearchProducts(context.Background(), "Plumbis", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
+
+	ok(t, err)
+	equals(t, 0, len(products.Products))
+	equals(t, "plumbus", products.DidYouMean)
+
+	products, err = repo.SearchProducts(context.Background(), "Plumbis", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{Fuzzy: true})
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, "2", products.Products[0].Id)
+	equals(t, "", products.DidYouMean)
+}
+
+// TestSearchProducts_ImSuccessDidYouMeanFirstPageOnly ensures that corrected search text is only suggested on the first
+// page, like the pg repo does, even when nothing matches after the cursor.
+func TestSearchProducts_ImSuccessDidYouMeanFirstPageOnly(t *testing.T) {
+	repo := makeNewImRepo(t)
+	products, err := repo.SearchProducts(context.Background(), "portal", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
+	ok(t, err)
+
+	for _, options := range []common.SearchOptions{{}, {Facets: common.FacetRequest{Category: true}}} {
+		products, err := repo.SearchProducts(context.Background(), "Plumbis", 5, products.Cursor,
+			common.OrderBy{}, common.ProductFilter{}, options)
+
+		ok(t, err)
+		equals(t, 0, len(products.Products))
+		equals(t, "", products.DidYouMean)
+	}
+}
+
+// TestSearchProducts_ImSuccessDidYouMeanAfterWrites ensures that corrections are suggested from the words of products
+// as they are written.
+func TestSearchProducts_ImSuccessDidYouMeanAfterWrites(t *testing.T) {
+	repo := makeNewImRepo(t)
+	product := makeTestProduct("A")
+	product.Name = "Grumbo"
+	_, err := repo.CreateProduct(context.Background(), product)
+	ok(t, err)
+
+	products, err := repo.SearchProducts(context.Background(), "grumbi", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
+
+	ok(t, err)
+	equals(t, "grumbo", products.DidYouMean)
+
+	ok(t, repo.DeleteProduct(context.Background(), "A"))
+	products, err = repo.SearchProducts(context.Background(), "grumbi", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
+
+	ok(t, err)
+	equals(t, "", products.DidYouMean)
+}
+
+// TestSearchProducts_ImSuccessRanksNameMatchesFirst ensures that matches in a product's name outrank matches in its
+// descriptions, as with the weights of the PostgreSQL text search vector.
+func TestSearchProducts_ImSuccessRanksNameMatchesFirst(t *testing.T) {
+	repo := makeNewImRepo(t)
+	products, err := repo.SearchProducts(context.Background(), "time", 5, "", common.OrderBy{}, common.ProductFilter{},
+		common.SearchOptions{})
+
+	ok(t, err)
+	equals(t, 5, len(products.Products))
+	nameMatches := []string{products.Products[0].Id, products.Products[1].Id}
+	sort.Strings(nameMatches)
+	equals(t, []string{"16", "17"}, nameMatches)
+	assert(t, products.Hits[1].Score > products.Hits[2].Score, "expected name matches to score higher")
+}
+
+// TestSearchProducts_ImSuccessWithFilter ensures that matches can be filtered by price in a currency and category.
+func TestSearchProducts_ImSuccessWithFilter(t *testing.T) {
+	repo := makeNewImRepo(t)
+
+	maxPrice := decimal.New(4949, 0)
+	filter := common.ProductFilter{Currency: common.CurrencyJPY, MaxPrice: &maxPrice, CategoryIds: []string{"weapons"}}
+	products, err := repo.SearchProducts(context.Background(), "ray OR bomb", 5, "",
+		common.OrderBy{}, filter, common.SearchOptions{})
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, "12", products.Products[0].Id)
+}
+
+// TestSearchProducts_ImSuccessFilterInStockAfterReservation ensures that searches filtered by stock reflect the stock
+// held by reservations.
+func TestSearchProducts_ImSuccessFilterInStockAfterReservation(t *testing.T) {
+	repo := makeNewImRepo(t)
+	inStock, outOfStock := true, false
+
+	products, err := repo.SearchProducts(context.Background(), "gun", 5, "",
+		common.OrderBy{}, common.ProductFilter{InStock: &inStock}, common.SearchOptions{})
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+
+	_, err = repo.ReserveProduct(context.Background(), "1", 1, time.Minute)
+	ok(t, err)
+
+	products, err = repo.SearchProducts(context.Background(), "gun", 5, "",
+		common.OrderBy{}, common.ProductFilter{InStock: &inStock}, common.SearchOptions{})
+	ok(t, err)
+	equals(t, 0, len(products.Products))
+
+	products, err = repo.SearchProducts(context.Background(), "gun", 5, "",
+		common.OrderBy{}, common.ProductFilter{InStock: &outOfStock}, common.SearchOptions{})
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, "1", products.Products[0].Id)
+}
+
+// TestSuggestProducts_ImSuccess ensures that product and category names are suggested from prefixes of their words.
+func TestSuggestProducts_ImSuccess(t *testing.T) {
+	repo := makeNewImRepo(t)
+	suggestions, err := repo.SuggestProducts(context.Background(), "time cr", 5, false)
+
+	ok(t, err)
+	equals(t, []common.Suggestion{{Id: "17", Text: "Time Crystal", Score: suggestions.Products[0].Score}},
+		suggestions.Products)
+	equals(t, 0, len(suggestions.Categories))
+
+	suggestions, err = repo.SuggestProducts(context.Background(), "R", 3, true)
+
+	ok(t, err)
+	equals(t, 3, len(suggestions.Products))
+	equals(t, []common.Suggestion{{Id: "robots", Text: "Robots", Score: 1}}, suggestions.Categories)
+}
+
+// TestSuggestProducts_ImFailEmptyPrefix ensures that a prefix without any words is rejected.
+func TestSuggestProducts_ImFailEmptyPrefix(t *testing.T) {
+	repo := makeNewImRepo(t)
+	_, err := repo.SuggestProducts(context.Background(), " - ", 5, true)
+
+	equals(t, repository.ErrInvalidSearch, err)
+}
+
+// TestSearchProducts_ImSuccessWithHighlights ensures that matches are scored, most relevant first, and that their names
+// are highlighted when requested.
+func TestSearchProducts_ImSuccessWithHighlights(t *testing.T) {
+	repo := makeNewImRepo(t)
+	products, err := repo.SearchProducts(context.Background(), "shrink", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{Highlight: true})
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, 1, len(products.Hits))
+	assert(t, products.Hits[0].Score > 0, "Expected score to be positive")
+	equals(t, []string{"<mark>Shrink</mark> Ray"}, products.Hits[0].Highlights[common.HighlightName])
+
+	products, err = repo.SearchProducts(context.Background(), "portal OR shrink", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
+
+	ok(t, err)
+	equals(t, 2, len(products.Hits))
+	assert(t, products.Hits[0].Score >= products.Hits[1].Score, "Expected hits to be ordered by score")
+	assert(t, products.Hits[0].Highlights == nil, "Expected highlights to be nil")
+}
+
+// TestSearchProducts_ImSuccessWithFacets ensures that the requested facets are counted across every match rather than
+// just the returned page.
+func TestSearchProducts_ImSuccessWithFacets(t *testing.T) {
+	repo := makeNewImRepo(t)
+	options := common.SearchOptions{Facets: common.FacetRequest{
+		Price:           true,
+		PriceBoundaries: []decimal.Decimal{decimal.New(100, 0), decimal.New(1000, 0)},
+		InStock:         true,
+	}}
+	products, err := repo.SearchProducts(context.Background(), "portal OR shrink", 1, "",
+		common.OrderBy{}, common.ProductFilter{}, options)
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, 2, len(products.Facets))
+	equals(t, common.FacetPrice, products.Facets[0].Name)
+	equals(t, 3, len(products.Facets[0].Buckets))
+	equals(t, "-100", products.Facets[0].Buckets[0].Value)
+	equals(t, 0, products.Facets[0].Buckets[0].Count)
+	equals(t, "100-1000", products.Facets[0].Buckets[1].Value)
+	equals(t, 1, products.Facets[0].Buckets[1].Count)
+	equals(t, "1000-", products.Facets[0].Buckets[2].Value)
+	equals(t, 1, products.Facets[0].Buckets[2].Count)
+	equals(t, common.FacetInStock, products.Facets[1].Name)
+	equals(t, common.FacetBucket{Value: "true", Count: 2}, products.Facets[1].Buckets[0])
+	equals(t, common.FacetBucket{Value: "false", Count: 0}, products.Facets[1].Buckets[1])
+}
+
+// TestSearchProducts_ImSuccessWithOptionFacet ensures that variant options are counted once per matching product.
+func TestSearchProducts_ImSuccessWithOptionFacet(t *testing.T) {
+	repo := makeNewImRepo(t)
+	options := common.SearchOptions{Facets: common.FacetRequest{Options: []string{"color"}}}
+	products, err := repo.SearchProducts(context.Background(), "grappling OR collar", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, options)
+
+	ok(t, err)
+	equals(t, 2, len(products.Products))
+	equals(t, []common.Facet{{Name: "option:color", Buckets: []common.FacetBucket{
+		{Value: "gold", Count: 1},
+		{Value: "silver", Count: 1},
+	}}}, products.Facets)
+}
+
+func makeTestProduct(id string) common.Product {
+	price := decimal.NewFromFloat(9.99)
+	description := "A test product."
+	return common.Product{
+		Id:          id,
+		Name:        "Test Product",
+		Price:       &price,
+		Description: &description,
+		QtyInStock:  5,
+	}
+}
+
+// TestCreateProduct_ImSuccess ensures a new product can be stored and then retrieved and searched for.
+func TestCreateProduct_ImSuccess(t *testing.T) {
+	repo := makeNewImRepo(t)
+	product, err := repo.CreateProduct(context.Background(), makeTestProduct("A"))
+
+	ok(t, err)
+	assert(t, product.CreatedAt != nil, "Expected createdAt to be set")
+
+	product, err = repo.GetProduct(context.Background(), "A")
+
+	ok(t, err)
+	assert(t, product != nil, "Expected product to not be nil")
+	equals(t, "Test Product", product.Name)
+
+	products, err := repo.SearchProducts(context.Background(), "test", 5, "", common.OrderBy{}, common.ProductFilter{},
+		common.SearchOptions{})
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, "A", products.Products[0].Id)
+}
+
+// TestCreateProduct_ImFailExists ensures a product can not be created with an id that is already in use.
+func TestCreateProduct_ImFailExists(t *testing.T) {
+	repo := makeNewImRepo(t)
+	_, err := repo.CreateProduct(context.Background(), makeTestProduct("1"))
+
+	equals(t, repository.ErrProductExists, err)
+}
+
+// TestUpdateProduct_ImSuccess ensures an existing product can be replaced.
+func TestUpdateProduct_ImSuccess(t *testing.T) {
+	repo := makeNewImRepo(t)
+	existing, err := repo.GetProduct(context.Background(), "1")
+	ok(t, err)
+
+	product, err := repo.UpdateProduct(context.Background(), makeTestProduct("1"))
+
+	ok(t, err)
+	equals(t, "Test Product", product.Name)
+	equals(t, existing.CreatedAt, product.CreatedAt)
+
+	products, err := repo.SearchProducts(context.Background(), "portal", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
+
+	ok(t, err)
+	equals(t, 0, len(products.Products))
+}
+
+// TestGetProducts_ImSuccessAfterMutations ensures that products keep their order as they are created, updated and
+// deleted after having been retrieved in that order.
+func TestGetProducts_ImSuccessAfterMutations(t *testing.T) {
+	repo := makeNewImRepo(t)
+	orderBy := common.OrderBy{}
+	ok(t, orderBy.Add(common.OrderByName))
+	products, err := repo.GetProducts(context.Background(), 20, "", orderBy, common.ProductFilter{})
+	ok(t, err)
+
+	first := products.Products[0]
+	created := makeTestProduct("A")
+	created.Name = "0 " + first.Name
+	_, err = repo.CreateProduct(context.Background(), created)
+	ok(t, err)
+
+	updated := makeTestProduct(first.Id)
+	updated.Name = "~"
+	_, err = repo.UpdateProduct(context.Background(), updated)
+	ok(t, err)
+
+	ok(t, repo.DeleteProduct(context.Background(), products.Products[1].Id))
+
+	products, err = repo.GetProducts(context.Background(), 20, "", orderBy, common.ProductFilter{})
+
+	ok(t, err)
+	equals(t, 20, len(products.Products))
+	equals(t, "A", products.Products[0].Id)
+	equals(t, first.Id, products.Products[19].Id)
+	for i := 1; i < len(products.Products); i++ {
+		assert(t, products.Products[i-1].Name <= products.Products[i].Name, "Expected products to be sorted by name")
+	}
+}
+
+// TestUpdateProduct_ImFailNotFound ensures that updating a product that does not exist fails.
+func TestUpdateProduct_ImFailNotFound(t *testing.T) {
+	repo := makeNewImRepo(t)
+	_, err := repo.UpdateProduct(context.Background(), makeTestProduct("A"))
+
+	equals(t, repository.ErrProductNotFound, err)
+}
+
+// TestDeleteProduct_ImSuccess ensures an existing product can be removed.
+func TestDeleteProduct_ImSuccess(t *testing.T) {
+	repo := makeNewImRepo(t)
+	ok(t, repo.DeleteProduct(context.Background(), "1"))
+
+	product, err := repo.GetProduct(context.Background(), "1")
+
+	ok(t, err)
+	assert(t, product == nil, "expected product to be nil")
+
+	products, err := repo.SearchProducts(context.Background(), "portal", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
+
+	ok(t, err)
+	equals(t, 0, len(products.Products))
+}
+
+// TestDeleteProduct_ImFailNotFound ensures that deleting a product that does not exist fails.
+func TestDeleteProduct_ImFailNotFound(t *testing.T) {
+	repo := makeNewImRepo(t)
+
+	equals(t, repository.ErrProductNotFound, repo.DeleteProduct(context.Background(), "A"))
+}
+
+// TestCreateProduct_ImFailUnknownCategory ensures a product can not be assigned to a category that does not exist.
+func TestCreateProduct_ImFailUnknownCategory(t *testing.T) {
+	repo := makeNewImRepo(t)
+	product := makeTestProduct("A")
+	product.CategoryIds = []string{"unknown"}
+	_, err := repo.CreateProduct(context.Background(), product)
+
+	equals(t, repository.ErrCategoryNotFound, err)
+}
+
+// TestGetCategories_ImSuccess ensures every category can be retrieved.
+func TestGetCategories_ImSuccess(t *testing.T) {
+	repo := makeNewImRepo(t)
+	categories, err := repo.GetCategories(context.Background())
+
+	ok(t, err)
+	equals(t, 8, len(categories))
+}
+
+// TestGetCategory_ImSuccessWithResult ensures a category can be retrieved by id.
+func TestGetCategory_ImSuccessWithResult(t *testing.T) {
+	repo := makeNewImRepo(t)
+	category, err := repo.GetCategory(context.Background(), "weapons")
+
+	ok(t, err)
+	assert(t, category != nil, "Expected category to not be nil")
+	equals(t, "gadgets", *category.ParentId)
+}
+
+// TestGetCategory_ImSuccessWithNoResult ensures that nil is returned if the requested category does not exist.
+func TestGetCategory_ImSuccessWithNoResult(t *testing.T) {
+	repo := makeNewImRepo(t)
+	category, err := repo.GetCategory(context.Background(), "unknown")
+
+	ok(t, err)
+	assert(t, category == nil, "expected category to be nil")
+}
+
+// TestGetProducts_ImSuccessFilterCategory ensures that products can be filtered by category, with or without the
+// products of subcategories.
+func TestGetProducts_ImSuccessFilterCategory(t *testing.T) {
+	repo := makeNewImRepo(t)
+
+	filter := common.ProductFilter{CategoryIds: []string{"gadgets"}}
+	products, err := repo.GetProducts(context.Background(), 20, "", common.OrderBy{}, filter)
+
+	ok(t, err)
+	equals(t, 6, len(products.Products))
+
+	filter.IncludeSubcategories = true
+	products, err = repo.GetProducts(context.Background(), 20, "", common.OrderBy{}, filter)
+
+	ok(t, err)
+	equals(t, 10, len(products.Products))
+}
+
+// TestGetVariant_ImSuccessWithResult ensures a variant can be retrieved by SKU.
+func TestGetVariant_ImSuccessWithResult(t *testing.T) {
+	repo := makeNewImRepo(t)
+	variant, err := repo.GetVariant(context.Background(), "13-L")
+
+	ok(t, err)
+	assert(t, variant != nil, "Expected variant to not be nil")
+	equals(t, "13", variant.ProductId)
+	equals(t, "L", variant.Options["size"])
+	equals(t, "139.99", variant.Price.String())
+}
+
+// TestGetVariant_ImSuccessWithNoResult ensures that nil is returned if the requested variant does not exist.
+func TestGetVariant_ImSuccessWithNoResult(t *testing.T) {
+	repo := makeNewImRepo(t)
+	variant, err := repo.GetVariant(context.Background(), "unknown")
+
+	ok(t, err)
+	assert(t, variant == nil, "expected variant to be nil")
+}
+
+// TestCreateProduct_ImFailVariantExists ensures a product can not be created with a variant SKU that is already in
+// use by another product.
+func TestCreateProduct_ImFailVariantExists(t *testing.T) {
+	repo := makeNewImRepo(t)
+	product := makeTestProduct("A")
+	product.Variants = []common.Variant{{Sku: "13-S"}}
+	_, err := repo.CreateProduct(context.Background(), product)
+
+	equals(t, repository.ErrVariantExists, err)
+}
+
+// TestUpdateProduct_ImSuccessWithVariants ensures a product's variants can be replaced and then resolved by SKU.
+func TestUpdateProduct_ImSuccessWithVariants(t *testing.T) {
+	repo := makeNewImRepo(t)
+	product, err := repo.GetProduct(context.Background(), "13")
+	ok(t, err)
+
+	product.Variants = append(product.Variants, common.Variant{Sku: "13-XL", Options: map[string]string{"size": "XL"}})
+	updated, err := repo.UpdateProduct(context.Background(), *product)
+
+	ok(t, err)
+	equals(t, 4, len(updated.Variants))
+
+	variant, err := repo.GetVariant(context.Background(), "13-XL")
+
+	ok(t, err)
+	assert(t, variant != nil, "Expected variant to not be nil")
+	equals(t, "13", variant.ProductId)
+}
+
+// TestReserveProduct_ImSuccess ensures that reserving units of a product removes them from stock until released.
+func TestReserveProduct_ImSuccess(t *testing.T) {
+	repo := makeNewImRepo(t)
+	reservation, err := repo.ReserveProduct(context.Background(), "2", 10, time.Minute)
+
+	ok(t, err)
+	equals(t, common.ReservationPending, reservation.Status)
+	product, err := repo.GetProduct(context.Background(), "2")
+	ok(t, err)
+	equals(t, 990, product.QtyInStock)
+
+	reservation, err = repo.ReleaseReservation(context.Background(), "2", reservation.Id)
+
+	ok(t, err)
+	equals(t, common.ReservationReleased, reservation.Status)
+	product, err = repo.GetProduct(context.Background(), "2")
+	ok(t, err)
+	equals(t, 1000, product.QtyInStock)
+}
+
+// TestCommitReservation_ImSuccess ensures that committing a reservation keeps its units out of stock and that it can
+// not be closed again.
+func TestCommitReservation_ImSuccess(t *testing.T) {
+	repo := makeNewImRepo(t)
+	reservation, err := repo.ReserveProduct(context.Background(), "2", 10, time.Minute)
+	ok(t, err)
+
+	reservation, err = repo.CommitReservation(context.Background(), "2", reservation.Id)
+
+	ok(t, err)
+	equals(t, common.ReservationCommitted, reservation.Status)
+	product, err := repo.GetProduct(context.Background(), "2")
+	ok(t, err)
+	equals(t, 990, product.QtyInStock)
+
+	_, err = repo.ReleaseReservation(context.Background(), "2", reservation.Id)
+	equals(t, repository.ErrReservationNotActive, err)
+}
+
+// TestReserveProduct_ImFailInsufficientStock ensures that more units than are in stock can not be reserved.
+func TestReserveProduct_ImFailInsufficientStock(t *testing.T) {
+	repo := makeNewImRepo(t)
+	_, err := repo.ReserveProduct(context.Background(), "1", 2, time.Minute)
+
+	equals(t, repository.ErrInsufficientStock, err)
+}
+
+// TestReserveProduct_ImFailNotFound ensures that a product that does not exist can not be reserved.
+func TestReserveProduct_ImFailNotFound(t *testing.T) {
+	repo := makeNewImRepo(t)
+	_, err := repo.ReserveProduct(context.Background(), "unknown", 1, time.Minute)
+
+	equals(t, repository.ErrProductNotFound, err)
+}
+
+// TestCommitReservation_ImFailNotFound ensures that a reservation can only be committed through the product it holds.
+func TestCommitReservation_ImFailNotFound(t *testing.T) {
+	repo := makeNewImRepo(t)
+	reservation, err := repo.ReserveProduct(context.Background(), "2", 1, time.Minute)
+	ok(t, err)
+
+	_, err = repo.CommitReservation(context.Background(), "3", reservation.Id)
+
+	equals(t, repository.ErrReservationNotFound, err)
+}
+
+// TestExpireReservations_ImSuccess ensures that expired reservations return their units to stock and can no longer be
+// committed.
+func TestExpireReservations_ImSuccess(t *testing.T) {
+	repo := makeNewImRepo(t)
+	reservation, err := repo.ReserveProduct(context.Background(), "2", 10, time.Nanosecond)
+	ok(t, err)
+	time.Sleep(time.Millisecond)
+
+	expired, err := repo.ExpireReservations(context.Background())
+
+	ok(t, err)
+	equals(t, 1, expired)
+	product, err := repo.GetProduct(context.Background(), "2")
+	ok(t, err)
+	equals(t, 1000, product.QtyInStock)
+
+	_, err = repo.CommitReservation(context.Background(), "2", reservation.Id)
+	equals(t, repository.ErrReservationNotActive, err)
+}
+
+// TestReserveProduct_ImConcurrent ensures that concurrent reservations can not oversell a product.
+func TestReserveProduct_ImConcurrent(t *testing.T) {
+	repo := makeNewImRepo(t)
+	var wg sync.WaitGroup
+	var reserved int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := repo.ReserveProduct(context.Background(), "14", 1, time.Minute); err == nil {
+				atomic.AddInt32(&reserved, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	equals(t, int32(5), reserved)
+	product, err := repo.GetProduct(context.Background(), "14")
+	ok(t, err)
+	equals(t, 0, product.QtyInStock)
+}
+
+// TestGetProducts_ImConcurrentWrites ensures that products can be read and searched while they are being written, with
+// every read seeing a consistent catalog and every search retrieving products from the catalog its index matches, so
+// that they satisfy its text and filter. Run with -race to detect unsynchronized access.
+func TestGetProducts_ImConcurrentWrites(t *testing.T) {
+	repo := makeNewImRepo(t)
+	orderBy := common.OrderBy{}
+	ok(t, orderBy.Add(common.OrderByName))
+
+	var writers, readers sync.WaitGroup
+	done := make(chan struct{})
+	errs := make(chan error, 100)
+	for i := 0; i < 4; i++ {
+		writers.Add(1)
+		go func(i int) {
+			defer writers.Done()
+			for j := 0; j < 25; j++ {
+				id := fmt.Sprintf("W%d-%d", i, j)
+				product := makeTestProduct(id)
+				product.Name = fmt.Sprintf("Test Product %d", 25-j)
+				if _, err := repo.CreateProduct(context.Background(), product); err != nil {
+					errs <- err
+					return
+				}
+
+				product.Name = fmt.Sprintf("Updated Product %d", j)
+				if _, err := repo.UpdateProduct(context.Background(), product); err != nil {
+					errs <- err
+					return
+				}
+
+				reservation, err := repo.ReserveProduct(context.Background(), id, product.QtyInStock, time.Minute)
+				if err != nil {
+					errs <- err
+					return
+				} else if _, err := repo.ReleaseReservation(context.Background(), id, reservation.Id); err != nil {
+					errs <- err
+					return
+				}
+
+				if j%2 == 0 {
+					if err := repo.DeleteProduct(context.Background(), id); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+		}(i)
+	}
+
+	for i := 0; i < 8; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				products, err := repo.GetProducts(context.Background(), 100, "", orderBy, common.ProductFilter{})
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				for j := 1; j < len(products.Products); j++ {
+					if products.Products[j-1].Name > products.Products[j].Name {
+						errs <- fmt.Errorf("products %s and %s are out of order", products.Products[j-1].Id,
+							products.Products[j].Id)
+						return
+					}
+				}
+
+				inStock := true
+				products, err = repo.SearchProducts(context.Background(), "product", 100, "", orderBy,
+					common.ProductFilter{InStock: &inStock}, common.SearchOptions{})
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				for j, product := range products.Products {
+					if product.QtyInStock <= 0 {
+						errs <- fmt.Errorf("product %s found in stock is out of stock", product.Id)
+						return
+					} else if j > 0 && products.Products[j-1].Name > product.Name {
+						errs <- fmt.Errorf("products %s and %s found are out of order", products.Products[j-1].Id,
+							product.Id)
+						return
+					}
+				}
+
+				// products are named "Updated" by their first update, which is indexed along with the catalog holding it
+				products, err = repo.SearchProducts(context.Background(), "updated", 100, "", orderBy,
+					common.ProductFilter{}, common.SearchOptions{})
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				for _, product := range products.Products {
+					if !strings.HasPrefix(product.Name, "Updated") {
+						errs <- fmt.Errorf("product %s found by its updated name is named %s", product.Id,
+							product.Name)
+						return
+					}
+				}
+
+				if _, err := repo.GetProduct(context.Background(), "W0-1"); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	writers.Wait()
+	close(done)
+	readers.Wait()
+	close(errs)
+
+	for err := range errs {
+		ok(t, err)
+	}
+
+	products, err := repo.GetProducts(context.Background(), 100, "", orderBy,
+		common.ProductFilter{Ids: []string{"W0-0", "W0-1", "W3-24"}})
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, "Updated Product 1", products.Products[0].Name)
+	equals(t, 5, products.Products[0].QtyInStock)
+}
+
+// TestGetProducts_ImSuccessOrderByPriceInCurrency ensures that products can be sorted and filtered by their price in
+// a currency other than the default.
+func TestGetProducts_ImSuccessOrderByPriceInCurrency(t *testing.T) {
+	repo := makeNewImRepo(t)
+
+	orderBy := common.OrderBy{}
+	orderBy.Add(common.OrderByPrice)
+	minPrice := decimal.NewFromFloat(3000)
+	filter := common.ProductFilter{Currency: common.CurrencyEUR, MinPrice: &minPrice}
+	products, err := repo.GetProducts(context.Background(), 2, "", orderBy, filter)
+
+	ok(t, err)
+	equals(t, 2, len(products.Products))
+	equals(t, "19", products.Products[0].Id)
+	equals(t, "6", products.Products[1].Id)
+
+	products, err = repo.GetProducts(context.Background(), 2, products.Cursor, orderBy, filter)
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, "8", products.Products[0].Id)
+}
+
+// TestGetProducts_ImSuccessExcludesUnpricedCurrency ensures that products without a price in the requested currency
+// are excluded.
+func TestGetProducts_ImSuccessExcludesUnpricedCurrency(t *testing.T) {
+	repo := makeNewImRepo(t)
+	_, err := repo.CreateProduct(context.Background(), makeTestProduct("A"))
+	ok(t, err)
+
+	products, err := repo.GetProducts(context.Background(), 30, "", common.OrderBy{}, common.ProductFilter{})
+	ok(t, err)
+	equals(t, 21, len(products.Products))
+
+	filter := common.ProductFilter{Currency: common.CurrencyJPY}
+	products, err = repo.GetProducts(context.Background(), 30, "", common.OrderBy{}, filter)
+	ok(t, err)
+	equals(t, 20, len(products.Products))
+}
+
+// TestGetProducts_ImFailMismatchedCurrencyCursor ensures that a cursor issued for prices in a different currency is
+// rejected.
+func TestGetProducts_ImFailMismatchedCurrencyCursor(t *testing.T) {
+	repo := makeNewImRepo(t)
+
+	orderBy := common.OrderBy{}
+	orderBy.Add(common.OrderByPrice)
+	products, err := repo.GetProducts(context.Background(), 5, "", orderBy, common.ProductFilter{})
+	ok(t, err)
+
+	filter := common.ProductFilter{Currency: common.CurrencyJPY}
+	_, err = repo.GetProducts(context.Background(), 5, products.Cursor, orderBy, filter)
+
+	equals(t, repository.ErrInvalidCursor, err)
+}
+
+// datasetConfiguration configures a repo loading the dataset at path.
+type datasetConfiguration struct {
+	configuration
+	path string
+}
+
+func (dc datasetConfiguration) GetInitDataSet() string {
+	return dc.path
+}
+
+// TestMakeInMemoryRepository_SuccessUpsert ensures that dataset entries sharing an id are loaded once, the latest entry
+// replacing earlier ones.
+func TestMakeInMemoryRepository_SuccessUpsert(t *testing.T) {
+	file, err := ioutil.TempFile("", "dataset")
+	ok(t, err)
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(`{
+		"categories": [{"id": "tools", "name": "Tools"}, {"id": "tools", "name": "Tools"}],
+		"products": [
+			{"id": "A", "name": "First", "price": "1.00", "categories": ["tools"]},
+			{"id": "A", "name": "Second", "price": "2.00", "categories": ["tools"]}
+		]
+	}`)
+	ok(t, err)
+	ok(t, file.Close())
+
+	repo, err := repository.MakeInMemoryRepository(datasetConfiguration{inMemoryEmpty, file.Name()})
+	ok(t, err)
+
+	categories, err := repo.GetCategories(context.Background())
+	ok(t, err)
+	equals(t, 1, len(categories))
+
+	products, err := repo.GetProducts(context.Background(), 5, "", common.OrderBy{}, common.ProductFilter{})
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, "Second", products.Products[0].Name)
 }
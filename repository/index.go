@@ -0,0 +1,302 @@
+package repository
+
+import (
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/analysis/lang/en"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/search"
+	"github.com/blevesearch/bleve/search/query"
+	"github.com/stone1549/product-service/common"
+	"math"
+	"strings"
+	"time"
+)
+
+// Fields of the product documents held in the index.
+const (
+	nameField             = "name"
+	nameWordsField        = "nameWords"
+	wordsField            = "words"
+	idField               = "id"
+	shortDescriptionField = "shortDescription"
+	descriptionField      = "description"
+	categoriesField       = "categories"
+	pricesField           = "prices"
+	qtyInStockField       = "qtyInStock"
+	createdAtField        = "createdAt"
+	updatedAtField        = "updatedAt"
+)
+
+// searchField is a text field of the index matched by search text, along with the boost given to its matches.
+type searchField struct {
+	name  string
+	boost float64
+}
+
+// searchFields are boosted like the A, B, C and D weights of the PostgreSQL text search vector, so that a name match
+// outranks a description match on both backends.
+var searchFields = []searchField{
+	{nameField, 1.0},
+	{idField, 0.4},
+	{shortDescriptionField, 0.2},
+	{descriptionField, 0.1},
+}
+
+// productDocument holds the fields of a product as stored in the index. Text is stored so that it can be highlighted,
+// prices are keyed by currency and hold the price of the product in every currency it is sold in.
+type productDocument struct {
+	Name             string                      `json:"name"`
+	Id               string                      `json:"id"`
+	ShortDescription string                      `json:"shortDescription"`
+	Description      string                      `json:"description"`
+	CategoryIds      []string                    `json:"categories"`
+	Prices           map[common.Currency]float64 `json:"prices"`
+	QtyInStock       int                         `json:"qtyInStock"`
+	CreatedAt        *time.Time                  `json:"createdAt"`
+	UpdatedAt        *time.Time                  `json:"updatedAt"`
+}
+
+// newProductDocument builds the document indexing the given product.
+func newProductDocument(product common.Product) productDocument {
+	doc := productDocument{
+		Name:        product.Name,
+		Id:          product.Id,
+		CategoryIds: product.CategoryIds,
+		Prices:      make(map[common.Currency]float64),
+		QtyInStock:  product.QtyInStock,
+		CreatedAt:   product.CreatedAt,
+		UpdatedAt:   product.UpdatedAt,
+	}
+
+	if product.ShortDescription != nil {
+		doc.ShortDescription = *product.ShortDescription
+	}
+	if product.Description != nil {
+		doc.Description = *product.Description
+	}
+
+	currencies := []common.Currency{common.DefaultCurrency}
+	for currency := range product.Prices {
+		currencies = append(currencies, currency)
+	}
+
+	for _, currency := range currencies {
+		if price := product.PriceIn(currency); price != nil {
+			doc.Prices[currency], _ = price.Float64()
+		}
+	}
+
+	return doc
+}
+
+func indexProduct(idx bleve.Index, product common.Product) error {
+	return idx.Index(product.Id, newProductDocument(product))
+}
+
+func newTextFieldMapping(analyzer string) *mapping.FieldMapping {
+	fieldMapping := bleve.NewTextFieldMapping()
+	fieldMapping.Analyzer = analyzer
+	return fieldMapping
+}
+
+// newWordsFieldMapping builds the mapping of a text field indexed unstemmed under the given name, for its words to be
+// looked up rather than searched.
+func newWordsFieldMapping(name string) *mapping.FieldMapping {
+	fieldMapping := newTextFieldMapping(standard.Name)
+	fieldMapping.Name = name
+	fieldMapping.Store = false
+	fieldMapping.IncludeTermVectors = false
+	fieldMapping.IncludeInAll = false
+	return fieldMapping
+}
+
+// newProductIndexMapping builds the mapping of product documents. Text is stemmed like the english configuration of
+// the PostgreSQL text search vector, the name is also indexed unstemmed so that it can be completed from a prefix, and
+// the name and descriptions together so that the dictionary of their words holds the candidates of fuzzy search words.
+// Categories are matched as a whole and prices, stock and timestamps are indexed so that they can be filtered on.
+func newProductIndexMapping() *mapping.IndexMappingImpl {
+	product := bleve.NewDocumentStaticMapping()
+	product.AddFieldMappingsAt(nameField, newTextFieldMapping(en.AnalyzerName), newWordsFieldMapping(nameWordsField),
+		newWordsFieldMapping(wordsField))
+	product.AddFieldMappingsAt(idField, newTextFieldMapping(en.AnalyzerName))
+	product.AddFieldMappingsAt(shortDescriptionField, newTextFieldMapping(en.AnalyzerName),
+		newWordsFieldMapping(wordsField))
+	product.AddFieldMappingsAt(descriptionField, newTextFieldMapping(en.AnalyzerName),
+		newWordsFieldMapping(wordsField))
+	product.AddFieldMappingsAt(categoriesField, newTextFieldMapping(keyword.Name))
+	product.AddFieldMappingsAt(qtyInStockField, bleve.NewNumericFieldMapping())
+	product.AddFieldMappingsAt(createdAtField, bleve.NewDateTimeFieldMapping())
+	product.AddFieldMappingsAt(updatedAtField, bleve.NewDateTimeFieldMapping())
+	// prices are keyed by currency code, the dynamic mapping indexes each of them as a number
+	product.AddSubDocumentMapping(pricesField, bleve.NewDocumentMapping())
+
+	result := bleve.NewIndexMapping()
+	result.DefaultMapping = product
+	return result
+}
+
+// bleveQuery compiles the given query into an equivalent bleve query, with required words matching fuzzily when fuzzy
+// is true.
+func bleveQuery(parsed common.SearchQuery, fuzzy bool) *query.BooleanQuery {
+	result := bleve.NewBooleanQuery()
+	for _, group := range parsed.Required {
+		if len(group) == 1 {
+			result.AddMust(bleveTermQuery(group[0], fuzzy))
+			continue
+		}
+
+		alternatives := make([]query.Query, len(group))
+		for i, term := range group {
+			alternatives[i] = bleveTermQuery(term, fuzzy)
+		}
+
+		result.AddMust(bleve.NewDisjunctionQuery(alternatives...))
+	}
+
+	for _, term := range parsed.Excluded {
+		result.AddMustNot(bleveTermQuery(term, false))
+	}
+
+	return result
+}
+
+// bleveTermQuery compiles the given term into a bleve query matching it in any of the search fields.
+func bleveTermQuery(term common.SearchTerm, fuzzy bool) query.Query {
+	fields := make([]query.Query, len(searchFields))
+	for i, field := range searchFields {
+		fields[i] = bleveFieldQuery(term, fuzzy, field)
+	}
+
+	return bleve.NewDisjunctionQuery(fields...)
+}
+
+// bleveFieldQuery compiles the given term into a bleve query matching it in the given field, single words match
+// fuzzily when fuzzy is true. Phrases cannot end in a prefix, so a prefixed phrase matches the phrase without its last
+// word along with any word starting with the prefix.
+func bleveFieldQuery(term common.SearchTerm, fuzzy bool, field searchField) query.Query {
+	last := len(term.Words) - 1
+	if !term.Prefix {
+		if last == 0 {
+			match := bleve.NewMatchQuery(term.Words[0])
+			match.SetField(field.name)
+			match.SetBoost(field.boost)
+			if fuzzy {
+				match.SetFuzziness(common.Fuzziness(term.Words[0]))
+			}
+
+			return match
+		}
+
+		phrase := bleve.NewMatchPhraseQuery(strings.Join(term.Words, " "))
+		phrase.SetField(field.name)
+		phrase.SetBoost(field.boost)
+		return phrase
+	}
+
+	prefix := bleveFieldPrefixQuery(term.Words[last], field)
+	if last == 0 {
+		return prefix
+	}
+
+	phrase := bleve.NewMatchPhraseQuery(strings.Join(term.Words[:last], " "))
+	phrase.SetField(field.name)
+	phrase.SetBoost(field.boost)
+	return bleve.NewConjunctionQuery(phrase, prefix)
+}
+
+// bleveFieldPrefixQuery matches any word of the given field starting with the given prefix. Prefixes are not
+// analyzed while the words of the field are stemmed, so the prefix also matches the word it spells out on its own.
+func bleveFieldPrefixQuery(word string, field searchField) query.Query {
+	prefix := bleve.NewPrefixQuery(word)
+	prefix.SetField(field.name)
+	prefix.SetBoost(field.boost)
+
+	match := bleve.NewMatchQuery(word)
+	match.SetField(field.name)
+	match.SetBoost(field.boost)
+	return bleve.NewDisjunctionQuery(prefix, match)
+}
+
+// bleveFilterQueries compiles the given filter into bleve queries that every product satisfying it matches. categoryIds
+// holds the filter's category ids expanded by expandCategoryIds.
+func bleveFilterQueries(filter common.ProductFilter, categoryIds map[string]bool) []query.Query {
+	var result []query.Query
+	inclusive, exclusive := true, false
+
+	// products without a price in the default currency are only excluded by a price range
+	currency := filter.PriceCurrency()
+	if currency != common.DefaultCurrency || filter.MinPrice != nil || filter.MaxPrice != nil {
+		min := -math.MaxFloat64
+		if filter.MinPrice != nil {
+			min, _ = filter.MinPrice.Float64()
+		}
+
+		var max *float64
+		if filter.MaxPrice != nil {
+			value, _ := filter.MaxPrice.Float64()
+			max = &value
+		}
+
+		price := bleve.NewNumericRangeInclusiveQuery(&min, max, &inclusive, &inclusive)
+		price.SetField(pricesField + "." + string(currency))
+		result = append(result, price)
+	}
+
+	if filter.InStock != nil {
+		one := 1.0
+		stock := bleve.NewNumericRangeInclusiveQuery(&one, nil, &inclusive, nil)
+		if !*filter.InStock {
+			stock = bleve.NewNumericRangeInclusiveQuery(nil, &one, nil, &exclusive)
+		}
+
+		stock.SetField(qtyInStockField)
+		result = append(result, stock)
+	}
+
+	if filter.CreatedAfter != nil {
+		created := bleve.NewDateRangeInclusiveQuery(*filter.CreatedAfter, time.Time{}, &exclusive, nil)
+		created.SetField(createdAtField)
+		result = append(result, created)
+	}
+
+	if filter.UpdatedSince != nil {
+		updated := bleve.NewDateRangeInclusiveQuery(*filter.UpdatedSince, time.Time{}, &inclusive, nil)
+		updated.SetField(updatedAtField)
+		result = append(result, updated)
+	}
+
+	if len(filter.Ids) > 0 {
+		result = append(result, bleve.NewDocIDQuery(filter.Ids))
+	}
+
+	if len(filter.CategoryIds) > 0 {
+		categories := bleve.NewDisjunctionQuery()
+		for id := range categoryIds {
+			category := bleve.NewTermQuery(id)
+			category.SetField(categoriesField)
+			categories.AddQuery(category)
+		}
+
+		result = append(result, categories)
+	}
+
+	return result
+}
+
+// newSearchHit builds a SearchHit from the given index match, with the highlighted fragments of the match when
+// highlight is true.
+func newSearchHit(match *search.DocumentMatch, highlight bool) common.SearchHit {
+	hit := common.SearchHit{Score: match.Score}
+	if highlight {
+		hit.Highlights = make(map[string][]string)
+		for _, field := range []string{common.HighlightName, common.HighlightDescription} {
+			if fragments, ok := match.Fragments[field]; ok {
+				hit.Highlights[field] = fragments
+			}
+		}
+	}
+
+	return hit
+}
@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"github.com/stone1549/product-service/common"
+	"time"
+)
+
+const (
+	// migrationLockKey identifies the advisory lock held while migrating, so that instances of the service starting
+	// together do not migrate the same database at once. The value is arbitrary but must never change.
+	migrationLockKey           int64 = 7153406911
+	lockMigrationQuery               = "SELECT pg_advisory_xact_lock($1)"
+	createMigrationsTableQuery       = `CREATE TABLE IF NOT EXISTS schema_migrations (
+									version int PRIMARY KEY,
+									applied_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC')
+								  )`
+	listMigrationsQuery  = "SELECT version, applied_at FROM schema_migrations ORDER BY version"
+	insertMigrationQuery = "INSERT INTO schema_migrations (version) VALUES ($1)"
+	deleteMigrationQuery = "DELETE FROM schema_migrations WHERE version=$1"
+	// undefinedTableCode is the PostgreSQL error code raised when a table does not exist.
+	undefinedTableCode = "42P01"
+)
+
+// Migration describes a migration of the PostgreSQL schema, applied at AppliedAt or pending when nil.
+type Migration struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// queryer is implemented by both sql.DB and sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// appliedMigrations retrieves when each applied migration was applied by version, none if the migrations table does not
+// exist yet.
+func appliedMigrations(ctx context.Context, db queryer) (map[int]time.Time, error) {
+	rows, err := db.QueryContext(ctx, listMigrationsQuery)
+
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == undefinedTableCode {
+		return map[int]time.Time{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		err = rows.Scan(&version, &appliedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// migrationStatus describes every known migration, along with when it was applied if it was.
+func migrationStatus(applied map[int]time.Time) []Migration {
+	result := make([]Migration, len(postgresqlMigrations))
+	for i, m := range postgresqlMigrations {
+		result[i] = Migration{Version: m.version, Name: m.name}
+
+		if appliedAt, ok := applied[m.version]; ok {
+			result[i].AppliedAt = &appliedAt
+		}
+	}
+
+	return result
+}
+
+// beginMigration begins a transaction holding the migration lock, in which the migrations table exists.
+func beginMigration(ctx context.Context, db *sql.DB) (*sql.Tx, error) {
+	txn, err := db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = txn.ExecContext(ctx, lockMigrationQuery, migrationLockKey)
+
+	if err == nil {
+		_, err = txn.ExecContext(ctx, createMigrationsTableQuery)
+	}
+
+	if err != nil {
+		txn.Rollback()
+		return nil, err
+	}
+
+	return txn, nil
+}
+
+// PostgresqlMigrationStatus describes every migration of the PostgreSQL schema, in the order they are applied.
+func PostgresqlMigrationStatus(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	applied, err := appliedMigrations(ctx, db)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return migrationStatus(applied), nil
+}
+
+// MigratePostgresqlUp applies every pending migration of the PostgreSQL schema, in order, returning the migrations
+// applied. Either every pending migration is applied or none are.
+func MigratePostgresqlUp(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	txn, err := beginMigration(ctx, db)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer txn.Rollback()
+
+	applied, err := appliedMigrations(ctx, txn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Migration, 0)
+	for _, m := range postgresqlMigrations {
+		if _, ok := applied[m.version]; ok {
+			continue
+		}
+
+		_, err = txn.ExecContext(ctx, m.up)
+
+		if err == nil {
+			_, err = txn.ExecContext(ctx, insertMigrationQuery, m.version)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, Migration{Version: m.version, Name: m.name})
+	}
+
+	return result, txn.Commit()
+}
+
+// MigratePostgresqlDown reverts the latest applied migration of the PostgreSQL schema, returning the migration reverted
+// or nil if none are applied.
+func MigratePostgresqlDown(ctx context.Context, db *sql.DB) (*Migration, error) {
+	txn, err := beginMigration(ctx, db)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer txn.Rollback()
+
+	applied, err := appliedMigrations(ctx, txn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(postgresqlMigrations) - 1; i >= 0; i-- {
+		m := postgresqlMigrations[i]
+		if _, ok := applied[m.version]; !ok {
+			continue
+		}
+
+		if m.down != "" {
+			_, err = txn.ExecContext(ctx, m.down)
+		}
+
+		if err == nil {
+			_, err = txn.ExecContext(ctx, deleteMigrationQuery, m.version)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Migration{Version: m.version, Name: m.name}, txn.Commit()
+	}
+
+	return nil, nil
+}
+
+// CheckPostgresqlSchema returns ErrSchemaOutdated if a migration of the PostgreSQL schema is pending, or
+// ErrSchemaUnknown if a migration unknown to this version of the service has been applied.
+func CheckPostgresqlSchema(ctx context.Context, db *sql.DB) error {
+	applied, err := appliedMigrations(ctx, db)
+
+	if err != nil {
+		return err
+	}
+
+	for _, m := range postgresqlMigrations {
+		if _, ok := applied[m.version]; !ok {
+			return ErrSchemaOutdated
+		}
+	}
+
+	if len(applied) > len(postgresqlMigrations) {
+		return ErrSchemaUnknown
+	}
+
+	return nil
+}
+
+// PreparePostgresqlSchema ensures the schema of the configured PostgreSQL database matches the repository, applying
+// pending migrations first when auto migration is configured.
+func PreparePostgresqlSchema(ctx context.Context, config common.Configuration) error {
+	db, err := sql.Open("postgres", config.GetPgUrl())
+
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	if config.GetAutoMigrate() {
+		_, err = MigratePostgresqlUp(ctx, db)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return CheckPostgresqlSchema(ctx, db)
+}
@@ -0,0 +1,167 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"github.com/lib/pq"
+	"github.com/stone1549/product-service/repository"
+	"gopkg.in/DATA-DOG/go-sqlmock.v2"
+	"testing"
+	"time"
+)
+
+// mockAppliedMigrations expects the applied migrations to be listed, returning the given versions.
+func mockAppliedMigrations(mock sqlmock.Sqlmock, versions ...int) {
+	rows := sqlmock.NewRows([]string{"version", "applied_at"})
+	for _, version := range versions {
+		rows.AddRow(version, time.Now())
+	}
+
+	mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").WillReturnRows(rows)
+}
+
+// mockBeginMigration expects a transaction holding the migration lock to be begun and the migrations table created.
+func mockBeginMigration(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+// TestMigratePostgresqlUp_Success ensures that only pending migrations are applied, in order, and recorded.
+func TestMigratePostgresqlUp_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	ok(t, err)
+	defer db.Close()
+
+	mockBeginMigration(mock)
+	mockAppliedMigrations(mock, 1, 2, 3, 4, 5)
+	mock.ExpectExec("CREATE INDEX IF NOT EXISTS product_name_suggest_idx").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(6).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("CREATE EXTENSION IF NOT EXISTS pg_trgm").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("ADD COLUMN IF NOT EXISTS content_hash").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(8).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS product_word").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(9).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("ALTER COLUMN price SET NOT NULL").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(10).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	applied, err := repository.MigratePostgresqlUp(context.Background(), db)
+
+	ok(t, err)
+	equals(t, 5, len(applied))
+	equals(t, 6, applied[0].Version)
+	equals(t, 10, applied[4].Version)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestMigratePostgresqlUp_SuccessAdoptedSchema ensures that a database whose schema was applied by hand, leaving
+// product columns nullable and sort columns indexed alone, is brought in line with migrated databases.
+func TestMigratePostgresqlUp_SuccessAdoptedSchema(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	ok(t, err)
+	defer db.Close()
+
+	mockBeginMigration(mock)
+	mockAppliedMigrations(mock)
+	for version, query := range []string{
+		"CREATE TABLE IF NOT EXISTS product \\(",
+		"CREATE TABLE IF NOT EXISTS category",
+		"CREATE TABLE IF NOT EXISTS product_variant",
+		"CREATE TABLE IF NOT EXISTS product_reservation",
+		"CREATE TABLE IF NOT EXISTS product_price",
+		"CREATE INDEX IF NOT EXISTS product_name_suggest_idx",
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"ADD COLUMN IF NOT EXISTS content_hash",
+		"CREATE TABLE IF NOT EXISTS product_word",
+		"(?s)WHERE created_at IS NULL.*ALTER COLUMN price SET NOT NULL.*ALTER COLUMN created_at SET NOT NULL" +
+			".*indnatts = 1.*DROP INDEX.*product_name_idx ON product \\(name, id\\)" +
+			".*product_price_idx ON product \\(price, id\\)",
+	} {
+		mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(version + 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	applied, err := repository.MigratePostgresqlUp(context.Background(), db)
+
+	ok(t, err)
+	equals(t, 10, len(applied))
+	equals(t, 10, applied[9].Version)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestMigratePostgresqlUp_FailRollback ensures that no migrations are applied when one of them fails.
+func TestMigratePostgresqlUp_FailRollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	ok(t, err)
+	defer db.Close()
+
+	mockBeginMigration(mock)
+	mockAppliedMigrations(mock, 1, 2, 3, 4, 5)
+	mock.ExpectExec("CREATE INDEX IF NOT EXISTS product_name_suggest_idx").WillReturnError(errors.New("failed"))
+	mock.ExpectRollback()
+
+	_, err = repository.MigratePostgresqlUp(context.Background(), db)
+
+	notOk(t, err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestMigratePostgresqlDown_Success ensures that only the latest applied migration is reverted.
+func TestMigratePostgresqlDown_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	ok(t, err)
+	defer db.Close()
+
+	mockBeginMigration(mock)
+	mockAppliedMigrations(mock, 1, 2, 3, 4, 5, 6)
+	mock.ExpectExec("DROP INDEX IF EXISTS product_name_suggest_idx").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM schema_migrations").WithArgs(6).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	reverted, err := repository.MigratePostgresqlDown(context.Background(), db)
+
+	ok(t, err)
+	equals(t, 6, reverted.Version)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestPostgresqlMigrationStatus_Success ensures that every migration is listed, pending when the migrations table does
+// not exist yet.
+func TestPostgresqlMigrationStatus_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	ok(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").
+		WillReturnError(&pq.Error{Code: "42P01"})
+
+	migrations, err := repository.PostgresqlMigrationStatus(context.Background(), db)
+
+	ok(t, err)
+	equals(t, 10, len(migrations))
+	for _, m := range migrations {
+		assert(t, m.AppliedAt == nil, "Expected migration %d to be pending", m.Version)
+	}
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestCheckPostgresqlSchema ensures that the schema is only accepted when every migration, and no unknown migration,
+// has been applied.
+func TestCheckPostgresqlSchema(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	ok(t, err)
+	defer db.Close()
+
+	mockAppliedMigrations(mock, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+	mockAppliedMigrations(mock, 1, 2, 3)
+	mockAppliedMigrations(mock, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11)
+
+	ok(t, repository.CheckPostgresqlSchema(context.Background(), db))
+	equals(t, repository.ErrSchemaOutdated, repository.CheckPostgresqlSchema(context.Background(), db))
+	equals(t, repository.ErrSchemaUnknown, repository.CheckPostgresqlSchema(context.Background(), db))
+	ok(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,285 @@
+package repository
+
+// migration is a numbered change to the PostgreSQL schema, applied by up and reverted by down. Migrations only create
+// what does not exist yet and only drop what exists, so that databases whose schema was applied by hand can adopt them.
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// postgresqlMigrations lists every migration of the PostgreSQL schema in the order they are applied. Applied
+// migrations must never be changed, changes to the schema are made by appending migrations.
+var postgresqlMigrations = []migration{
+	{
+		version: 1,
+		name:    "create product",
+		up: `
+CREATE TABLE IF NOT EXISTS product (
+  id text PRIMARY KEY,
+  name text NOT NULL,
+  display_image text,
+  thumbnail text,
+  price numeric(15,6) NOT NULL,
+  description text,
+  short_description text,
+  qty_in_stock int NOT NULL DEFAULT 0,
+  created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC'),
+  updated_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC'),
+  textsearchable_index_col tsvector
+);
+
+-- Sort columns are indexed together with id, which the repository uses as a tiebreaker for keyset pagination.
+CREATE INDEX IF NOT EXISTS product_name_idx ON product (name, id);
+CREATE INDEX IF NOT EXISTS product_price_idx ON product (price, id);
+CREATE INDEX IF NOT EXISTS product_textsearch_idx ON product USING GIN (textsearchable_index_col);
+CREATE INDEX IF NOT EXISTS product_created_at_idx ON product (created_at, id);
+CREATE INDEX IF NOT EXISTS product_updated_at_idx ON product (updated_at, id);
+
+CREATE OR REPLACE FUNCTION product_search_update_func() RETURNS trigger AS $$
+begin
+  new.textsearchable_index_col :=
+  setweight(to_tsvector('pg_catalog.english', coalesce(new.name,'')), 'A') ||
+  setweight(to_tsvector('pg_catalog.english', coalesce(new.id,'')), 'B') ||
+  setweight(to_tsvector('pg_catalog.english', coalesce(new.short_description,'')), 'C') ||
+  setweight(to_tsvector('pg_catalog.english', coalesce(new.description,'')), 'D');
+  return new;
+end
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS product_search_update_trg ON product;
+CREATE TRIGGER product_search_update_trg BEFORE INSERT OR UPDATE
+  ON product FOR EACH ROW EXECUTE PROCEDURE product_search_update_func();
+
+CREATE OR REPLACE FUNCTION set_updated_at()
+  RETURNS TRIGGER AS $$
+BEGIN
+  NEW.updated_at = NOW();
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS product_set_updated_at_trg ON product;
+CREATE TRIGGER product_set_updated_at_trg
+  BEFORE UPDATE ON product
+  FOR EACH ROW
+EXECUTE PROCEDURE set_updated_at();
+`,
+		down: `
+DROP TABLE IF EXISTS product;
+DROP FUNCTION IF EXISTS product_search_update_func();
+DROP FUNCTION IF EXISTS set_updated_at();
+`,
+	},
+	{
+		version: 2,
+		name:    "create category",
+		up: `
+CREATE TABLE IF NOT EXISTS category (
+  id text PRIMARY KEY,
+  name text NOT NULL,
+  parent_id text REFERENCES category (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS category_parent_id_idx ON category (parent_id);
+
+CREATE TABLE IF NOT EXISTS product_category (
+  product_id text NOT NULL REFERENCES product (id) ON DELETE CASCADE,
+  category_id text NOT NULL REFERENCES category (id) ON DELETE CASCADE,
+  PRIMARY KEY (product_id, category_id)
+);
+
+CREATE INDEX IF NOT EXISTS product_category_category_id_idx ON product_category (category_id);
+`,
+		down: `
+DROP TABLE IF EXISTS product_category;
+DROP TABLE IF EXISTS category;
+`,
+	},
+	{
+		version: 3,
+		name:    "create product variant",
+		up: `
+CREATE TABLE IF NOT EXISTS product_variant (
+  sku text PRIMARY KEY,
+  product_id text NOT NULL REFERENCES product (id) ON DELETE CASCADE,
+  options jsonb NOT NULL DEFAULT '{}',
+  price numeric(15,6),
+  qty_in_stock int NOT NULL DEFAULT 0,
+  images text[] NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS product_variant_product_id_idx ON product_variant (product_id);
+`,
+		down: `
+DROP TABLE IF EXISTS product_variant;
+`,
+	},
+	{
+		version: 4,
+		name:    "create product reservation",
+		up: `
+CREATE TABLE IF NOT EXISTS product_reservation (
+  id text PRIMARY KEY,
+  product_id text NOT NULL REFERENCES product (id) ON DELETE CASCADE,
+  quantity int NOT NULL CHECK (quantity > 0),
+  status text NOT NULL CHECK (status IN ('pending', 'committed', 'released', 'expired')),
+  expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+  created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC'),
+  updated_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC')
+);
+
+-- The sweeper looks up pending reservations by expiry.
+CREATE INDEX IF NOT EXISTS product_reservation_pending_idx ON product_reservation (expires_at)
+  WHERE status = 'pending';
+`,
+		down: `
+DROP TABLE IF EXISTS product_reservation;
+`,
+	},
+	{
+		version: 5,
+		name:    "create product price",
+		up: `
+CREATE TABLE IF NOT EXISTS product_price (
+  product_id text NOT NULL REFERENCES product (id) ON DELETE CASCADE,
+  currency char(3) NOT NULL,
+  price numeric(15,6) NOT NULL,
+  PRIMARY KEY (product_id, currency)
+);
+
+-- Prices in currencies other than USD are sorted by currency, mirroring product_price_idx.
+CREATE INDEX IF NOT EXISTS product_price_currency_idx ON product_price (currency, price, product_id);
+
+ALTER TABLE product_variant ADD COLUMN IF NOT EXISTS prices jsonb NOT NULL DEFAULT '{}';
+`,
+		down: `
+ALTER TABLE product_variant DROP COLUMN IF EXISTS prices;
+DROP TABLE IF EXISTS product_price;
+`,
+	},
+	{
+		version: 6,
+		name:    "index product names for suggestions",
+		up: `
+-- Backs name suggestions, which match prefixes of unstemmed words.
+CREATE INDEX IF NOT EXISTS product_name_suggest_idx ON product USING GIN (to_tsvector('simple', name));
+`,
+		down: `
+DROP INDEX IF EXISTS product_name_suggest_idx;
+`,
+	},
+	{
+		version: 7,
+		name:    "enable trigram similarity",
+		up: `
+-- Trigram similarity narrows down the candidates of fuzzy search words.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+`,
+		// the extension is left installed, other schemas of the database may use it
+		down: "",
+	},
+	{
+		version: 8,
+		name:    "add dataset content hashes",
+		up: `
+-- Hash of the dataset entry a row was last loaded from, rows loaded from unchanged entries are left untouched.
+ALTER TABLE category ADD COLUMN IF NOT EXISTS content_hash text;
+ALTER TABLE product ADD COLUMN IF NOT EXISTS content_hash text;
+`,
+		down: `
+ALTER TABLE product DROP COLUMN IF EXISTS content_hash;
+ALTER TABLE category DROP COLUMN IF EXISTS content_hash;
+`,
+	},
+	{
+		version: 9,
+		name:    "create product word vocabulary",
+		up: `
+-- The words of the searchable text of products, unstemmed so that they can be suggested as corrections, along with the
+-- number of products each appears in. Fuzzy search words look up their candidates here by trigram similarity.
+CREATE TABLE IF NOT EXISTS product_word (
+  word text PRIMARY KEY,
+  ndoc int NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS product_word_trgm_idx ON product_word USING GIN (word gin_trgm_ops);
+
+CREATE OR REPLACE FUNCTION product_words(name text, short_description text, description text) RETURNS text[] AS $$
+  SELECT tsvector_to_array(to_tsvector('simple',
+    coalesce(name,'') || ' ' || coalesce(short_description,'') || ' ' || coalesce(description,'')));
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION product_word_update_func() RETURNS trigger AS $$
+declare
+  old_words text[] := '{}';
+  new_words text[] := '{}';
+begin
+  if tg_op <> 'INSERT' then
+    old_words := product_words(old.name, old.short_description, old.description);
+  end if;
+  if tg_op <> 'DELETE' then
+    new_words := product_words(new.name, new.short_description, new.description);
+  end if;
+
+  UPDATE product_word SET ndoc = ndoc - 1 WHERE word = ANY(old_words) AND NOT word = ANY(new_words);
+  DELETE FROM product_word WHERE word = ANY(old_words) AND ndoc <= 0;
+  INSERT INTO product_word (word, ndoc)
+    SELECT added.word, 1 FROM unnest(new_words) AS added(word) WHERE NOT added.word = ANY(old_words)
+    ON CONFLICT (word) DO UPDATE SET ndoc = product_word.ndoc + 1;
+  return null;
+end
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS product_word_update_trg ON product;
+CREATE TRIGGER product_word_update_trg AFTER INSERT OR DELETE OR UPDATE OF name, short_description, description
+  ON product FOR EACH ROW EXECUTE PROCEDURE product_word_update_func();
+
+INSERT INTO product_word (word, ndoc)
+  SELECT word, count(*) FROM product, unnest(product_words(name, short_description, description)) AS words(word)
+  GROUP BY word
+  ON CONFLICT (word) DO NOTHING;
+`,
+		down: `
+DROP TRIGGER IF EXISTS product_word_update_trg ON product;
+DROP FUNCTION IF EXISTS product_word_update_func();
+DROP FUNCTION IF EXISTS product_words(text, text, text);
+DROP TABLE IF EXISTS product_word;
+`,
+	},
+	{
+		version: 10,
+		name:    "constrain product columns of adopted schemas",
+		up: `
+-- Schemas applied by hand left these columns nullable, which migration 1 does not change on tables that exist. Rows
+-- missing a timestamp get the default, while products missing a price have to be priced before migrating.
+UPDATE product SET created_at = (NOW() AT TIME ZONE 'UTC') WHERE created_at IS NULL;
+UPDATE product SET updated_at = (NOW() AT TIME ZONE 'UTC') WHERE updated_at IS NULL;
+ALTER TABLE product ALTER COLUMN price SET NOT NULL;
+ALTER TABLE product ALTER COLUMN created_at SET NOT NULL;
+ALTER TABLE product ALTER COLUMN updated_at SET NOT NULL;
+
+-- Schemas applied by hand indexed the sort columns alone, those indexes are replaced by ones ending with id.
+DO $$
+declare
+  index_name text;
+begin
+  FOREACH index_name IN ARRAY
+    ARRAY['product_name_idx', 'product_price_idx', 'product_created_at_idx', 'product_updated_at_idx'] LOOP
+    IF EXISTS (SELECT 1 FROM pg_index WHERE indexrelid = to_regclass(index_name) AND indnatts = 1) THEN
+      EXECUTE format('DROP INDEX %I', index_name);
+    END IF;
+  END LOOP;
+end
+$$;
+
+CREATE INDEX IF NOT EXISTS product_name_idx ON product (name, id);
+CREATE INDEX IF NOT EXISTS product_price_idx ON product (price, id);
+CREATE INDEX IF NOT EXISTS product_created_at_idx ON product (created_at, id);
+CREATE INDEX IF NOT EXISTS product_updated_at_idx ON product (updated_at, id);
+`,
+		// the constraints and indexes are those created by migration 1, which are left in place until it is reverted
+		down: "",
+	},
+}
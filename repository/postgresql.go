@@ -3,44 +3,212 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/shopspring/decimal"
 	"github.com/stone1549/product-service/common"
+	"log"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
-	listProductsQuery = "SELECT id, name, description, short_description, display_image, thumbnail, price, qty_in_stock, created_at, updated_at FROM product ORDER BY %s LIMIT $1 OFFSET $2"
-	getProductQuery   = `SELECT id, name, description, short_description, display_image, thumbnail, price, qty_in_stock, 
-						created_at, updated_at FROM product WHERE id=$1`
+	// listProductsQuery is formatted with the product columns, the WHERE clause and the ORDER BY fields.
+	listProductsQuery = "SELECT %s FROM product %s ORDER BY %s LIMIT $1"
+	// getProductQuery is formatted with the product columns.
+	getProductQuery = "SELECT %s FROM product WHERE id=$1"
+	// getProductsByIdsQuery is formatted with the product columns.
+	getProductsByIdsQuery = "SELECT %s FROM product WHERE id = ANY($1)"
+	// productColumns is formatted with the description, short_description, display_image, thumbnail, categories and
+	// variants columns, any of which may be replaced by NULL when the field is not requested.
+	productColumns = `id, name, %s, %s, %s, %s, price, qty_in_stock, created_at, updated_at, %s, %s, 
+						` + productPricesColumn
 	insertProductQuery = `INSERT INTO product (id, name, description, short_description, display_image, thumbnail, 
 							price, qty_in_stock) 
 						  	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
-	searchProductQuery = `SELECT id, name, description, short_description, display_image, thumbnail, price, 
-							qty_in_stock, created_at, updated_at FROM product WHERE 
-								textsearchable_index_col @@ to_tsquery($1) 
-							ORDER BY textsearchable_index_col 
-							LIMIT $2 OFFSET $3`
+	updateProductQuery = `UPDATE product SET name=$2, description=$3, short_description=$4, display_image=$5, 
+							thumbnail=$6, price=$7, qty_in_stock=$8 
+						  	WHERE id=$1`
+	deleteProductQuery = "DELETE FROM product WHERE id=$1"
+	searchCondition    = "textsearchable_index_col @@ to_tsquery($2)"
+	// searchProductsQuery is formatted with the product columns, the highlight columns, the WHERE clause and the ORDER
+	// BY fields.
+	searchProductsQuery = "SELECT %s, " + searchRankColumn + ", %s FROM product %s ORDER BY %s LIMIT $1"
+	// searchRankColumn ranks matches using the A/B/C/D weights set by product_search_update_func. Ranks change when a
+	// product is updated, so a relevance keyset may skip or repeat matches updated between pages.
+	searchRankColumn = "ts_rank(textsearchable_index_col, to_tsquery($2))"
+	highlightColumns = `ts_headline('pg_catalog.english', name, to_tsquery($2), 
+							'StartSel=` + common.HighlightStart + `, StopSel=` + common.HighlightEnd + `'), 
+						ts_headline('pg_catalog.english', description, to_tsquery($2), 
+							'StartSel=` + common.HighlightStart + `, StopSel=` + common.HighlightEnd + `')`
+	noHighlightColumns = "NULL, NULL"
+	// fuzzyCandidatesQuery pairs each word with the similar words of the vocabulary maintained by
+	// product_word_update_func, along with the number of products each appears in. The % operator compares trigram
+	// similarity with pg_trgm.similarity_threshold, using the trigram index of the vocabulary.
+	fuzzyCandidatesQuery = `SELECT term.word, product_word.word, product_word.ndoc FROM unnest($1::text[]) AS term(word) 
+							JOIN product_word ON product_word.word % term.word`
+
+	// suggestion queries match names word by word with the simple configuration, so that prefixes are not stemmed.
+	suggestProductsQuery = `SELECT id, name, ts_rank(to_tsvector('simple', name), to_tsquery('simple', $1)) 
+							FROM product WHERE to_tsvector('simple', name) @@ to_tsquery('simple', $1) 
+							ORDER BY 3 DESC, name, id LIMIT $2`
+	suggestCategoriesQuery = `SELECT id, name, ts_rank(to_tsvector('simple', name), to_tsquery('simple', $1)) 
+								FROM category WHERE to_tsvector('simple', name) @@ to_tsquery('simple', $1) 
+								ORDER BY 3 DESC, name, id LIMIT $2`
+
+	productCategoriesColumn = `ARRAY(SELECT category_id FROM product_category WHERE product_id=product.id 
+								ORDER BY category_id)`
+	insertProductCategoryQuery   = "INSERT INTO product_category (product_id, category_id) VALUES ($1, $2)"
+	deleteProductCategoriesQuery = "DELETE FROM product_category WHERE product_id=$1"
+	categoryCondition            = "id IN (SELECT product_id FROM product_category WHERE category_id = ANY($%d))"
+	categorySubtreeCondition     = `id IN (SELECT product_id FROM product_category WHERE category_id IN (
+										WITH RECURSIVE subtree(id) AS (
+											SELECT id FROM category WHERE id = ANY($%d) 
+											UNION SELECT category.id FROM category 
+											JOIN subtree ON category.parent_id=subtree.id
+										) SELECT id FROM subtree))`
+
+	productVariantsColumn = `COALESCE((SELECT json_agg(json_build_object('sku', sku, 'productId', product_id, 
+								'options', options, 'price', price, 'qtyInStock', qty_in_stock, 'images', images, 
+								'prices', prices) ORDER BY sku) FROM product_variant WHERE product_id=product.id), '[]')`
+	getVariantQuery = `SELECT sku, product_id, options, price, qty_in_stock, images, prices FROM product_variant 
+						WHERE sku=$1`
+	insertProductVariantQuery = `INSERT INTO product_variant (sku, product_id, options, price, qty_in_stock, images, 
+									prices) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	deleteProductVariantsQuery = "DELETE FROM product_variant WHERE product_id=$1"
+
+	productPricesColumn = `COALESCE((SELECT json_object_agg(currency, price) FROM product_price 
+							WHERE product_id=product.id), '{}')`
+	// currencyPriceColumn is formatted with a currency code, which must be validated as supported beforehand.
+	currencyPriceColumn      = "(SELECT price FROM product_price WHERE product_id=product.id AND currency='%s')"
+	insertProductPriceQuery  = "INSERT INTO product_price (product_id, currency, price) VALUES ($1, $2, $3)"
+	deleteProductPricesQuery = "DELETE FROM product_price WHERE product_id=$1"
+
+	// matchedProductsQuery selects the ids of every product satisfying the WHERE clause it is formatted with. It is
+	// bound to the same parameters as the page query with NULL in place of the page size, which PostgreSQL treats as no
+	// limit.
+	matchedProductsQuery = "SELECT id FROM product %s LIMIT $1"
+	priceFacetQuery      = `SELECT width_bucket(%s, $%d::numeric[]), COUNT(*) FROM product WHERE id IN (%s) 
+							GROUP BY 1`
+	inStockFacetQuery  = "SELECT qty_in_stock > 0, COUNT(*) FROM product WHERE id IN (%s) GROUP BY 1"
+	categoryFacetQuery = `SELECT category_id, COUNT(*) FROM product_category WHERE product_id IN (%s) 
+							GROUP BY category_id`
+	optionFacetQuery = `SELECT options->>$%d, COUNT(DISTINCT product_id) FROM product_variant 
+						WHERE options->>$%d IS NOT NULL AND product_id IN (%s) GROUP BY 1`
+
+	reserveStockQuery      = "UPDATE product SET qty_in_stock=qty_in_stock - $2 WHERE id=$1 AND qty_in_stock >= $2"
+	restockQuery           = "UPDATE product SET qty_in_stock=qty_in_stock + $2 WHERE id=$1"
+	productExistsQuery     = "SELECT EXISTS(SELECT 1 FROM product WHERE id=$1)"
+	insertReservationQuery = `INSERT INTO product_reservation (id, product_id, quantity, status, expires_at, created_at, 
+								updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	lockReservationQuery = `SELECT id, product_id, quantity, status, expires_at, created_at, updated_at 
+							FROM product_reservation WHERE id=$1 AND product_id=$2 FOR UPDATE`
+	updateReservationStatusQuery = "UPDATE product_reservation SET status=$2, updated_at=$3 WHERE id=$1"
+	expireReservationsQuery      = `WITH expired AS (
+										UPDATE product_reservation SET status='expired', updated_at=$1 
+										WHERE status='pending' AND expires_at <= $1 RETURNING product_id, quantity
+									), restocked AS (
+										UPDATE product SET qty_in_stock=product.qty_in_stock + expired_qty.quantity 
+										FROM (SELECT product_id, SUM(quantity) AS quantity FROM expired 
+											GROUP BY product_id) expired_qty 
+										WHERE product.id=expired_qty.product_id
+									) SELECT COUNT(*) FROM expired`
+
+	listCategoriesQuery = "SELECT id, name, parent_id FROM category ORDER BY name, id"
+	getCategoryQuery    = "SELECT id, name, parent_id FROM category WHERE id=$1"
+	// upsertCategoryQuery and upsertProductQuery only touch rows loaded from a dataset entry with a different content
+	// hash, returning whether the row was inserted, or no row when it was left unchanged.
+	upsertCategoryQuery = `INSERT INTO category (id, name, parent_id, content_hash) VALUES ($1, $2, $3, $4)
+							ON CONFLICT (id) DO UPDATE SET name=EXCLUDED.name, parent_id=EXCLUDED.parent_id,
+								content_hash=EXCLUDED.content_hash
+							WHERE category.content_hash IS DISTINCT FROM EXCLUDED.content_hash
+							RETURNING (xmax = 0) AS inserted`
+	upsertProductQuery = `INSERT INTO product (id, name, description, short_description, display_image, thumbnail,
+							price, qty_in_stock, content_hash)
+							VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+							ON CONFLICT (id) DO UPDATE SET name=EXCLUDED.name, description=EXCLUDED.description,
+								short_description=EXCLUDED.short_description, display_image=EXCLUDED.display_image,
+								thumbnail=EXCLUDED.thumbnail, price=EXCLUDED.price,
+								qty_in_stock=EXCLUDED.qty_in_stock, content_hash=EXCLUDED.content_hash
+							WHERE product.content_hash IS DISTINCT FROM EXCLUDED.content_hash
+							RETURNING (xmax = 0) AS inserted`
+)
+
+const (
+	// uniqueViolationCode is the PostgreSQL error code raised when a unique constraint is violated.
+	uniqueViolationCode = "23505"
+	// foreignKeyViolationCode is the PostgreSQL error code raised when a foreign key constraint is violated.
+	foreignKeyViolationCode = "23503"
 )
 
 type postgresqlProductRepository struct {
-	db *sql.DB
+	db      *sql.DB
+	cursors cursorCodec
+}
+
+func priceParam(price *decimal.Decimal) interface{} {
+	if price == nil {
+		return nil
+	}
+
+	return price.StringFixed(6)
+}
+
+// fieldColumn returns the given column if the given field is selected, NULL otherwise.
+func fieldColumn(fields common.ProductFields, field common.ProductField, column string) string {
+	if !fields.Includes(field) {
+		return "NULL"
+	}
+
+	return column
+}
+
+// selectProductColumns returns the columns scanned by scanProductFromRow and scanProductFromRows, skipping the
+// descriptions, images, categories and variants of products unless selected by the given fields. Every other column
+// is cheap to select and some are needed to build cursors, so they are always selected.
+func selectProductColumns(fields common.ProductFields) string {
+	return fmt.Sprintf(productColumns,
+		fieldColumn(fields, common.ProductFieldDescription, "description"),
+		fieldColumn(fields, common.ProductFieldShortDescription, "short_description"),
+		fieldColumn(fields, common.ProductFieldDisplayImage, "display_image"),
+		fieldColumn(fields, common.ProductFieldThumbnail, "thumbnail"),
+		fieldColumn(fields, common.ProductFieldCategories, productCategoriesColumn),
+		fieldColumn(fields, common.ProductFieldVariants, productVariantsColumn))
 }
 
 func scanProductFromRow(row *sql.Row) (*common.Product, error) {
 	var result common.Product
 
 	var priceStr string
+	var variantsJson, pricesJson []byte
 	err := row.Scan(&result.Id, &result.Name, &result.Description, &result.ShortDescription, &result.DisplayImage,
-		&result.Thumbnail, &priceStr, &result.QtyInStock, &result.CreatedAt, &result.UpdatedAt)
+		&result.Thumbnail, &priceStr, &result.QtyInStock, &result.CreatedAt, &result.UpdatedAt,
+		pq.Array(&result.CategoryIds), &variantsJson, &pricesJson)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
 	} else if err != nil {
 		return nil, err
 	}
+
+	// variants are NULL when not selected
+	if variantsJson != nil {
+		err = json.Unmarshal(variantsJson, &result.Variants)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = json.Unmarshal(pricesJson, &result.Prices)
+
+	if err != nil {
+		return nil, err
+	}
+
 	if priceStr != "" {
 		price, err := decimal.NewFromString(priceStr)
 
@@ -54,12 +222,36 @@ func scanProductFromRow(row *sql.Row) (*common.Product, error) {
 	return &result, err
 }
 
-func scanProductFromRows(rows *sql.Rows) (*common.Product, error) {
+// scanProductFromRows scans a product from the current row, along with any columns selected after the product's into
+// the given extra destinations.
+func scanProductFromRows(rows *sql.Rows, extra ...interface{}) (*common.Product, error) {
 	var result common.Product
 
 	var priceStr string
-	err := rows.Scan(&result.Id, &result.Name, &result.Description, &result.ShortDescription, &result.DisplayImage,
-		&result.Thumbnail, &priceStr, &result.QtyInStock, &result.CreatedAt, &result.UpdatedAt)
+	var variantsJson, pricesJson []byte
+	dest := []interface{}{&result.Id, &result.Name, &result.Description, &result.ShortDescription,
+		&result.DisplayImage, &result.Thumbnail, &priceStr, &result.QtyInStock, &result.CreatedAt, &result.UpdatedAt,
+		pq.Array(&result.CategoryIds), &variantsJson, &pricesJson}
+	err := rows.Scan(append(dest, extra...)...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// variants are NULL when not selected
+	if variantsJson != nil {
+		err = json.Unmarshal(variantsJson, &result.Variants)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = json.Unmarshal(pricesJson, &result.Prices)
+
+	if err != nil {
+		return nil, err
+	}
 
 	if priceStr != "" {
 		price, err := decimal.NewFromString(priceStr)
@@ -74,56 +266,202 @@ func scanProductFromRows(rows *sql.Rows) (*common.Product, error) {
 	return &result, err
 }
 
-func orderByFields(orderBy common.OrderBy) (string, error) {
-	var keys []string
-	for _, key := range orderBy.Order() {
+type sortColumn struct {
+	name string
+	desc bool
+}
+
+// priceColumn returns the expression holding product prices in the given currency.
+func priceColumn(currency common.Currency) (string, error) {
+	if currency == common.DefaultCurrency {
+		return "price", nil
+	} else if !currency.Supported() {
+		return "", newErrRepository(fmt.Sprintf("Unsupported currency %s", currency))
+	}
+
+	return fmt.Sprintf(currencyPriceColumn, currency), nil
+}
+
+// orderByColumns translates the given keys into the columns to sort by, with prices in the given currency, followed by
+// id as a tiebreaker sharing the direction of the final key.
+func orderByColumns(order []common.OrderByKey, currency common.Currency) ([]sortColumn, error) {
+	price, err := priceColumn(currency)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var columns []sortColumn
+	for _, key := range order {
 		switch key {
 		case common.OrderByCreated:
-			keys = append(keys, "created_at")
+			columns = append(columns, sortColumn{"created_at", false})
 		case common.OrderByCreatedDesc:
-			keys = append(keys, "created_at DESC")
+			columns = append(columns, sortColumn{"created_at", true})
 		case common.OrderByUpdated:
-			keys = append(keys, "updated_at")
+			columns = append(columns, sortColumn{"updated_at", false})
 		case common.OrderByUpdatedDesc:
-			keys = append(keys, "updated_at DESC")
+			columns = append(columns, sortColumn{"updated_at", true})
 		case common.OrderByName:
-			keys = append(keys, "name")
+			columns = append(columns, sortColumn{"name", false})
 		case common.OrderByNameDesc:
-			keys = append(keys, "name DESC")
+			columns = append(columns, sortColumn{"name", true})
 		case common.OrderByPrice:
-			keys = append(keys, "price")
+			columns = append(columns, sortColumn{price, false})
 		case common.OrderByPriceDesc:
-			keys = append(keys, "price DESC")
+			columns = append(columns, sortColumn{price, true})
+		case common.OrderByRelevance:
+			columns = append(columns, sortColumn{searchRankColumn, true})
 		default:
-			return "", newErrRepository(fmt.Sprintf("Unsupported order by field %s", key))
+			return nil, newErrRepository(fmt.Sprintf("Unsupported order by field %s", key))
 		}
 	}
 
-	return strings.Join(keys, ", "), nil
+	return append(columns, sortColumn{"id", columns[len(columns)-1].desc}), nil
 }
 
-// GetProducts retrieves a list of the first X products starting from the given cursor.
-func (ppr postgresqlProductRepository) GetProducts(ctx context.Context, first int, cursor string,
-	orderBy common.OrderBy) (ProductList, error) {
+func orderByFields(columns []sortColumn) string {
+	var keys []string
+	for _, column := range columns {
+		if column.desc {
+			keys = append(keys, column.name+" DESC")
+		} else {
+			keys = append(keys, column.name)
+		}
+	}
+
+	return strings.Join(keys, ", ")
+}
+
+// keysetPredicate builds a predicate matching the rows that sort after a row holding the values bound to the
+// parameters starting at firstParam. When every column shares a direction a row comparison is used so the
+// predicate can be satisfied by an index seek.
+func keysetPredicate(columns []sortColumn, firstParam int) string {
+	names := make([]string, len(columns))
+	params := make([]string, len(columns))
+	sameDirection := true
+	for i, column := range columns {
+		names[i] = column.name
+		params[i] = fmt.Sprintf("$%d", firstParam+i)
+		sameDirection = sameDirection && column.desc == columns[0].desc
+	}
+
+	if sameDirection {
+		op := ">"
+		if columns[0].desc {
+			op = "<"
+		}
+
+		return fmt.Sprintf("(%s) %s (%s)", strings.Join(names, ", "), op, strings.Join(params, ", "))
+	}
+
+	var terms []string
+	for i, column := range columns {
+		var conds []string
+		for j := 0; j < i; j++ {
+			conds = append(conds, fmt.Sprintf("%s = %s", names[j], params[j]))
+		}
+
+		op := ">"
+		if column.desc {
+			op = "<"
+		}
+
+		conds = append(conds, fmt.Sprintf("%s %s %s", names[i], op, params[i]))
+		terms = append(terms, "("+strings.Join(conds, " AND ")+")")
+	}
+
+	return "(" + strings.Join(terms, " OR ") + ")"
+}
+
+// filterConditions translates the given filter into SQL conditions, binding their values to parameters following
+// those already in args.
+func filterConditions(filter common.ProductFilter, args []interface{}) ([]string, []interface{}, error) {
+	var conditions []string
+	addCondition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+
+	price, err := priceColumn(filter.PriceCurrency())
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if filter.PriceCurrency() != common.DefaultCurrency {
+		conditions = append(conditions, price+" IS NOT NULL")
+	}
+
+	if filter.MinPrice != nil {
+		addCondition(price+" >= $%d", filter.MinPrice.String())
+	}
+
+	if filter.MaxPrice != nil {
+		addCondition(price+" <= $%d", filter.MaxPrice.String())
+	}
+
+	if filter.InStock != nil && *filter.InStock {
+		conditions = append(conditions, "qty_in_stock > 0")
+	} else if filter.InStock != nil {
+		conditions = append(conditions, "qty_in_stock <= 0")
+	}
+
+	if filter.CreatedAfter != nil {
+		addCondition("created_at > $%d", *filter.CreatedAfter)
+	}
+
+	if filter.UpdatedSince != nil {
+		addCondition("updated_at >= $%d", *filter.UpdatedSince)
+	}
+
+	if len(filter.Ids) > 0 {
+		addCondition("id = ANY($%d)", pq.Array(filter.Ids))
+	}
+
+	if len(filter.CategoryIds) > 0 && filter.IncludeSubcategories {
+		addCondition(categorySubtreeCondition, pq.Array(filter.CategoryIds))
+	} else if len(filter.CategoryIds) > 0 {
+		addCondition(categoryCondition, pq.Array(filter.CategoryIds))
+	}
+
+	return conditions, args, nil
+}
+
+// queryProductPage runs the given query, which must contain a %s placeholder for the product columns, a %s placeholder
+// for a WHERE clause and a %s placeholder for the ORDER BY list, and builds a ProductList from the results. The given conditions are combined with
+// a keyset predicate derived from the cursor to form the WHERE clause.
+func (ppr *postgresqlProductRepository) queryProductPage(ctx context.Context, query string, conditions []string,
+	args []interface{}, cursor string, orderBy common.OrderBy, currency common.Currency) (ProductList, error) {
 	var result ProductList
-	var offset int
-	var err error
+
+	order := orderBy.Order()
+	columns, err := orderByColumns(order, currency)
+
+	if err != nil {
+		return result, err
+	}
 
 	if strings.TrimSpace(cursor) != "" {
-		offset, err = strconv.Atoi(cursor)
+		values, err := ppr.cursors.decode(order, currency, cursor)
 
 		if err != nil {
-			return result, newErrRepository("Invalid cursor")
+			return result, err
 		}
-	}
 
-	orderByStr, err := orderByFields(orderBy)
+		conditions = append(conditions, keysetPredicate(columns, len(args)+1))
+		for _, value := range values {
+			args = append(args, value)
+		}
+	}
 
-	if err != nil {
-		return ProductList{}, err
+	var where string
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
 	}
 
-	rows, err := ppr.db.QueryContext(ctx, fmt.Sprintf(listProductsQuery, orderByStr), first, offset)
+	selected := selectProductColumns(common.ProductFieldsFrom(ctx))
+	rows, err := ppr.db.QueryContext(ctx, fmt.Sprintf(query, selected, where, orderByFields(columns)), args...)
 	if err != nil {
 		return result, err
 	}
@@ -143,13 +481,41 @@ func (ppr postgresqlProductRepository) GetProducts(ctx context.Context, first in
 		return result, err
 	}
 
-	result.Cursor = strconv.Itoa(offset + len(result.Products))
+	result.Cursor = cursor
+	result.Cursors = make([]string, len(result.Products))
+	for i, product := range result.Products {
+		result.Cursors[i], err = ppr.cursors.encode(order, currency, product)
+
+		if err != nil {
+			return result, err
+		}
+
+		result.Cursor = result.Cursors[i]
+	}
+
 	return result, nil
 }
 
+// GetProducts retrieves a list of the first X products matching the given filter starting from the given cursor.
+func (ppr postgresqlProductRepository) GetProducts(ctx context.Context, first int, cursor string,
+	orderBy common.OrderBy, filter common.ProductFilter) (ProductList, error) {
+	if orderBy.Contains(common.OrderByRelevance) {
+		return ProductList{}, ErrInvalidOrder
+	}
+
+	conditions, args, err := filterConditions(filter, []interface{}{first})
+
+	if err != nil {
+		return ProductList{}, err
+	}
+
+	return ppr.queryProductPage(ctx, listProductsQuery, conditions, args, cursor, orderBy, filter.PriceCurrency())
+}
+
 // GetProduct retrieves a product from the given id.
 func (ppr postgresqlProductRepository) GetProduct(ctx context.Context, id string) (*common.Product, error) {
-	row := ppr.db.QueryRowContext(ctx, getProductQuery, id)
+	query := fmt.Sprintf(getProductQuery, selectProductColumns(common.ProductFieldsFrom(ctx)))
+	row := ppr.db.QueryRowContext(ctx, query, id)
 
 	if row == nil {
 		return nil, nil
@@ -158,69 +524,1043 @@ func (ppr postgresqlProductRepository) GetProduct(ctx context.Context, id string
 	return scanProductFromRow(row)
 }
 
-// SearchProducts retrieves the first X matches starting from the given cursor.
-func (ppr *postgresqlProductRepository) SearchProducts(ctx context.Context, searchTxt string, first int,
-	cursor string) (ProductList, error) {
-	var result ProductList
-	var offset int
+// GetProductsByIds retrieves the products with the given ids, in the order of their ids. Ids without a product are
+// skipped and products requested more than once are retrieved once.
+func (ppr *postgresqlProductRepository) GetProductsByIds(ctx context.Context, ids []string) ([]common.Product, error) {
+	query := fmt.Sprintf(getProductsByIdsQuery, selectProductColumns(common.ProductFieldsFrom(ctx)))
+	rows, err := ppr.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make(map[string]common.Product)
+	for rows.Next() {
+		product, err := scanProductFromRows(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		found[product.Id] = *product
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return productsInIdOrder(ids, found), nil
+}
+
+// SuggestProducts retrieves up to first product names, and category names when includeCategories is true, with a word
+// starting with each word of the given prefix.
+func (ppr *postgresqlProductRepository) SuggestProducts(ctx context.Context, prefix string, first int,
+	includeCategories bool) (common.Suggestions, error) {
+	var result common.Suggestions
+	words := common.SplitSearchWords(prefix)
+
+	if len(words) == 0 {
+		return result, ErrInvalidSearch
+	}
+
+	var prefixes common.SearchQuery
+	for _, word := range words {
+		prefixes.Required = append(prefixes.Required, []common.SearchTerm{{Words: []string{word}, Prefix: true}})
+	}
+
+	query := tsQuery(prefixes)
 	var err error
+	result.Products, err = ppr.querySuggestions(ctx, suggestProductsQuery, query, first)
+
+	if err != nil || !includeCategories {
+		return result, err
+	}
+
+	result.Categories, err = ppr.querySuggestions(ctx, suggestCategoriesQuery, query, first)
+	return result, err
+}
+
+// querySuggestions runs the given suggestion query for the given tsquery, returning up to first suggestions.
+func (ppr *postgresqlProductRepository) querySuggestions(ctx context.Context, query string, tsquery string,
+	first int) ([]common.Suggestion, error) {
+	rows, err := ppr.db.QueryContext(ctx, query, tsquery, first)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]common.Suggestion, 0)
+	for rows.Next() {
+		var suggestion common.Suggestion
+		err = rows.Scan(&suggestion.Id, &suggestion.Text, &suggestion.Score)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, suggestion)
+	}
+
+	return result, rows.Err()
+}
+
+// tsQuery compiles the given query into the text accepted by to_tsquery. Words only hold letters and digits, so they
+// can never be interpreted as operators.
+func tsQuery(query common.SearchQuery) string {
+	var clauses []string
+	for _, group := range query.Required {
+		alternatives := make([]string, len(group))
+		for i, term := range group {
+			alternatives[i] = tsQueryTerm(term)
+		}
+
+		if len(alternatives) == 1 {
+			clauses = append(clauses, alternatives[0])
+		} else {
+			clauses = append(clauses, "("+strings.Join(alternatives, " | ")+")")
+		}
+	}
+
+	for _, term := range query.Excluded {
+		clauses = append(clauses, "!"+tsQueryTerm(term))
+	}
+
+	return strings.Join(clauses, " & ")
+}
+
+// tsQueryTerm compiles the given term into a to_tsquery lexeme, or a phrase of lexemes.
+func tsQueryTerm(term common.SearchTerm) string {
+	words := make([]string, len(term.Words))
+	copy(words, term.Words)
+
+	if term.Prefix {
+		words[len(words)-1] += ":*"
+	}
+
+	if len(words) == 1 {
+		return words[0]
+	}
+
+	return "(" + strings.Join(words, " <-> ") + ")"
+}
+
+// querySearchPage retrieves a page of search results satisfying the given conditions, sorted by order with prices in
+// the given currency, following the given cursor.
+func (ppr *postgresqlProductRepository) querySearchPage(ctx context.Context, conditions []string, args []interface{},
+	cursor string, order []common.OrderByKey, currency common.Currency, highlight bool) (ProductList, error) {
+	var result ProductList
+
+	columns, err := orderByColumns(order, currency)
+
+	if err != nil {
+		return result, err
+	}
 
 	if strings.TrimSpace(cursor) != "" {
-		offset, err = strconv.Atoi(cursor)
+		values, err := ppr.cursors.decode(order, currency, cursor)
 
 		if err != nil {
-			return result, newErrRepository("Invalid cursor")
+			return result, err
+		}
+
+		conditions = append(conditions, keysetPredicate(columns, len(args)+1))
+		for _, value := range values {
+			args = append(args, value)
 		}
 	}
 
-	// TODO: handle tokenizing searchTxt or require clients to use PG syntax?
-	rows, err := ppr.db.QueryContext(ctx, searchProductQuery, searchTxt, first, offset)
+	highlights := noHighlightColumns
+	if highlight {
+		highlights = highlightColumns
+	}
+
+	selected := selectProductColumns(common.ProductFieldsFrom(ctx))
+	query := fmt.Sprintf(searchProductsQuery, selected, highlights, "WHERE "+strings.Join(conditions, " AND "),
+		orderByFields(columns))
+	rows, err := ppr.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return result, err
 	}
 	defer rows.Close()
 
+	var score float64
 	result.Products = make([]common.Product, 0)
+	result.Hits = make([]common.SearchHit, 0)
 	for rows.Next() {
-		product, err := scanProductFromRows(rows)
+		var name, description sql.NullString
+		product, err := scanProductFromRows(rows, &score, &name, &description)
 
 		if err != nil {
 			return result, err
 		}
 
+		hit := common.SearchHit{Score: score}
+		if highlight {
+			hit.Highlights = make(map[string][]string)
+			if name.Valid {
+				hit.Highlights[common.HighlightName] = []string{name.String}
+			}
+
+			if description.Valid {
+				hit.Highlights[common.HighlightDescription] = []string{description.String}
+			}
+		}
+
 		result.Products = append(result.Products, *product)
+		result.Hits = append(result.Hits, hit)
 	}
 	if err := rows.Err(); err != nil {
 		return result, err
 	}
 
-	result.Cursor = strconv.Itoa(offset + len(result.Products))
+	result.Cursor = cursor
+	result.Cursors = make([]string, len(result.Products))
+	for i, product := range result.Products {
+		// ts_rank returns a real, format the score with the same precision so that it compares equal when sent back
+		scoreStr := strconv.FormatFloat(result.Hits[i].Score, 'g', -1, 32)
+		values := searchSortValues(order, currency, product, scoreStr)
+		result.Cursors[i], err = ppr.cursors.encodeValues(order, currency, values)
+
+		if err != nil {
+			return result, err
+		}
+
+		result.Cursor = result.Cursors[i]
+	}
+
 	return result, nil
 }
 
-func loadInitPostgresqlData(db *sql.DB, dataset string) error {
-	products, err := loadInitInMemoryDataset(dataset)
+// SearchProducts retrieves the first X matches satisfying the given filter starting from the given cursor, most
+// relevant first unless otherwise ordered, along with the facets requested by the given options counted across every
+// match.
+func (ppr *postgresqlProductRepository) SearchProducts(ctx context.Context, searchTxt string, first int,
+	cursor string, orderBy common.OrderBy, filter common.ProductFilter, options common.SearchOptions) (ProductList,
+	error) {
+	query := common.ParseSearchQuery(searchTxt)
+
+	if query.Empty() {
+		return ProductList{}, ErrInvalidSearch
+	}
+
+	var candidates map[string][]vocabularyWord
+	var err error
+	matchQuery := query
+	if options.Fuzzy {
+		candidates, err = ppr.queryFuzzyCandidates(ctx, fuzzyWords(query))
+
+		if err != nil {
+			return ProductList{}, err
+		}
+
+		matchQuery = expandFuzzyQuery(query, candidates)
+	}
+
+	conditions, args, err := filterConditions(filter, []interface{}{first, tsQuery(matchQuery)})
 
 	if err != nil {
-		return err
+		return ProductList{}, err
 	}
 
-	txn, err := db.Begin()
+	conditions = append([]string{searchCondition}, conditions...)
+	result, err := ppr.querySearchPage(ctx, conditions, args, cursor, orderBy.SearchOrder(), filter.PriceCurrency(),
+		options.Highlight)
 
 	if err != nil {
-		return err
+		return result, err
+	}
+
+	if suggestsCorrection(result, cursor) {
+		if candidates == nil {
+			candidates, err = ppr.queryFuzzyCandidates(ctx, fuzzyWords(query))
+
+			if err != nil {
+				return result, err
+			}
+		}
+
+		result.DidYouMean = didYouMean(searchTxt, query, candidates)
+	}
+
+	if !options.Facets.Requested() {
+		return result, nil
+	}
+
+	matchArgs := append([]interface{}{nil}, args[1:]...)
+	result.Facets, err = ppr.queryFacets(ctx, options.Facets, filter.PriceCurrency(),
+		fmt.Sprintf(matchedProductsQuery, "WHERE "+strings.Join(conditions, " AND ")), matchArgs)
+	return result, err
+}
+
+// queryFuzzyCandidates returns, for each of the given words, the words of searchable product text within its
+// fuzziness. Words are narrowed down by trigram similarity before their edit distance is checked.
+func (ppr *postgresqlProductRepository) queryFuzzyCandidates(ctx context.Context,
+	words []string) (map[string][]vocabularyWord, error) {
+	result := make(map[string][]vocabularyWord)
+
+	if len(words) == 0 {
+		return result, nil
+	}
+
+	rows, err := ppr.db.QueryContext(ctx, fuzzyCandidatesQuery, pq.Array(words))
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	for _, product := range products {
-		_, err = txn.Exec(insertProductQuery, product.Id, product.Name, product.Description, product.ShortDescription,
-			product.DisplayImage, product.Thumbnail, product.Price.StringFixed(6), product.QtyInStock)
+	for rows.Next() {
+		var word string
+		var candidate vocabularyWord
+		err = rows.Scan(&word, &candidate.word, &candidate.count)
 
 		if err != nil {
-			return err
+			return nil, err
 		}
+
+		result[word] = append(result[word], candidate)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for word, candidates := range result {
+		result[word] = closeWords(word, candidates)
+	}
+
+	return result, nil
+}
+
+// queryFacets counts the products selected by the given query, bound to the given args, for each facet of the given
+// request, with prices in the given currency.
+func (ppr *postgresqlProductRepository) queryFacets(ctx context.Context, request common.FacetRequest,
+	currency common.Currency, matched string, args []interface{}) ([]common.Facet, error) {
+	var facets []common.Facet
+
+	if request.Price {
+		price, err := priceColumn(currency)
+
+		if err != nil {
+			return nil, err
+		}
+
+		boundaries := make([]string, len(request.PriceBoundaries))
+		for i, boundary := range request.PriceBoundaries {
+			boundaries[i] = boundary.String()
+		}
+
+		counts := make([]int, len(boundaries)+1)
+		err = ppr.queryFacetCounts(ctx, fmt.Sprintf(priceFacetQuery, price, len(args)+1, matched),
+			append(args, pq.Array(boundaries)), func(value sql.NullString, count int) error {
+				if !value.Valid {
+					return nil
+				}
+
+				bucket, err := strconv.Atoi(value.String)
+
+				if err != nil {
+					return err
+				}
+
+				counts[bucket] += count
+				return nil
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		facets = append(facets, newPriceFacet(request.PriceBoundaries, counts))
+	}
+
+	if request.InStock {
+		var inStock, outOfStock int
+		err := ppr.queryFacetCounts(ctx, fmt.Sprintf(inStockFacetQuery, matched), args,
+			func(value sql.NullString, count int) error {
+				inStockValue, err := strconv.ParseBool(value.String)
+
+				if inStockValue {
+					inStock = count
+				} else {
+					outOfStock = count
+				}
+
+				return err
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		facets = append(facets, newInStockFacet(inStock, outOfStock))
+	}
+
+	if request.Category {
+		counts, err := ppr.queryValueFacetCounts(ctx, fmt.Sprintf(categoryFacetQuery, matched), args)
+
+		if err != nil {
+			return nil, err
+		}
+
+		facets = append(facets, newValueFacet(common.FacetCategory, counts))
+	}
+
+	for _, option := range request.Options {
+		query := fmt.Sprintf(optionFacetQuery, len(args)+1, len(args)+1, matched)
+		counts, err := ppr.queryValueFacetCounts(ctx, query, append(args, option))
+
+		if err != nil {
+			return nil, err
+		}
+
+		facets = append(facets, newValueFacet(common.FacetOptionPrefix+option, counts))
+	}
+
+	return facets, nil
+}
+
+// queryFacetCounts runs the given query, which must select a value followed by a count, passing each row to the given
+// function.
+func (ppr *postgresqlProductRepository) queryFacetCounts(ctx context.Context, query string, args []interface{},
+	fn func(value sql.NullString, count int) error) error {
+	rows, err := ppr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var value sql.NullString
+		var count int
+		err = rows.Scan(&value, &count)
+
+		if err == nil {
+			err = fn(value, count)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// queryValueFacetCounts runs the given query, which must select a value followed by a count, returning the count of
+// each value.
+func (ppr *postgresqlProductRepository) queryValueFacetCounts(ctx context.Context, query string,
+	args []interface{}) (map[string]int, error) {
+	counts := make(map[string]int)
+	err := ppr.queryFacetCounts(ctx, query, args, func(value sql.NullString, count int) error {
+		if value.Valid {
+			counts[value.String] += count
+		}
+
+		return nil
+	})
+
+	return counts, err
+}
+
+// setProductCategories replaces the categories the given product belongs to.
+func setProductCategories(ctx context.Context, txn *sql.Tx, product common.Product) error {
+	_, err := txn.ExecContext(ctx, deleteProductCategoriesQuery, product.Id)
+
+	if err != nil {
+		return err
+	}
+
+	for _, categoryId := range product.CategoryIds {
+		_, err = txn.ExecContext(ctx, insertProductCategoryQuery, product.Id, categoryId)
+
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == foreignKeyViolationCode {
+			return ErrCategoryNotFound
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setProductVariants replaces the variants of the given product.
+func setProductVariants(ctx context.Context, txn *sql.Tx, product common.Product) error {
+	_, err := txn.ExecContext(ctx, deleteProductVariantsQuery, product.Id)
+
+	if err != nil {
+		return err
+	}
+
+	for _, variant := range product.Variants {
+		err = insertProductVariant(ctx, txn, product.Id, variant)
+
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolationCode {
+			return ErrVariantExists
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func insertProductVariant(ctx context.Context, txn *sql.Tx, productId string, variant common.Variant) error {
+	options := variant.Options
+	if options == nil {
+		options = make(map[string]string)
+	}
+
+	optionsJson, err := json.Marshal(options)
+
+	if err != nil {
+		return err
+	}
+
+	images := variant.Images
+	if images == nil {
+		images = make([]string, 0)
+	}
+
+	prices := make(map[common.Currency]string)
+	for currency, price := range variant.Prices {
+		prices[currency] = price.StringFixed(6)
+	}
+
+	pricesJson, err := json.Marshal(prices)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = txn.ExecContext(ctx, insertProductVariantQuery, variant.Sku, productId, string(optionsJson),
+		priceParam(variant.Price), variant.QtyInStock, pq.Array(images), string(pricesJson))
+	return err
+}
+
+// sortedCurrencies returns the currencies of the given price list in alphabetical order.
+func sortedCurrencies(prices map[common.Currency]decimal.Decimal) []common.Currency {
+	currencies := make([]common.Currency, 0, len(prices))
+	for currency := range prices {
+		currencies = append(currencies, currency)
+	}
+
+	sort.Slice(currencies, func(i, j int) bool {
+		return currencies[i] < currencies[j]
+	})
+	return currencies
+}
+
+// setProductPrices replaces the price list of the given product.
+func setProductPrices(ctx context.Context, txn *sql.Tx, product common.Product) error {
+	_, err := txn.ExecContext(ctx, deleteProductPricesQuery, product.Id)
+
+	if err != nil {
+		return err
+	}
+
+	for _, currency := range sortedCurrencies(product.Prices) {
+		_, err = txn.ExecContext(ctx, insertProductPriceQuery, product.Id, currency,
+			product.Prices[currency].StringFixed(6))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateProduct stores a new product and returns it as stored.
+func (ppr *postgresqlProductRepository) CreateProduct(ctx context.Context, product common.Product) (*common.Product,
+	error) {
+	txn, err := ppr.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Rollback()
+
+	_, err = txn.ExecContext(ctx, insertProductQuery, product.Id, product.Name, product.Description,
+		product.ShortDescription, product.DisplayImage, product.Thumbnail, priceParam(product.Price),
+		product.QtyInStock)
+
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolationCode {
+		return nil, ErrProductExists
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = setProductCategories(ctx, txn, product)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = setProductVariants(ctx, txn, product)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = setProductPrices(ctx, txn, product)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = txn.Commit()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ppr.GetProduct(ctx, product.Id)
+}
+
+// UpdateProduct replaces the product sharing the given product's id and returns it as stored.
+func (ppr *postgresqlProductRepository) UpdateProduct(ctx context.Context, product common.Product) (*common.Product,
+	error) {
+	txn, err := ppr.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Rollback()
+
+	res, err := txn.ExecContext(ctx, updateProductQuery, product.Id, product.Name, product.Description,
+		product.ShortDescription, product.DisplayImage, product.Thumbnail, priceParam(product.Price),
+		product.QtyInStock)
+
+	if err != nil {
+		return nil, err
+	}
+
+	affected, err := res.RowsAffected()
+
+	if err != nil {
+		return nil, err
+	} else if affected == 0 {
+		return nil, ErrProductNotFound
+	}
+
+	err = setProductCategories(ctx, txn, product)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = setProductVariants(ctx, txn, product)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = setProductPrices(ctx, txn, product)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = txn.Commit()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ppr.GetProduct(ctx, product.Id)
+}
+
+// DeleteProduct removes the product with the given id.
+func (ppr *postgresqlProductRepository) DeleteProduct(ctx context.Context, id string) error {
+	res, err := ppr.db.ExecContext(ctx, deleteProductQuery, id)
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrProductNotFound
+	}
+
+	return nil
+}
+
+func scanCategory(scanner interface {
+	Scan(dest ...interface{}) error
+}) (*common.Category, error) {
+	var result common.Category
+	err := scanner.Scan(&result.Id, &result.Name, &result.ParentId)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// GetCategories retrieves every category.
+func (ppr *postgresqlProductRepository) GetCategories(ctx context.Context) ([]common.Category, error) {
+	rows, err := ppr.db.QueryContext(ctx, listCategoriesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := make([]common.Category, 0)
+	for rows.Next() {
+		category, err := scanCategory(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		categories = append(categories, *category)
+	}
+
+	return categories, rows.Err()
+}
+
+// GetCategory retrieves a category from the given id.
+func (ppr *postgresqlProductRepository) GetCategory(ctx context.Context, id string) (*common.Category, error) {
+	return scanCategory(ppr.db.QueryRowContext(ctx, getCategoryQuery, id))
+}
+
+// GetVariant retrieves a product variant from the given SKU.
+func (ppr *postgresqlProductRepository) GetVariant(ctx context.Context, sku string) (*common.Variant, error) {
+	var result common.Variant
+	var optionsJson, pricesJson []byte
+	var priceStr sql.NullString
+	err := ppr.db.QueryRowContext(ctx, getVariantQuery, sku).Scan(&result.Sku, &result.ProductId, &optionsJson,
+		&priceStr, &result.QtyInStock, pq.Array(&result.Images), &pricesJson)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(optionsJson, &result.Options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(pricesJson, &result.Prices)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if priceStr.Valid {
+		price, err := decimal.NewFromString(priceStr.String)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result.Price = &price
+	}
+
+	return &result, nil
+}
+
+// ReserveProduct holds the given quantity of a product out of stock until the reservation is committed, released or
+// the given ttl elapses. Stock is only decremented while enough units remain, so concurrent reservations can not
+// oversell a product.
+func (ppr *postgresqlProductRepository) ReserveProduct(ctx context.Context, productId string, quantity int,
+	ttl time.Duration) (*common.Reservation, error) {
+	id, err := newReservationId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	txn, err := ppr.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Rollback()
+
+	res, err := txn.ExecContext(ctx, reserveStockQuery, productId, quantity)
+
+	if err != nil {
+		return nil, err
+	}
+
+	affected, err := res.RowsAffected()
+
+	if err != nil {
+		return nil, err
+	} else if affected == 0 {
+		var exists bool
+		err = txn.QueryRowContext(ctx, productExistsQuery, productId).Scan(&exists)
+
+		if err != nil {
+			return nil, err
+		} else if !exists {
+			return nil, ErrProductNotFound
+		}
+
+		return nil, ErrInsufficientStock
+	}
+
+	now := time.Now().UTC()
+	reservation := common.Reservation{
+		Id:        id,
+		ProductId: productId,
+		Quantity:  quantity,
+		Status:    common.ReservationPending,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	_, err = txn.ExecContext(ctx, insertReservationQuery, reservation.Id, reservation.ProductId,
+		reservation.Quantity, reservation.Status, reservation.ExpiresAt, reservation.CreatedAt, reservation.UpdatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = txn.Commit()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &reservation, nil
+}
+
+// CommitReservation permanently removes the units held by an active reservation from stock.
+func (ppr *postgresqlProductRepository) CommitReservation(ctx context.Context, productId,
+	reservationId string) (*common.Reservation, error) {
+	return ppr.closeReservation(ctx, productId, reservationId, common.ReservationCommitted)
+}
+
+// ReleaseReservation returns the units held by an active reservation to stock.
+func (ppr *postgresqlProductRepository) ReleaseReservation(ctx context.Context, productId,
+	reservationId string) (*common.Reservation, error) {
+	return ppr.closeReservation(ctx, productId, reservationId, common.ReservationReleased)
+}
+
+// closeReservation moves an active reservation to the given status, returning its units to stock unless it is being
+// committed. The reservation row is locked for the duration so it can only be closed once. A reservation found pending
+// past its expiry is expired instead.
+func (ppr *postgresqlProductRepository) closeReservation(ctx context.Context, productId, reservationId string,
+	status common.ReservationStatus) (*common.Reservation, error) {
+	txn, err := ppr.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Rollback()
+
+	var reservation common.Reservation
+	err = txn.QueryRowContext(ctx, lockReservationQuery, reservationId, productId).Scan(&reservation.Id,
+		&reservation.ProductId, &reservation.Quantity, &reservation.Status, &reservation.ExpiresAt,
+		&reservation.CreatedAt, &reservation.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrReservationNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var closeErr error
+	if !reservation.Active(now) {
+		if reservation.Status != common.ReservationPending {
+			return nil, ErrReservationNotActive
+		}
+
+		status = common.ReservationExpired
+		closeErr = ErrReservationNotActive
+	}
+
+	_, err = txn.ExecContext(ctx, updateReservationStatusQuery, reservation.Id, status, now)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if status != common.ReservationCommitted {
+		_, err = txn.ExecContext(ctx, restockQuery, reservation.ProductId, reservation.Quantity)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = txn.Commit()
+
+	if err != nil {
+		return nil, err
+	} else if closeErr != nil {
+		return nil, closeErr
+	}
+
+	reservation.Status = status
+	reservation.UpdatedAt = now
+	return &reservation, nil
+}
+
+// ExpireReservations returns the units held by every pending reservation past its expiry to stock, returning the
+// number of reservations expired.
+func (ppr *postgresqlProductRepository) ExpireReservations(ctx context.Context) (int, error) {
+	var expired int
+	err := ppr.db.QueryRowContext(ctx, expireReservationsQuery, time.Now().UTC()).Scan(&expired)
+	return expired, err
+}
+
+// upsertDatasetEntry runs an upsert query of a dataset entry, returning whether its row was inserted, updated or left
+// unchanged.
+func upsertDatasetEntry(txn *sql.Tx, query string, args ...interface{}) (upsertResult, error) {
+	var inserted bool
+	err := txn.QueryRow(query, args...).Scan(&inserted)
+
+	if err == sql.ErrNoRows {
+		return entryUnchanged, nil
+	} else if err != nil {
+		return entryUnchanged, err
+	} else if inserted {
+		return entryInserted, nil
+	}
+
+	return entryUpdated, nil
+}
+
+// loadInitPostgresqlData upserts the categories and products of the dataset at the given path, so that it can be
+// loaded on every launch. Rows are only touched when their dataset entry changed since it was last loaded, leaving
+// changes made through the repository, such as stock taken by reservations, in place otherwise. Products deleted
+// through the repository have no row left, so they are inserted again. Nothing is loaded if any entry fails to load.
+func loadInitPostgresqlData(db *sql.DB, path string) error {
+	data, err := loadInitDataset(path)
+
+	if err != nil {
+		return err
+	}
+
+	categories, err := sortCategoriesParentsFirst(data.Categories)
+
+	if err != nil {
+		return err
+	}
+
+	txn, err := db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer txn.Rollback()
+
+	var categoryCounts, productCounts loadCounts
+	for _, category := range categories {
+		hash, err := contentHash(category)
+
+		if err != nil {
+			return err
+		}
+
+		result, err := upsertDatasetEntry(txn, upsertCategoryQuery, category.Id, category.Name, category.ParentId,
+			hash)
+
+		if err != nil {
+			return err
+		}
+
+		categoryCounts.add(result)
+	}
+
+	// products loaded from changed entries, the latest entry of each id, along with those that already existed, whose
+	// previous categories, prices and variants are removed before any are added so that variants can move between
+	// products
+	changed := make([]common.Product, 0)
+	changedAt := make(map[string]int)
+	updated := make([]common.Product, 0)
+	for _, product := range data.Products {
+		hash, err := contentHash(product)
+
+		if err != nil {
+			return err
+		}
+
+		result, err := upsertDatasetEntry(txn, upsertProductQuery, product.Id, product.Name, product.Description,
+			product.ShortDescription, product.DisplayImage, product.Thumbnail, priceParam(product.Price),
+			product.QtyInStock, hash)
+
+		if err != nil {
+			return err
+		}
+
+		productCounts.add(result)
+
+		if i, ok := changedAt[product.Id]; ok && result != entryUnchanged {
+			changed[i] = product
+		} else if result != entryUnchanged {
+			changedAt[product.Id] = len(changed)
+			changed = append(changed, product)
+		}
+
+		if result == entryUpdated {
+			updated = append(updated, product)
+		}
+	}
+
+	for _, product := range updated {
+		for _, query := range []string{deleteProductCategoriesQuery, deleteProductPricesQuery,
+			deleteProductVariantsQuery} {
+			_, err = txn.Exec(query, product.Id)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, product := range changed {
+		for _, categoryId := range product.CategoryIds {
+			_, err = txn.Exec(insertProductCategoryQuery, product.Id, categoryId)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, product := range changed {
+		for _, currency := range sortedCurrencies(product.Prices) {
+			_, err = txn.Exec(insertProductPriceQuery, product.Id, currency, product.Prices[currency].StringFixed(6))
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, product := range changed {
+		for _, variant := range product.Variants {
+			err = insertProductVariant(context.Background(), txn, product.Id, variant)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = txn.Commit()
+
+	if err == nil {
+		log.Printf("Loaded dataset %s, categories: %s, products: %s", path, categoryCounts, productCounts)
 	}
 
-	return txn.Commit()
+	return err
 }
 
 // MakePostgresqlProductRespository constructs a PostgreSQL backed ProductRepository from the given params.
@@ -234,5 +1574,5 @@ func MakePostgresqlProductRespository(config common.Configuration, db *sql.DB) (
 		return nil, err
 	}
 
-	return &postgresqlProductRepository{db}, nil
+	return &postgresqlProductRepository{db, newCursorCodec(config)}, nil
 }
@@ -3,10 +3,15 @@ package repository_test
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
 	"github.com/stone1549/product-service/common"
 	"github.com/stone1549/product-service/repository"
 	"gopkg.in/DATA-DOG/go-sqlmock.v2"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 )
@@ -17,6 +22,19 @@ func mockExpectExecTimes(mock sqlmock.Sqlmock, sqlRegexStr string, times int) {
 	}
 }
 
+// mockExpectUpsertTimes expects a dataset entry to be upserted the given number of times, each inserting the entry when
+// inserted is true or leaving it unchanged otherwise.
+func mockExpectUpsertTimes(mock sqlmock.Sqlmock, sqlRegexStr string, times int, inserted bool) {
+	for i := 0; i < times; i++ {
+		rows := sqlmock.NewRows([]string{"inserted"})
+		if inserted {
+			rows.AddRow(true)
+		}
+
+		mock.ExpectQuery(sqlRegexStr).WillReturnRows(rows)
+	}
+}
+
 func makeAndTestPgSmallRepo() (*sql.DB, sqlmock.Sqlmock, repository.ProductRepository, error) {
 	var err error
 	db, mock, err := sqlmock.New()
@@ -25,7 +43,11 @@ func makeAndTestPgSmallRepo() (*sql.DB, sqlmock.Sqlmock, repository.ProductRepos
 	}
 
 	mock.ExpectBegin()
-	mockExpectExecTimes(mock, "INSERT INTO product", 20)
+	mockExpectUpsertTimes(mock, "INSERT INTO category", 8, true)
+	mockExpectUpsertTimes(mock, "INSERT INTO product \\(", 20, true)
+	mockExpectExecTimes(mock, "INSERT INTO product_category", 21)
+	mockExpectExecTimes(mock, "INSERT INTO product_price", 40)
+	mockExpectExecTimes(mock, "INSERT INTO product_variant", 5)
 	mock.ExpectCommit()
 	repo, err := repository.MakePostgresqlProductRespository(pgSmall, db)
 
@@ -40,6 +62,119 @@ func TestMakePostgresqlProductRespository_Ds(t *testing.T) {
 	ok(t, mock.ExpectationsWereMet())
 }
 
+// TestMakePostgresqlProductRespository_DsUnchanged ensures that loading a dataset that was already loaded leaves every
+// row untouched.
+func TestMakePostgresqlProductRespository_DsUnchanged(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	ok(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mockExpectUpsertTimes(mock, "INSERT INTO category", 8, false)
+	mockExpectUpsertTimes(mock, "INSERT INTO product \\(", 20, false)
+	mock.ExpectCommit()
+	_, err = repository.MakePostgresqlProductRespository(pgSmall, db)
+
+	ok(t, err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestMakePostgresqlProductRespository_DsUpdated ensures that the categories, prices and variants of a product updated
+// by a dataset are replaced.
+func TestMakePostgresqlProductRespository_DsUpdated(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	ok(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mockExpectUpsertTimes(mock, "INSERT INTO category", 8, false)
+	mock.ExpectQuery("INSERT INTO product \\(").WithArgs("1", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+		sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(false))
+	mockExpectUpsertTimes(mock, "INSERT INTO product \\(", 19, false)
+	mock.ExpectExec("DELETE FROM product_category").WithArgs("1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM product_price").WithArgs("1").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("DELETE FROM product_variant").WithArgs("1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mockExpectExecTimes(mock, "INSERT INTO product_category", 1)
+	mockExpectExecTimes(mock, "INSERT INTO product_price", 2)
+	mock.ExpectCommit()
+	_, err = repository.MakePostgresqlProductRespository(pgSmall, db)
+
+	ok(t, err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestMakePostgresqlProductRespository_DsFailRollback ensures that nothing is loaded when an entry of a dataset fails
+// to load.
+func TestMakePostgresqlProductRespository_DsFailRollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	ok(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mockExpectUpsertTimes(mock, "INSERT INTO category", 8, true)
+	mock.ExpectQuery("INSERT INTO product \\(").WillReturnError(errors.New("failed"))
+	mock.ExpectRollback()
+	_, err = repository.MakePostgresqlProductRespository(pgSmall, db)
+
+	notOk(t, err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// writeDataset writes the given dataset to a temporary file, returning its path and a function removing it.
+func writeDataset(t *testing.T, contents string) (string, func()) {
+	file, err := ioutil.TempFile("", "dataset")
+	ok(t, err)
+	_, err = file.WriteString(contents)
+	ok(t, err)
+	ok(t, file.Close())
+
+	return file.Name(), func() { os.Remove(file.Name()) }
+}
+
+// TestMakePostgresqlProductRespository_DsDuplicateCategories ensures that a dataset listing a category more than once
+// loads, every entry of the category being upserted before its children.
+func TestMakePostgresqlProductRespository_DsDuplicateCategories(t *testing.T) {
+	path, remove := writeDataset(t, `{"categories": [
+		{"id": "sub", "name": "Sub", "parentId": "tools"},
+		{"id": "tools", "name": "Tools"},
+		{"id": "tools", "name": "Hand Tools"}]}`)
+	defer remove()
+	db, mock, err := sqlmock.New()
+	ok(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO category").WithArgs("tools", "Tools", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+	mock.ExpectQuery("INSERT INTO category").WithArgs("tools", "Hand Tools", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(false))
+	mock.ExpectQuery("INSERT INTO category").WithArgs("sub", "Sub", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+	mock.ExpectCommit()
+	_, err = repository.MakePostgresqlProductRespository(datasetConfiguration{pgEmpty, path}, db)
+
+	ok(t, err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestMakePostgresqlProductRespository_DsFailCategoryCycle ensures that a dataset whose categories are their own
+// ancestors is rejected before anything is loaded.
+func TestMakePostgresqlProductRespository_DsFailCategoryCycle(t *testing.T) {
+	path, remove := writeDataset(t, `{"categories": [
+		{"id": "a", "name": "A", "parentId": "b"},
+		{"id": "b", "name": "B", "parentId": "a"}]}`)
+	defer remove()
+	db, mock, err := sqlmock.New()
+	ok(t, err)
+	defer db.Close()
+
+	_, err = repository.MakePostgresqlProductRespository(datasetConfiguration{pgEmpty, path}, db)
+
+	equals(t, repository.ErrCategoryCycle, err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
 // TestMakePostgresqlProductRespository ensures that an empty pg repo can be constructed.
 func TestMakePostgresqlProductRespository(t *testing.T) {
 	db, mock, err := sqlmock.New()
@@ -65,16 +200,21 @@ func getProductColumns() []string {
 	columns = append(columns, "qty_in_stock")
 	columns = append(columns, "created_at")
 	columns = append(columns, "updated_at")
+	columns = append(columns, "category_ids")
+	columns = append(columns, "variants")
+	columns = append(columns, "prices")
 	return columns
 }
-func addExpectedProductId1Row(rows *sqlmock.Rows) *sqlmock.Rows {
+
+// addExpectedProductId1Row adds product 1 to the given rows, followed by the given values of any extra columns.
+func addExpectedProductId1Row(rows *sqlmock.Rows, extra ...driver.Value) *sqlmock.Rows {
 	createdAt, _ := time.Parse("2006-01-15T15:20:59", "2017-01-01T00:00:00Z")
 	updatedAt, _ := time.Parse("2006-01-15T15:20:59", "2018-01-01T00:00:20Z")
-	return rows.AddRow(
+	return rows.AddRow(append([]driver.Value{
 		"1",
 		"Portal Gun",
-		"The Portal Gun is a gadget that allows the user(s) to travel between different universes/dimensions/"+
-			"realities.\n\nThe Gun was likely created by a Rick, although it is unknown which one; if there is any "+
+		"The Portal Gun is a gadget that allows the user(s) to travel between different universes/dimensions/" +
+			"realities.\n\nThe Gun was likely created by a Rick, although it is unknown which one; if there is any " +
 			"truth to C-137's fabricated origin story, then he may not be the original inventor.",
 		"Travel between different dimensions!",
 		"https://images-na.ssl-images-amazon.com/images/I/31s7nNMzMUL.jpg",
@@ -83,17 +223,20 @@ func addExpectedProductId1Row(rows *sqlmock.Rows) *sqlmock.Rows {
 		1,
 		createdAt,
 		updatedAt,
-	)
+		"{gadgets}",
+		"[]",
+		`{"EUR": 2299.99, "JPY": 374999}`,
+	}, extra...)...)
 }
 
-func addExpectedProductId2Row(rows *sqlmock.Rows) *sqlmock.Rows {
+func addExpectedProductId2Row(rows *sqlmock.Rows, extra ...driver.Value) *sqlmock.Rows {
 	createdAt, _ := time.Parse("2006-01-15T15:20:59", "2017-01-01T00:00:01Z")
 	updatedAt, _ := time.Parse("2006-01-15T15:20:59", "2018-01-01T00:00:19Z")
-	return rows.AddRow(
+	return rows.AddRow(append([]driver.Value{
 		"2",
 		"Portal Gun",
-		"The Portal Gun is a gadget that allows the user(s) to travel between different universes/dimensions/"+
-			"realities.\n\nThe Gun was likely created by a Rick, although it is unknown which one; if there is any "+
+		"The Portal Gun is a gadget that allows the user(s) to travel between different universes/dimensions/" +
+			"realities.\n\nThe Gun was likely created by a Rick, although it is unknown which one; if there is any " +
 			"truth to C-137's fabricated origin story, then he may not be the original inventor.",
 		"Travel between different dimensions!",
 		"https://images-na.ssl-images-amazon.com/images/I/31s7nNMzMUL.jpg",
@@ -102,17 +245,20 @@ func addExpectedProductId2Row(rows *sqlmock.Rows) *sqlmock.Rows {
 		1,
 		createdAt,
 		updatedAt,
-	)
+		"{gadgets}",
+		"[]",
+		`{"EUR": 2299.99, "JPY": 374999}`,
+	}, extra...)...)
 }
 
-func addExpectedProductId3Row(rows *sqlmock.Rows) *sqlmock.Rows {
+func addExpectedProductId3Row(rows *sqlmock.Rows, extra ...driver.Value) *sqlmock.Rows {
 	createdAt, _ := time.Parse("2006-01-15T15:20:59", "2017-01-01T00:00:02Z")
 	updatedAt, _ := time.Parse("2006-01-15T15:20:59", "2018-01-01T00:00:18Z")
-	return rows.AddRow(
+	return rows.AddRow(append([]driver.Value{
 		"3",
 		"Portal Gun",
-		"The Portal Gun is a gadget that allows the user(s) to travel between different universes/dimensions/"+
-			"realities.\n\nThe Gun was likely created by a Rick, although it is unknown which one; if there is any "+
+		"The Portal Gun is a gadget that allows the user(s) to travel between different universes/dimensions/" +
+			"realities.\n\nThe Gun was likely created by a Rick, although it is unknown which one; if there is any " +
 			"truth to C-137's fabricated origin story, then he may not be the original inventor.",
 		"Travel between different dimensions!",
 		"https://images-na.ssl-images-amazon.com/images/I/31s7nNMzMUL.jpg",
@@ -121,17 +267,20 @@ func addExpectedProductId3Row(rows *sqlmock.Rows) *sqlmock.Rows {
 		10,
 		createdAt,
 		updatedAt,
-	)
+		"{gadgets}",
+		"[]",
+		`{"EUR": 2299.99, "JPY": 374999}`,
+	}, extra...)...)
 }
 
-func addExpectedProductId4Row(rows *sqlmock.Rows) *sqlmock.Rows {
+func addExpectedProductId4Row(rows *sqlmock.Rows, extra ...driver.Value) *sqlmock.Rows {
 	createdAt, _ := time.Parse("2006-01-15T15:20:59", "2017-01-01T00:00:03Z")
 	updatedAt, _ := time.Parse("2006-01-15T15:20:59", "2018-01-01T00:00:17Z")
-	return rows.AddRow(
+	return rows.AddRow(append([]driver.Value{
 		"4",
 		"Portal Gun",
-		"The Portal Gun is a gadget that allows the user(s) to travel between different universes/dimensions/"+
-			"realities.\n\nThe Gun was likely created by a Rick, although it is unknown which one; if there is any "+
+		"The Portal Gun is a gadget that allows the user(s) to travel between different universes/dimensions/" +
+			"realities.\n\nThe Gun was likely created by a Rick, although it is unknown which one; if there is any " +
 			"truth to C-137's fabricated origin story, then he may not be the original inventor.",
 		"Travel between different dimensions!",
 		"https://images-na.ssl-images-amazon.com/images/I/31s7nNMzMUL.jpg",
@@ -140,17 +289,20 @@ func addExpectedProductId4Row(rows *sqlmock.Rows) *sqlmock.Rows {
 		1,
 		createdAt,
 		updatedAt,
-	)
+		"{gadgets}",
+		"[]",
+		`{"EUR": 2299.99, "JPY": 374999}`,
+	}, extra...)...)
 }
 
-func addExpectedProductId5Row(rows *sqlmock.Rows) *sqlmock.Rows {
+func addExpectedProductId5Row(rows *sqlmock.Rows, extra ...driver.Value) *sqlmock.Rows {
 	createdAt, _ := time.Parse("2006-01-15T15:20:59", "2017-01-01T00:00:04Z")
 	updatedAt, _ := time.Parse("2006-01-15T15:20:59", "2018-01-01T00:00:16Z")
-	return rows.AddRow(
+	return rows.AddRow(append([]driver.Value{
 		"5",
 		"Portal Gun",
-		"The Portal Gun is a gadget that allows the user(s) to travel between different universes/dimensions/"+
-			"realities.\n\nThe Gun was likely created by a Rick, although it is unknown which one; if there is any "+
+		"The Portal Gun is a gadget that allows the user(s) to travel between different universes/dimensions/" +
+			"realities.\n\nThe Gun was likely created by a Rick, although it is unknown which one; if there is any " +
 			"truth to C-137's fabricated origin story, then he may not be the original inventor.",
 		"Travel between different dimensions!",
 		"https://images-na.ssl-images-amazon.com/images/I/31s7nNMzMUL.jpg",
@@ -159,13 +311,21 @@ func addExpectedProductId5Row(rows *sqlmock.Rows) *sqlmock.Rows {
 		1,
 		createdAt,
 		updatedAt,
-	)
+		"{gadgets}",
+		"[]",
+		`{"EUR": 2299.99, "JPY": 374999}`,
+	}, extra...)...)
 }
 
 func newProductRows() *sqlmock.Rows {
 	return sqlmock.NewRows(getProductColumns())
 }
 
+// newSearchRows builds rows holding the product columns followed by the score and highlight columns of a search.
+func newSearchRows() *sqlmock.Rows {
+	return sqlmock.NewRows(append(getProductColumns(), "score", "name_headline", "description_headline"))
+}
+
 // TestGetProduct_PgSuccessWithResult ensures that a product can be retrieved by its id.
 func TestGetProduct_PgSuccessWithResult(t *testing.T) {
 	db, mock, repo, err := makeAndTestPgSmallRepo()
@@ -182,6 +342,48 @@ func TestGetProduct_PgSuccessWithResult(t *testing.T) {
 	ok(t, mock.ExpectationsWereMet())
 }
 
+// TestGetProduct_PgSuccessWithFields ensures that only the columns of the requested fields are selected.
+func TestGetProduct_PgSuccessWithFields(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	fields, err := common.ParseProductFields("id,name,price,thumbnail")
+	ok(t, err)
+
+	mock.ExpectQuery("SELECT id, name, NULL, NULL, NULL, thumbnail, price, qty_in_stock, created_at, updated_at, " +
+		"NULL, NULL, .* FROM product WHERE id=\\$1").
+		WithArgs("1").
+		WillReturnRows(newProductRows().AddRow("1", "Portal Gun", nil, nil, nil, "thumbnail.jpg", "2499.990000", 1,
+			nil, nil, nil, nil, "{}"))
+	product, err := repo.GetProduct(common.WithProductFields(context.Background(), fields), "1")
+
+	ok(t, err)
+	equals(t, "Portal Gun", product.Name)
+	assert(t, product.Description == nil, "Expected description to not be selected")
+	equals(t, 0, len(product.Variants))
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestGetProductsByIds_PgSuccess ensures that products are retrieved once each, in the order of their ids, skipping ids
+// without a product.
+func TestGetProductsByIds_PgSuccess(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectQuery("SELECT .* FROM product WHERE id = ANY\\(\\$1\\)").
+		WithArgs(`{"2","A","1","2"}`).
+		WillReturnRows(addExpectedProductId2Row(addExpectedProductId1Row(newProductRows())))
+	products, err := repo.GetProductsByIds(context.Background(), []string{"2", "A", "1", "2"})
+
+	ok(t, err)
+	equals(t, 2, len(products))
+	equals(t, "2", products[0].Id)
+	equals(t, "1", products[1].Id)
+	ok(t, mock.ExpectationsWereMet())
+}
+
 // TestGetProduct_PgSuccessWithNoResult ensures that attempting to retrieve a product that does not exist will return
 // nil.
 func TestGetProduct_PgSuccessWithNoResult(t *testing.T) {
@@ -212,7 +414,22 @@ func TestGetProduct_PgError(t *testing.T) {
 	ok(t, mock.ExpectationsWereMet())
 }
 
-const getProductsRegexStr = "SELECT .* FROM product .* LIMIT \\$1 OFFSET \\$2"
+const getProductsRegexStr = "SELECT .* FROM product +ORDER BY updated_at DESC, created_at DESC, id DESC LIMIT \\$1"
+const getProductsPageTwoRegexStr = "SELECT .* FROM product WHERE \\(updated_at, created_at, id\\) < " +
+	"\\(\\$2, \\$3, \\$4\\) ORDER BY updated_at DESC, created_at DESC, id DESC LIMIT \\$1"
+
+// getPgPageTwoCursor retrieves the cursor following product 5 from the given repo using the default order.
+func getPgPageTwoCursor(t *testing.T, mock sqlmock.Sqlmock, repo repository.ProductRepository) string {
+	expRows := addExpectedProductId5Row(addExpectedProductId4Row(addExpectedProductId3Row(
+		addExpectedProductId2Row(addExpectedProductId1Row(newProductRows())))))
+	mock.ExpectQuery(getProductsRegexStr).
+		WithArgs(5).
+		WillReturnRows(expRows)
+	products, err := repo.GetProducts(context.Background(), 5, "", common.OrderBy{}, common.ProductFilter{})
+
+	ok(t, err)
+	return products.Cursor
+}
 
 // TestGetProducts_PgSuccessWithPartialResults ensures that a partial set of products will be returned when appropriate.
 func TestGetProducts_PgSuccessWithPartialResults(t *testing.T) {
@@ -221,13 +438,13 @@ func TestGetProducts_PgSuccessWithPartialResults(t *testing.T) {
 	ok(t, err)
 
 	mock.ExpectQuery(getProductsRegexStr).
-		WithArgs(5, 0).
+		WithArgs(5).
 		WillReturnRows(addExpectedProductId2Row(addExpectedProductId1Row(newProductRows())))
-	products, err := repo.GetProducts(context.Background(), 5, "", common.OrderBy{})
+	products, err := repo.GetProducts(context.Background(), 5, "", common.OrderBy{}, common.ProductFilter{})
 
 	ok(t, err)
 	equals(t, 2, len(products.Products))
-	equals(t, "2", products.Cursor)
+	assert(t, products.Cursor != "", "Expected cursor to not be empty")
 	ok(t, mock.ExpectationsWereMet())
 }
 
@@ -240,13 +457,13 @@ func TestGetProducts_PgSuccessWithFullResults(t *testing.T) {
 	expRows := addExpectedProductId5Row(addExpectedProductId4Row(addExpectedProductId3Row(
 		addExpectedProductId2Row(addExpectedProductId1Row(newProductRows())))))
 	mock.ExpectQuery(getProductsRegexStr).
-		WithArgs(5, 0).
+		WithArgs(5).
 		WillReturnRows(expRows)
-	products, err := repo.GetProducts(context.Background(), 5, "", common.OrderBy{})
+	products, err := repo.GetProducts(context.Background(), 5, "", common.OrderBy{}, common.ProductFilter{})
 
 	ok(t, err)
 	equals(t, 5, len(products.Products))
-	equals(t, "5", products.Cursor)
+	assert(t, products.Cursor != "", "Expected cursor to not be empty")
 	ok(t, mock.ExpectationsWereMet())
 }
 
@@ -257,14 +474,55 @@ func TestGetProducts_PgSuccessWithFullResultsEmptyPageTwo(t *testing.T) {
 	defer db.Close()
 	ok(t, err)
 
-	mock.ExpectQuery(getProductsRegexStr).
-		WithArgs(5, 5).
+	cursor := getPgPageTwoCursor(t, mock, repo)
+	mock.ExpectQuery(getProductsPageTwoRegexStr).
+		WithArgs(5, sqlmock.AnyArg(), sqlmock.AnyArg(), "5").
 		WillReturnRows(newProductRows())
-	products, err := repo.GetProducts(context.Background(), 5, "5", common.OrderBy{})
+	products, err := repo.GetProducts(context.Background(), 5, cursor, common.OrderBy{}, common.ProductFilter{})
 
 	ok(t, err)
 	equals(t, 0, len(products.Products))
-	equals(t, "5", products.Cursor)
+	equals(t, cursor, products.Cursor)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestGetProducts_PgSuccessMixedOrder ensures that a cursor for keys sorted in differing directions is translated
+// into an expanded keyset predicate.
+func TestGetProducts_PgSuccessMixedOrder(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	orderBy := common.OrderBy{}
+	ok(t, orderBy.Add(common.OrderByName))
+	ok(t, orderBy.Add(common.OrderByCreatedDesc))
+
+	mock.ExpectQuery("SELECT .* FROM product +ORDER BY name, created_at DESC, id DESC LIMIT \\$1").
+		WithArgs(1).
+		WillReturnRows(addExpectedProductId1Row(newProductRows()))
+	products, err := repo.GetProducts(context.Background(), 1, "", orderBy, common.ProductFilter{})
+	ok(t, err)
+
+	mock.ExpectQuery("SELECT .* FROM product WHERE \\(\\(name > \\$2\\) OR \\(name = \\$2 AND "+
+		"created_at < \\$3\\) OR \\(name = \\$2 AND created_at = \\$3 AND id < \\$4\\)\\) ORDER BY").
+		WithArgs(1, "Portal Gun", sqlmock.AnyArg(), "1").
+		WillReturnRows(addExpectedProductId2Row(newProductRows()))
+	products, err = repo.GetProducts(context.Background(), 1, products.Cursor, orderBy, common.ProductFilter{})
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestGetProducts_PgFailInvalidCursor ensures that a malformed cursor is rejected without querying PG.
+func TestGetProducts_PgFailInvalidCursor(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	_, err = repo.GetProducts(context.Background(), 5, "5", common.OrderBy{}, common.ProductFilter{})
+
+	equals(t, repository.ErrInvalidCursor, err)
 	ok(t, mock.ExpectationsWereMet())
 }
 
@@ -274,10 +532,10 @@ func TestGetProducts_PgError(t *testing.T) {
 	defer db.Close()
 	ok(t, err)
 
-	mock.ExpectQuery(getProductsRegexStr).
-		WithArgs(5, 5).
+	cursor := getPgPageTwoCursor(t, mock, repo)
+	mock.ExpectQuery(getProductsPageTwoRegexStr).
 		WillReturnError(errors.New("test error"))
-	_, err = repo.GetProducts(context.Background(), 5, "5", common.OrderBy{})
+	_, err = repo.GetProducts(context.Background(), 5, cursor, common.OrderBy{}, common.ProductFilter{})
 
 	notOk(t, err)
 	ok(t, mock.ExpectationsWereMet())
@@ -290,13 +548,16 @@ func TestSearchProducts_PgSuccessWithPartialResults(t *testing.T) {
 	ok(t, err)
 
 	mock.ExpectQuery("SELECT .* FROM product").
-		WithArgs("portal", 5, 0).
-		WillReturnRows(addExpectedProductId2Row(addExpectedProductId1Row(newProductRows())))
-	products, err := repo.SearchProducts(context.Background(), "portal", 5, "")
+		WithArgs(5, "portal").
+		WillReturnRows(addExpectedProductId2Row(addExpectedProductId1Row(newSearchRows(), 0.6, nil, nil), 0.3, nil,
+			nil))
+	products, err := repo.SearchProducts(context.Background(), "portal", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
 
 	ok(t, err)
 	equals(t, 2, len(products.Products))
-	equals(t, "2", products.Cursor)
+	equals(t, 2, len(products.Hits))
+	assert(t, products.Cursor != "", "Expected cursor to not be empty")
 	ok(t, mock.ExpectationsWereMet())
 }
 
@@ -306,33 +567,102 @@ func TestSearchProducts_PgSuccessWithFullResults(t *testing.T) {
 	defer db.Close()
 	ok(t, err)
 
-	expRows := addExpectedProductId5Row(addExpectedProductId4Row(addExpectedProductId3Row(
-		addExpectedProductId2Row(addExpectedProductId1Row(newProductRows())))))
-	mock.ExpectQuery("SELECT .* FROM product").
-		WithArgs("portal", 5, 0).
-		WillReturnRows(expRows)
-	products, err := repo.SearchProducts(context.Background(), "portal", 5, "")
+	mock.ExpectQuery(searchProductsRegexStr).
+		WithArgs(5, "portal").
+		WillReturnRows(newFullSearchRows())
+	products, err := repo.SearchProducts(context.Background(), "portal", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
 
 	ok(t, err)
 	equals(t, 5, len(products.Products))
-	equals(t, "5", products.Cursor)
+	equals(t, "1", products.Products[0].Id)
+	equals(t, 0.9, products.Hits[0].Score)
+	assert(t, products.Hits[0].Highlights == nil, "Expected highlights to be nil")
+	assert(t, products.Cursor != "", "Expected cursor to not be empty")
 	ok(t, mock.ExpectationsWereMet())
 }
 
+const searchProductsRegexStr = "SELECT .*ts_rank\\(textsearchable_index_col, to_tsquery\\(\\$2\\)\\), NULL, NULL +" +
+	"FROM product WHERE textsearchable_index_col @@ to_tsquery\\(\\$2\\) +" +
+	"ORDER BY ts_rank\\(textsearchable_index_col, to_tsquery\\(\\$2\\)\\) DESC, id DESC LIMIT \\$1"
+
+// newFullSearchRows builds the rows of a full page of search results, most relevant first.
+func newFullSearchRows() *sqlmock.Rows {
+	rows := addExpectedProductId1Row(newSearchRows(), 0.9, nil, nil)
+	rows = addExpectedProductId2Row(rows, 0.7, nil, nil)
+	rows = addExpectedProductId3Row(rows, 0.5, nil, nil)
+	rows = addExpectedProductId4Row(rows, 0.3, nil, nil)
+	return addExpectedProductId5Row(rows, 0.1, nil, nil)
+}
+
 // TestSearchProducts_PgSuccessWithFullResultsEmptyPageTwo ensures that an empty set will be returned when appropriate.
 func TestSearchProducts_PgSuccessWithFullResultsEmptyPageTwo(t *testing.T) {
 	db, mock, repo, err := makeAndTestPgSmallRepo()
 	defer db.Close()
 	ok(t, err)
 
-	mock.ExpectQuery("SELECT .* FROM product").
-		WithArgs("portal", 5, 5).
-		WillReturnRows(newProductRows())
-	products, err := repo.SearchProducts(context.Background(), "portal", 5, "5")
+	mock.ExpectQuery(searchProductsRegexStr).
+		WithArgs(5, "portal").
+		WillReturnRows(newFullSearchRows())
+	products, err := repo.SearchProducts(context.Background(), "portal", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
+	ok(t, err)
+
+	cursor := products.Cursor
+	mock.ExpectQuery("SELECT .* FROM product WHERE .* AND \\(ts_rank\\(textsearchable_index_col, "+
+		"to_tsquery\\(\\$2\\)\\), id\\) < \\(\\$3, \\$4\\)").
+		WithArgs(5, "portal", "0.1", "5").
+		WillReturnRows(newSearchRows())
+	products, err = repo.SearchProducts(context.Background(), "portal", 5, cursor,
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
+
+	ok(t, err)
+	equals(t, 0, len(products.Products))
+	equals(t, cursor, products.Cursor)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestSearchProducts_PgSuccessOrderByPrice ensures that matches can be ordered by price before relevance and paged
+// through.
+func TestSearchProducts_PgSuccessOrderByPrice(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	orderBy := common.OrderBy{}
+	ok(t, orderBy.Add(common.OrderByPrice))
+	ok(t, orderBy.Add(common.OrderByRelevance))
+	mock.ExpectQuery("SELECT .* FROM product WHERE .* ORDER BY price, ts_rank\\(textsearchable_index_col, "+
+		"to_tsquery\\(\\$2\\)\\) DESC, id DESC LIMIT \\$1").
+		WithArgs(1, "portal").
+		WillReturnRows(addExpectedProductId5Row(newSearchRows(), 0.1, nil, nil))
+	products, err := repo.SearchProducts(context.Background(), "portal", 1, "", orderBy, common.ProductFilter{},
+		common.SearchOptions{})
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+
+	mock.ExpectQuery("SELECT .* FROM product WHERE .* AND \\(\\(price > \\$3\\) OR .* AND id < \\$5\\)\\)").
+		WithArgs(1, "portal", "2499.99", "0.1", "5").
+		WillReturnRows(newSearchRows())
+	products, err = repo.SearchProducts(context.Background(), "portal", 1, products.Cursor, orderBy,
+		common.ProductFilter{}, common.SearchOptions{})
 
 	ok(t, err)
 	equals(t, 0, len(products.Products))
-	equals(t, "5", products.Cursor)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestGetProducts_PgFailOrderByRelevance ensures that products can only be ordered by relevance when searching.
+func TestGetProducts_PgFailOrderByRelevance(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	orderBy := common.OrderBy{}
+	ok(t, orderBy.Add(common.OrderByRelevance))
+	_, err = repo.GetProducts(context.Background(), 5, "", orderBy, common.ProductFilter{})
+
+	equals(t, repository.ErrInvalidOrder, err)
 	ok(t, mock.ExpectationsWereMet())
 }
 
@@ -344,10 +674,843 @@ func TestSearchProducts_PgError(t *testing.T) {
 	ok(t, err)
 
 	mock.ExpectQuery("SELECT .* FROM product").
-		WithArgs("portal", 5, 5).
+		WithArgs(5, "portal").
 		WillReturnError(errors.New("test error"))
-	_, err = repo.SearchProducts(context.Background(), "portal", 5, "5")
+	_, err = repo.SearchProducts(context.Background(), "portal", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
 
 	notOk(t, err)
 	ok(t, mock.ExpectationsWereMet())
 }
+
+// TestSearchProducts_PgSuccessWithQuerySyntax ensures that search text is compiled into a tsquery that cannot be
+// mistaken for operators.
+func TestSearchProducts_PgSuccessWithQuerySyntax(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectQuery(searchProductsRegexStr).
+		WithArgs(5, "((portal <-> gun) | ray:*) & c & !(time <-> crystal) & !seeds").
+		WillReturnRows(addExpectedProductId1Row(newSearchRows(), 0.6, nil, nil))
+	products, err := repo.SearchProducts(context.Background(), `"portal gun" OR ray* & c! -"time crystal" -seeds`,
+		5, "", common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestSearchProducts_PgFailEmptySearch ensures that search text without any words to match is rejected without
+// querying PG.
+func TestSearchProducts_PgFailEmptySearch(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	_, err = repo.SearchProducts(context.Background(), "& -portal", 5, "", common.OrderBy{}, common.ProductFilter{},
+		common.SearchOptions{})
+
+	equals(t, repository.ErrInvalidSearch, err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestSearchProducts_PgSuccessFuzzy ensures that fuzzy words also match similar words within their fuzziness.
+func TestSearchProducts_PgSuccessFuzzy(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectQuery("SELECT term.word, product_word.word, product_word.ndoc FROM unnest\\(\\$1::text\\[\\]\\)").
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"word", "word", "ndoc"}).
+			AddRow("plumbis", "plumbus", 1).
+			AddRow("plumbis", "plum", 3))
+	mock.ExpectQuery(searchProductsRegexStr).
+		WithArgs(5, "(plumbis | plumbus) & ok").
+		WillReturnRows(addExpectedProductId2Row(newSearchRows(), 0.6, nil, nil))
+	products, err := repo.SearchProducts(context.Background(), "plumbis ok", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{Fuzzy: true})
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, "", products.DidYouMean)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestSearchProducts_PgSuccessDidYouMean ensures that corrected search text is suggested when nothing matches.
+func TestSearchProducts_PgSuccessDidYouMean(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectQuery(searchProductsRegexStr).
+		WithArgs(5, "portl & gum").
+		WillReturnRows(newSearchRows())
+	mock.ExpectQuery("SELECT term.word, product_word.word, product_word.ndoc FROM unnest").
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"word", "word", "ndoc"}).
+			AddRow("portl", "portal", 1).
+			AddRow("portl", "port", 4).
+			AddRow("gum", "gum", 1).
+			AddRow("gum", "gun", 2))
+	products, err := repo.SearchProducts(context.Background(), "Portl gum", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
+
+	ok(t, err)
+	equals(t, 0, len(products.Products))
+	equals(t, "port gum", products.DidYouMean)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestSearchProducts_PgSuccessDidYouMeanFirstPageOnly ensures that corrected search text is only suggested on the first
+// page, later pages running out of matches without querying candidates.
+func TestSearchProducts_PgSuccessDidYouMeanFirstPageOnly(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectQuery(searchProductsRegexStr).
+		WithArgs(5, "portal").
+		WillReturnRows(newFullSearchRows())
+	products, err := repo.SearchProducts(context.Background(), "portal", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
+	ok(t, err)
+
+	mock.ExpectQuery("SELECT .* FROM product WHERE .* AND \\(ts_rank\\(textsearchable_index_col, "+
+		"to_tsquery\\(\\$2\\)\\), id\\) < \\(\\$3, \\$4\\)").
+		WithArgs(5, "portl & gum", "0.1", "5").
+		WillReturnRows(newSearchRows())
+	products, err = repo.SearchProducts(context.Background(), "Portl gum", 5, products.Cursor,
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{})
+
+	ok(t, err)
+	equals(t, 0, len(products.Products))
+	equals(t, "", products.DidYouMean)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestSuggestProducts_PgSuccess ensures that product and category names are suggested with a prefix tsquery.
+func TestSuggestProducts_PgSuccess(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectQuery("SELECT id, name, ts_rank\\(.*\\) FROM product WHERE to_tsvector\\('simple', name\\) @@ "+
+		"to_tsquery\\('simple', \\$1\\)").
+		WithArgs("time:* & cr:*", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "ts_rank"}).AddRow("17", "Time Crystal", 0.2))
+	mock.ExpectQuery("SELECT id, name, ts_rank\\(.*\\) FROM category WHERE").
+		WithArgs("time:* & cr:*", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "ts_rank"}))
+	suggestions, err := repo.SuggestProducts(context.Background(), "Time cr", 5, true)
+
+	ok(t, err)
+	equals(t, []common.Suggestion{{Id: "17", Text: "Time Crystal", Score: 0.2}}, suggestions.Products)
+	equals(t, []common.Suggestion{}, suggestions.Categories)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestSearchProducts_PgSuccessWithHighlights ensures that highlighted snippets of the name and description are
+// returned when requested.
+func TestSearchProducts_PgSuccessWithHighlights(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectQuery("SELECT .*ts_headline\\('pg_catalog.english', name, to_tsquery\\(\\$2\\), "+
+		"'StartSel=<mark>, StopSel=</mark>'\\).* FROM product WHERE").
+		WithArgs(5, "portal").
+		WillReturnRows(addExpectedProductId1Row(newSearchRows(), 0.6, "<mark>Portal</mark> Gun", nil))
+	products, err := repo.SearchProducts(context.Background(), "portal", 5, "",
+		common.OrderBy{}, common.ProductFilter{}, common.SearchOptions{Highlight: true})
+
+	ok(t, err)
+	equals(t, 1, len(products.Hits))
+	equals(t, map[string][]string{common.HighlightName: {"<mark>Portal</mark> Gun"}}, products.Hits[0].Highlights)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestSearchProducts_PgSuccessWithFacets ensures that the requested facets are counted across every match with
+// GROUP BY queries.
+func TestSearchProducts_PgSuccessWithFacets(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	options := common.SearchOptions{Facets: common.FacetRequest{
+		Price:           true,
+		PriceBoundaries: []decimal.Decimal{decimal.New(100, 0), decimal.New(1000, 0)},
+		InStock:         true,
+		Category:        true,
+		Options:         []string{"size"},
+	}}
+	mock.ExpectQuery("SELECT .* FROM product").
+		WithArgs(1, "portal").
+		WillReturnRows(addExpectedProductId1Row(newSearchRows(), 0.6, nil, nil))
+	mock.ExpectQuery("SELECT width_bucket\\(price, \\$3::numeric\\[\\]\\), COUNT\\(\\*\\) FROM product WHERE id IN "+
+		"\\(SELECT id FROM product WHERE textsearchable_index_col @@ to_tsquery\\(\\$2\\) LIMIT \\$1\\)").
+		WithArgs(nil, "portal", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"width_bucket", "count"}).AddRow(1, 3).AddRow(2, 4).AddRow(nil, 1))
+	mock.ExpectQuery("SELECT qty_in_stock > 0, COUNT\\(\\*\\) FROM product").
+		WithArgs(nil, "portal").
+		WillReturnRows(sqlmock.NewRows([]string{"in_stock", "count"}).AddRow(true, 6).AddRow(false, 1))
+	mock.ExpectQuery("SELECT category_id, COUNT\\(\\*\\) FROM product_category").
+		WithArgs(nil, "portal").
+		WillReturnRows(sqlmock.NewRows([]string{"category_id", "count"}).AddRow("gadgets", 2).AddRow("apparel", 5))
+	mock.ExpectQuery("SELECT options->>\\$3, COUNT\\(DISTINCT product_id\\) FROM product_variant").
+		WithArgs(nil, "portal", "size").
+		WillReturnRows(sqlmock.NewRows([]string{"size", "count"}).AddRow("M", 1))
+	products, err := repo.SearchProducts(context.Background(), "portal", 1, "",
+		common.OrderBy{}, common.ProductFilter{}, options)
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, 4, len(products.Facets))
+	equals(t, common.FacetPrice, products.Facets[0].Name)
+	equals(t, 0, products.Facets[0].Buckets[0].Count)
+	equals(t, 3, products.Facets[0].Buckets[1].Count)
+	equals(t, 4, products.Facets[0].Buckets[2].Count)
+	equals(t, common.FacetBucket{Value: "true", Count: 6}, products.Facets[1].Buckets[0])
+	equals(t, common.FacetBucket{Value: "false", Count: 1}, products.Facets[1].Buckets[1])
+	equals(t, common.Facet{Name: common.FacetCategory, Buckets: []common.FacetBucket{
+		{Value: "apparel", Count: 5},
+		{Value: "gadgets", Count: 2},
+	}}, products.Facets[2])
+	equals(t, common.Facet{Name: "option:size", Buckets: []common.FacetBucket{{Value: "M", Count: 1}}},
+		products.Facets[3])
+	ok(t, mock.ExpectationsWereMet())
+}
+
+func makeTestPgProduct() common.Product {
+	price := decimal.NewFromFloat(2499.99)
+	return common.Product{
+		Id:          "1",
+		Name:        "Portal Gun",
+		Price:       &price,
+		QtyInStock:  1,
+		CategoryIds: []string{"gadgets"},
+	}
+}
+
+// TestCreateProduct_PgSuccess ensures that a product can be created.
+func TestCreateProduct_PgSuccess(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO product").
+		WithArgs("1", "Portal Gun", nil, nil, nil, nil, "2499.990000", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM product_category WHERE product_id=\\$1").
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO product_category").
+		WithArgs("1", "gadgets").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM product_variant WHERE product_id=\\$1").
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM product_price WHERE product_id=\\$1").
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT .* FROM product WHERE id=\\$1").
+		WithArgs("1").
+		WillReturnRows(addExpectedProductId1Row(newProductRows()))
+	product, err := repo.CreateProduct(context.Background(), makeTestPgProduct())
+
+	ok(t, err)
+	assert(t, product != nil, "Expected product to not be nil")
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestCreateProduct_PgFailExists ensures that a product can not be created with an id that is already in use.
+func TestCreateProduct_PgFailExists(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO product").
+		WillReturnError(&pq.Error{Code: "23505"})
+	mock.ExpectRollback()
+	_, err = repo.CreateProduct(context.Background(), makeTestPgProduct())
+
+	equals(t, repository.ErrProductExists, err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestUpdateProduct_PgSuccess ensures that a product can be replaced.
+func TestUpdateProduct_PgSuccess(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE product SET .* WHERE id=\\$1").
+		WithArgs("1", "Portal Gun", nil, nil, nil, nil, "2499.990000", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM product_category WHERE product_id=\\$1").
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO product_category").
+		WithArgs("1", "gadgets").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM product_variant WHERE product_id=\\$1").
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM product_price WHERE product_id=\\$1").
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT .* FROM product WHERE id=\\$1").
+		WithArgs("1").
+		WillReturnRows(addExpectedProductId1Row(newProductRows()))
+	product, err := repo.UpdateProduct(context.Background(), makeTestPgProduct())
+
+	ok(t, err)
+	assert(t, product != nil, "Expected product to not be nil")
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestUpdateProduct_PgFailNotFound ensures that updating a product that does not exist fails.
+func TestUpdateProduct_PgFailNotFound(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE product SET .* WHERE id=\\$1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	_, err = repo.UpdateProduct(context.Background(), makeTestPgProduct())
+
+	equals(t, repository.ErrProductNotFound, err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestDeleteProduct_PgSuccess ensures that a product can be removed.
+func TestDeleteProduct_PgSuccess(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectExec("DELETE FROM product WHERE id=\\$1").
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ok(t, repo.DeleteProduct(context.Background(), "1"))
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestDeleteProduct_PgSuccessReloaded ensures that a product deleted through the repo is inserted again when the dataset
+// is loaded, along with its categories and prices.
+func TestDeleteProduct_PgSuccessReloaded(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectExec("DELETE FROM product WHERE id=\\$1").
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	ok(t, repo.DeleteProduct(context.Background(), "1"))
+
+	mock.ExpectBegin()
+	mockExpectUpsertTimes(mock, "INSERT INTO category", 8, false)
+	mock.ExpectQuery("INSERT INTO product \\(").WithArgs("1", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+		sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+	mockExpectUpsertTimes(mock, "INSERT INTO product \\(", 19, false)
+	mock.ExpectExec("INSERT INTO product_category").WithArgs("1", "gadgets").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mockExpectExecTimes(mock, "INSERT INTO product_price", 2)
+	mock.ExpectCommit()
+	_, err = repository.MakePostgresqlProductRespository(pgSmall, db)
+
+	ok(t, err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestDeleteProduct_PgFailNotFound ensures that deleting a product that does not exist fails.
+func TestDeleteProduct_PgFailNotFound(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectExec("DELETE FROM product WHERE id=\\$1").
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	equals(t, repository.ErrProductNotFound, repo.DeleteProduct(context.Background(), "1"))
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestGetProducts_PgFailTamperedCursor ensures that a cursor that has been modified is rejected without querying PG.
+func TestGetProducts_PgFailTamperedCursor(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	cursor := []byte(getPgPageTwoCursor(t, mock, repo))
+	cursor[len(cursor)/2] ^= 1
+	_, err = repo.GetProducts(context.Background(), 5, string(cursor), common.OrderBy{}, common.ProductFilter{})
+
+	equals(t, repository.ErrInvalidCursor, err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestGetProducts_PgFailMismatchedCursor ensures that a cursor issued for a different order is rejected without
+// querying PG.
+func TestGetProducts_PgFailMismatchedCursor(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	cursor := getPgPageTwoCursor(t, mock, repo)
+	orderBy := common.OrderBy{}
+	ok(t, orderBy.Add(common.OrderByName))
+	_, err = repo.GetProducts(context.Background(), 5, cursor, orderBy, common.ProductFilter{})
+
+	equals(t, repository.ErrInvalidCursor, err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestGetProducts_PgSuccessFilter ensures that a filter is translated into parameterized conditions.
+func TestGetProducts_PgSuccessFilter(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	minPrice := decimal.NewFromFloat(10)
+	maxPrice := decimal.NewFromFloat(100.5)
+	inStock := true
+	createdAfter := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	filter := common.ProductFilter{MinPrice: &minPrice, MaxPrice: &maxPrice, InStock: &inStock,
+		CreatedAfter: &createdAfter, Ids: []string{"1", "2"}}
+
+	mock.ExpectQuery("SELECT .* FROM product WHERE price >= \\$2 AND price <= \\$3 AND qty_in_stock > 0 AND "+
+		"created_at > \\$4 AND id = ANY\\(\\$5\\) ORDER BY").
+		WithArgs(5, "10", "100.5", createdAfter, sqlmock.AnyArg()).
+		WillReturnRows(addExpectedProductId1Row(newProductRows()))
+	products, err := repo.GetProducts(context.Background(), 5, "", common.OrderBy{}, filter)
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestGetProducts_PgSuccessFilterPageTwo ensures that a filter is combined with the keyset predicate.
+func TestGetProducts_PgSuccessFilterPageTwo(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	inStock := false
+	filter := common.ProductFilter{InStock: &inStock}
+	cursor := getPgPageTwoCursor(t, mock, repo)
+
+	mock.ExpectQuery("SELECT .* FROM product WHERE qty_in_stock <= 0 AND \\(updated_at, created_at, id\\) < "+
+		"\\(\\$2, \\$3, \\$4\\) ORDER BY").
+		WithArgs(5, sqlmock.AnyArg(), sqlmock.AnyArg(), "5").
+		WillReturnRows(newProductRows())
+	products, err := repo.GetProducts(context.Background(), 5, cursor, common.OrderBy{}, filter)
+
+	ok(t, err)
+	equals(t, 0, len(products.Products))
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestCreateProduct_PgFailUnknownCategory ensures that a product can not be assigned to a category that does not
+// exist.
+func TestCreateProduct_PgFailUnknownCategory(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO product").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM product_category WHERE product_id=\\$1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO product_category").
+		WillReturnError(&pq.Error{Code: "23503"})
+	mock.ExpectRollback()
+	_, err = repo.CreateProduct(context.Background(), makeTestPgProduct())
+
+	equals(t, repository.ErrCategoryNotFound, err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+func newCategoryRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "name", "parent_id"})
+}
+
+// TestGetCategories_PgSuccess ensures that every category can be retrieved.
+func TestGetCategories_PgSuccess(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectQuery("SELECT id, name, parent_id FROM category ORDER BY").
+		WillReturnRows(newCategoryRows().AddRow("gadgets", "Gadgets", nil).AddRow("weapons", "Weapons", "gadgets"))
+	categories, err := repo.GetCategories(context.Background())
+
+	ok(t, err)
+	equals(t, 2, len(categories))
+	equals(t, "gadgets", *categories[1].ParentId)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestGetCategory_PgSuccessWithNoResult ensures that attempting to retrieve a category that does not exist will return
+// nil.
+func TestGetCategory_PgSuccessWithNoResult(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectQuery("SELECT id, name, parent_id FROM category WHERE id=\\$1").
+		WithArgs("unknown").
+		WillReturnRows(newCategoryRows())
+	category, err := repo.GetCategory(context.Background(), "unknown")
+
+	ok(t, err)
+	assert(t, category == nil, "expected category to be nil")
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestSearchProducts_PgSuccessFilterCategory ensures that a category filter including subcategories is translated into
+// a recursive condition.
+func TestSearchProducts_PgSuccessFilterCategory(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	filter := common.ProductFilter{CategoryIds: []string{"gadgets"}, IncludeSubcategories: true}
+	mock.ExpectQuery("SELECT .* FROM product WHERE textsearchable_index_col @@ to_tsquery\\(\\$2\\) AND id IN "+
+		"\\(SELECT product_id FROM product_category WHERE category_id IN \\(\\s*WITH RECURSIVE .*\\$3").
+		WithArgs(5, "portal", sqlmock.AnyArg()).
+		WillReturnRows(addExpectedProductId1Row(newSearchRows(), 0.6, nil, nil))
+	products, err := repo.SearchProducts(context.Background(), "portal", 5, "",
+		common.OrderBy{}, filter, common.SearchOptions{})
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, []string{"gadgets"}, products.Products[0].CategoryIds)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestCreateProduct_PgSuccessWithVariants ensures that a product can be created along with its variants.
+func TestCreateProduct_PgSuccessWithVariants(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	product := makeTestPgProduct()
+	product.Variants = []common.Variant{{Sku: "1-BLUE", Options: map[string]string{"color": "blue"}, QtyInStock: 2}}
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO product").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM product_category WHERE product_id=\\$1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO product_category").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM product_variant WHERE product_id=\\$1").
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO product_variant").
+		WithArgs("1-BLUE", "1", `{"color":"blue"}`, nil, 2, sqlmock.AnyArg(), "{}").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM product_price WHERE product_id=\\$1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT .* FROM product WHERE id=\\$1").
+		WithArgs("1").
+		WillReturnRows(newProductRows().AddRow("1", "Portal Gun", nil, nil, nil, nil, "2499.990000", 1,
+			time.Now(), time.Now(), "{gadgets}",
+			`[{"sku": "1-BLUE", "productId": "1", "options": {"color": "blue"}, "price": null, "qtyInStock": 2, `+
+				`"images": [], "prices": {}}]`, "{}"))
+	created, err := repo.CreateProduct(context.Background(), product)
+
+	ok(t, err)
+	equals(t, 1, len(created.Variants))
+	equals(t, "1-BLUE", created.Variants[0].Sku)
+	equals(t, "1", created.Variants[0].ProductId)
+	equals(t, "blue", created.Variants[0].Options["color"])
+	assert(t, created.Variants[0].Price == nil, "expected variant price to be nil")
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestCreateProduct_PgFailVariantExists ensures that a product can not be created with a variant SKU that is already
+// in use.
+func TestCreateProduct_PgFailVariantExists(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	product := makeTestPgProduct()
+	product.Variants = []common.Variant{{Sku: "13-S"}}
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO product").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM product_category WHERE product_id=\\$1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO product_category").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM product_variant WHERE product_id=\\$1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO product_variant").
+		WillReturnError(&pq.Error{Code: "23505"})
+	mock.ExpectRollback()
+	_, err = repo.CreateProduct(context.Background(), product)
+
+	equals(t, repository.ErrVariantExists, err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+func newVariantRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"sku", "product_id", "options", "price", "qty_in_stock", "images", "prices"})
+}
+
+// TestGetVariant_PgSuccessWithResult ensures that a variant can be retrieved by SKU.
+func TestGetVariant_PgSuccessWithResult(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectQuery("SELECT sku, product_id, options, price, qty_in_stock, images, prices FROM product_variant").
+		WithArgs("13-L").
+		WillReturnRows(newVariantRows().AddRow("13-L", "13", `{"size": "L"}`, "139.990000", 2, "{a.jpg}",
+			`{"EUR": 127.99}`))
+	variant, err := repo.GetVariant(context.Background(), "13-L")
+
+	ok(t, err)
+	assert(t, variant != nil, "Expected variant to not be nil")
+	equals(t, "13", variant.ProductId)
+	equals(t, "L", variant.Options["size"])
+	equals(t, "139.99", variant.Price.String())
+	equals(t, []string{"a.jpg"}, variant.Images)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestGetVariant_PgSuccessWithNoResult ensures that attempting to retrieve a variant that does not exist will return
+// nil.
+func TestGetVariant_PgSuccessWithNoResult(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectQuery("SELECT sku, product_id, options, price, qty_in_stock, images, prices FROM product_variant").
+		WithArgs("unknown").
+		WillReturnRows(newVariantRows())
+	variant, err := repo.GetVariant(context.Background(), "unknown")
+
+	ok(t, err)
+	assert(t, variant == nil, "expected variant to be nil")
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestReserveProduct_PgSuccess ensures that reserving units of a product conditionally decrements its stock and
+// records the reservation.
+func TestReserveProduct_PgSuccess(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE product SET qty_in_stock=qty_in_stock - \\$2 WHERE id=\\$1 AND qty_in_stock >= \\$2").
+		WithArgs("2", 10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO product_reservation").
+		WithArgs(sqlmock.AnyArg(), "2", 10, common.ReservationPending, sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	reservation, err := repo.ReserveProduct(context.Background(), "2", 10, time.Minute)
+
+	ok(t, err)
+	equals(t, common.ReservationPending, reservation.Status)
+	equals(t, 10, reservation.Quantity)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestReserveProduct_PgFailInsufficientStock ensures that more units than are in stock can not be reserved.
+func TestReserveProduct_PgFailInsufficientStock(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE product SET qty_in_stock=qty_in_stock - \\$2").
+		WithArgs("1", 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+	_, err = repo.ReserveProduct(context.Background(), "1", 2, time.Minute)
+
+	equals(t, repository.ErrInsufficientStock, err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestReserveProduct_PgFailNotFound ensures that a product that does not exist can not be reserved.
+func TestReserveProduct_PgFailNotFound(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE product SET qty_in_stock=qty_in_stock - \\$2").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectRollback()
+	_, err = repo.ReserveProduct(context.Background(), "unknown", 1, time.Minute)
+
+	equals(t, repository.ErrProductNotFound, err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+func newReservationRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "product_id", "quantity", "status", "expires_at", "created_at",
+		"updated_at"})
+}
+
+// TestCommitReservation_PgSuccess ensures that committing a reservation locks it and keeps its units out of stock.
+func TestCommitReservation_PgSuccess(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	now := time.Now().UTC()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .* FROM product_reservation WHERE id=\\$1 AND product_id=\\$2 FOR UPDATE").
+		WithArgs("r1", "2").
+		WillReturnRows(newReservationRows().AddRow("r1", "2", 10, "pending", now.Add(time.Minute), now, now))
+	mock.ExpectExec("UPDATE product_reservation SET status=\\$2").
+		WithArgs("r1", common.ReservationCommitted, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	reservation, err := repo.CommitReservation(context.Background(), "2", "r1")
+
+	ok(t, err)
+	equals(t, common.ReservationCommitted, reservation.Status)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestReleaseReservation_PgSuccess ensures that releasing a reservation returns its units to stock.
+func TestReleaseReservation_PgSuccess(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	now := time.Now().UTC()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .* FROM product_reservation WHERE id=\\$1 AND product_id=\\$2 FOR UPDATE").
+		WithArgs("r1", "2").
+		WillReturnRows(newReservationRows().AddRow("r1", "2", 10, "pending", now.Add(time.Minute), now, now))
+	mock.ExpectExec("UPDATE product_reservation SET status=\\$2").
+		WithArgs("r1", common.ReservationReleased, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE product SET qty_in_stock=qty_in_stock \\+ \\$2 WHERE id=\\$1").
+		WithArgs("2", 10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	reservation, err := repo.ReleaseReservation(context.Background(), "2", "r1")
+
+	ok(t, err)
+	equals(t, common.ReservationReleased, reservation.Status)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestCommitReservation_PgFailExpired ensures that a reservation found pending past its expiry is expired rather than
+// committed.
+func TestCommitReservation_PgFailExpired(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	now := time.Now().UTC()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .* FROM product_reservation").
+		WillReturnRows(newReservationRows().AddRow("r1", "2", 10, "pending", now.Add(-time.Minute), now, now))
+	mock.ExpectExec("UPDATE product_reservation SET status=\\$2").
+		WithArgs("r1", common.ReservationExpired, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE product SET qty_in_stock=qty_in_stock \\+ \\$2").
+		WithArgs("2", 10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	_, err = repo.CommitReservation(context.Background(), "2", "r1")
+
+	equals(t, repository.ErrReservationNotActive, err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestCommitReservation_PgFailNotFound ensures that committing a reservation that does not exist fails.
+func TestCommitReservation_PgFailNotFound(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .* FROM product_reservation").
+		WillReturnRows(newReservationRows())
+	mock.ExpectRollback()
+	_, err = repo.CommitReservation(context.Background(), "2", "unknown")
+
+	equals(t, repository.ErrReservationNotFound, err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestExpireReservations_PgSuccess ensures that expired reservations are released in a single statement.
+func TestExpireReservations_PgSuccess(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	mock.ExpectQuery("WITH expired AS \\(\\s*UPDATE product_reservation SET status='expired'").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	expired, err := repo.ExpireReservations(context.Background())
+
+	ok(t, err)
+	equals(t, 3, expired)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestGetProducts_PgSuccessOrderByPriceInCurrency ensures that products are filtered and sorted by their price list
+// entry when a currency other than the default is requested.
+func TestGetProducts_PgSuccessOrderByPriceInCurrency(t *testing.T) {
+	db, mock, repo, err := makeAndTestPgSmallRepo()
+	defer db.Close()
+	ok(t, err)
+
+	orderBy := common.OrderBy{}
+	orderBy.Add(common.OrderByPrice)
+	minPrice := decimal.NewFromFloat(3000)
+	filter := common.ProductFilter{Currency: common.CurrencyEUR, MinPrice: &minPrice}
+	eurPrice := "\\(SELECT price FROM product_price WHERE product_id=product.id AND currency='EUR'\\)"
+
+	mock.ExpectQuery("SELECT .* FROM product WHERE "+eurPrice+" IS NOT NULL AND "+eurPrice+" >= \\$2 "+
+		"ORDER BY "+eurPrice+", id LIMIT").
+		WithArgs(5, "3000").
+		WillReturnRows(addExpectedProductId1Row(newProductRows()))
+	products, err := repo.GetProducts(context.Background(), 5, "", orderBy, filter)
+
+	ok(t, err)
+	equals(t, 1, len(products.Products))
+	equals(t, "2299.99", products.Products[0].Prices[common.CurrencyEUR].String())
+	ok(t, mock.ExpectationsWereMet())
+
+	mock.ExpectQuery("SELECT .* FROM product WHERE "+eurPrice+" IS NOT NULL AND "+eurPrice+" >= \\$2 "+
+		"AND \\("+eurPrice+", id\\) > \\(\\$3, \\$4\\) ORDER BY").
+		WithArgs(5, "3000", "2299.99", "1").
+		WillReturnRows(newProductRows())
+	products, err = repo.GetProducts(context.Background(), 5, products.Cursor, orderBy, filter)
+
+	ok(t, err)
+	equals(t, 0, len(products.Products))
+	ok(t, mock.ExpectationsWereMet())
+}
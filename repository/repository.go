@@ -4,22 +4,80 @@ import (
 	"context"
 	"database/sql"
 	"github.com/stone1549/product-service/common"
+	"time"
 )
 
-// ProductList holds a slice of products and a cursor that can be used to retrieve more results
+// ProductList holds a slice of products and a cursor that can be used to retrieve more results, along with a cursor
+// pointing after each of the products, in the same order. Search results also hold a hit for each product, in the same
+// order, along with any facets requested. First pages of searches without any matches may suggest corrected search
+// text in DidYouMean.
 type ProductList struct {
-	Products []common.Product
-	Cursor   string
+	Products   []common.Product
+	Cursor     string
+	Cursors    []string
+	Hits       []common.SearchHit
+	Facets     []common.Facet
+	DidYouMean string
 }
 
-// ProductRepository represents a data source through which products can be retrieved.
+// ProductRepository represents a data source through which products can be retrieved. Products retrieved with a context
+// carrying a selection of fields, see common.WithProductFields, may be missing the fields not selected.
 type ProductRepository interface {
-	// GetProducts retrieves a list of the first X products starting from the given cursor.
-	GetProducts(ctx context.Context, first int, cursor string, orderBy common.OrderBy) (ProductList, error)
+	// GetProducts retrieves a list of the first X products matching the given filter starting from the given cursor.
+	GetProducts(ctx context.Context, first int, cursor string, orderBy common.OrderBy,
+		filter common.ProductFilter) (ProductList, error)
 	// GetProduct retrieves a product from the given id.
 	GetProduct(ctx context.Context, id string) (*common.Product, error)
-	// SearchProducts retrieves the first X matches starting from the given cursor.
-	SearchProducts(ctx context.Context, searchTxt string, first int, cursor string) (ProductList, error)
+	// GetProductsByIds retrieves the products with the given ids, in the order of their ids. Ids without a product are
+	// skipped and products requested more than once are retrieved once.
+	GetProductsByIds(ctx context.Context, ids []string) ([]common.Product, error)
+	// SearchProducts retrieves the first X matches satisfying the given filter starting from the given cursor, most
+	// relevant first unless otherwise ordered, along with the facets requested by the given options counted across
+	// every match. Relevance cursors hold the score of the last match, which writes can change, so pages of relevance
+	// ordered results are only consistent while the products are left unchanged.
+	SearchProducts(ctx context.Context, searchTxt string, first int, cursor string, orderBy common.OrderBy,
+		filter common.ProductFilter, options common.SearchOptions) (ProductList, error)
+	// SuggestProducts retrieves up to first product names, and category names when includeCategories is true, with a
+	// word starting with each word of the given prefix.
+	SuggestProducts(ctx context.Context, prefix string, first int, includeCategories bool) (common.Suggestions,
+		error)
+	// CreateProduct stores a new product and returns it as stored.
+	CreateProduct(ctx context.Context, product common.Product) (*common.Product, error)
+	// UpdateProduct replaces the product sharing the given product's id and returns it as stored.
+	UpdateProduct(ctx context.Context, product common.Product) (*common.Product, error)
+	// DeleteProduct removes the product with the given id.
+	DeleteProduct(ctx context.Context, id string) error
+	// GetCategories retrieves every category.
+	GetCategories(ctx context.Context) ([]common.Category, error)
+	// GetCategory retrieves a category from the given id.
+	GetCategory(ctx context.Context, id string) (*common.Category, error)
+	// GetVariant retrieves a product variant from the given SKU.
+	GetVariant(ctx context.Context, sku string) (*common.Variant, error)
+	// ReserveProduct holds the given quantity of a product out of stock until the reservation is committed, released
+	// or the given ttl elapses.
+	ReserveProduct(ctx context.Context, productId string, quantity int, ttl time.Duration) (*common.Reservation,
+		error)
+	// CommitReservation permanently removes the units held by an active reservation from stock.
+	CommitReservation(ctx context.Context, productId, reservationId string) (*common.Reservation, error)
+	// ReleaseReservation returns the units held by an active reservation to stock.
+	ReleaseReservation(ctx context.Context, productId, reservationId string) (*common.Reservation, error)
+	// ExpireReservations returns the units held by every pending reservation past its expiry to stock, returning the
+	// number of reservations expired.
+	ExpireReservations(ctx context.Context) (int, error)
+}
+
+// productsInIdOrder lists the given products found by id in the order of the given ids, skipping ids without a product
+// and listing each product once.
+func productsInIdOrder(ids []string, found map[string]common.Product) []common.Product {
+	result := make([]common.Product, 0, len(found))
+	for _, id := range ids {
+		if product, ok := found[id]; ok {
+			result = append(result, product)
+			delete(found, id)
+		}
+	}
+
+	return result
 }
 
 // NewProductRepository constructs a ProductRepository from the given configuration.
@@ -37,9 +95,15 @@ func NewProductRepository(config common.Configuration) (ProductRepository, error
 			return nil, err
 		}
 		repo, err = MakePostgresqlProductRespository(config, db)
+	case common.EmbeddedRepo:
+		repo, err = MakeEmbeddedRepository(config)
 	default:
 		err = newErrRepository("repository type unimplemented")
 	}
 
+	if err == nil && config.GetCacheSize() > 0 {
+		repo = MakeCachingRepository(repo, config.GetCacheSize(), config.GetCacheTtl())
+	}
+
 	return repo, err
 }
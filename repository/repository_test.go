@@ -1,6 +1,7 @@
 package repository_test
 
 import (
+	"context"
 	"fmt"
 	"github.com/stone1549/product-service/common"
 	"github.com/stone1549/product-service/repository"
@@ -47,6 +48,28 @@ func equals(tb testing.TB, exp, act interface{}) {
 	}
 }
 
+// searchIds pages through every match of the given search text, first at a time, and returns the ids of the matches.
+func searchIds(tb testing.TB, repo repository.ProductRepository, searchTxt string, first int,
+	options common.SearchOptions) []string {
+	var ids []string
+	cursor := ""
+	for {
+		products, err := repo.SearchProducts(context.Background(), searchTxt, first, cursor, common.OrderBy{},
+			common.ProductFilter{}, options)
+		ok(tb, err)
+
+		for _, product := range products.Products {
+			ids = append(ids, product.Id)
+		}
+
+		if len(products.Products) < first {
+			return ids
+		}
+
+		cursor = products.Cursor
+	}
+}
+
 type configuration int
 
 const (
@@ -83,6 +106,10 @@ func (c configuration) GetPort() int {
 	return 3333
 }
 
+func (c configuration) GetGrpcPort() int {
+	return 0
+}
+
 func (c configuration) GetInitDataSet() string {
 	switch c {
 	case inMemoryEmpty:
@@ -113,6 +140,34 @@ func (c configuration) GetPgUrl() string {
 	}
 }
 
+func (c configuration) GetAutoMigrate() bool {
+	return false
+}
+
+func (c configuration) GetDataDir() string {
+	return ""
+}
+
+func (c configuration) GetCursorSecret() []byte {
+	return []byte("test cursor secret")
+}
+
+func (c configuration) GetReservationSweepInterval() time.Duration {
+	return 30 * time.Second
+}
+
+func (c configuration) GetSuggestTimeout() time.Duration {
+	return 250 * time.Millisecond
+}
+
+func (c configuration) GetCacheSize() int {
+	return 0
+}
+
+func (c configuration) GetCacheTtl() time.Duration {
+	return 30 * time.Second
+}
+
 // TestNewProductRepository_ImSuccessEmpty ensures an empty in memory repo can be constructed
 func TestNewProductRepository_ImSuccessEmpty(t *testing.T) {
 	_, err := repository.NewProductRepository(inMemoryEmpty)
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"time"
+)
+
+func newReservationId() (string, error) {
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// SweepExpiredReservations expires reservations left pending past their expiry at the given interval until the given
+// context is done.
+func SweepExpiredReservations(ctx context.Context, repo ProductRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := repo.ExpireReservations(ctx)
+
+			if err != nil {
+				log.Printf("Unable to expire reservations: %s", err.Error())
+			} else if expired > 0 {
+				log.Printf("Expired %d reservations", expired)
+			}
+		}
+	}
+}
@@ -0,0 +1,410 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blevesearch/bleve"
+	"github.com/stone1549/product-service/common"
+)
+
+// searchableProducts are the products and categories of a repository that are searched through a bleve index.
+type searchableProducts interface {
+	// productCount returns the number of products.
+	productCount() (int, error)
+	// productById retrieves the product with the given id, nil if there is none.
+	productById(id string) (*common.Product, error)
+	// allCategories retrieves every category.
+	allCategories() ([]common.Category, error)
+}
+
+// searchMatch is a product matching a search along with its hit.
+type searchMatch struct {
+	product common.Product
+	hit     common.SearchHit
+}
+
+// compareSearchMatches compares a and b like compareProducts, ordering by relevance from highest to lowest score.
+func compareSearchMatches(order []common.OrderByKey, currency common.Currency, a, b *searchMatch) int {
+	for _, key := range order {
+		value := compareByKey(key, currency, &a.product, &b.product)
+		if key == common.OrderByRelevance && a.hit.Score != b.hit.Score {
+			value = 1
+			if a.hit.Score > b.hit.Score {
+				value = -1
+			}
+		}
+
+		if value != 0 {
+			return value
+		}
+	}
+
+	// every key compares equal, leaving the id tiebreaker
+	return compareProducts(order, currency, &a.product, &b.product)
+}
+
+// searchMatchFromSortValues constructs a match holding the given sort values, as returned by searchSortValues, so that
+// it can be compared against other matches.
+func searchMatchFromSortValues(order []common.OrderByKey, currency common.Currency, values []*string) (searchMatch,
+	error) {
+	var match searchMatch
+	product, err := productFromSortValues(order, currency, values)
+
+	if err != nil {
+		return match, err
+	}
+
+	match.product = product
+	for i, key := range order {
+		if key != common.OrderByRelevance || values[i] == nil {
+			continue
+		}
+
+		match.hit.Score, err = strconv.ParseFloat(*values[i], 64)
+
+		if err != nil {
+			return match, ErrInvalidCursor
+		}
+	}
+
+	return match, nil
+}
+
+// searchIndex retrieves the first X of the given products matching a search of the given index satisfying the given
+// filter, starting from the given cursor, most relevant first unless otherwise ordered, along with the facets requested
+// by the given options counted across every match. The filter is applied by the index, which scores matches
+// deterministically so that they can be paged through by score. Scores depend on every indexed product, so writes
+// between pages may move matches across the cursor and relevance ordered pages may skip or repeat them. Hits are looked
+// up in the given products and checked against the filter again, as the index may have been updated since they were
+// read, and hits without a product or whose product no longer satisfies the filter are skipped.
+func searchIndex(idx bleve.Index, cursors cursorCodec, products searchableProducts, searchTxt string, first int,
+	cursor string, orderBy common.OrderBy, filter common.ProductFilter, options common.SearchOptions) (ProductList,
+	error) {
+	parsed := common.ParseSearchQuery(searchTxt)
+
+	if parsed.Empty() {
+		return ProductList{}, ErrInvalidSearch
+	}
+
+	categories, err := products.allCategories()
+
+	if err != nil {
+		return ProductList{}, err
+	}
+
+	order := orderBy.SearchOrder()
+	currency := filter.PriceCurrency()
+	var last *searchMatch
+	if cursor != "" {
+		values, err := cursors.decode(order, currency, cursor)
+
+		if err != nil {
+			return ProductList{}, err
+		}
+
+		match, err := searchMatchFromSortValues(order, currency, values)
+
+		if err != nil {
+			return ProductList{}, err
+		}
+
+		last = &match
+	}
+
+	categoryIds := expandCategoryIds(categories, filter.CategoryIds, filter.IncludeSubcategories)
+	searchQuery := bleveQuery(parsed, options.Fuzzy)
+	searchQuery.AddMust(bleveFilterQueries(filter, categoryIds)...)
+	search := bleve.NewSearchRequest(searchQuery)
+	if options.Highlight {
+		search.Highlight = bleve.NewHighlightWithStyle("html")
+		search.Highlight.AddField(common.HighlightName)
+		search.Highlight.AddField(common.HighlightDescription)
+	}
+
+	var page []searchMatch
+	var facets []common.Facet
+	if len(order) == 1 && order[0] == common.OrderByRelevance && !options.Facets.Requested() {
+		page, err = searchIndexPage(idx, search, products, filter, categoryIds, options.Highlight, last, first)
+	} else {
+		var matches []searchMatch
+		matches, err = searchIndexMatches(idx, search, products, filter, categoryIds, options.Highlight)
+		sort.SliceStable(matches, func(i, j int) bool {
+			return compareSearchMatches(order, currency, &matches[i], &matches[j]) < 0
+		})
+
+		start := 0
+		if last != nil {
+			start = sort.Search(len(matches), func(i int) bool {
+				return compareSearchMatches(order, currency, &matches[i], last) > 0
+			})
+		}
+
+		end := start + first
+		if end > len(matches) {
+			end = len(matches)
+		}
+
+		page = matches[start:end]
+		if options.Facets.Requested() {
+			matchedProducts := make([]common.Product, len(matches))
+			for i, match := range matches {
+				matchedProducts[i] = match.product
+			}
+
+			facets = computeFacets(options.Facets, currency, matchedProducts)
+		}
+	}
+
+	if err != nil {
+		return ProductList{}, err
+	}
+
+	result := ProductList{Products: make([]common.Product, 0, len(page)), Cursor: cursor,
+		Cursors: make([]string, 0, len(page)), Hits: make([]common.SearchHit, 0, len(page)), Facets: facets}
+	for _, match := range page {
+		score := strconv.FormatFloat(match.hit.Score, 'g', -1, 64)
+		result.Cursor, err = cursors.encodeValues(order, currency,
+			searchSortValues(order, currency, match.product, score))
+
+		if err != nil {
+			return result, err
+		}
+
+		result.Products = append(result.Products, match.product)
+		result.Cursors = append(result.Cursors, result.Cursor)
+		result.Hits = append(result.Hits, match.hit)
+	}
+
+	if suggestsCorrection(result, cursor) {
+		candidates, err := fuzzyCandidates(idx, fuzzyWords(parsed))
+
+		if err != nil {
+			return result, err
+		}
+
+		result.DidYouMean = didYouMean(searchTxt, parsed, candidates)
+	}
+
+	return result, nil
+}
+
+// searchIndexMatches retrieves every product matching the given search request that still satisfies the given filter,
+// in no particular order.
+func searchIndexMatches(idx bleve.Index, search *bleve.SearchRequest, products searchableProducts,
+	filter common.ProductFilter, categoryIds map[string]bool, highlight bool) ([]searchMatch, error) {
+	var err error
+	search.Size, err = products.productCount()
+
+	if err != nil {
+		return nil, err
+	}
+
+	searchResults, err := idx.Search(search)
+
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]searchMatch, 0, len(searchResults.Hits))
+	for _, hit := range searchResults.Hits {
+		product, err := products.productById(hit.ID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if product != nil && matchesFilter(filter, categoryIds, *product) {
+			matches = append(matches, searchMatch{*product, newSearchHit(hit, highlight)})
+		}
+	}
+
+	return matches, nil
+}
+
+// searchIndexPage retrieves the first X products matching the given search request that still satisfy the given
+// filter after the given last match, if any, most relevant first. The index sorts hits like compareSearchMatches and
+// is read a window at a time, each twice as large as the last, so that hits past the page are not loaded.
+func searchIndexPage(idx bleve.Index, search *bleve.SearchRequest, products searchableProducts,
+	filter common.ProductFilter, categoryIds map[string]bool, highlight bool, last *searchMatch,
+	first int) ([]searchMatch, error) {
+	order := []common.OrderByKey{common.OrderByRelevance}
+	// relevance is descending, so ties are broken by descending id
+	search.SortBy([]string{"-_score", "-_id"})
+	search.From, search.Size = 0, first+1
+	page := make([]searchMatch, 0, first)
+	for {
+		searchResults, err := idx.Search(search)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hit := range searchResults.Hits {
+			match := searchMatch{product: common.Product{Id: hit.ID}, hit: newSearchHit(hit, highlight)}
+			if last != nil && compareSearchMatches(order, "", &match, last) <= 0 {
+				continue
+			}
+
+			product, err := products.productById(hit.ID)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if product == nil || !matchesFilter(filter, categoryIds, *product) {
+				continue
+			}
+
+			if len(page) == first {
+				return page, nil
+			}
+
+			match.product = *product
+			page = append(page, match)
+		}
+
+		if len(searchResults.Hits) < search.Size {
+			return page, nil
+		}
+
+		search.From += search.Size
+		search.Size *= 2
+	}
+}
+
+// suggestFromIndex retrieves up to first of the given products, found in the given index, and of their categories when
+// includeCategories is true, with a word of their name starting with each word of the given prefix.
+func suggestFromIndex(ctx context.Context, idx bleve.Index, products searchableProducts, prefix string, first int,
+	includeCategories bool) (common.Suggestions, error) {
+	var result common.Suggestions
+	words := common.SplitSearchWords(prefix)
+
+	if len(words) == 0 {
+		return result, ErrInvalidSearch
+	}
+
+	prefixes := bleve.NewConjunctionQuery()
+	for _, word := range words {
+		wordPrefix := bleve.NewPrefixQuery(word)
+		wordPrefix.SetField(nameWordsField)
+		prefixes.AddQuery(wordPrefix)
+	}
+
+	search := bleve.NewSearchRequest(prefixes)
+	search.Size = first
+	searchResults, err := idx.SearchInContext(ctx, search)
+
+	if err != nil {
+		return result, err
+	}
+
+	result.Products = make([]common.Suggestion, 0, len(searchResults.Hits))
+	for _, hit := range searchResults.Hits {
+		product, err := products.productById(hit.ID)
+
+		if err != nil {
+			return result, err
+		}
+
+		if product != nil {
+			result.Products = append(result.Products, common.Suggestion{Id: product.Id, Text: product.Name,
+				Score: hit.Score})
+		}
+	}
+
+	if includeCategories {
+		categories, err := products.allCategories()
+
+		if err != nil {
+			return result, err
+		}
+
+		result.Categories = suggestCategories(categories, words, first)
+	}
+
+	return result, nil
+}
+
+// suggestCategories retrieves up to first of the given categories with a word starting with each of the given words.
+// Categories are scored by the share of the words of their name that were typed, so closer matches rank first.
+func suggestCategories(categories []common.Category, words []string, first int) []common.Suggestion {
+	result := make([]common.Suggestion, 0)
+	for _, category := range categories {
+		nameWords := common.SplitSearchWords(category.Name)
+		matched := true
+		for _, word := range words {
+			found := false
+			for _, nameWord := range nameWords {
+				found = found || strings.HasPrefix(nameWord, word)
+			}
+
+			matched = matched && found
+		}
+
+		if matched {
+			result = append(result, common.Suggestion{Id: category.Id, Text: category.Name,
+				Score: float64(len(words)) / float64(len(nameWords))})
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score > result[j].Score
+		}
+
+		return result[i].Text < result[j].Text
+	})
+
+	if len(result) > first {
+		result = result[:first]
+	}
+
+	return result
+}
+
+// fuzzyCandidates returns, for each of the given words, the words of the names and descriptions of the products in the
+// given index within its fuzziness. Words are read from the dictionary of the index, which is kept up to date as
+// products are indexed, rather than from the products themselves.
+func fuzzyCandidates(idx bleve.Index, words []string) (map[string][]vocabularyWord, error) {
+	result := make(map[string][]vocabularyWord)
+
+	if len(words) == 0 {
+		return result, nil
+	}
+
+	dict, err := idx.FieldDict(wordsField)
+
+	if err != nil {
+		return result, err
+	}
+
+	defer dict.Close()
+
+	for {
+		entry, err := dict.Next()
+
+		if err != nil {
+			return result, err
+		}
+
+		if entry == nil {
+			break
+		}
+
+		// words of deleted products may remain in the dictionary until it is compacted
+		if entry.Count == 0 {
+			continue
+		}
+
+		for _, word := range words {
+			if common.EditDistance(word, entry.Term) <= common.Fuzziness(word) {
+				result[word] = append(result[word], vocabularyWord{entry.Term, int(entry.Count)})
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/stone1549/product-service/common"
+)
+
+// sortedIndex holds the ids of products sorted by an order, with prices in a currency, so that pages of products can
+// be retrieved without sorting every product. Indexes are never modified once built, changes are made to copies.
+type sortedIndex struct {
+	order    []common.OrderByKey
+	currency common.Currency
+	ids      []string
+}
+
+// indexCurrency returns the currency products are compared in when sorted by the given order, the default currency
+// unless the order compares prices, so that orders that do not compare prices share an index across currencies.
+func indexCurrency(order []common.OrderByKey, currency common.Currency) common.Currency {
+	for _, key := range order {
+		if key == common.OrderByPrice || key == common.OrderByPriceDesc {
+			return currency
+		}
+	}
+
+	return common.DefaultCurrency
+}
+
+// sortedIndexKey returns the key identifying the index sorted by the given order with prices in the given currency.
+func sortedIndexKey(order []common.OrderByKey, currency common.Currency) string {
+	keys := make([]string, len(order))
+	for i, key := range order {
+		keys[i] = string(key)
+	}
+
+	return strings.Join(keys, ",") + "@" + string(currency)
+}
+
+// sortProducts sorts the given products by the given order with prices in the given currency and returns their ids.
+func sortProducts(order []common.OrderByKey, currency common.Currency, products []common.Product) []string {
+	sort.Sort(&orderBySort{products, order, currency})
+
+	ids := make([]string, len(products))
+	for i, product := range products {
+		ids[i] = product.Id
+	}
+
+	return ids
+}
+
+// newSortedIndex builds an index of the given products sorted by the given order with prices in the given currency.
+func newSortedIndex(order []common.OrderByKey, currency common.Currency,
+	products map[string]common.Product) *sortedIndex {
+	sorted := make([]common.Product, 0, len(products))
+	for _, product := range products {
+		sorted = append(sorted, product)
+	}
+
+	return &sortedIndex{order: order, currency: currency, ids: sortProducts(order, currency, sorted)}
+}
+
+// position returns the position of the given product in the index, or where it would be inserted if it is not
+// indexed, looking up the indexed products by id in the given products.
+func (si *sortedIndex) position(products map[string]common.Product, product common.Product) int {
+	return sort.Search(len(si.ids), func(i int) bool {
+		other := products[si.ids[i]]
+		return compareProducts(si.order, si.currency, &other, &product) >= 0
+	})
+}
+
+// inserted returns a copy of the index with the given product, which must not be indexed, added to it.
+func (si *sortedIndex) inserted(products map[string]common.Product, product common.Product) *sortedIndex {
+	i := si.position(products, product)
+	ids := make([]string, len(si.ids)+1)
+	copy(ids, si.ids[:i])
+	ids[i] = product.Id
+	copy(ids[i+1:], si.ids[i:])
+
+	return &sortedIndex{order: si.order, currency: si.currency, ids: ids}
+}
+
+// removed returns a copy of the index without the given product. The given products must hold the product as it was
+// indexed.
+func (si *sortedIndex) removed(products map[string]common.Product, product common.Product) *sortedIndex {
+	i := si.position(products, product)
+
+	if i >= len(si.ids) || si.ids[i] != product.Id {
+		return si
+	}
+
+	ids := make([]string, 0, len(si.ids)-1)
+	ids = append(ids, si.ids[:i]...)
+	ids = append(ids, si.ids[i+1:]...)
+
+	return &sortedIndex{order: si.order, currency: si.currency, ids: ids}
+}
@@ -0,0 +1,4 @@
+package rpc
+
+// StatusError exposes statusError to the tests of the package.
+var StatusError = statusError
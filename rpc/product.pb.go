@@ -0,0 +1,1042 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: product.proto
+
+package rpc
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	timestamp "github.com/golang/protobuf/ptypes/timestamp"
+	wrappers "github.com/golang/protobuf/ptypes/wrappers"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type GetProductRequest struct {
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// currency prices are given in, defaults to USD.
+	Currency             string   `protobuf:"bytes,2,opt,name=currency,proto3" json:"currency,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetProductRequest) Reset()         { *m = GetProductRequest{} }
+func (m *GetProductRequest) String() string { return proto.CompactTextString(m) }
+func (*GetProductRequest) ProtoMessage()    {}
+func (*GetProductRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f0fd8b59378f44a5, []int{0}
+}
+
+func (m *GetProductRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetProductRequest.Unmarshal(m, b)
+}
+func (m *GetProductRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetProductRequest.Marshal(b, m, deterministic)
+}
+func (m *GetProductRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetProductRequest.Merge(m, src)
+}
+func (m *GetProductRequest) XXX_Size() int {
+	return xxx_messageInfo_GetProductRequest.Size(m)
+}
+func (m *GetProductRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetProductRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetProductRequest proto.InternalMessageInfo
+
+func (m *GetProductRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *GetProductRequest) GetCurrency() string {
+	if m != nil {
+		return m.Currency
+	}
+	return ""
+}
+
+// ProductFilter holds criteria products must satisfy, unset criteria are ignored.
+type ProductFilter struct {
+	// currency prices are given and filtered in, defaults to USD.
+	Currency string `protobuf:"bytes,1,opt,name=currency,proto3" json:"currency,omitempty"`
+	// min_price and max_price are decimal numbers.
+	MinPrice     string               `protobuf:"bytes,2,opt,name=min_price,json=minPrice,proto3" json:"min_price,omitempty"`
+	MaxPrice     string               `protobuf:"bytes,3,opt,name=max_price,json=maxPrice,proto3" json:"max_price,omitempty"`
+	InStock      *wrappers.BoolValue  `protobuf:"bytes,4,opt,name=in_stock,json=inStock,proto3" json:"in_stock,omitempty"`
+	CreatedAfter *timestamp.Timestamp `protobuf:"bytes,5,opt,name=created_after,json=createdAfter,proto3" json:"created_after,omitempty"`
+	UpdatedSince *timestamp.Timestamp `protobuf:"bytes,6,opt,name=updated_since,json=updatedSince,proto3" json:"updated_since,omitempty"`
+	Ids          []string             `protobuf:"bytes,7,rep,name=ids,proto3" json:"ids,omitempty"`
+	CategoryIds  []string             `protobuf:"bytes,8,rep,name=category_ids,json=categoryIds,proto3" json:"category_ids,omitempty"`
+	// include_subcategories extends category_ids to their descendants, defaults to true.
+	IncludeSubcategories *wrappers.BoolValue `protobuf:"bytes,9,opt,name=include_subcategories,json=includeSubcategories,proto3" json:"include_subcategories,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}            `json:"-"`
+	XXX_unrecognized     []byte              `json:"-"`
+	XXX_sizecache        int32               `json:"-"`
+}
+
+func (m *ProductFilter) Reset()         { *m = ProductFilter{} }
+func (m *ProductFilter) String() string { return proto.CompactTextString(m) }
+func (*ProductFilter) ProtoMessage()    {}
+func (*ProductFilter) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f0fd8b59378f44a5, []int{1}
+}
+
+func (m *ProductFilter) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ProductFilter.Unmarshal(m, b)
+}
+func (m *ProductFilter) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ProductFilter.Marshal(b, m, deterministic)
+}
+func (m *ProductFilter) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ProductFilter.Merge(m, src)
+}
+func (m *ProductFilter) XXX_Size() int {
+	return xxx_messageInfo_ProductFilter.Size(m)
+}
+func (m *ProductFilter) XXX_DiscardUnknown() {
+	xxx_messageInfo_ProductFilter.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ProductFilter proto.InternalMessageInfo
+
+func (m *ProductFilter) GetCurrency() string {
+	if m != nil {
+		return m.Currency
+	}
+	return ""
+}
+
+func (m *ProductFilter) GetMinPrice() string {
+	if m != nil {
+		return m.MinPrice
+	}
+	return ""
+}
+
+func (m *ProductFilter) GetMaxPrice() string {
+	if m != nil {
+		return m.MaxPrice
+	}
+	return ""
+}
+
+func (m *ProductFilter) GetInStock() *wrappers.BoolValue {
+	if m != nil {
+		return m.InStock
+	}
+	return nil
+}
+
+func (m *ProductFilter) GetCreatedAfter() *timestamp.Timestamp {
+	if m != nil {
+		return m.CreatedAfter
+	}
+	return nil
+}
+
+func (m *ProductFilter) GetUpdatedSince() *timestamp.Timestamp {
+	if m != nil {
+		return m.UpdatedSince
+	}
+	return nil
+}
+
+func (m *ProductFilter) GetIds() []string {
+	if m != nil {
+		return m.Ids
+	}
+	return nil
+}
+
+func (m *ProductFilter) GetCategoryIds() []string {
+	if m != nil {
+		return m.CategoryIds
+	}
+	return nil
+}
+
+func (m *ProductFilter) GetIncludeSubcategories() *wrappers.BoolValue {
+	if m != nil {
+		return m.IncludeSubcategories
+	}
+	return nil
+}
+
+type ListProductsRequest struct {
+	// first is the size of the page, defaults to 20.
+	First  int32  `protobuf:"varint,1,opt,name=first,proto3" json:"first,omitempty"`
+	Cursor string `protobuf:"bytes,2,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	// order_by holds keys such as price or nameDesc, as accepted by the orderBy parameter of the REST API.
+	OrderBy              []string       `protobuf:"bytes,3,rep,name=order_by,json=orderBy,proto3" json:"order_by,omitempty"`
+	Filter               *ProductFilter `protobuf:"bytes,4,opt,name=filter,proto3" json:"filter,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *ListProductsRequest) Reset()         { *m = ListProductsRequest{} }
+func (m *ListProductsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListProductsRequest) ProtoMessage()    {}
+func (*ListProductsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f0fd8b59378f44a5, []int{2}
+}
+
+func (m *ListProductsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListProductsRequest.Unmarshal(m, b)
+}
+func (m *ListProductsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListProductsRequest.Marshal(b, m, deterministic)
+}
+func (m *ListProductsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListProductsRequest.Merge(m, src)
+}
+func (m *ListProductsRequest) XXX_Size() int {
+	return xxx_messageInfo_ListProductsRequest.Size(m)
+}
+func (m *ListProductsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListProductsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListProductsRequest proto.InternalMessageInfo
+
+func (m *ListProductsRequest) GetFirst() int32 {
+	if m != nil {
+		return m.First
+	}
+	return 0
+}
+
+func (m *ListProductsRequest) GetCursor() string {
+	if m != nil {
+		return m.Cursor
+	}
+	return ""
+}
+
+func (m *ListProductsRequest) GetOrderBy() []string {
+	if m != nil {
+		return m.OrderBy
+	}
+	return nil
+}
+
+func (m *ListProductsRequest) GetFilter() *ProductFilter {
+	if m != nil {
+		return m.Filter
+	}
+	return nil
+}
+
+type SearchProductsRequest struct {
+	SearchText string `protobuf:"bytes,1,opt,name=search_text,json=searchText,proto3" json:"search_text,omitempty"`
+	// first is the size of the page, defaults to 20.
+	First  int32  `protobuf:"varint,2,opt,name=first,proto3" json:"first,omitempty"`
+	Cursor string `protobuf:"bytes,3,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	// order_by holds keys such as relevance or price, most relevant first when empty.
+	OrderBy              []string       `protobuf:"bytes,4,rep,name=order_by,json=orderBy,proto3" json:"order_by,omitempty"`
+	Filter               *ProductFilter `protobuf:"bytes,5,opt,name=filter,proto3" json:"filter,omitempty"`
+	Highlight            bool           `protobuf:"varint,6,opt,name=highlight,proto3" json:"highlight,omitempty"`
+	Fuzzy                bool           `protobuf:"varint,7,opt,name=fuzzy,proto3" json:"fuzzy,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *SearchProductsRequest) Reset()         { *m = SearchProductsRequest{} }
+func (m *SearchProductsRequest) String() string { return proto.CompactTextString(m) }
+func (*SearchProductsRequest) ProtoMessage()    {}
+func (*SearchProductsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f0fd8b59378f44a5, []int{3}
+}
+
+func (m *SearchProductsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SearchProductsRequest.Unmarshal(m, b)
+}
+func (m *SearchProductsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SearchProductsRequest.Marshal(b, m, deterministic)
+}
+func (m *SearchProductsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SearchProductsRequest.Merge(m, src)
+}
+func (m *SearchProductsRequest) XXX_Size() int {
+	return xxx_messageInfo_SearchProductsRequest.Size(m)
+}
+func (m *SearchProductsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SearchProductsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SearchProductsRequest proto.InternalMessageInfo
+
+func (m *SearchProductsRequest) GetSearchText() string {
+	if m != nil {
+		return m.SearchText
+	}
+	return ""
+}
+
+func (m *SearchProductsRequest) GetFirst() int32 {
+	if m != nil {
+		return m.First
+	}
+	return 0
+}
+
+func (m *SearchProductsRequest) GetCursor() string {
+	if m != nil {
+		return m.Cursor
+	}
+	return ""
+}
+
+func (m *SearchProductsRequest) GetOrderBy() []string {
+	if m != nil {
+		return m.OrderBy
+	}
+	return nil
+}
+
+func (m *SearchProductsRequest) GetFilter() *ProductFilter {
+	if m != nil {
+		return m.Filter
+	}
+	return nil
+}
+
+func (m *SearchProductsRequest) GetHighlight() bool {
+	if m != nil {
+		return m.Highlight
+	}
+	return false
+}
+
+func (m *SearchProductsRequest) GetFuzzy() bool {
+	if m != nil {
+		return m.Fuzzy
+	}
+	return false
+}
+
+type Variant struct {
+	Sku       string            `protobuf:"bytes,1,opt,name=sku,proto3" json:"sku,omitempty"`
+	ProductId string            `protobuf:"bytes,2,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	Options   map[string]string `protobuf:"bytes,3,rep,name=options,proto3" json:"options,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// price is a decimal number in the requested currency, empty if the variant is not sold in it.
+	Price    string   `protobuf:"bytes,4,opt,name=price,proto3" json:"price,omitempty"`
+	Quantity int32    `protobuf:"varint,5,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	Images   []string `protobuf:"bytes,6,rep,name=images,proto3" json:"images,omitempty"`
+	Currency string   `protobuf:"bytes,7,opt,name=currency,proto3" json:"currency,omitempty"`
+	// prices holds the price of the variant in every currency it is sold in.
+	Prices               map[string]string `protobuf:"bytes,8,rep,name=prices,proto3" json:"prices,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *Variant) Reset()         { *m = Variant{} }
+func (m *Variant) String() string { return proto.CompactTextString(m) }
+func (*Variant) ProtoMessage()    {}
+func (*Variant) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f0fd8b59378f44a5, []int{4}
+}
+
+func (m *Variant) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Variant.Unmarshal(m, b)
+}
+func (m *Variant) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Variant.Marshal(b, m, deterministic)
+}
+func (m *Variant) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Variant.Merge(m, src)
+}
+func (m *Variant) XXX_Size() int {
+	return xxx_messageInfo_Variant.Size(m)
+}
+func (m *Variant) XXX_DiscardUnknown() {
+	xxx_messageInfo_Variant.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Variant proto.InternalMessageInfo
+
+func (m *Variant) GetSku() string {
+	if m != nil {
+		return m.Sku
+	}
+	return ""
+}
+
+func (m *Variant) GetProductId() string {
+	if m != nil {
+		return m.ProductId
+	}
+	return ""
+}
+
+func (m *Variant) GetOptions() map[string]string {
+	if m != nil {
+		return m.Options
+	}
+	return nil
+}
+
+func (m *Variant) GetPrice() string {
+	if m != nil {
+		return m.Price
+	}
+	return ""
+}
+
+func (m *Variant) GetQuantity() int32 {
+	if m != nil {
+		return m.Quantity
+	}
+	return 0
+}
+
+func (m *Variant) GetImages() []string {
+	if m != nil {
+		return m.Images
+	}
+	return nil
+}
+
+func (m *Variant) GetCurrency() string {
+	if m != nil {
+		return m.Currency
+	}
+	return ""
+}
+
+func (m *Variant) GetPrices() map[string]string {
+	if m != nil {
+		return m.Prices
+	}
+	return nil
+}
+
+type Product struct {
+	Id           string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name         string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	DisplayImage string `protobuf:"bytes,3,opt,name=display_image,json=displayImage,proto3" json:"display_image,omitempty"`
+	Thumbnail    string `protobuf:"bytes,4,opt,name=thumbnail,proto3" json:"thumbnail,omitempty"`
+	// price is a decimal number in the requested currency, empty if the product is not sold in it.
+	Price            string               `protobuf:"bytes,5,opt,name=price,proto3" json:"price,omitempty"`
+	Description      string               `protobuf:"bytes,6,opt,name=description,proto3" json:"description,omitempty"`
+	ShortDescription string               `protobuf:"bytes,7,opt,name=short_description,json=shortDescription,proto3" json:"short_description,omitempty"`
+	Quantity         int32                `protobuf:"varint,8,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	CreatedAt        *timestamp.Timestamp `protobuf:"bytes,9,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt        *timestamp.Timestamp `protobuf:"bytes,10,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	Categories       []string             `protobuf:"bytes,11,rep,name=categories,proto3" json:"categories,omitempty"`
+	Variants         []*Variant           `protobuf:"bytes,12,rep,name=variants,proto3" json:"variants,omitempty"`
+	Currency         string               `protobuf:"bytes,13,opt,name=currency,proto3" json:"currency,omitempty"`
+	// prices holds the price of the product in every currency it is sold in.
+	Prices               map[string]string `protobuf:"bytes,14,rep,name=prices,proto3" json:"prices,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *Product) Reset()         { *m = Product{} }
+func (m *Product) String() string { return proto.CompactTextString(m) }
+func (*Product) ProtoMessage()    {}
+func (*Product) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f0fd8b59378f44a5, []int{5}
+}
+
+func (m *Product) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Product.Unmarshal(m, b)
+}
+func (m *Product) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Product.Marshal(b, m, deterministic)
+}
+func (m *Product) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Product.Merge(m, src)
+}
+func (m *Product) XXX_Size() int {
+	return xxx_messageInfo_Product.Size(m)
+}
+func (m *Product) XXX_DiscardUnknown() {
+	xxx_messageInfo_Product.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Product proto.InternalMessageInfo
+
+func (m *Product) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Product) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Product) GetDisplayImage() string {
+	if m != nil {
+		return m.DisplayImage
+	}
+	return ""
+}
+
+func (m *Product) GetThumbnail() string {
+	if m != nil {
+		return m.Thumbnail
+	}
+	return ""
+}
+
+func (m *Product) GetPrice() string {
+	if m != nil {
+		return m.Price
+	}
+	return ""
+}
+
+func (m *Product) GetDescription() string {
+	if m != nil {
+		return m.Description
+	}
+	return ""
+}
+
+func (m *Product) GetShortDescription() string {
+	if m != nil {
+		return m.ShortDescription
+	}
+	return ""
+}
+
+func (m *Product) GetQuantity() int32 {
+	if m != nil {
+		return m.Quantity
+	}
+	return 0
+}
+
+func (m *Product) GetCreatedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return nil
+}
+
+func (m *Product) GetUpdatedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.UpdatedAt
+	}
+	return nil
+}
+
+func (m *Product) GetCategories() []string {
+	if m != nil {
+		return m.Categories
+	}
+	return nil
+}
+
+func (m *Product) GetVariants() []*Variant {
+	if m != nil {
+		return m.Variants
+	}
+	return nil
+}
+
+func (m *Product) GetCurrency() string {
+	if m != nil {
+		return m.Currency
+	}
+	return ""
+}
+
+func (m *Product) GetPrices() map[string]string {
+	if m != nil {
+		return m.Prices
+	}
+	return nil
+}
+
+type Fragments struct {
+	Fragments            []string `protobuf:"bytes,1,rep,name=fragments,proto3" json:"fragments,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Fragments) Reset()         { *m = Fragments{} }
+func (m *Fragments) String() string { return proto.CompactTextString(m) }
+func (*Fragments) ProtoMessage()    {}
+func (*Fragments) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f0fd8b59378f44a5, []int{6}
+}
+
+func (m *Fragments) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Fragments.Unmarshal(m, b)
+}
+func (m *Fragments) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Fragments.Marshal(b, m, deterministic)
+}
+func (m *Fragments) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Fragments.Merge(m, src)
+}
+func (m *Fragments) XXX_Size() int {
+	return xxx_messageInfo_Fragments.Size(m)
+}
+func (m *Fragments) XXX_DiscardUnknown() {
+	xxx_messageInfo_Fragments.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Fragments proto.InternalMessageInfo
+
+func (m *Fragments) GetFragments() []string {
+	if m != nil {
+		return m.Fragments
+	}
+	return nil
+}
+
+// SearchHit holds how well a product matched a search.
+type SearchHit struct {
+	Score float64 `protobuf:"fixed64,1,opt,name=score,proto3" json:"score,omitempty"`
+	// highlights holds fragments of the name and description with matches marked, when requested.
+	Highlights           map[string]*Fragments `protobuf:"bytes,2,rep,name=highlights,proto3" json:"highlights,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}              `json:"-"`
+	XXX_unrecognized     []byte                `json:"-"`
+	XXX_sizecache        int32                 `json:"-"`
+}
+
+func (m *SearchHit) Reset()         { *m = SearchHit{} }
+func (m *SearchHit) String() string { return proto.CompactTextString(m) }
+func (*SearchHit) ProtoMessage()    {}
+func (*SearchHit) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f0fd8b59378f44a5, []int{7}
+}
+
+func (m *SearchHit) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SearchHit.Unmarshal(m, b)
+}
+func (m *SearchHit) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SearchHit.Marshal(b, m, deterministic)
+}
+func (m *SearchHit) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SearchHit.Merge(m, src)
+}
+func (m *SearchHit) XXX_Size() int {
+	return xxx_messageInfo_SearchHit.Size(m)
+}
+func (m *SearchHit) XXX_DiscardUnknown() {
+	xxx_messageInfo_SearchHit.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SearchHit proto.InternalMessageInfo
+
+func (m *SearchHit) GetScore() float64 {
+	if m != nil {
+		return m.Score
+	}
+	return 0
+}
+
+func (m *SearchHit) GetHighlights() map[string]*Fragments {
+	if m != nil {
+		return m.Highlights
+	}
+	return nil
+}
+
+type ProductList struct {
+	Products []*Product `protobuf:"bytes,1,rep,name=products,proto3" json:"products,omitempty"`
+	Cursor   string     `protobuf:"bytes,2,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	// hits holds the hit of each product of a search.
+	Hits []*SearchHit `protobuf:"bytes,3,rep,name=hits,proto3" json:"hits,omitempty"`
+	// did_you_mean holds corrected search text when a search matches nothing.
+	DidYouMean           string   `protobuf:"bytes,4,opt,name=did_you_mean,json=didYouMean,proto3" json:"did_you_mean,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ProductList) Reset()         { *m = ProductList{} }
+func (m *ProductList) String() string { return proto.CompactTextString(m) }
+func (*ProductList) ProtoMessage()    {}
+func (*ProductList) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f0fd8b59378f44a5, []int{8}
+}
+
+func (m *ProductList) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ProductList.Unmarshal(m, b)
+}
+func (m *ProductList) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ProductList.Marshal(b, m, deterministic)
+}
+func (m *ProductList) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ProductList.Merge(m, src)
+}
+func (m *ProductList) XXX_Size() int {
+	return xxx_messageInfo_ProductList.Size(m)
+}
+func (m *ProductList) XXX_DiscardUnknown() {
+	xxx_messageInfo_ProductList.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ProductList proto.InternalMessageInfo
+
+func (m *ProductList) GetProducts() []*Product {
+	if m != nil {
+		return m.Products
+	}
+	return nil
+}
+
+func (m *ProductList) GetCursor() string {
+	if m != nil {
+		return m.Cursor
+	}
+	return ""
+}
+
+func (m *ProductList) GetHits() []*SearchHit {
+	if m != nil {
+		return m.Hits
+	}
+	return nil
+}
+
+func (m *ProductList) GetDidYouMean() string {
+	if m != nil {
+		return m.DidYouMean
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*GetProductRequest)(nil), "product.GetProductRequest")
+	proto.RegisterType((*ProductFilter)(nil), "product.ProductFilter")
+	proto.RegisterType((*ListProductsRequest)(nil), "product.ListProductsRequest")
+	proto.RegisterType((*SearchProductsRequest)(nil), "product.SearchProductsRequest")
+	proto.RegisterType((*Variant)(nil), "product.Variant")
+	proto.RegisterMapType((map[string]string)(nil), "product.Variant.OptionsEntry")
+	proto.RegisterMapType((map[string]string)(nil), "product.Variant.PricesEntry")
+	proto.RegisterType((*Product)(nil), "product.Product")
+	proto.RegisterMapType((map[string]string)(nil), "product.Product.PricesEntry")
+	proto.RegisterType((*Fragments)(nil), "product.Fragments")
+	proto.RegisterType((*SearchHit)(nil), "product.SearchHit")
+	proto.RegisterMapType((map[string]*Fragments)(nil), "product.SearchHit.HighlightsEntry")
+	proto.RegisterType((*ProductList)(nil), "product.ProductList")
+}
+
+func init() {
+	proto.RegisterFile("product.proto", fileDescriptor_f0fd8b59378f44a5)
+}
+
+var fileDescriptor_f0fd8b59378f44a5 = []byte{
+	// 1008 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x56, 0xdb, 0x6e, 0x23, 0x45,
+	0x10, 0xd5, 0xf8, 0x3e, 0xe5, 0x0b, 0xd9, 0x26, 0xbb, 0x1a, 0x86, 0x6c, 0xd6, 0x18, 0x09, 0x05,
+	0x81, 0xbc, 0xc8, 0x80, 0x60, 0xf3, 0xb2, 0x5a, 0x0b, 0xc2, 0x46, 0x02, 0x6d, 0x18, 0xaf, 0x56,
+	0x82, 0x97, 0x51, 0x7b, 0xa6, 0x6d, 0xb7, 0xe2, 0xb9, 0x6c, 0x77, 0x4f, 0x88, 0xf3, 0x01, 0x3c,
+	0xf2, 0x05, 0xf0, 0xc6, 0x47, 0xf0, 0xcc, 0xbf, 0xf0, 0x1f, 0xa8, 0x2f, 0x33, 0x1e, 0xdb, 0xb1,
+	0x12, 0xc4, 0x93, 0xa7, 0xaa, 0x4e, 0x55, 0xd7, 0xe5, 0x74, 0xb5, 0xa1, 0x9b, 0xb2, 0x24, 0xcc,
+	0x02, 0x31, 0x4c, 0x59, 0x22, 0x12, 0xd4, 0x34, 0xa2, 0xfb, 0x64, 0x9e, 0x24, 0xf3, 0x25, 0x79,
+	0xaa, 0xd4, 0xd3, 0x6c, 0xf6, 0x54, 0xd0, 0x88, 0x70, 0x81, 0xa3, 0x54, 0x23, 0xdd, 0xe3, 0x6d,
+	0xc0, 0x2f, 0x0c, 0xa7, 0x29, 0x61, 0x5c, 0xdb, 0x07, 0xcf, 0xe1, 0xc1, 0x77, 0x44, 0x5c, 0xe8,
+	0x70, 0x1e, 0x79, 0x9b, 0x11, 0x2e, 0x50, 0x0f, 0x2a, 0x34, 0x74, 0xac, 0xbe, 0x75, 0x62, 0x7b,
+	0x15, 0x1a, 0x22, 0x17, 0x5a, 0x41, 0xc6, 0x18, 0x89, 0x83, 0x95, 0x53, 0x51, 0xda, 0x42, 0x1e,
+	0xfc, 0x59, 0x85, 0xae, 0x71, 0x3f, 0xa3, 0x4b, 0x41, 0xd8, 0x06, 0xda, 0xda, 0x44, 0xa3, 0xf7,
+	0xc1, 0x8e, 0x68, 0xec, 0xa7, 0x8c, 0x06, 0x24, 0x0f, 0x15, 0xd1, 0xf8, 0x42, 0xca, 0xca, 0x88,
+	0xaf, 0x8d, 0xb1, 0x6a, 0x8c, 0xf8, 0x5a, 0x1b, 0xbf, 0x84, 0x16, 0x8d, 0x7d, 0x2e, 0x92, 0xe0,
+	0xd2, 0xa9, 0xf5, 0xad, 0x93, 0xf6, 0xc8, 0x1d, 0xea, 0xda, 0x86, 0x79, 0x6d, 0xc3, 0x71, 0x92,
+	0x2c, 0xdf, 0xe0, 0x65, 0x46, 0xbc, 0x26, 0x8d, 0x27, 0x12, 0x8a, 0x9e, 0x43, 0x37, 0x60, 0x04,
+	0x0b, 0x12, 0xfa, 0x78, 0x26, 0x08, 0x73, 0xea, 0x7b, 0x7c, 0x5f, 0xe7, 0x8d, 0xf3, 0x3a, 0xc6,
+	0xe1, 0x85, 0xc4, 0xcb, 0x00, 0x59, 0x1a, 0xaa, 0x00, 0x9c, 0xc6, 0x01, 0x71, 0x1a, 0x77, 0x07,
+	0x30, 0x0e, 0x13, 0x89, 0x47, 0x07, 0x50, 0xa5, 0x21, 0x77, 0x9a, 0xfd, 0xea, 0x89, 0xed, 0xc9,
+	0x4f, 0xf4, 0x01, 0x74, 0x02, 0x2c, 0xc8, 0x3c, 0x61, 0x2b, 0x5f, 0x9a, 0x5a, 0xca, 0xd4, 0xce,
+	0x75, 0xe7, 0x21, 0x47, 0xaf, 0xe0, 0x21, 0x8d, 0x83, 0x65, 0x16, 0x12, 0x9f, 0x67, 0x53, 0x63,
+	0xa1, 0x84, 0x3b, 0xf6, 0x9d, 0xa5, 0x1f, 0x1a, 0xc7, 0x49, 0xd9, 0x6f, 0xf0, 0x9b, 0x05, 0xef,
+	0x7e, 0x4f, 0x79, 0x3e, 0x69, 0x9e, 0x8f, 0xfa, 0x10, 0xea, 0x33, 0xca, 0xb8, 0x50, 0x93, 0xaa,
+	0x7b, 0x5a, 0x40, 0x8f, 0xa0, 0x11, 0x64, 0x8c, 0x27, 0xcc, 0xcc, 0xc8, 0x48, 0xe8, 0x3d, 0x68,
+	0x25, 0x2c, 0x24, 0xcc, 0x9f, 0xae, 0x9c, 0xaa, 0xca, 0xba, 0xa9, 0xe4, 0xf1, 0x0a, 0x0d, 0xa1,
+	0x31, 0x53, 0xf3, 0x37, 0xd3, 0x79, 0x34, 0xcc, 0x29, 0xbb, 0xc1, 0x0e, 0xcf, 0xa0, 0x06, 0xff,
+	0x58, 0xf0, 0x70, 0x42, 0x30, 0x0b, 0x16, 0xdb, 0x29, 0x3d, 0x81, 0x36, 0x57, 0x06, 0x5f, 0x90,
+	0x6b, 0x61, 0x28, 0x04, 0x5a, 0xf5, 0x9a, 0x5c, 0x97, 0x72, 0xae, 0xdc, 0x9e, 0x73, 0x75, 0x6f,
+	0xce, 0xb5, 0x7d, 0x39, 0xd7, 0xef, 0x93, 0x33, 0x3a, 0x02, 0x7b, 0x41, 0xe7, 0x8b, 0x25, 0x9d,
+	0x2f, 0x84, 0xe2, 0x41, 0xcb, 0x5b, 0x2b, 0x54, 0x5a, 0xd9, 0xcd, 0xcd, 0xca, 0x69, 0x2a, 0x8b,
+	0x16, 0x06, 0xbf, 0x56, 0xa1, 0xf9, 0x06, 0x33, 0x8a, 0x63, 0x21, 0xa9, 0xc0, 0x2f, 0x33, 0x53,
+	0x91, 0xfc, 0x44, 0x8f, 0x01, 0xcc, 0x91, 0x3e, 0x0d, 0x4d, 0xb3, 0x6d, 0xa3, 0x39, 0x0f, 0xd1,
+	0x57, 0xd0, 0x4c, 0x52, 0x41, 0x93, 0x98, 0xab, 0x76, 0xb7, 0x47, 0x8f, 0x8b, 0x0c, 0x4d, 0xcc,
+	0xe1, 0x2b, 0x6d, 0xff, 0x36, 0x16, 0x6c, 0xe5, 0xe5, 0x68, 0x99, 0x8b, 0xbe, 0x46, 0x35, 0x15,
+	0x52, 0x0b, 0xf2, 0x66, 0xbe, 0xcd, 0x70, 0x2c, 0xa8, 0x58, 0xa9, 0x8a, 0xeb, 0x5e, 0x21, 0xcb,
+	0xf6, 0xd1, 0x08, 0xcf, 0x09, 0x77, 0x1a, 0xaa, 0x49, 0x46, 0xda, 0xb8, 0xcd, 0xcd, 0xad, 0xdb,
+	0xfc, 0x05, 0x34, 0x54, 0x60, 0x4d, 0xe1, 0xf6, 0xe8, 0x68, 0x27, 0x3b, 0x75, 0x77, 0x4d, 0x72,
+	0x06, 0xeb, 0x9e, 0x42, 0xa7, 0x9c, 0xb4, 0xec, 0xca, 0x25, 0xc9, 0x57, 0x85, 0xfc, 0x94, 0xd9,
+	0x5f, 0x49, 0x2e, 0x9b, 0x86, 0x68, 0xe1, 0xb4, 0xf2, 0xb5, 0xe5, 0x3e, 0x83, 0x76, 0x29, 0xe4,
+	0x7f, 0x71, 0x1d, 0xfc, 0x5d, 0x83, 0xa6, 0x19, 0xeb, 0xce, 0x82, 0x43, 0x50, 0x8b, 0x71, 0x94,
+	0x3b, 0xa9, 0x6f, 0xf4, 0x21, 0x74, 0x43, 0xca, 0xd3, 0x25, 0x5e, 0xf9, 0xaa, 0x15, 0x86, 0x56,
+	0x1d, 0xa3, 0x3c, 0x97, 0x3a, 0xc9, 0x08, 0xb1, 0xc8, 0xa2, 0x69, 0x8c, 0xe9, 0xd2, 0xf4, 0x7a,
+	0xad, 0x58, 0x4f, 0xa1, 0x5e, 0x9e, 0x42, 0x1f, 0xda, 0x21, 0xe1, 0x01, 0xa3, 0xaa, 0x09, 0x8a,
+	0x47, 0xb6, 0x57, 0x56, 0xa1, 0x4f, 0xe0, 0x01, 0x5f, 0x24, 0x4c, 0xf8, 0x65, 0x9c, 0x6e, 0xfe,
+	0x81, 0x32, 0x7c, 0x53, 0x02, 0x97, 0x87, 0xda, 0xda, 0x1a, 0xea, 0x33, 0x80, 0x62, 0xfb, 0x09,
+	0xc7, 0xbe, 0x73, 0x73, 0xd9, 0xf9, 0xea, 0x13, 0xd2, 0x35, 0xdf, 0x7b, 0x58, 0x38, 0x70, 0xb7,
+	0xab, 0x41, 0xbf, 0x10, 0xe8, 0x18, 0xa0, 0xb4, 0xb1, 0xda, 0x8a, 0x4e, 0x25, 0x0d, 0xfa, 0x14,
+	0x5a, 0x57, 0x9a, 0x1f, 0xdc, 0xe9, 0x28, 0xe2, 0x1c, 0x6c, 0x13, 0xc7, 0x2b, 0x10, 0x1b, 0x04,
+	0xec, 0xee, 0x25, 0x60, 0x6f, 0x8b, 0x80, 0x17, 0xc5, 0xef, 0x2e, 0x01, 0xff, 0x07, 0x89, 0x3e,
+	0x06, 0xfb, 0x8c, 0xe1, 0x79, 0x44, 0x64, 0x66, 0x47, 0x60, 0xcf, 0x72, 0xc1, 0xb1, 0x54, 0x99,
+	0x6b, 0xc5, 0xe0, 0x2f, 0x0b, 0x6c, 0xbd, 0xe0, 0x5e, 0x52, 0xb5, 0x1c, 0x78, 0x90, 0x30, 0xa2,
+	0x8e, 0xb1, 0x3c, 0x2d, 0xa0, 0x31, 0x40, 0xb1, 0x3f, 0xb8, 0x53, 0x51, 0x35, 0x0c, 0x8a, 0x1a,
+	0x0a, 0xef, 0xe1, 0xcb, 0x02, 0xa4, 0x2b, 0x29, 0x79, 0xb9, 0x3f, 0xc2, 0x3b, 0x5b, 0xe6, 0x5b,
+	0x2a, 0x3a, 0x29, 0x57, 0xd4, 0x1e, 0xa1, 0xe2, 0x8c, 0xa2, 0x9a, 0x72, 0x95, 0x7f, 0x58, 0xb2,
+	0x43, 0x0a, 0x20, 0xdf, 0x0c, 0x39, 0x30, 0x83, 0xd7, 0x75, 0x96, 0x07, 0x66, 0x70, 0x5e, 0x81,
+	0xd8, 0xfb, 0x78, 0x7c, 0x04, 0xb5, 0x05, 0x15, 0xf9, 0x26, 0x43, 0xbb, 0x65, 0x7a, 0xca, 0x8e,
+	0xfa, 0xd0, 0x09, 0x69, 0xe8, 0xaf, 0x92, 0xcc, 0x8f, 0x08, 0x8e, 0xcd, 0xb5, 0x82, 0x90, 0x86,
+	0x3f, 0x25, 0xd9, 0x0f, 0x04, 0xc7, 0xa3, 0xdf, 0x2b, 0xd0, 0x33, 0xe7, 0x4e, 0x08, 0xbb, 0x92,
+	0x97, 0xea, 0x14, 0x60, 0xfd, 0x3f, 0x06, 0xb9, 0x45, 0xf0, 0x9d, 0x3f, 0x37, 0xee, 0x4e, 0xea,
+	0x68, 0x0c, 0x9d, 0xf2, 0xd3, 0x88, 0xd6, 0x2c, 0xba, 0xe5, 0xc5, 0x74, 0x0f, 0xb7, 0xfd, 0x55,
+	0x8b, 0xce, 0xa0, 0xb7, 0xf9, 0x9a, 0xa1, 0xe3, 0xad, 0x02, 0xef, 0x17, 0x67, 0x0c, 0xbd, 0x89,
+	0x60, 0x04, 0x47, 0xf7, 0xcc, 0x66, 0xa7, 0x9a, 0xcf, 0xac, 0x71, 0xfd, 0xe7, 0x2a, 0x4b, 0x83,
+	0x69, 0x43, 0xdd, 0xd2, 0xcf, 0xff, 0x1d, 0x00, 0x7c, 0x12, 0x1c, 0xc8, 0x3c, 0x0a, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// ProductServiceClient is the client API for ProductService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type ProductServiceClient interface {
+	// GetProduct retrieves a product from its id.
+	GetProduct(ctx context.Context, in *GetProductRequest, opts ...grpc.CallOption) (*Product, error)
+	// ListProducts retrieves a page of the products matching a filter.
+	ListProducts(ctx context.Context, in *ListProductsRequest, opts ...grpc.CallOption) (*ProductList, error)
+	// SearchProducts retrieves a page of the products matching search text and a filter.
+	SearchProducts(ctx context.Context, in *SearchProductsRequest, opts ...grpc.CallOption) (*ProductList, error)
+	// StreamProducts streams every product matching a filter, starting from the cursor of the request, page by page.
+	StreamProducts(ctx context.Context, in *ListProductsRequest, opts ...grpc.CallOption) (ProductService_StreamProductsClient, error)
+}
+
+type productServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewProductServiceClient(cc grpc.ClientConnInterface) ProductServiceClient {
+	return &productServiceClient{cc}
+}
+
+func (c *productServiceClient) GetProduct(ctx context.Context, in *GetProductRequest, opts ...grpc.CallOption) (*Product, error) {
+	out := new(Product)
+	err := c.cc.Invoke(ctx, "/product.ProductService/GetProduct", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *productServiceClient) ListProducts(ctx context.Context, in *ListProductsRequest, opts ...grpc.CallOption) (*ProductList, error) {
+	out := new(ProductList)
+	err := c.cc.Invoke(ctx, "/product.ProductService/ListProducts", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *productServiceClient) SearchProducts(ctx context.Context, in *SearchProductsRequest, opts ...grpc.CallOption) (*ProductList, error) {
+	out := new(ProductList)
+	err := c.cc.Invoke(ctx, "/product.ProductService/SearchProducts", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *productServiceClient) StreamProducts(ctx context.Context, in *ListProductsRequest, opts ...grpc.CallOption) (ProductService_StreamProductsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_ProductService_serviceDesc.Streams[0], "/product.ProductService/StreamProducts", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &productServiceStreamProductsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ProductService_StreamProductsClient interface {
+	Recv() (*Product, error)
+	grpc.ClientStream
+}
+
+type productServiceStreamProductsClient struct {
+	grpc.ClientStream
+}
+
+func (x *productServiceStreamProductsClient) Recv() (*Product, error) {
+	m := new(Product)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ProductServiceServer is the server API for ProductService service.
+type ProductServiceServer interface {
+	// GetProduct retrieves a product from its id.
+	GetProduct(context.Context, *GetProductRequest) (*Product, error)
+	// ListProducts retrieves a page of the products matching a filter.
+	ListProducts(context.Context, *ListProductsRequest) (*ProductList, error)
+	// SearchProducts retrieves a page of the products matching search text and a filter.
+	SearchProducts(context.Context, *SearchProductsRequest) (*ProductList, error)
+	// StreamProducts streams every product matching a filter, starting from the cursor of the request, page by page.
+	StreamProducts(*ListProductsRequest, ProductService_StreamProductsServer) error
+}
+
+// UnimplementedProductServiceServer can be embedded to have forward compatible implementations.
+type UnimplementedProductServiceServer struct {
+}
+
+func (*UnimplementedProductServiceServer) GetProduct(ctx context.Context, req *GetProductRequest) (*Product, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetProduct not implemented")
+}
+func (*UnimplementedProductServiceServer) ListProducts(ctx context.Context, req *ListProductsRequest) (*ProductList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListProducts not implemented")
+}
+func (*UnimplementedProductServiceServer) SearchProducts(ctx context.Context, req *SearchProductsRequest) (*ProductList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchProducts not implemented")
+}
+func (*UnimplementedProductServiceServer) StreamProducts(req *ListProductsRequest, srv ProductService_StreamProductsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamProducts not implemented")
+}
+
+func RegisterProductServiceServer(s *grpc.Server, srv ProductServiceServer) {
+	s.RegisterService(&_ProductService_serviceDesc, srv)
+}
+
+func _ProductService_GetProduct_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetProductRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProductServiceServer).GetProduct(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/product.ProductService/GetProduct",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProductServiceServer).GetProduct(ctx, req.(*GetProductRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProductService_ListProducts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListProductsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProductServiceServer).ListProducts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/product.ProductService/ListProducts",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProductServiceServer).ListProducts(ctx, req.(*ListProductsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProductService_SearchProducts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchProductsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProductServiceServer).SearchProducts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/product.ProductService/SearchProducts",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProductServiceServer).SearchProducts(ctx, req.(*SearchProductsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProductService_StreamProducts_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListProductsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ProductServiceServer).StreamProducts(m, &productServiceStreamProductsServer{stream})
+}
+
+type ProductService_StreamProductsServer interface {
+	Send(*Product) error
+	grpc.ServerStream
+}
+
+type productServiceStreamProductsServer struct {
+	grpc.ServerStream
+}
+
+func (x *productServiceStreamProductsServer) Send(m *Product) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _ProductService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "product.ProductService",
+	HandlerType: (*ProductServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetProduct",
+			Handler:    _ProductService_GetProduct_Handler,
+		},
+		{
+			MethodName: "ListProducts",
+			Handler:    _ProductService_ListProducts_Handler,
+		},
+		{
+			MethodName: "SearchProducts",
+			Handler:    _ProductService_SearchProducts_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamProducts",
+			Handler:       _ProductService_StreamProducts_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "product.proto",
+}
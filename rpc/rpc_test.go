@@ -0,0 +1,88 @@
+package rpc_test
+
+import (
+	"fmt"
+	"github.com/stone1549/product-service/common"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+// configuration configures an in memory repo holding the small dataset.
+type configuration struct{}
+
+func (c configuration) GetLifeCycle() common.LifeCycle {
+	return common.DevLifeCycle
+}
+
+func (c configuration) GetRepoType() common.ProductRepositoryType {
+	return common.InMemoryRepo
+}
+
+func (c configuration) GetTimeout() time.Duration {
+	return 60 * time.Second
+}
+
+func (c configuration) GetPort() int {
+	return 3333
+}
+
+func (c configuration) GetGrpcPort() int {
+	return 0
+}
+
+func (c configuration) GetInitDataSet() string {
+	return "../data/small_set.json"
+}
+
+func (c configuration) GetPgUrl() string {
+	return ""
+}
+
+func (c configuration) GetAutoMigrate() bool {
+	return false
+}
+
+func (c configuration) GetDataDir() string {
+	return ""
+}
+
+func (c configuration) GetCursorSecret() []byte {
+	return []byte("test cursor secret")
+}
+
+func (c configuration) GetReservationSweepInterval() time.Duration {
+	return 30 * time.Second
+}
+
+func (c configuration) GetSuggestTimeout() time.Duration {
+	return 250 * time.Millisecond
+}
+
+func (c configuration) GetCacheSize() int {
+	return 0
+}
+
+func (c configuration) GetCacheTtl() time.Duration {
+	return 30 * time.Second
+}
@@ -0,0 +1,370 @@
+package rpc
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. product.proto
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/shopspring/decimal"
+	"github.com/stone1549/product-service/common"
+	"github.com/stone1549/product-service/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultFirst is the size of the pages requested without one.
+const defaultFirst = 20
+
+// productServer implements ProductServiceServer on top of a ProductRepository.
+type productServer struct {
+	repo repository.ProductRepository
+}
+
+// NewProductServer constructs a ProductServiceServer serving the products of the given repository.
+func NewProductServer(repo repository.ProductRepository) ProductServiceServer {
+	return &productServer{repo}
+}
+
+// statusError translates the given repository error into a gRPC status error.
+func statusError(err error) error {
+	var code codes.Code
+	switch err {
+	case repository.ErrInvalidCursor, repository.ErrInvalidSearch, repository.ErrInvalidOrder:
+		code = codes.InvalidArgument
+	case repository.ErrProductNotFound, repository.ErrCategoryNotFound, repository.ErrReservationNotFound:
+		code = codes.NotFound
+	case repository.ErrProductExists, repository.ErrVariantExists:
+		code = codes.AlreadyExists
+	case repository.ErrInsufficientStock, repository.ErrReservationNotActive:
+		code = codes.FailedPrecondition
+	case context.DeadlineExceeded:
+		code = codes.DeadlineExceeded
+	case context.Canceled:
+		code = codes.Canceled
+	default:
+		code = codes.Internal
+	}
+
+	return status.Error(code, err.Error())
+}
+
+func invalidArgument(err error) error {
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+// GetProduct retrieves a product from its id.
+func (ps *productServer) GetProduct(ctx context.Context, request *GetProductRequest) (*Product, error) {
+	currency, err := parseCurrency(request.Currency)
+
+	if err != nil {
+		return nil, invalidArgument(err)
+	}
+
+	product, err := ps.repo.GetProduct(ctx, request.Id)
+
+	if err != nil {
+		return nil, statusError(err)
+	} else if product == nil {
+		return nil, statusError(repository.ErrProductNotFound)
+	}
+
+	return newProduct(*product, currency), nil
+}
+
+// ListProducts retrieves a page of the products matching a filter. Unlike the REST API an empty page is not an error.
+func (ps *productServer) ListProducts(ctx context.Context, request *ListProductsRequest) (*ProductList, error) {
+	orderBy, filter, err := parseListRequest(request)
+
+	if err != nil {
+		return nil, invalidArgument(err)
+	}
+
+	products, err := ps.repo.GetProducts(ctx, pageSize(request.First), request.Cursor, orderBy, filter)
+
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return newProductList(products, filter.PriceCurrency()), nil
+}
+
+// SearchProducts retrieves a page of the products matching search text and a filter.
+func (ps *productServer) SearchProducts(ctx context.Context, request *SearchProductsRequest) (*ProductList, error) {
+	orderBy, err := parseOrderBy(request.OrderBy)
+
+	if err != nil {
+		return nil, invalidArgument(err)
+	}
+
+	filter, err := parseFilter(request.Filter)
+
+	if err != nil {
+		return nil, invalidArgument(err)
+	}
+
+	products, err := ps.repo.SearchProducts(ctx, request.SearchText, pageSize(request.First), request.Cursor, orderBy,
+		filter, common.SearchOptions{Highlight: request.Highlight, Fuzzy: request.Fuzzy})
+
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return newProductList(products, filter.PriceCurrency()), nil
+}
+
+// StreamProducts streams every product matching a filter, starting from the cursor of the request, retrieving them
+// from the repository a page of the requested size at a time.
+func (ps *productServer) StreamProducts(request *ListProductsRequest,
+	stream ProductService_StreamProductsServer) error {
+	orderBy, filter, err := parseListRequest(request)
+
+	if err != nil {
+		return invalidArgument(err)
+	}
+
+	first := pageSize(request.First)
+	cursor := request.Cursor
+	for {
+		products, err := ps.repo.GetProducts(stream.Context(), first, cursor, orderBy, filter)
+
+		if err != nil {
+			return statusError(err)
+		}
+
+		for _, product := range products.Products {
+			if err := stream.Send(newProduct(product, filter.PriceCurrency())); err != nil {
+				return err
+			}
+		}
+
+		if len(products.Products) < first {
+			return nil
+		}
+
+		cursor = products.Cursor
+	}
+}
+
+func pageSize(first int32) int {
+	if first <= 0 {
+		return defaultFirst
+	}
+
+	return int(first)
+}
+
+func parseCurrency(code string) (common.Currency, error) {
+	if code == "" {
+		return common.DefaultCurrency, nil
+	}
+
+	return common.ParseCurrency(code)
+}
+
+func parseListRequest(request *ListProductsRequest) (common.OrderBy, common.ProductFilter, error) {
+	orderBy, err := parseOrderBy(request.OrderBy)
+
+	if err != nil {
+		return orderBy, common.ProductFilter{}, err
+	}
+
+	filter, err := parseFilter(request.Filter)
+	return orderBy, filter, err
+}
+
+func parseOrderBy(keys []string) (common.OrderBy, error) {
+	orderBy := common.OrderBy{}
+	for _, key := range keys {
+		if err := orderBy.Add(common.OrderByKey(key)); err != nil {
+			return orderBy, err
+		}
+	}
+
+	return orderBy, nil
+}
+
+func parseDecimal(name, str string) (*decimal.Decimal, error) {
+	if str == "" {
+		return nil, nil
+	}
+
+	value, err := decimal.NewFromString(str)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a number", name)
+	}
+
+	return &value, nil
+}
+
+func parseTimestamp(name string, ts *timestamp.Timestamp) (*time.Time, error) {
+	if ts == nil {
+		return nil, nil
+	}
+
+	value, err := ptypes.Timestamp(ts)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a valid timestamp", name)
+	}
+
+	return &value, nil
+}
+
+// parseFilter builds a ProductFilter from the given message, which may be nil. Subcategories are included unless
+// include_subcategories is set to false, as with the REST API.
+func parseFilter(message *ProductFilter) (common.ProductFilter, error) {
+	var filter common.ProductFilter
+	var err error
+
+	if message == nil {
+		message = &ProductFilter{}
+	}
+
+	filter.Currency, err = parseCurrency(message.Currency)
+
+	if err != nil {
+		return filter, err
+	}
+
+	filter.MinPrice, err = parseDecimal("min_price", message.MinPrice)
+
+	if err != nil {
+		return filter, err
+	}
+
+	filter.MaxPrice, err = parseDecimal("max_price", message.MaxPrice)
+
+	if err != nil {
+		return filter, err
+	}
+
+	if message.InStock != nil {
+		inStock := message.InStock.Value
+		filter.InStock = &inStock
+	}
+
+	filter.CreatedAfter, err = parseTimestamp("created_after", message.CreatedAfter)
+
+	if err != nil {
+		return filter, err
+	}
+
+	filter.UpdatedSince, err = parseTimestamp("updated_since", message.UpdatedSince)
+
+	if err != nil {
+		return filter, err
+	}
+
+	filter.Ids = message.Ids
+	filter.CategoryIds = message.CategoryIds
+	filter.IncludeSubcategories = message.IncludeSubcategories == nil || message.IncludeSubcategories.Value
+	return filter, nil
+}
+
+func formatPrice(price *decimal.Decimal, currency common.Currency) string {
+	if price == nil {
+		return ""
+	}
+
+	return currency.Format(*price)
+}
+
+// formatPrices renders the given prices, along with the given default price, each in its own currency.
+func formatPrices(defaultPrice *decimal.Decimal, prices map[common.Currency]decimal.Decimal) map[string]string {
+	result := make(map[string]string)
+	if defaultPrice != nil {
+		result[string(common.DefaultCurrency)] = common.DefaultCurrency.Format(*defaultPrice)
+	}
+
+	for currency, price := range prices {
+		result[string(currency)] = currency.Format(price)
+	}
+
+	return result
+}
+
+func stringValue(str *string) string {
+	if str == nil {
+		return ""
+	}
+
+	return *str
+}
+
+// timestampProto converts the given time, times that can not be represented are left unset.
+func timestampProto(t *time.Time) *timestamp.Timestamp {
+	if t == nil {
+		return nil
+	}
+
+	ts, err := ptypes.TimestampProto(*t)
+
+	if err != nil {
+		return nil
+	}
+
+	return ts
+}
+
+// newProduct builds a message for the given product priced in the given currency.
+func newProduct(product common.Product, currency common.Currency) *Product {
+	variants := make([]*Variant, len(product.Variants))
+	for i, variant := range product.Variants {
+		variants[i] = &Variant{
+			Sku:       variant.Sku,
+			ProductId: variant.ProductId,
+			Options:   variant.Options,
+			Price:     formatPrice(variant.EffectivePrice(product, currency), currency),
+			Quantity:  int32(variant.QtyInStock),
+			Images:    variant.Images,
+			Currency:  string(currency),
+			Prices:    formatPrices(variant.Price, variant.Prices),
+		}
+	}
+
+	return &Product{
+		Id:               product.Id,
+		Name:             product.Name,
+		DisplayImage:     stringValue(product.DisplayImage),
+		Thumbnail:        stringValue(product.Thumbnail),
+		Price:            formatPrice(product.PriceIn(currency), currency),
+		Description:      stringValue(product.Description),
+		ShortDescription: stringValue(product.ShortDescription),
+		Quantity:         int32(product.QtyInStock),
+		CreatedAt:        timestampProto(product.CreatedAt),
+		UpdatedAt:        timestampProto(product.UpdatedAt),
+		Categories:       product.CategoryIds,
+		Variants:         variants,
+		Currency:         string(currency),
+		Prices:           formatPrices(product.Price, product.Prices),
+	}
+}
+
+// newProductList builds a message for the given list of products priced in the given currency.
+func newProductList(list repository.ProductList, currency common.Currency) *ProductList {
+	result := &ProductList{
+		Products:   make([]*Product, len(list.Products)),
+		Cursor:     list.Cursor,
+		DidYouMean: list.DidYouMean,
+	}
+
+	for i, product := range list.Products {
+		result.Products[i] = newProduct(product, currency)
+	}
+
+	for _, hit := range list.Hits {
+		highlights := make(map[string]*Fragments)
+		for field, fragments := range hit.Highlights {
+			highlights[field] = &Fragments{Fragments: fragments}
+		}
+
+		result.Hits = append(result.Hits, &SearchHit{Score: hit.Score, Highlights: highlights})
+	}
+
+	return result
+}
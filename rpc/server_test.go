@@ -0,0 +1,88 @@
+package rpc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stone1549/product-service/common"
+	"github.com/stone1549/product-service/repository"
+	"github.com/stone1549/product-service/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestStatusError ensures that repository errors are translated into status errors with the matching code, and that
+// other errors are internal.
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+	}{
+		{repository.ErrInvalidCursor, codes.InvalidArgument},
+		{repository.ErrInvalidSearch, codes.InvalidArgument},
+		{repository.ErrInvalidOrder, codes.InvalidArgument},
+		{repository.ErrProductNotFound, codes.NotFound},
+		{repository.ErrCategoryNotFound, codes.NotFound},
+		{repository.ErrReservationNotFound, codes.NotFound},
+		{repository.ErrProductExists, codes.AlreadyExists},
+		{repository.ErrVariantExists, codes.AlreadyExists},
+		{repository.ErrInsufficientStock, codes.FailedPrecondition},
+		{repository.ErrReservationNotActive, codes.FailedPrecondition},
+		{context.DeadlineExceeded, codes.DeadlineExceeded},
+		{context.Canceled, codes.Canceled},
+		{errors.New("failed"), codes.Internal},
+	}
+
+	for _, test := range tests {
+		err := rpc.StatusError(test.err)
+
+		equals(t, test.code, status.Code(err))
+		equals(t, test.err.Error(), status.Convert(err).Message())
+	}
+}
+
+// productStream collects the products sent by a server streaming them.
+type productStream struct {
+	grpc.ServerStream
+	products []*rpc.Product
+}
+
+func (ps *productStream) Context() context.Context {
+	return context.Background()
+}
+
+func (ps *productStream) Send(product *rpc.Product) error {
+	ps.products = append(ps.products, product)
+	return nil
+}
+
+// TestStreamProducts_Success ensures that every product is streamed once and in order, whether or not the page size
+// evenly divides the number of products.
+func TestStreamProducts_Success(t *testing.T) {
+	repo, err := repository.MakeInMemoryRepository(configuration{})
+	ok(t, err)
+	orderBy := common.OrderBy{}
+	ok(t, orderBy.Add(common.OrderByName))
+	products, err := repo.GetProducts(context.Background(), 100, "", orderBy, common.ProductFilter{})
+	ok(t, err)
+
+	var ids []string
+	for _, product := range products.Products {
+		ids = append(ids, product.Id)
+	}
+
+	server := rpc.NewProductServer(repo)
+	for _, first := range []int32{3, 4, 100} {
+		stream := &productStream{}
+		ok(t, server.StreamProducts(&rpc.ListProductsRequest{First: first, OrderBy: []string{"name"}}, stream))
+
+		var streamed []string
+		for _, product := range stream.products {
+			streamed = append(streamed, product.Id)
+		}
+
+		equals(t, ids, streamed)
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-chi/render"
+	"github.com/stone1549/product-service/common"
+	"github.com/stone1549/product-service/repository"
+	"net/http"
+)
+
+// maxBatchIds is the most products that can be retrieved by a single batch get.
+const maxBatchIds = 500
+
+type batchGetRequest struct {
+	Ids []string `json:"ids"`
+}
+
+func (bgr *batchGetRequest) Bind(r *http.Request) error {
+	return validateBatchIds(bgr.Ids)
+}
+
+type batchGetResponse struct {
+	Products []productResponse `json:"products"`
+	Missing  []string          `json:"missing"`
+}
+
+func (bgr batchGetResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func validateBatchIds(ids []string) error {
+	if len(ids) == 0 {
+		return errors.New("ids must be provided")
+	}
+
+	if len(ids) > maxBatchIds {
+		return fmt.Errorf("at most %d ids can be requested at once", maxBatchIds)
+	}
+
+	return nil
+}
+
+// parseBatchIds retrieves the requested ids from the JSON body of a POST, or from the comma separated ids query
+// parameter otherwise.
+func parseBatchIds(r *http.Request) ([]string, error) {
+	if r.Method == http.MethodPost {
+		data := &batchGetRequest{}
+		err := render.Bind(r, data)
+		return data.Ids, err
+	}
+
+	var ids []string
+	if idsStr := r.URL.Query().Get("ids"); idsStr != "" {
+		ids = strings.Split(idsStr, ",")
+	}
+
+	return ids, validateBatchIds(ids)
+}
+
+// newBatchGetResponse builds a response for the given products priced in the given currency, listing the requested ids
+// without a product as missing.
+func newBatchGetResponse(ids []string, products []common.Product, currency common.Currency,
+	fields common.ProductFields) batchGetResponse {
+	response := batchGetResponse{Products: make([]productResponse, 0, len(products)), Missing: make([]string, 0)}
+	found := make(map[string]bool, len(products))
+	for _, product := range products {
+		productResponse := newProductResponse(product, currency)
+		productResponse.fields = fields
+		response.Products = append(response.Products, productResponse)
+		found[product.Id] = true
+	}
+
+	for _, id := range ids {
+		if !found[id] {
+			response.Missing = append(response.Missing, id)
+			found[id] = true
+		}
+	}
+
+	return response
+}
+
+// BatchGetProducts renders the products with the ids listed by the request, in the order they are listed, along with
+// the ids without a product. Finding none of the products is not an error.
+func BatchGetProducts(w http.ResponseWriter, r *http.Request) {
+	ids, err := parseBatchIds(r)
+
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	currency, err := parseCurrency(r)
+
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	fields, err := parseProductFields(r)
+
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	productRepo, ok := r.Context().Value("repo").(repository.ProductRepository)
+
+	if !ok {
+		render.Render(w, r, errRepository(errors.New("ProductRepository not found in context")))
+		return
+	}
+
+	products, err := productRepo.GetProductsByIds(common.WithProductFields(r.Context(), fields), ids)
+
+	if err != nil {
+		render.Render(w, r, errRepository(err))
+		return
+	}
+
+	if err := render.Render(w, r, newBatchGetResponse(ids, products, currency, fields)); err != nil {
+		render.Render(w, r, errUnknown(err))
+		return
+	}
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-chi/render"
+	"github.com/shopspring/decimal"
+	"github.com/stone1549/product-service/common"
+	"github.com/stone1549/product-service/repository"
+	"net/http"
+)
+
+type productRequest struct {
+	Id               *string                              `json:"id"`
+	Name             *string                              `json:"name"`
+	DisplayImage     *string                              `json:"displayImage"`
+	Thumbnail        *string                              `json:"thumbnail"`
+	Price            *decimal.Decimal                     `json:"price"`
+	Description      *string                              `json:"description"`
+	ShortDescription *string                              `json:"shortDescription"`
+	Quantity         *int                                 `json:"quantity"`
+	Categories       *[]string                            `json:"categories"`
+	Variants         *[]variantRequest                    `json:"variants"`
+	Prices           *map[common.Currency]decimal.Decimal `json:"prices"`
+}
+
+type variantRequest struct {
+	Sku      string                              `json:"sku"`
+	Options  map[string]string                   `json:"options"`
+	Price    *decimal.Decimal                    `json:"price"`
+	Quantity int                                 `json:"quantity"`
+	Images   []string                            `json:"images"`
+	Prices   map[common.Currency]decimal.Decimal `json:"prices"`
+}
+
+func (pr *productRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+// newProduct constructs a product solely from the fields present in the request.
+func (pr *productRequest) newProduct() common.Product {
+	var product common.Product
+	pr.applyTo(&product)
+	return product
+}
+
+// applyTo overwrites the fields of the given product with those present in the request.
+func (pr *productRequest) applyTo(product *common.Product) {
+	if pr.Id != nil {
+		product.Id = *pr.Id
+	}
+
+	if pr.Name != nil {
+		product.Name = *pr.Name
+	}
+
+	if pr.DisplayImage != nil {
+		product.DisplayImage = pr.DisplayImage
+	}
+
+	if pr.Thumbnail != nil {
+		product.Thumbnail = pr.Thumbnail
+	}
+
+	if pr.Price != nil {
+		product.Price = pr.Price
+	}
+
+	if pr.Description != nil {
+		product.Description = pr.Description
+	}
+
+	if pr.ShortDescription != nil {
+		product.ShortDescription = pr.ShortDescription
+	}
+
+	if pr.Quantity != nil {
+		product.QtyInStock = *pr.Quantity
+	}
+
+	if pr.Categories != nil {
+		product.CategoryIds = *pr.Categories
+	}
+
+	if pr.Variants != nil {
+		product.Variants = make([]common.Variant, len(*pr.Variants))
+		for i, variant := range *pr.Variants {
+			product.Variants[i] = common.Variant{
+				Sku:        variant.Sku,
+				ProductId:  product.Id,
+				Options:    variant.Options,
+				Price:      variant.Price,
+				QtyInStock: variant.Quantity,
+				Images:     variant.Images,
+				Prices:     variant.Prices,
+			}
+		}
+	}
+
+	if pr.Prices != nil {
+		product.Prices = *pr.Prices
+	}
+}
+
+func validateProduct(product common.Product) error {
+	if strings.TrimSpace(product.Id) == "" {
+		return errors.New("id is required")
+	}
+
+	if strings.TrimSpace(product.Name) == "" {
+		return errors.New("name is required")
+	}
+
+	if product.Price == nil {
+		return errors.New("price is required")
+	}
+
+	if product.Price.IsNegative() {
+		return errors.New("price must not be negative")
+	}
+
+	if product.QtyInStock < 0 {
+		return errors.New("quantity must not be negative")
+	}
+
+	if err := validatePrices(product.Prices, "prices"); err != nil {
+		return err
+	}
+
+	skus := make(map[string]bool)
+	for _, variant := range product.Variants {
+		if strings.TrimSpace(variant.Sku) == "" {
+			return errors.New("variant sku is required")
+		}
+
+		if skus[variant.Sku] {
+			return fmt.Errorf("variant sku %s is duplicated", variant.Sku)
+		}
+		skus[variant.Sku] = true
+
+		if variant.Price != nil && variant.Price.IsNegative() {
+			return fmt.Errorf("variant %s price must not be negative", variant.Sku)
+		}
+
+		if variant.QtyInStock < 0 {
+			return fmt.Errorf("variant %s quantity must not be negative", variant.Sku)
+		}
+
+		if err := validatePrices(variant.Prices, fmt.Sprintf("variant %s prices", variant.Sku)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validatePrices ensures the given price list holds non-negative prices in supported currencies other than the default
+// currency, which is priced through the price field.
+func validatePrices(prices map[common.Currency]decimal.Decimal, name string) error {
+	for currency, price := range prices {
+		if !currency.Supported() {
+			return fmt.Errorf("%s currency %s is not supported", name, currency)
+		}
+
+		if currency == common.DefaultCurrency {
+			return fmt.Errorf("%s must not include %s, use price instead", name, currency)
+		}
+
+		if price.IsNegative() {
+			return fmt.Errorf("%s %s must not be negative", name, currency)
+		}
+	}
+
+	return nil
+}
+
+func newProductId() (string, error) {
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// CreateProduct stores the product described by the request body and renders it. If no id is provided one is
+// generated.
+func CreateProduct(w http.ResponseWriter, r *http.Request) {
+	data := &productRequest{}
+
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	currency, err := parseCurrency(r)
+
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	product := data.newProduct()
+
+	if product.Id == "" {
+		id, err := newProductId()
+
+		if err != nil {
+			render.Render(w, r, errUnknown(err))
+			return
+		}
+
+		product.Id = id
+	}
+
+	if err := validateProduct(product); err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	productRepo, ok := r.Context().Value("repo").(repository.ProductRepository)
+
+	if !ok {
+		render.Render(w, r, errRepository(errors.New("ProductRepository not found in context")))
+		return
+	}
+
+	created, err := productRepo.CreateProduct(r.Context(), product)
+
+	if err == repository.ErrProductExists || err == repository.ErrVariantExists {
+		render.Render(w, r, errConflict(err))
+		return
+	} else if err == repository.ErrCategoryNotFound {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	} else if err != nil {
+		render.Render(w, r, errRepository(err))
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	if err := render.Render(w, r, newProductResponse(*created, currency)); err != nil {
+		render.Render(w, r, errUnknown(err))
+		return
+	}
+}
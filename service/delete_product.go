@@ -0,0 +1,39 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/go-chi/render"
+	"github.com/stone1549/product-service/common"
+	"github.com/stone1549/product-service/repository"
+	"net/http"
+)
+
+// DeleteProduct removes the product loaded by GetProductMiddleware.
+func DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	product, ok := r.Context().Value("product").(common.Product)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("unable to retrieve product at this time")))
+		return
+	}
+
+	productRepo, ok := r.Context().Value("repo").(repository.ProductRepository)
+
+	if !ok {
+		render.Render(w, r, errRepository(errors.New("ProductRepository not found in context")))
+		return
+	}
+
+	err := productRepo.DeleteProduct(r.Context(), product.Id)
+
+	if err == repository.ErrProductNotFound {
+		render.Render(w, r, errNotFound)
+		return
+	} else if err != nil {
+		render.Render(w, r, errRepository(err))
+		return
+	}
+
+	render.NoContent(w, r)
+}
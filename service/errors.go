@@ -28,6 +28,24 @@ func errInvalidRequest(err error) render.Renderer {
 	}
 }
 
+func errConflict(err error) render.Renderer {
+	return &errResponse{
+		Err:            err,
+		HTTPStatusCode: 409,
+		StatusText:     "Resource already exists.",
+		ErrorText:      err.Error(),
+	}
+}
+
+func errStateConflict(err error) render.Renderer {
+	return &errResponse{
+		Err:            err,
+		HTTPStatusCode: 409,
+		StatusText:     "Request conflicts with the current state of the resource.",
+		ErrorText:      err.Error(),
+	}
+}
+
 func errRepository(err error) render.Renderer {
 	return &errResponse{
 		Err:            err,
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/go-chi/render"
+	"github.com/stone1549/product-service/common"
+	"github.com/stone1549/product-service/repository"
+	"net/http"
+)
+
+type categoryResponse struct {
+	Id       string             `json:"id"`
+	Name     string             `json:"name"`
+	ParentId *string            `json:"parentId"`
+	Children []categoryResponse `json:"children"`
+}
+
+func (cr categoryResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newCategoryResponse builds a response for the given category holding all of its descendants found in categories.
+func newCategoryResponse(category common.Category, categories []common.Category) categoryResponse {
+	children := make([]categoryResponse, 0)
+	for _, child := range categories {
+		if child.ParentId != nil && *child.ParentId == category.Id {
+			children = append(children, newCategoryResponse(child, categories))
+		}
+	}
+
+	return categoryResponse{
+		Id:       category.Id,
+		Name:     category.Name,
+		ParentId: category.ParentId,
+		Children: children,
+	}
+}
+
+type categoryListResponse struct {
+	Categories []categoryResponse `json:"categories"`
+}
+
+func (clr categoryListResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newCategoryListResponse builds a response holding the tree of the given categories, starting from those without a
+// parent.
+func newCategoryListResponse(categories []common.Category) categoryListResponse {
+	roots := make([]categoryResponse, 0)
+	for _, category := range categories {
+		if category.ParentId == nil {
+			roots = append(roots, newCategoryResponse(category, categories))
+		}
+	}
+
+	return categoryListResponse{roots}
+}
+
+// GetCategories renders the tree of all categories.
+func GetCategories(w http.ResponseWriter, r *http.Request) {
+	productRepo, ok := r.Context().Value("repo").(repository.ProductRepository)
+
+	if !ok {
+		render.Render(w, r, errRepository(errors.New("ProductRepository not found in context")))
+		return
+	}
+
+	categories, err := productRepo.GetCategories(r.Context())
+
+	if err != nil {
+		render.Render(w, r, errRepository(err))
+		return
+	}
+
+	if err := render.Render(w, r, newCategoryListResponse(categories)); err != nil {
+		render.Render(w, r, errUnknown(err))
+		return
+	}
+}
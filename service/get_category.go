@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/stone1549/product-service/common"
+	"github.com/stone1549/product-service/repository"
+	"net/http"
+)
+
+// GetCategoryMiddleware middleware loads a category from the request parameters and adds it to the request context.
+// If no category is found, a 404 is returned.
+func GetCategoryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "categoryId")
+
+		if id == "" {
+			render.Render(w, r, errNotFound)
+			return
+		}
+
+		productRepo, ok := r.Context().Value("repo").(repository.ProductRepository)
+
+		if !ok {
+			render.Render(w, r, errRepository(errors.New("ProductRepository not found in context")))
+			return
+		}
+
+		category, err := productRepo.GetCategory(r.Context(), id)
+
+		if err != nil {
+			render.Render(w, r, errRepository(err))
+			return
+		} else if category == nil {
+			render.Render(w, r, errNotFound)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "category", *category)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// GetCategory renders the requested category along with its subcategories.
+func GetCategory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	category, ok := ctx.Value("category").(common.Category)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("unable to retrieve category at this time")))
+		return
+	}
+
+	productRepo, ok := ctx.Value("repo").(repository.ProductRepository)
+
+	if !ok {
+		render.Render(w, r, errRepository(errors.New("ProductRepository not found in context")))
+		return
+	}
+
+	categories, err := productRepo.GetCategories(ctx)
+
+	if err != nil {
+		render.Render(w, r, errRepository(err))
+		return
+	}
+
+	if err := render.Render(w, r, newCategoryResponse(category, categories)); err != nil {
+		render.Render(w, r, errUnknown(err))
+		return
+	}
+}
@@ -2,39 +2,112 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
+	"github.com/shopspring/decimal"
 	"github.com/stone1549/product-service/common"
 	"github.com/stone1549/product-service/repository"
 	"net/http"
 )
 
 type productResponse struct {
-	Id               string     `json:"id"`
-	Name             string     `json:"name"`
-	DisplayImage     *string    `json:"displayImage"`
-	Thumbnail        *string    `json:"thumbnail"`
-	Price            *string    `json:"price"`
-	Description      *string    `json:"description"`
-	ShortDescription *string    `json:"shortDescription"`
-	Quantity         int        `json:"quantity"`
-	CreatedAt        *time.Time `json:"createdAt"`
-	UpdatedAt        *time.Time `json:"updatedAt"`
+	Id               string                     `json:"id"`
+	Name             string                     `json:"name"`
+	DisplayImage     *string                    `json:"displayImage"`
+	Thumbnail        *string                    `json:"thumbnail"`
+	Price            *string                    `json:"price"`
+	Description      *string                    `json:"description"`
+	ShortDescription *string                    `json:"shortDescription"`
+	Quantity         int                        `json:"quantity"`
+	CreatedAt        *time.Time                 `json:"createdAt"`
+	UpdatedAt        *time.Time                 `json:"updatedAt"`
+	Categories       []string                   `json:"categories"`
+	Variants         []variantResponse          `json:"variants"`
+	Currency         common.Currency            `json:"currency"`
+	Prices           map[common.Currency]string `json:"prices"`
+	Score            *float64                   `json:"score,omitempty"`
+	Highlights       map[string][]string        `json:"highlights,omitempty"`
+	// fields holds the fields requested by the client, the others are left out of the JSON representation.
+	fields common.ProductFields
 }
 
 func (plr productResponse) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
-func newProductResponse(product common.Product) productResponse {
-	var price *string
+// MarshalJSON encodes the response, leaving out the fields not requested by the client.
+func (plr productResponse) MarshalJSON() ([]byte, error) {
+	// response does not inherit MarshalJSON, so that it can be encoded as usual
+	type response productResponse
+	jsonBytes, err := json.Marshal(response(plr))
 
-	if product.Price == nil {
-		str := product.Price.StringFixed(2)
-		price = &str
+	if err != nil || plr.fields.All() {
+		return jsonBytes, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(jsonBytes, &fields); err != nil {
+		return nil, err
+	}
+
+	for name := range fields {
+		if !plr.fields.Includes(common.ProductField(name)) {
+			delete(fields, name)
+		}
+	}
+
+	return json.Marshal(fields)
+}
+
+// parseProductFields retrieves the fields requested by the comma separated fields query parameter, every field if
+// absent.
+func parseProductFields(r *http.Request) (common.ProductFields, error) {
+	return common.ParseProductFields(r.URL.Query().Get("fields"))
+}
+
+// parseCurrency retrieves the currency requested by the currency query parameter, or the default currency if absent.
+func parseCurrency(r *http.Request) (common.Currency, error) {
+	str := r.URL.Query().Get("currency")
+
+	if str == "" {
+		return common.DefaultCurrency, nil
+	}
+
+	return common.ParseCurrency(str)
+}
+
+func formatPrice(price *decimal.Decimal, currency common.Currency) *string {
+	if price == nil {
+		return nil
+	}
+
+	str := currency.Format(*price)
+	return &str
+}
+
+// formatPrices renders the price of the product in every currency it is sold in.
+func formatPrices(defaultPrice *decimal.Decimal, prices map[common.Currency]decimal.Decimal) map[common.Currency]string {
+	result := make(map[common.Currency]string)
+	if defaultPrice != nil {
+		result[common.DefaultCurrency] = common.DefaultCurrency.Format(*defaultPrice)
+	}
+
+	for currency, price := range prices {
+		result[currency] = currency.Format(price)
+	}
+
+	return result
+}
+
+// newProductResponse builds a response for the given product priced in the given currency.
+func newProductResponse(product common.Product, currency common.Currency) productResponse {
+	categories := product.CategoryIds
+	if categories == nil {
+		categories = make([]string, 0)
 	}
 
 	return productResponse{
@@ -42,12 +115,16 @@ func newProductResponse(product common.Product) productResponse {
 		Name:             product.Name,
 		DisplayImage:     product.DisplayImage,
 		Id:               product.Id,
-		Price:            price,
+		Price:            formatPrice(product.PriceIn(currency), currency),
 		Quantity:         product.QtyInStock,
 		ShortDescription: product.ShortDescription,
 		Thumbnail:        product.Thumbnail,
 		CreatedAt:        product.CreatedAt,
 		UpdatedAt:        product.UpdatedAt,
+		Categories:       categories,
+		Variants:         newVariantResponses(product, currency),
+		Currency:         currency,
+		Prices:           formatPrices(product.Price, product.Prices),
 	}
 }
 
@@ -59,6 +136,7 @@ func GetProductMiddleware(next http.Handler) http.Handler {
 
 		if id == "" {
 			render.Render(w, r, errNotFound)
+			return
 		}
 
 		productRepo, ok := r.Context().Value("repo").(repository.ProductRepository)
@@ -68,16 +146,30 @@ func GetProductMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		product, err := productRepo.GetProduct(r.Context(), id)
+		// only reads are narrowed to the requested fields, updates need every field of the product they modify
+		ctx := r.Context()
+		if r.Method == http.MethodGet {
+			fields, err := parseProductFields(r)
+
+			if err != nil {
+				render.Render(w, r, errInvalidRequest(err))
+				return
+			}
+
+			ctx = common.WithProductFields(ctx, fields)
+		}
+
+		product, err := productRepo.GetProduct(ctx, id)
 
 		if err != nil {
 			render.Render(w, r, errRepository(err))
+			return
 		} else if product == nil {
 			render.Render(w, r, errNotFound)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), "product", *product)
+		ctx = context.WithValue(ctx, "product", *product)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -92,7 +184,17 @@ func GetProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := render.Render(w, r, newProductResponse(product)); err != nil {
+	currency, err := parseCurrency(r)
+
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	response := newProductResponse(product, currency)
+	response.fields = common.ProductFieldsFrom(ctx)
+
+	if err := render.Render(w, r, response); err != nil {
 		render.Render(w, r, errUnknown(err))
 		return
 	}
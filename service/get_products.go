@@ -3,9 +3,12 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/go-chi/render"
+	"github.com/shopspring/decimal"
 	"github.com/stone1549/product-service/common"
 	"github.com/stone1549/product-service/repository"
 	"net/http"
@@ -13,22 +16,144 @@ import (
 )
 
 type productListResponse struct {
-	Products []productResponse `json:"products"`
-	Cursor   string            `json:"cursor"`
+	Products   []productResponse `json:"products"`
+	Cursor     string            `json:"cursor"`
+	Facets     []facetResponse   `json:"facets,omitempty"`
+	DidYouMean *string           `json:"didYouMean,omitempty"`
 }
 
 func (plr productListResponse) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
-func newProductListResponse(products []common.Product, cursor string) productListResponse {
+func newProductListResponse(products []common.Product, cursor string, currency common.Currency) productListResponse {
 	results := make([]productResponse, 0)
 	for _, product := range products {
-		productResponse := newProductResponse(product)
+		productResponse := newProductResponse(product, currency)
 		results = append(results, productResponse)
 	}
 
-	return productListResponse{results, cursor}
+	return productListResponse{Products: results, Cursor: cursor}
+}
+
+func parseDecimalParam(r *http.Request, name string) (*decimal.Decimal, error) {
+	str := r.URL.Query().Get(name)
+
+	if str == "" {
+		return nil, nil
+	}
+
+	value, err := decimal.NewFromString(str)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a number", name)
+	}
+
+	return &value, nil
+}
+
+func parseTimeParam(r *http.Request, name string) (*time.Time, error) {
+	str := r.URL.Query().Get(name)
+
+	if str == "" {
+		return nil, nil
+	}
+
+	value, err := time.Parse(time.RFC3339, str)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+	}
+
+	return &value, nil
+}
+
+// parseOrderBy builds an OrderBy from the comma separated orderBy query parameter.
+func parseOrderBy(r *http.Request) (common.OrderBy, error) {
+	orderBy := common.OrderBy{}
+
+	orderByStr := r.URL.Query().Get("orderBy")
+
+	if orderByStr == "" {
+		return orderBy, nil
+	}
+
+	for _, keyStr := range strings.Split(orderByStr, ",") {
+		if err := orderBy.Add(common.OrderByKey(keyStr)); err != nil {
+			return orderBy, err
+		}
+	}
+
+	return orderBy, nil
+}
+
+// parseProductFilter builds a ProductFilter from the currency, minPrice, maxPrice, inStock, createdAfter, updatedSince,
+// ids, category and includeSubcategories query parameters. A category loaded by GetCategoryMiddleware takes the place
+// of the category parameter.
+func parseProductFilter(r *http.Request) (common.ProductFilter, error) {
+	var filter common.ProductFilter
+	var err error
+
+	filter.Currency, err = parseCurrency(r)
+
+	if err != nil {
+		return filter, err
+	}
+
+	filter.MinPrice, err = parseDecimalParam(r, "minPrice")
+
+	if err != nil {
+		return filter, err
+	}
+
+	filter.MaxPrice, err = parseDecimalParam(r, "maxPrice")
+
+	if err != nil {
+		return filter, err
+	}
+
+	if inStockStr := r.URL.Query().Get("inStock"); inStockStr != "" {
+		inStock, err := strconv.ParseBool(inStockStr)
+
+		if err != nil {
+			return filter, errors.New("inStock must be true or false")
+		}
+
+		filter.InStock = &inStock
+	}
+
+	filter.CreatedAfter, err = parseTimeParam(r, "createdAfter")
+
+	if err != nil {
+		return filter, err
+	}
+
+	filter.UpdatedSince, err = parseTimeParam(r, "updatedSince")
+
+	if err != nil {
+		return filter, err
+	}
+
+	if idsStr := r.URL.Query().Get("ids"); idsStr != "" {
+		filter.Ids = strings.Split(idsStr, ",")
+	}
+
+	if category, ok := r.Context().Value("category").(common.Category); ok {
+		filter.CategoryIds = []string{category.Id}
+	} else if categoryStr := r.URL.Query().Get("category"); categoryStr != "" {
+		filter.CategoryIds = strings.Split(categoryStr, ",")
+	}
+
+	filter.IncludeSubcategories = true
+	if includeStr := r.URL.Query().Get("includeSubcategories"); includeStr != "" {
+		filter.IncludeSubcategories, err = strconv.ParseBool(includeStr)
+
+		if err != nil {
+			return filter, errors.New("includeSubcategories must be true or false")
+		}
+	}
+
+	return filter, nil
 }
 
 // GetProductMiddleware middleware loads a list of products from the request parameters and adds them to the request
@@ -44,20 +169,25 @@ func GetProductsMiddleware(next http.Handler) http.Handler {
 
 		cursor := r.URL.Query().Get("cursor")
 
-		orderBy := common.OrderBy{}
+		orderBy, err := parseOrderBy(r)
+
+		if err != nil {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		}
+
+		filter, err := parseProductFilter(r)
 
-		orderByStr := r.URL.Query().Get("orderBy")
+		if err != nil {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		}
 
-		if orderByStr != "" {
-			keyStrings := strings.Split(orderByStr, ",")
+		fields, err := parseProductFields(r)
 
-			for _, keyStr := range keyStrings {
-				err = orderBy.Add(common.OrderByKey(keyStr))
-				if err != nil {
-					render.Render(w, r, errInvalidRequest(err))
-					return
-				}
-			}
+		if err != nil {
+			render.Render(w, r, errInvalidRequest(err))
+			return
 		}
 
 		productRepo, ok := r.Context().Value("repo").(repository.ProductRepository)
@@ -67,9 +197,13 @@ func GetProductsMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		productsList, err := productRepo.GetProducts(r.Context(), first, cursor, orderBy)
+		ctx := common.WithProductFields(r.Context(), fields)
+		productsList, err := productRepo.GetProducts(ctx, first, cursor, orderBy, filter)
 
-		if err != nil {
+		if err == repository.ErrInvalidCursor || err == repository.ErrInvalidOrder {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		} else if err != nil {
 			render.Render(w, r, errRepository(err))
 			return
 		} else if len(productsList.Products) == 0 {
@@ -77,8 +211,9 @@ func GetProductsMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), "products", productsList.Products)
+		ctx = context.WithValue(ctx, "products", productsList.Products)
 		ctx = context.WithValue(ctx, "cursor", productsList.Cursor)
+		ctx = context.WithValue(ctx, "currency", filter.PriceCurrency())
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -94,8 +229,14 @@ func GetProducts(w http.ResponseWriter, r *http.Request) {
 	}
 
 	cursor := r.Context().Value("cursor").(string)
+	currency := r.Context().Value("currency").(common.Currency)
+
+	response := newProductListResponse(products, cursor, currency)
+	for i := range response.Products {
+		response.Products[i].fields = common.ProductFieldsFrom(ctx)
+	}
 
-	if err := render.Render(w, r, newProductListResponse(products, cursor)); err != nil {
+	if err := render.Render(w, r, response); err != nil {
 		render.Render(w, r, errUnknown(err))
 		return
 	}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/stone1549/product-service/common"
+	"github.com/stone1549/product-service/repository"
+	"net/http"
+)
+
+type variantResponse struct {
+	Sku       string                     `json:"sku"`
+	ProductId string                     `json:"productId"`
+	Options   map[string]string          `json:"options"`
+	Price     *string                    `json:"price"`
+	Quantity  int                        `json:"quantity"`
+	Images    []string                   `json:"images"`
+	Currency  common.Currency            `json:"currency"`
+	Prices    map[common.Currency]string `json:"prices"`
+}
+
+func (vr variantResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newVariantResponse builds a response for the given variant of the given product priced in the given currency, at the
+// product's price unless the variant overrides it.
+func newVariantResponse(variant common.Variant, product common.Product, currency common.Currency) variantResponse {
+	options := variant.Options
+	if options == nil {
+		options = make(map[string]string)
+	}
+
+	images := variant.Images
+	if images == nil {
+		images = make([]string, 0)
+	}
+
+	return variantResponse{
+		Sku:       variant.Sku,
+		ProductId: product.Id,
+		Options:   options,
+		Price:     formatPrice(variant.EffectivePrice(product, currency), currency),
+		Quantity:  variant.QtyInStock,
+		Images:    images,
+		Currency:  currency,
+		Prices:    formatPrices(variant.Price, variant.Prices),
+	}
+}
+
+func newVariantResponses(product common.Product, currency common.Currency) []variantResponse {
+	variants := make([]variantResponse, len(product.Variants))
+	for i, variant := range product.Variants {
+		variants[i] = newVariantResponse(variant, product, currency)
+	}
+
+	return variants
+}
+
+// GetVariantMiddleware middleware loads a variant from the request parameters and adds it to the request context.
+// If no variant is found, a 404 is returned.
+func GetVariantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sku := chi.URLParam(r, "sku")
+
+		if sku == "" {
+			render.Render(w, r, errNotFound)
+			return
+		}
+
+		productRepo, ok := r.Context().Value("repo").(repository.ProductRepository)
+
+		if !ok {
+			render.Render(w, r, errRepository(errors.New("ProductRepository not found in context")))
+			return
+		}
+
+		variant, err := productRepo.GetVariant(r.Context(), sku)
+
+		if err != nil {
+			render.Render(w, r, errRepository(err))
+			return
+		} else if variant == nil {
+			render.Render(w, r, errNotFound)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "variant", *variant)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// GetVariant renders the requested variant if it was found.
+func GetVariant(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	variant, ok := ctx.Value("variant").(common.Variant)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("unable to retrieve variant at this time")))
+		return
+	}
+
+	currency, err := parseCurrency(r)
+
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	productRepo, ok := ctx.Value("repo").(repository.ProductRepository)
+
+	if !ok {
+		render.Render(w, r, errRepository(errors.New("ProductRepository not found in context")))
+		return
+	}
+
+	product, err := productRepo.GetProduct(ctx, variant.ProductId)
+
+	if err != nil {
+		render.Render(w, r, errRepository(err))
+		return
+	} else if product == nil {
+		render.Render(w, r, errNotFound)
+		return
+	}
+
+	if err := render.Render(w, r, newVariantResponse(variant, *product, currency)); err != nil {
+		render.Render(w, r, errUnknown(err))
+		return
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/stone1549/product-service/common"
+	"github.com/stone1549/product-service/repository"
+	"net/http"
+)
+
+const (
+	// defaultReservationTtl is how long units are held when a reservation request does not specify a ttl.
+	defaultReservationTtl = 15 * time.Minute
+	// maxReservationTtl is the longest units may be held by a single reservation.
+	maxReservationTtl = 24 * time.Hour
+)
+
+type reservationRequest struct {
+	Quantity int  `json:"quantity"`
+	Ttl      *int `json:"ttl"`
+}
+
+func (rr *reservationRequest) Bind(r *http.Request) error {
+	if rr.Quantity <= 0 {
+		return errors.New("quantity must be positive")
+	}
+
+	if rr.Ttl != nil && *rr.Ttl <= 0 {
+		return errors.New("ttl must be positive")
+	}
+
+	if rr.Ttl != nil && time.Duration(*rr.Ttl)*time.Second > maxReservationTtl {
+		return errors.New("ttl must not exceed 24 hours")
+	}
+
+	return nil
+}
+
+func (rr *reservationRequest) ttl() time.Duration {
+	if rr.Ttl == nil {
+		return defaultReservationTtl
+	}
+
+	return time.Duration(*rr.Ttl) * time.Second
+}
+
+type reservationResponse struct {
+	Id        string    `json:"id"`
+	ProductId string    `json:"productId"`
+	Quantity  int       `json:"quantity"`
+	Status    string    `json:"status"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (rr reservationResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func newReservationResponse(reservation common.Reservation) reservationResponse {
+	return reservationResponse{
+		Id:        reservation.Id,
+		ProductId: reservation.ProductId,
+		Quantity:  reservation.Quantity,
+		Status:    string(reservation.Status),
+		ExpiresAt: reservation.ExpiresAt,
+		CreatedAt: reservation.CreatedAt,
+		UpdatedAt: reservation.UpdatedAt,
+	}
+}
+
+// CreateReservation holds the quantity of the product loaded by GetProductMiddleware described by the request body.
+func CreateReservation(w http.ResponseWriter, r *http.Request) {
+	product, ok := r.Context().Value("product").(common.Product)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("unable to retrieve product at this time")))
+		return
+	}
+
+	data := &reservationRequest{}
+
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	productRepo, ok := r.Context().Value("repo").(repository.ProductRepository)
+
+	if !ok {
+		render.Render(w, r, errRepository(errors.New("ProductRepository not found in context")))
+		return
+	}
+
+	reservation, err := productRepo.ReserveProduct(r.Context(), product.Id, data.Quantity, data.ttl())
+
+	if err == repository.ErrProductNotFound {
+		render.Render(w, r, errNotFound)
+		return
+	} else if err == repository.ErrInsufficientStock {
+		render.Render(w, r, errStateConflict(err))
+		return
+	} else if err != nil {
+		render.Render(w, r, errRepository(err))
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	if err := render.Render(w, r, newReservationResponse(*reservation)); err != nil {
+		render.Render(w, r, errUnknown(err))
+		return
+	}
+}
+
+type closeReservationFunc func(repo repository.ProductRepository, ctx context.Context, productId,
+	reservationId string) (*common.Reservation, error)
+
+func closeReservation(w http.ResponseWriter, r *http.Request, closeFunc closeReservationFunc) {
+	product, ok := r.Context().Value("product").(common.Product)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("unable to retrieve product at this time")))
+		return
+	}
+
+	reservationId := chi.URLParam(r, "reservationId")
+
+	if reservationId == "" {
+		render.Render(w, r, errNotFound)
+		return
+	}
+
+	productRepo, ok := r.Context().Value("repo").(repository.ProductRepository)
+
+	if !ok {
+		render.Render(w, r, errRepository(errors.New("ProductRepository not found in context")))
+		return
+	}
+
+	reservation, err := closeFunc(productRepo, r.Context(), product.Id, reservationId)
+
+	if err == repository.ErrReservationNotFound {
+		render.Render(w, r, errNotFound)
+		return
+	} else if err == repository.ErrReservationNotActive {
+		render.Render(w, r, errStateConflict(err))
+		return
+	} else if err != nil {
+		render.Render(w, r, errRepository(err))
+		return
+	}
+
+	if err := render.Render(w, r, newReservationResponse(*reservation)); err != nil {
+		render.Render(w, r, errUnknown(err))
+		return
+	}
+}
+
+// CommitReservation permanently removes the units held by the requested reservation from stock.
+func CommitReservation(w http.ResponseWriter, r *http.Request) {
+	closeReservation(w, r, func(repo repository.ProductRepository, ctx context.Context, productId,
+		reservationId string) (*common.Reservation, error) {
+		return repo.CommitReservation(ctx, productId, reservationId)
+	})
+}
+
+// ReleaseReservation returns the units held by the requested reservation to stock.
+func ReleaseReservation(w http.ResponseWriter, r *http.Request) {
+	closeReservation(w, r, func(repo repository.ProductRepository, ctx context.Context, productId,
+		reservationId string) (*common.Reservation, error) {
+		return repo.ReleaseReservation(ctx, productId, reservationId)
+	})
+}
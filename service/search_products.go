@@ -3,17 +3,115 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
+	"github.com/shopspring/decimal"
 	"github.com/stone1549/product-service/common"
 	"github.com/stone1549/product-service/repository"
 	"net/http"
 	"strconv"
 )
 
+// defaultPriceRanges holds the price facet boundaries used when a search does not specify any.
+var defaultPriceRanges = []decimal.Decimal{
+	decimal.New(10, 0),
+	decimal.New(50, 0),
+	decimal.New(100, 0),
+	decimal.New(500, 0),
+	decimal.New(1000, 0),
+}
+
+type facetBucketResponse struct {
+	Value string  `json:"value"`
+	Min   *string `json:"min,omitempty"`
+	Max   *string `json:"max,omitempty"`
+	Count int     `json:"count"`
+}
+
+type facetResponse struct {
+	Name    string                `json:"name"`
+	Buckets []facetBucketResponse `json:"buckets"`
+}
+
+// newFacetResponses builds responses for the given facets, with price bounds formatted in the given currency.
+func newFacetResponses(facets []common.Facet, currency common.Currency) []facetResponse {
+	results := make([]facetResponse, 0, len(facets))
+	for _, facet := range facets {
+		buckets := make([]facetBucketResponse, 0, len(facet.Buckets))
+		for _, bucket := range facet.Buckets {
+			buckets = append(buckets, facetBucketResponse{
+				Value: bucket.Value,
+				Min:   formatPrice(bucket.Min, currency),
+				Max:   formatPrice(bucket.Max, currency),
+				Count: bucket.Count,
+			})
+		}
+
+		results = append(results, facetResponse{facet.Name, buckets})
+	}
+
+	return results
+}
+
+// parseFacetRequest builds a FacetRequest from the comma separated facets query parameter, naming any of price,
+// inStock, category or option:<name>, and the comma separated, ascending priceRanges boundaries.
+func parseFacetRequest(r *http.Request) (common.FacetRequest, error) {
+	var request common.FacetRequest
+
+	facetsStr := r.URL.Query().Get("facets")
+
+	if facetsStr == "" {
+		return request, nil
+	}
+
+	for _, name := range strings.Split(facetsStr, ",") {
+		switch {
+		case name == common.FacetPrice:
+			request.Price = true
+		case name == common.FacetInStock:
+			request.InStock = true
+		case name == common.FacetCategory:
+			request.Category = true
+		case strings.HasPrefix(name, common.FacetOptionPrefix) && len(name) > len(common.FacetOptionPrefix):
+			request.Options = append(request.Options, strings.TrimPrefix(name, common.FacetOptionPrefix))
+		default:
+			return request, fmt.Errorf("unknown facet %s", name)
+		}
+	}
+
+	if !request.Price {
+		return request, nil
+	}
+
+	request.PriceBoundaries = defaultPriceRanges
+
+	if rangesStr := r.URL.Query().Get("priceRanges"); rangesStr != "" {
+		request.PriceBoundaries = nil
+		for _, boundaryStr := range strings.Split(rangesStr, ",") {
+			boundary, err := decimal.NewFromString(boundaryStr)
+
+			if err != nil {
+				return request, errors.New("priceRanges must be a list of numbers")
+			}
+
+			request.PriceBoundaries = append(request.PriceBoundaries, boundary)
+		}
+
+		for i := 1; i < len(request.PriceBoundaries); i++ {
+			if !request.PriceBoundaries[i-1].LessThan(request.PriceBoundaries[i]) {
+				return request, errors.New("priceRanges must be in ascending order")
+			}
+		}
+	}
+
+	return request, nil
+}
+
 // SearchProductsMiddleware middleware loads a list of products from the request parameters and adds them to the request
-// context. If no products are found, a 404 is returned.
+// context. If no products are found, a 404 is returned unless corrected search text can be suggested.
 func SearchProductsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		first, err := strconv.Atoi(chi.URLParam(r, "first"))
@@ -27,6 +125,54 @@ func SearchProductsMiddleware(next http.Handler) http.Handler {
 
 		searchTxt := r.URL.Query().Get("searchTxt")
 
+		orderBy, err := parseOrderBy(r)
+
+		if err != nil {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		}
+
+		filter, err := parseProductFilter(r)
+
+		if err != nil {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		}
+
+		facets, err := parseFacetRequest(r)
+
+		if err != nil {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		}
+
+		highlight := false
+		if highlightStr := r.URL.Query().Get("highlight"); highlightStr != "" {
+			highlight, err = strconv.ParseBool(highlightStr)
+
+			if err != nil {
+				render.Render(w, r, errInvalidRequest(errors.New("highlight must be true or false")))
+				return
+			}
+		}
+
+		fuzzy := false
+		if fuzzyStr := r.URL.Query().Get("fuzzy"); fuzzyStr != "" {
+			fuzzy, err = strconv.ParseBool(fuzzyStr)
+
+			if err != nil {
+				render.Render(w, r, errInvalidRequest(errors.New("fuzzy must be true or false")))
+				return
+			}
+		}
+
+		fields, err := parseProductFields(r)
+
+		if err != nil {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		}
+
 		productRepo, ok := r.Context().Value("repo").(repository.ProductRepository)
 
 		if !ok {
@@ -34,23 +180,32 @@ func SearchProductsMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		productsList, err := productRepo.SearchProducts(r.Context(), searchTxt, first, cursor)
+		ctx := common.WithProductFields(r.Context(), fields)
+		productsList, err := productRepo.SearchProducts(ctx, searchTxt, first, cursor, orderBy, filter,
+			common.SearchOptions{Facets: facets, Highlight: highlight, Fuzzy: fuzzy})
 
-		if err != nil {
+		if err == repository.ErrInvalidCursor || err == repository.ErrInvalidSearch {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		} else if err != nil {
 			render.Render(w, r, errRepository(err))
 			return
-		} else if len(productsList.Products) == 0 {
+		} else if len(productsList.Products) == 0 && productsList.DidYouMean == "" {
 			render.Render(w, r, errNotFound)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), "products", productsList.Products)
+		ctx = context.WithValue(ctx, "products", productsList.Products)
 		ctx = context.WithValue(ctx, "cursor", productsList.Cursor)
+		ctx = context.WithValue(ctx, "hits", productsList.Hits)
+		ctx = context.WithValue(ctx, "facets", productsList.Facets)
+		ctx = context.WithValue(ctx, "didYouMean", productsList.DidYouMean)
+		ctx = context.WithValue(ctx, "currency", filter.PriceCurrency())
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-// SearchProducts renders the matching products.
+// SearchProducts renders the matching products along with their scores, highlights and facets.
 func SearchProducts(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	products, ok := ctx.Value("products").([]common.Product)
@@ -61,8 +216,26 @@ func SearchProducts(w http.ResponseWriter, r *http.Request) {
 	}
 
 	cursor := r.Context().Value("cursor").(string)
+	currency := r.Context().Value("currency").(common.Currency)
+	hits, _ := r.Context().Value("hits").([]common.SearchHit)
+	facets, _ := r.Context().Value("facets").([]common.Facet)
+
+	response := newProductListResponse(products, cursor, currency)
+	for i := range hits {
+		response.Products[i].Score = &hits[i].Score
+		response.Products[i].Highlights = hits[i].Highlights
+	}
+
+	for i := range response.Products {
+		response.Products[i].fields = common.ProductFieldsFrom(ctx)
+	}
+
+	response.Facets = newFacetResponses(facets, currency)
+	if didYouMean, _ := r.Context().Value("didYouMean").(string); didYouMean != "" {
+		response.DidYouMean = &didYouMean
+	}
 
-	if err := render.Render(w, r, newProductListResponse(products, cursor)); err != nil {
+	if err := render.Render(w, r, response); err != nil {
 		render.Render(w, r, errUnknown(err))
 		return
 	}
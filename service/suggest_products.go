@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/go-chi/render"
+	"github.com/stone1549/product-service/common"
+	"github.com/stone1549/product-service/repository"
+	"net/http"
+)
+
+type suggestionResponse struct {
+	Id    string  `json:"id"`
+	Name  string  `json:"name"`
+	Score float64 `json:"score"`
+}
+
+type suggestionsResponse struct {
+	Products   []suggestionResponse `json:"products"`
+	Categories []suggestionResponse `json:"categories,omitempty"`
+}
+
+func (sr suggestionsResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func newSuggestionResponses(suggestions []common.Suggestion) []suggestionResponse {
+	results := make([]suggestionResponse, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		results = append(results, suggestionResponse{suggestion.Id, suggestion.Text, suggestion.Score})
+	}
+
+	return results
+}
+
+// newSuggestionsResponse builds a response for the given suggestions, categories are only included when requested.
+func newSuggestionsResponse(suggestions common.Suggestions, includeCategories bool) suggestionsResponse {
+	response := suggestionsResponse{Products: newSuggestionResponses(suggestions.Products)}
+	if includeCategories {
+		response.Categories = newSuggestionResponses(suggestions.Categories)
+	}
+
+	return response
+}
+
+// SuggestProductsMiddleware middleware loads the product, and optionally category, names completing the prefix
+// request parameter and adds them to the request context. Unlike searches, no suggestions is not an error.
+func SuggestProductsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		first, err := strconv.Atoi(r.URL.Query().Get("first"))
+
+		if err != nil || first <= 0 {
+			first = 10
+		}
+
+		prefix := r.URL.Query().Get("prefix")
+
+		includeCategories := false
+		if categoriesStr := r.URL.Query().Get("categories"); categoriesStr != "" {
+			includeCategories, err = strconv.ParseBool(categoriesStr)
+
+			if err != nil {
+				render.Render(w, r, errInvalidRequest(errors.New("categories must be true or false")))
+				return
+			}
+		}
+
+		productRepo, ok := r.Context().Value("repo").(repository.ProductRepository)
+
+		if !ok {
+			render.Render(w, r, errRepository(errors.New("ProductRepository not found in context")))
+			return
+		}
+
+		suggestions, err := productRepo.SuggestProducts(r.Context(), prefix, first, includeCategories)
+
+		if err == repository.ErrInvalidSearch {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		} else if err != nil {
+			render.Render(w, r, errRepository(err))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "suggestions", newSuggestionsResponse(suggestions, includeCategories))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// SuggestProducts renders the suggested names.
+func SuggestProducts(w http.ResponseWriter, r *http.Request) {
+	suggestions, ok := r.Context().Value("suggestions").(suggestionsResponse)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("unable to retrieve suggestions at this time")))
+		return
+	}
+
+	if err := render.Render(w, r, suggestions); err != nil {
+		render.Render(w, r, errUnknown(err))
+		return
+	}
+}
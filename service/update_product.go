@@ -0,0 +1,104 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/go-chi/render"
+	"github.com/stone1549/product-service/common"
+	"github.com/stone1549/product-service/repository"
+	"net/http"
+)
+
+func updateProduct(w http.ResponseWriter, r *http.Request, product common.Product) {
+	if err := validateProduct(product); err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	currency, err := parseCurrency(r)
+
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	productRepo, ok := r.Context().Value("repo").(repository.ProductRepository)
+
+	if !ok {
+		render.Render(w, r, errRepository(errors.New("ProductRepository not found in context")))
+		return
+	}
+
+	updated, err := productRepo.UpdateProduct(r.Context(), product)
+
+	if err == repository.ErrProductNotFound {
+		render.Render(w, r, errNotFound)
+		return
+	} else if err == repository.ErrCategoryNotFound {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	} else if err == repository.ErrVariantExists {
+		render.Render(w, r, errConflict(err))
+		return
+	} else if err != nil {
+		render.Render(w, r, errRepository(err))
+		return
+	}
+
+	if err := render.Render(w, r, newProductResponse(*updated, currency)); err != nil {
+		render.Render(w, r, errUnknown(err))
+		return
+	}
+}
+
+// ReplaceProduct replaces the product loaded by GetProductMiddleware with the product described by the request body.
+// Fields absent from the body are cleared.
+func ReplaceProduct(w http.ResponseWriter, r *http.Request) {
+	existing, ok := r.Context().Value("product").(common.Product)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("unable to retrieve product at this time")))
+		return
+	}
+
+	data := &productRequest{}
+
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	if data.Id != nil && *data.Id != existing.Id {
+		render.Render(w, r, errInvalidRequest(errors.New("id does not match the requested product")))
+		return
+	}
+
+	product := data.newProduct()
+	product.Id = existing.Id
+	updateProduct(w, r, product)
+}
+
+// PatchProduct updates the product loaded by GetProductMiddleware with the fields present in the request body.
+func PatchProduct(w http.ResponseWriter, r *http.Request) {
+	product, ok := r.Context().Value("product").(common.Product)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("unable to retrieve product at this time")))
+		return
+	}
+
+	data := &productRequest{}
+
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	if data.Id != nil && *data.Id != product.Id {
+		render.Render(w, r, errInvalidRequest(errors.New("id does not match the requested product")))
+		return
+	}
+
+	data.applyTo(&product)
+	updateProduct(w, r, product)
+}